@@ -0,0 +1,126 @@
+// Package config reads a -config file: a YAML (or JSON) file setting any
+// command-line flag by name, plus settings flags can't express, such as
+// several seed URLs and per-step overrides. Flags given on the command line
+// take precedence over the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the content of a config file, e.g.
+//
+//	url: https://docs.google.com/document/d/…/edit
+//	urls:
+//	  - https://docs.google.com/document/d/…/edit
+//	depth: 3
+//	owners: [alice@example.com, example.org]
+//	steps:
+//	  crawler:
+//	    timeout: 30m
+type File struct {
+	// URLs are more seed URLs, crawled at depth 0 next to -url
+	URLs []string `yaml:"urls"`
+	// Steps override settings of the named steps
+	Steps map[string]Step `yaml:"steps"`
+	// Flags holds every other key: the value of the flag of that name
+	Flags map[string]any `yaml:",inline"`
+}
+
+// Step holds the overrides of one step
+type Step struct {
+	// Timeout fails the step when it runs longer, like -step-timeout
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Load reads the config file at path
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Apply sets the flags of fs the file names, except those already set on
+// the command line. Lists become comma-separated values. Flags it sets
+// count as set afterwards: fs.Visit reports them like command-line ones.
+func (f *File) Apply(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	names := make([]string, 0, len(f.Flags))
+	for name := range f.Flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fl := fs.Lookup(name)
+		if fl == nil || name == "config" {
+			return fmt.Errorf("unknown option %q", name)
+		}
+		if set[name] {
+			continue
+		}
+		value, err := flagValue(f.Flags[name])
+		if err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// StepTimeouts returns the step timeouts the file sets, by step name
+func (f *File) StepTimeouts() map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for name, s := range f.Steps {
+		if s.Timeout > 0 {
+			timeouts[name] = s.Timeout
+		}
+	}
+	return timeouts
+}
+
+// flagValue renders a YAML value the way it would be passed on the command
+// line
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := flagValue(item)
+			if err != nil || strings.Contains(s, ",") {
+				return "", fmt.Errorf("list items must be plain values without commas")
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
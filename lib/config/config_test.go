@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestApplyLeavesCommandLineFlagsAlone(t *testing.T) {
+	path := writeConfig(t, `
+url: https://docs.google.com/document/d/root/edit
+urls:
+  - https://docs.google.com/document/d/second/edit
+depth: 3
+out: ./from-file
+owners: [alice@example.com, example.org]
+verify: true
+api-qps: 2.5
+patch-delay: 1s
+steps:
+  crawler:
+    timeout: 30m
+`)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	url := fs.String("url", "", "")
+	depth := fs.Int("depth", 5, "")
+	out := fs.String("out", "./out", "")
+	owners := fs.String("owners", "", "")
+	verify := fs.Bool("verify", false, "")
+	qps := fs.Float64("api-qps", 10, "")
+	delay := fs.Duration("patch-delay", 0, "")
+	require.NoError(t, fs.Parse([]string{"-out", "./from-flag"}))
+
+	file, err := config.Load(path)
+	require.NoError(t, err)
+	require.NoError(t, file.Apply(fs))
+
+	assert.Equal(t, "https://docs.google.com/document/d/root/edit", *url)
+	assert.Equal(t, 3, *depth)
+	assert.Equal(t, "./from-flag", *out)
+	assert.Equal(t, "alice@example.com,example.org", *owners)
+	assert.True(t, *verify)
+	assert.Equal(t, 2.5, *qps)
+	assert.Equal(t, time.Second, *delay)
+	assert.Equal(t, []string{"https://docs.google.com/document/d/second/edit"}, file.URLs)
+	assert.Equal(t, map[string]time.Duration{"crawler": 30 * time.Minute}, file.StepTimeouts())
+}
+
+func TestAppliedFlagsCountAsSet(t *testing.T) {
+	path := writeConfig(t, `
+incremental: false
+depth: 3
+`)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("incremental", false, "")
+	fs.Int("depth", 5, "")
+	fs.String("out", "./out", "")
+	require.NoError(t, fs.Parse([]string{"-out", "./from-flag"}))
+
+	file, err := config.Load(path)
+	require.NoError(t, err)
+	require.NoError(t, file.Apply(fs))
+
+	var set []string
+	fs.Visit(func(fl *flag.Flag) { set = append(set, fl.Name) })
+	// a value equal to the default still counts as chosen
+	assert.Equal(t, []string{"depth", "incremental", "out"}, set)
+}
+
+func TestInvalidConfigIsRefused(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("depth", 5, "")
+
+	file, err := config.Load(writeConfig(t, "dpeth: 3\n"))
+	require.NoError(t, err)
+	assert.ErrorContains(t, file.Apply(fs), `unknown option "dpeth"`)
+
+	file, err = config.Load(writeConfig(t, "depth: deep\n"))
+	require.NoError(t, err)
+	assert.ErrorContains(t, file.Apply(fs), "option depth")
+
+	_, err = config.Load(writeConfig(t, "steps:\n  crawler:\n    timout: 1m\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+// Package failures collects the items a run's steps failed on — documents
+// they couldn't crawl, upload, patch or verify — and writes them to
+// errors.json, so automation can tell a partial failure from a clean run.
+package failures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+)
+
+// File is the manifest written at the output root
+const File = "errors.json"
+
+// Manifest is the content of File
+type Manifest struct {
+	RunID    string    `json:"run_id"`
+	Failures []Failure `json:"failures"`
+}
+
+// Load reads the manifest the last run left in store
+func Load(ctx context.Context, store storage.Storage) (Manifest, error) {
+	var m Manifest
+	data, err := store.ReadFile(ctx, File)
+	if err != nil {
+		return m, fmt.Errorf("reading %s: %w", File, err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parsing %s: %w", File, err)
+	}
+	return m, nil
+}
+
+// Items returns the distinct items the named step failed on, in the order
+// they failed
+func (m Manifest) Items(step string) []string {
+	var items []string
+	for _, f := range m.Failures {
+		if f.Step == step && !slices.Contains(items, f.Item) {
+			items = append(items, f.Item)
+		}
+	}
+	return items
+}
+
+// Failure is one item a step gave up on
+type Failure struct {
+	Step string `json:"step"`
+	// Item identifies what failed: a URL, a directory or a document ID
+	Item  string    `json:"item"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// Log holds the failures of a run. It implements pipeline.Notifier: the
+// first step of a run clears it and the end of the run writes File, so a
+// log is reused across the runs of a recurring pipeline.
+type Log struct {
+	runID string
+	store storage.Storage
+
+	mu       sync.Mutex
+	running  bool
+	failures []Failure
+}
+
+// New returns a log writing the failures of run runID to store
+func New(runID string, store storage.Storage) *Log {
+	return &Log{runID: runID, store: store}
+}
+
+// For returns the recorder of the named step. A nil log hands out nil
+// recorders.
+func (l *Log) For(step string) *Recorder {
+	if l == nil {
+		return nil
+	}
+	return &Recorder{log: l, step: step}
+}
+
+// Failures returns the failures of the current or last run
+func (l *Log) Failures() []Failure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.failures)
+}
+
+// Count returns the number of failures of the current or last run in the
+// given steps, or in every step when none are given. A nil log counts none.
+func (l *Log) Count(steps ...string) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, f := range l.failures {
+		if len(steps) == 0 || slices.Contains(steps, f.Step) {
+			n++
+		}
+	}
+	return n
+}
+
+// Notify implements pipeline.Notifier
+func (l *Log) Notify(ctx context.Context, ev pipeline.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch ev.Type {
+	case pipeline.EventStepStarted:
+		if !l.running {
+			l.running = true
+			l.failures = nil
+		}
+	case pipeline.EventRunCompleted, pipeline.EventRunFailed:
+		l.running = false
+		if err := l.write(ctx); err != nil {
+			slog.Warn("failed to write error manifest", slog.Any("error", err))
+		}
+	}
+}
+
+// write saves the manifest; callers must hold l.mu
+func (l *Log) write(ctx context.Context) error {
+	m := Manifest{RunID: l.runID, Failures: l.failures}
+	if m.Failures == nil {
+		m.Failures = []Failure{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return l.store.WriteFile(ctx, File, data)
+}
+
+// Recorder is one step's share of a Log. A nil Recorder records nothing, so
+// steps work without a log.
+type Recorder struct {
+	log  *Log
+	step string
+}
+
+// Add records that the step gave up on item
+func (r *Recorder) Add(item string, err error) {
+	if r == nil {
+		return
+	}
+	r.log.mu.Lock()
+	defer r.log.mu.Unlock()
+	r.log.failures = append(r.log.failures, Failure{
+		Step:  r.step,
+		Item:  item,
+		Error: err.Error(),
+		Time:  time.Now().UTC(),
+	})
+}
@@ -0,0 +1,64 @@
+package failures_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failing records a failure of each of its items and completes
+type failing struct {
+	name  string
+	rec   *failures.Recorder
+	items []string
+}
+
+func (s failing) Name() string { return s.name }
+func (s failing) Run(ctx context.Context) error {
+	for _, item := range s.items {
+		s.rec.Add(item, errors.New("quota exceeded"))
+	}
+	return nil
+}
+
+func TestLogWritesManifestPerRun(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	log := failures.New("r1", store)
+
+	pipe := pipeline.NewPipeline(
+		failing{name: "crawler", rec: log.For("crawler"), items: []string{"https://docs.google.com/document/d/a"}},
+		failing{name: "uploader", rec: log.For("uploader"), items: []string{"a-123456", "b-654321"}},
+	)
+	pipe.AddNotifier(log)
+	require.NoError(t, pipe.RunFrom(ctx, 0))
+
+	assert.Equal(t, 3, log.Count())
+	assert.Equal(t, 2, log.Count("uploader", "patcher"))
+
+	data, err := store.ReadFile(ctx, failures.File)
+	require.NoError(t, err)
+	var m failures.Manifest
+	require.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, "r1", m.RunID)
+	require.Len(t, m.Failures, 3)
+	assert.Equal(t, "uploader", m.Failures[1].Step)
+	assert.Equal(t, "a-123456", m.Failures[1].Item)
+	assert.Equal(t, "quota exceeded", m.Failures[1].Error)
+
+	// the next run starts from an empty log
+	require.NoError(t, pipe.RunFrom(ctx, 1))
+	assert.Equal(t, 2, log.Count())
+}
+
+func TestNilRecorderRecordsNothing(t *testing.T) {
+	var log *failures.Log
+	log.For("crawler").Add("x", errors.New("boom"))
+}
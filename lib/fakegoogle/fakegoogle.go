@@ -0,0 +1,592 @@
+// Package fakegoogle is an in-process stand-in for the Google endpoints the
+// pipeline talks to: document exports, the Drive API (with its changes
+// feed, resumable uploads and permissions) and the Docs API. Tests point the crawler at Transport and the
+// uploader, patcher, verifier and watcher at ClientOptions, so the whole
+// pipeline runs without credentials.
+package fakegoogle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// docMimeType marks uploads converted to Google Docs
+const docMimeType = "application/vnd.google-apps.document"
+
+// exportRe matches the export and preview URLs the crawler fetches
+var exportRe = regexp.MustCompile(`^/(document|spreadsheets)/d/([^/]+)/(export|preview)$`)
+
+// File is a file created in the fake Drive
+type File struct {
+	ID            string
+	Name          string
+	MimeType      string
+	Parents       []string
+	AppProperties map[string]string
+	// Content is the uploaded media, before conversion
+	Content []byte
+	// Revisions counts the updates that replaced the file's metadata or content
+	Revisions int
+	// Permissions are listed by permissions.list; grants don't add to them
+	Permissions []*drive.Permission
+}
+
+// Grant is a permission created through the Drive API
+type Grant struct {
+	FileID     string
+	Permission drive.Permission
+	// Notify is false when the request turned notification emails off
+	Notify bool
+}
+
+// session is a resumable upload in progress
+type session struct {
+	meta    drive.File
+	content []byte
+}
+
+// Server serves exports of the source documents it was given and keeps the
+// files and documents created through its Drive and Docs APIs in memory
+type Server struct {
+	api *httptest.Server
+
+	mu      sync.Mutex
+	exports map[string]string
+	titles  map[string]string
+	files   map[string]*File
+	order   []string
+	docs    map[string]*docs.Document
+	updates map[string]int
+	// changes is the Drive changes feed, file IDs in order; a page token
+	// is an index into it
+	changes []string
+
+	account  string
+	grants   []Grant
+	refuse   func(File) bool
+	searches []string
+	writes   int
+	sessions []*session
+	chunks   int
+	// failChunk is the chunk answered with 503 once; 0 fails none
+	failChunk int
+}
+
+// New starts a server; Close stops it
+func New() *Server {
+	s := &Server{
+		exports: make(map[string]string),
+		titles:  make(map[string]string),
+		files:   make(map[string]*File),
+		docs:    make(map[string]*docs.Document),
+		updates: make(map[string]int),
+	}
+	s.api = httptest.NewServer(http.HandlerFunc(s.serveAPI))
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.api.Close()
+}
+
+// AddDoc makes a source doc exportable as HTML
+func (s *Server) AddDoc(id, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exports["document/"+id] = content
+}
+
+// AddSheet makes a source sheet exportable as CSV, with a preview page
+// carrying its title
+func (s *Server) AddSheet(id, title, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exports["spreadsheets/"+id] = content
+	s.titles["spreadsheets/"+id] = title
+}
+
+// AddFile puts a file in the fake Drive as if an earlier run had created it
+func (s *Server) AddFile(f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[f.ID] = &f
+	s.order = append(s.order, f.ID)
+}
+
+// SetAccount sets the email address about.get reports for the caller
+func (s *Server) SetAccount(email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account = email
+}
+
+// RefuseGrants answers permission grants on the files refuse matches with 403
+func (s *Server) RefuseGrants(refuse func(File) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// FailChunk answers the nth resumable upload chunk, counting from 1 across
+// uploads, with 503 once
+func (s *Server) FailChunk(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failChunk = n
+}
+
+// Transport answers the crawler's export and sheet preview requests to
+// docs.google.com. Documents that weren't added are answered with 404.
+func (s *Server) Transport() http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		code, body := http.StatusNotFound, ""
+		if m := exportRe.FindStringSubmatch(req.URL.Path); m != nil && req.URL.Host == "docs.google.com" {
+			s.mu.Lock()
+			content, ok := s.exports[m[1]+"/"+m[2]]
+			if m[3] == "preview" {
+				content, ok = s.titles[m[1]+"/"+m[2]]
+				content = "<html><head><title>" + html.EscapeString(content) + " - Google Sheets</title></head></html>"
+			}
+			s.mu.Unlock()
+			if ok {
+				code, body = http.StatusOK, content
+			}
+		}
+		return &http.Response{
+			StatusCode: code,
+			Status:     http.StatusText(code),
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// ClientOptions point a Drive or Docs client at the server
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{option.WithEndpoint(s.api.URL + "/"), option.WithoutAuthentication()}
+}
+
+// Files returns the files created so far, folders included, in creation order
+func (s *Server) Files() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make([]File, 0, len(s.order))
+	for _, id := range s.order {
+		files = append(files, *s.files[id])
+	}
+	return files
+}
+
+// Grants returns the permissions granted so far, in order
+func (s *Server) Grants() []Grant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.grants)
+}
+
+// Searches returns the q parameter of every files.list request, in order
+func (s *Server) Searches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.searches)
+}
+
+// Writes returns the number of API requests other than reads
+func (s *Server) Writes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+// Chunks returns the number of resumable upload chunks received, failed
+// ones included
+func (s *Server) Chunks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chunks
+}
+
+// Links returns the link targets of an uploaded doc as it stands, in
+// document order
+func (s *Server) Links(docID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var links []string
+	if doc, ok := s.docs[docID]; ok {
+		for _, el := range doc.Body.Content {
+			for _, pe := range el.Paragraph.Elements {
+				links = append(links, pe.TextRun.TextStyle.Link.Url)
+			}
+		}
+	}
+	return links
+}
+
+// changesPageSize is small so clients page through the changes feed
+const changesPageSize = 2
+
+// Change adds an edit of each file to the Drive changes feed
+func (s *Server) Change(fileIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, fileIDs...)
+}
+
+// listChanges serves a page of the changes feed from the pageToken query
+// parameter, ending with a newStartPageToken for the next poll
+func (s *Server) listChanges(r *http.Request) (*drive.ChangeList, error) {
+	from, err := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	if err != nil || from < 0 || from > len(s.changes) {
+		return nil, fmt.Errorf("invalid page token %q", r.URL.Query().Get("pageToken"))
+	}
+	to := min(from+changesPageSize, len(s.changes))
+	list := &drive.ChangeList{Changes: []*drive.Change{}}
+	for _, id := range s.changes[from:to] {
+		list.Changes = append(list.Changes, &drive.Change{FileId: id})
+	}
+	if to < len(s.changes) {
+		list.NextPageToken = strconv.Itoa(to)
+	} else {
+		list.NewStartPageToken = strconv.Itoa(to)
+	}
+	return list, nil
+}
+
+// Updates returns how many batch updates a doc received
+func (s *Server) Updates(docID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updates[docID]
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		s.writes++
+	}
+	var v any
+	var err error
+	switch p := r.URL.Path; {
+	case strings.HasPrefix(p, "/v1/documents/"):
+		v, err = s.serveDocs(r, strings.TrimPrefix(p, "/v1/documents/"))
+	case p == "/about":
+		v = &drive.About{User: &drive.User{EmailAddress: s.account}}
+	case p == "/files" && r.Method == http.MethodGet:
+		// no search finds anything, so every run creates its files
+		s.searches = append(s.searches, r.URL.Query().Get("q"))
+		v = &drive.FileList{Files: []*drive.File{}}
+	case p == "/upload/drive/v3/files" && r.URL.Query().Has("upload_id"):
+		var f *drive.File
+		if f, err = s.uploadChunk(w, r); f == nil && err == nil {
+			return // waiting for more chunks
+		}
+		v = f
+	case p == "/upload/drive/v3/files" && r.URL.Query().Get("uploadType") == "resumable":
+		err = s.startUpload(w, r)
+		if err == nil {
+			return
+		}
+	case p == "/files" || p == "/upload/drive/v3/files":
+		v, err = s.createFile(r)
+	case p == "/changes/startPageToken":
+		v = &drive.StartPageToken{StartPageToken: strconv.Itoa(len(s.changes))}
+	case p == "/changes":
+		v, err = s.listChanges(r)
+	case strings.HasPrefix(p, "/files/") && strings.HasSuffix(p, "/permissions"):
+		v, err = s.servePermissions(r, strings.TrimSuffix(strings.TrimPrefix(p, "/files/"), "/permissions"))
+	case strings.HasPrefix(p, "/files/") && r.Method == http.MethodGet:
+		v, err = s.getFile(strings.TrimPrefix(p, "/files/"))
+	case strings.HasPrefix(p, "/files/") || strings.HasPrefix(p, "/upload/drive/v3/files/"):
+		v, err = s.updateFile(r, path.Base(p))
+	default:
+		err = errNotFound
+	}
+	if err != nil {
+		code := http.StatusBadRequest
+		var status statusError
+		switch {
+		case errors.Is(err, errNotFound):
+			code = http.StatusNotFound
+		case errors.As(err, &status):
+			code = int(status)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": code, "message": err.Error()}})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// errNotFound answers requests for unknown files and documents with 404
+var errNotFound = errors.New("not found")
+
+// statusError answers a request with its HTTP status
+type statusError int
+
+func (e statusError) Error() string { return http.StatusText(int(e)) }
+
+// readUpload reads the metadata and, for multipart uploads, the media of a
+// create or update request
+func readUpload(r *http.Request) (drive.File, []byte, error) {
+	var meta drive.File
+	var content []byte
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return meta, nil, err
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		part, err := mr.NextPart()
+		if err != nil {
+			return meta, nil, fmt.Errorf("reading metadata part: %w", err)
+		}
+		if err := json.NewDecoder(part).Decode(&meta); err != nil {
+			return meta, nil, fmt.Errorf("decoding metadata: %w", err)
+		}
+		part, err = mr.NextPart()
+		if err != nil {
+			return meta, nil, fmt.Errorf("reading media part: %w", err)
+		}
+		if content, err = io.ReadAll(part); err != nil {
+			return meta, nil, err
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		return meta, nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	return meta, content, nil
+}
+
+// createFile creates a folder from a metadata-only request or a file from a
+// multipart upload
+func (s *Server) createFile(r *http.Request) (*drive.File, error) {
+	meta, content, err := readUpload(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.addFile(meta, content), nil
+}
+
+// addFile stores a new file; docs uploaded as HTML are converted so the
+// Docs API can read their links
+func (s *Server) addFile(meta drive.File, content []byte) *drive.File {
+	id := fmt.Sprintf("file-%d", len(s.order)+1)
+	s.files[id] = &File{
+		ID:            id,
+		Name:          meta.Name,
+		MimeType:      meta.MimeType,
+		Parents:       meta.Parents,
+		AppProperties: meta.AppProperties,
+		Content:       content,
+	}
+	s.order = append(s.order, id)
+	if meta.MimeType == docMimeType {
+		s.docs[id] = convert(id, meta.Name, content)
+	}
+	return &drive.File{Id: id, Name: meta.Name, MimeType: meta.MimeType}
+}
+
+// updateFile replaces the name and, when media is sent, the content of a file
+func (s *Server) updateFile(r *http.Request, id string) (*drive.File, error) {
+	f, ok := s.files[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	meta, content, err := readUpload(r)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Name != "" {
+		f.Name = meta.Name
+	}
+	if content != nil {
+		f.Content = content
+	}
+	f.Revisions++
+	return &drive.File{Id: f.ID, Name: f.Name, MimeType: f.MimeType}, nil
+}
+
+// startUpload opens a resumable upload session for the metadata in the body
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request) error {
+	var meta drive.File
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		return fmt.Errorf("decoding metadata: %w", err)
+	}
+	s.sessions = append(s.sessions, &session{meta: meta})
+	w.Header().Set("Location", fmt.Sprintf("%s/upload/drive/v3/files?uploadType=resumable&upload_id=%d", s.api.URL, len(s.sessions)-1))
+	return nil
+}
+
+// uploadChunk appends a chunk to its session. The last one, whose
+// Content-Range carries the total size, creates the file; earlier ones are
+// answered with Drive's "308 Resume Incomplete" and the bytes stored so far.
+func (s *Server) uploadChunk(w http.ResponseWriter, r *http.Request) (*drive.File, error) {
+	n, err := strconv.Atoi(r.URL.Query().Get("upload_id"))
+	if err != nil || n < 0 || n >= len(s.sessions) {
+		return nil, errNotFound
+	}
+	sess := s.sessions[n]
+	if s.chunks++; s.chunks == s.failChunk {
+		return nil, statusError(http.StatusServiceUnavailable)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	sess.content = append(sess.content, body...)
+	if !strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+		return s.addFile(sess.meta, sess.content), nil
+	}
+	// the client asks for this instead of a real 308
+	w.Header().Set("X-Http-Status-Code-Override", "308")
+	w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(sess.content)-1))
+	return nil, nil
+}
+
+// servePermissions answers permissions.list with a file's permissions and
+// records permissions.create as a grant
+func (s *Server) servePermissions(r *http.Request, id string) (any, error) {
+	f, ok := s.files[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	if r.Method == http.MethodGet {
+		return &drive.PermissionList{Permissions: f.Permissions}, nil
+	}
+	if s.refuse != nil && s.refuse(*f) {
+		return nil, statusError(http.StatusForbidden)
+	}
+	var perm drive.Permission
+	if err := json.NewDecoder(r.Body).Decode(&perm); err != nil {
+		return nil, fmt.Errorf("decoding permission: %w", err)
+	}
+	s.grants = append(s.grants, Grant{
+		FileID:     id,
+		Permission: perm,
+		Notify:     r.URL.Query().Get("sendNotificationEmail") != "false",
+	})
+	perm.Id = fmt.Sprintf("perm-%d", len(s.grants))
+	return &perm, nil
+}
+
+func (s *Server) getFile(id string) (*drive.File, error) {
+	f, ok := s.files[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &drive.File{Id: f.ID, Name: f.Name, MimeType: f.MimeType, Parents: f.Parents}, nil
+}
+
+// serveDocs answers documents.get and documents.batchUpdate
+func (s *Server) serveDocs(r *http.Request, rest string) (any, error) {
+	id, update := strings.CutSuffix(rest, ":batchUpdate")
+	doc, ok := s.docs[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	if !update {
+		return doc, nil
+	}
+
+	var req docs.BatchUpdateDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("decoding batch update: %w", err)
+	}
+	for _, u := range req.Requests {
+		style := u.UpdateTextStyle
+		if style == nil || style.TextStyle == nil || style.TextStyle.Link == nil || style.Range == nil {
+			return nil, errors.New("only link updates are supported")
+		}
+		for _, el := range doc.Body.Content {
+			for _, pe := range el.Paragraph.Elements {
+				if pe.StartIndex >= style.Range.StartIndex && pe.EndIndex <= style.Range.EndIndex {
+					pe.TextRun.TextStyle.Link = &docs.Link{Url: style.TextStyle.Link.Url}
+				}
+			}
+		}
+	}
+	s.updates[id]++
+	return &docs.BatchUpdateDocumentResponse{DocumentId: id}, nil
+}
+
+// convert turns uploaded HTML into a document holding one paragraph per
+// link, which is all the patcher and verifier look at
+func convert(id, title string, content []byte) *docs.Document {
+	doc := &docs.Document{DocumentId: id, Title: title, Body: &docs.Body{}}
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return doc
+	}
+	index := int64(1)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				text := textOf(n) + "\n"
+				doc.Body.Content = append(doc.Body.Content, &docs.StructuralElement{
+					Paragraph: &docs.Paragraph{Elements: []*docs.ParagraphElement{{
+						StartIndex: index,
+						EndIndex:   index + int64(len(text)),
+						TextRun: &docs.TextRun{
+							Content:   text,
+							TextStyle: &docs.TextStyle{Link: &docs.Link{Url: attr.Val}},
+						},
+					}}},
+				})
+				index += int64(len(text))
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return doc
+}
+
+// textOf returns the text inside n
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
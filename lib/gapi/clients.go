@@ -0,0 +1,97 @@
+// Package gapi builds the authenticated Google API clients a pipeline
+// shares between its steps.
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/forms/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Scopes are the OAuth scopes every pipeline client is authorized for
+var Scopes = []string{
+	drive.DriveScope,
+	docs.DocumentsScope,
+	sheets.SpreadsheetsScope,
+	forms.FormsBodyReadonlyScope,
+}
+
+// Clients is one set of Google API services over a single authenticated
+// HTTP client, so every step refreshes the same token and bills the same
+// quota project
+type Clients struct {
+	// HTTP is the authenticated client the services use
+	HTTP   *http.Client
+	Docs   *docs.Service
+	Drive  *drive.Service
+	Sheets *sheets.Service
+	Forms  *forms.Service
+}
+
+// Option configures how New authenticates
+type Option func(*settings)
+
+type settings struct {
+	tokenSource oauth2.TokenSource
+}
+
+// WithTokenSource authenticates with the given tokens, such as
+// UserCredentials or ServiceAccountCredentials, instead of the application default credentials
+func WithTokenSource(ts oauth2.TokenSource) Option {
+	return func(s *settings) {
+		s.tokenSource = ts
+	}
+}
+
+// New authenticates with the application default credentials, unless
+// configured otherwise, over base and creates every service. projectID, when
+// set, is billed for quota.
+func New(ctx context.Context, base http.RoundTripper, projectID string, opts ...Option) (*Clients, error) {
+	var set settings
+	for _, opt := range opts {
+		opt(&set)
+	}
+
+	authOpts := []option.ClientOption{option.WithScopes(Scopes...)}
+	if set.tokenSource != nil {
+		authOpts = append(authOpts, option.WithTokenSource(set.tokenSource))
+	}
+	if projectID != "" {
+		authOpts = append(authOpts, option.WithQuotaProject(projectID))
+	}
+	authed, err := htransport.NewTransport(ctx, base, authOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating API transport: %w", err)
+	}
+
+	c := &Clients{HTTP: &http.Client{Transport: authed}}
+	svcOpts := c.Options()
+
+	if c.Docs, err = docs.NewService(ctx, svcOpts...); err != nil {
+		return nil, fmt.Errorf("creating Docs service: %w", err)
+	}
+	if c.Drive, err = drive.NewService(ctx, svcOpts...); err != nil {
+		return nil, fmt.Errorf("creating Drive service: %w", err)
+	}
+	if c.Sheets, err = sheets.NewService(ctx, svcOpts...); err != nil {
+		return nil, fmt.Errorf("creating Sheets service: %w", err)
+	}
+	if c.Forms, err = forms.NewService(ctx, svcOpts...); err != nil {
+		return nil, fmt.Errorf("creating Forms service: %w", err)
+	}
+	return c, nil
+}
+
+// Options returns client options that build further services over the
+// shared authenticated client
+func (c *Clients) Options() []option.ClientOption {
+	return []option.ClientOption{option.WithHTTPClient(c.HTTP)}
+}
@@ -0,0 +1,193 @@
+package gapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultTokenFile is where user tokens are cached unless configured otherwise
+func DefaultTokenFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "gdoc-pipeline", "token.json")
+}
+
+// UserCredentials authorizes as the user who owns the documents, with an
+// OAuth "Desktop app" client. A token cached in tokenFile is reused (and
+// kept refreshed); without one the user is sent through the consent screen
+// in their browser once.
+func UserCredentials(ctx context.Context, clientSecretFile, tokenFile string) (oauth2.TokenSource, error) {
+	secret, err := os.ReadFile(clientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading OAuth client: %w", err)
+	}
+	cfg, err := google.ConfigFromJSON(secret, Scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OAuth client %s: %w", clientSecretFile, err)
+	}
+
+	tok, err := loadToken(tokenFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("ignoring unreadable OAuth token cache", slog.String("path", tokenFile), slog.Any("error", err))
+		}
+		if tok, err = consent(ctx, cfg); err != nil {
+			return nil, err
+		}
+		if err := saveToken(tokenFile, tok); err != nil {
+			return nil, err
+		}
+	}
+
+	// the source outlives ctx: it refreshes tokens for the whole run
+	src := cfg.TokenSource(context.WithoutCancel(ctx), tok)
+	return &cachingTokenSource{src: src, path: tokenFile, last: tok.AccessToken}, nil
+}
+
+// consent runs the installed-app flow: the browser sends the authorization
+// code to a one-off server on the loopback interface
+func consent(ctx context.Context, cfg *oauth2.Config) (*oauth2.Token, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listening for the OAuth redirect: %w", err)
+	}
+	defer ln.Close()
+	cfg.RedirectURL = fmt.Sprintf("http://%s/", ln.Addr())
+
+	state := randomState()
+	verifier := oauth2.GenerateVerifier()
+	authURL := cfg.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("state") != state:
+			http.Error(w, "unexpected state", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			fmt.Fprintln(w, "Authorization failed, you can close this window.")
+			errs <- fmt.Errorf("authorization denied: %s", q.Get("error"))
+			return
+		}
+		fmt.Fprintln(w, "Authorized, you can close this window.")
+		codes <- q.Get("code")
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	slog.Info("authorize access in your browser", slog.String("url", authURL))
+	fmt.Fprintf(os.Stderr, "Open this URL to authorize access to your documents:\n\n  %s\n\n", authURL)
+	openBrowser(authURL)
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	tok, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging authorization code: %w", err)
+	}
+	return tok, nil
+}
+
+// openBrowser tries to open url; the URL is printed either way
+func openBrowser(url string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
+}
+
+func randomState() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func loadToken(path string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		return nil, errors.New("token has no refresh token")
+	}
+	return &tok, nil
+}
+
+// saveToken writes the token readable by the user only
+func saveToken(path string, tok *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating token cache directory: %w", err)
+	}
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("caching OAuth token: %w", err)
+	}
+	return nil
+}
+
+// cachingTokenSource saves every refreshed token, so the cache keeps a
+// current refresh token if Google rotates it
+type cachingTokenSource struct {
+	src  oauth2.TokenSource
+	path string
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		if err := saveToken(s.path, tok); err != nil {
+			slog.Warn("failed to cache refreshed OAuth token", slog.Any("error", err))
+		}
+	}
+	return tok, nil
+}
@@ -0,0 +1,28 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// ServiceAccountCredentials authorizes as the service account of a JSON key.
+// With subject set, the account acts as that Workspace user through
+// domain-wide delegation, which an admin must have granted it for Scopes.
+func ServiceAccountCredentials(ctx context.Context, keyFile, subject string) (oauth2.TokenSource, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account key: %w", err)
+	}
+	cfg, err := google.JWTConfigFromJSON(key, Scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing service account key %s: %w", keyFile, err)
+	}
+	cfg.Subject = subject
+
+	// the source outlives ctx: it mints tokens for the whole run
+	return cfg.TokenSource(context.WithoutCancel(ctx)), nil
+}
@@ -0,0 +1,75 @@
+package gapi_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAccountCredentialsImpersonates(t *testing.T) {
+	var claims map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(payload, &claims))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"tok","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	keyFile := writeKey(t, srv.URL)
+	ts, err := gapi.ServiceAccountCredentials(context.Background(), keyFile, "admin@example.com")
+	require.NoError(t, err)
+
+	tok, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "tok", tok.AccessToken)
+	assert.Equal(t, "migrator@project.iam.gserviceaccount.com", claims["iss"])
+	assert.Equal(t, "admin@example.com", claims["sub"])
+}
+
+func TestServiceAccountCredentialsRejectsOtherKeys(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "client_secret.json")
+	require.NoError(t, os.WriteFile(name, []byte(`{"installed":{"client_id":"x"}}`), 0o600))
+
+	_, err := gapi.ServiceAccountCredentials(context.Background(), name, "")
+	assert.Error(t, err)
+}
+
+func writeKey(t *testing.T, tokenURI string) string {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+
+	key, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "migrator@project.iam.gserviceaccount.com",
+		"private_key_id": "k1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	require.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "key.json")
+	require.NoError(t, os.WriteFile(name, key, 0o600))
+	return name
+}
@@ -0,0 +1,153 @@
+// Package gdocs reads structure out of Google Docs API documents and finds
+// the documents their links point to.
+package gdocs
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// Link is a hyperlinked text run or inline object of a document
+type Link struct {
+	URL  string
+	Text string
+	// SegmentID is the header, footer or footnote holding the link; empty
+	// for the body
+	SegmentID  string
+	StartIndex int64
+	EndIndex   int64
+}
+
+// ElementLink returns the link target of a paragraph element and the text
+// it is attached to. Besides text runs, inline images and drawings carry
+// links too; their text is a bracketed label such as "[image: Logo]". It
+// returns "" for elements without a link.
+func ElementLink(doc *docs.Document, pe *docs.ParagraphElement) (string, string) {
+	switch {
+	case pe.TextRun != nil:
+		if style := pe.TextRun.TextStyle; style != nil && style.Link != nil {
+			return style.Link.Url, strings.TrimSpace(pe.TextRun.Content)
+		}
+	case pe.InlineObjectElement != nil:
+		if style := pe.InlineObjectElement.TextStyle; style != nil && style.Link != nil {
+			return style.Link.Url, inlineObjectLabel(doc, pe.InlineObjectElement.InlineObjectId)
+		}
+	}
+	return "", ""
+}
+
+// inlineObjectLabel describes an inline object for reports
+func inlineObjectLabel(doc *docs.Document, id string) string {
+	obj, ok := doc.InlineObjects[id]
+	if !ok || obj.InlineObjectProperties == nil || obj.InlineObjectProperties.EmbeddedObject == nil {
+		return "[object]"
+	}
+
+	embedded := obj.InlineObjectProperties.EmbeddedObject
+	kind := "image"
+	if embedded.EmbeddedDrawingProperties != nil {
+		kind = "drawing"
+	} else if embedded.LinkedContentReference != nil && embedded.LinkedContentReference.SheetsChartReference != nil {
+		kind = "chart"
+	}
+
+	name := embedded.Title
+	if name == "" {
+		name = embedded.Description
+	}
+	if name == "" {
+		return "[" + kind + "]"
+	}
+	return "[" + kind + ": " + name + "]"
+}
+
+// Links returns the hyperlinks of a document: its body, including tables and
+// the table of contents, then its headers, footers and footnotes
+func Links(doc *docs.Document) []Link {
+	var links []Link
+	var walk func(segment string, content []*docs.StructuralElement)
+	walk = func(segment string, content []*docs.StructuralElement) {
+		for _, el := range content {
+			switch {
+			case el.Paragraph != nil:
+				for _, pe := range el.Paragraph.Elements {
+					url, text := ElementLink(doc, pe)
+					if url == "" {
+						continue
+					}
+					links = append(links, Link{
+						URL:        url,
+						Text:       text,
+						SegmentID:  segment,
+						StartIndex: pe.StartIndex,
+						EndIndex:   pe.EndIndex,
+					})
+				}
+			case el.Table != nil:
+				for _, row := range el.Table.TableRows {
+					for _, cell := range row.TableCells {
+						walk(segment, cell.Content)
+					}
+				}
+			case el.TableOfContents != nil:
+				walk(segment, el.TableOfContents.Content)
+			}
+		}
+	}
+
+	if doc.Body != nil {
+		walk("", doc.Body.Content)
+	}
+	for _, id := range slices.Sorted(maps.Keys(doc.Headers)) {
+		walk(id, doc.Headers[id].Content)
+	}
+	for _, id := range slices.Sorted(maps.Keys(doc.Footers)) {
+		walk(id, doc.Footers[id].Content)
+	}
+	for _, id := range slices.Sorted(maps.Keys(doc.Footnotes)) {
+		walk(id, doc.Footnotes[id].Content)
+	}
+	return links
+}
+
+// Tab is one tab of a document, as a document of its own
+type Tab struct {
+	ID  string
+	Doc *docs.Document
+}
+
+// Tabs returns the tabs of a document fetched with includeTabsContent,
+// nested tabs after their parent. A document fetched without its tabs'
+// content is its only tab, with an empty ID.
+func Tabs(doc *docs.Document) []Tab {
+	if len(doc.Tabs) == 0 {
+		return []Tab{{Doc: doc}}
+	}
+	var tabs []Tab
+	var walk func([]*docs.Tab)
+	walk = func(ts []*docs.Tab) {
+		for _, t := range ts {
+			if dt := t.DocumentTab; dt != nil {
+				id := ""
+				if t.TabProperties != nil {
+					id = t.TabProperties.TabId
+				}
+				tabs = append(tabs, Tab{ID: id, Doc: &docs.Document{
+					DocumentId:    doc.DocumentId,
+					Title:         doc.Title,
+					Body:          dt.Body,
+					Headers:       dt.Headers,
+					Footers:       dt.Footers,
+					Footnotes:     dt.Footnotes,
+					InlineObjects: dt.InlineObjects,
+				}})
+			}
+			walk(t.ChildTabs)
+		}
+	}
+	walk(doc.Tabs)
+	return tabs
+}
@@ -0,0 +1,93 @@
+package gdocs_test
+
+import (
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/docs/v1"
+)
+
+func linkedRun(url, text string, start int64) *docs.ParagraphElement {
+	return &docs.ParagraphElement{
+		StartIndex: start,
+		EndIndex:   start + int64(len(text)),
+		TextRun: &docs.TextRun{
+			Content:   text,
+			TextStyle: &docs.TextStyle{Link: &docs.Link{Url: url}},
+		},
+	}
+}
+
+func paragraph(elements ...*docs.ParagraphElement) *docs.StructuralElement {
+	return &docs.StructuralElement{Paragraph: &docs.Paragraph{Elements: elements}}
+}
+
+func TestLinks(t *testing.T) {
+	doc := &docs.Document{
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			paragraph(
+				&docs.ParagraphElement{TextRun: &docs.TextRun{Content: "plain "}},
+				linkedRun("https://a.example", "first ", 7),
+			),
+			{Table: &docs.Table{TableRows: []*docs.TableRow{{
+				TableCells: []*docs.TableCell{{Content: []*docs.StructuralElement{
+					paragraph(linkedRun("https://b.example", "in a table", 20)),
+				}}},
+			}}}},
+			paragraph(&docs.ParagraphElement{
+				StartIndex: 40,
+				EndIndex:   41,
+				InlineObjectElement: &docs.InlineObjectElement{
+					InlineObjectId: "kix.logo",
+					TextStyle:      &docs.TextStyle{Link: &docs.Link{Url: "https://c.example"}},
+				},
+			}),
+		}},
+		Footers: map[string]docs.Footer{
+			"kix.footer": {Content: []*docs.StructuralElement{
+				paragraph(linkedRun("https://d.example", "footer", 1)),
+			}},
+		},
+		InlineObjects: map[string]docs.InlineObject{
+			"kix.logo": {InlineObjectProperties: &docs.InlineObjectProperties{
+				EmbeddedObject: &docs.EmbeddedObject{Title: "Logo"},
+			}},
+		},
+	}
+
+	assert.Equal(t, []gdocs.Link{
+		{URL: "https://a.example", Text: "first", StartIndex: 7, EndIndex: 13},
+		{URL: "https://b.example", Text: "in a table", StartIndex: 20, EndIndex: 30},
+		{URL: "https://c.example", Text: "[image: Logo]", StartIndex: 40, EndIndex: 41},
+		{URL: "https://d.example", Text: "footer", SegmentID: "kix.footer", StartIndex: 1, EndIndex: 7},
+	}, gdocs.Links(doc))
+}
+
+func TestTabs(t *testing.T) {
+	tab := func(id, url string, children ...*docs.Tab) *docs.Tab {
+		return &docs.Tab{
+			TabProperties: &docs.TabProperties{TabId: id},
+			DocumentTab: &docs.DocumentTab{Body: &docs.Body{Content: []*docs.StructuralElement{
+				paragraph(linkedRun(url, "link", 1)),
+			}}},
+			ChildTabs: children,
+		}
+	}
+	doc := &docs.Document{Tabs: []*docs.Tab{
+		tab("t.0", "https://a.example", tab("t.1", "https://b.example")),
+		tab("t.2", "https://c.example"),
+	}}
+
+	var got []string
+	for _, tab := range gdocs.Tabs(doc) {
+		for _, l := range gdocs.Links(tab.Doc) {
+			got = append(got, tab.ID+" "+l.URL)
+		}
+	}
+	assert.Equal(t, []string{"t.0 https://a.example", "t.1 https://b.example", "t.2 https://c.example"}, got)
+
+	// documents fetched without their tabs' content are a single tab
+	single := &docs.Document{Body: &docs.Body{}}
+	assert.Equal(t, []gdocs.Tab{{Doc: single}}, gdocs.Tabs(single))
+}
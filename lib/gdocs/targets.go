@@ -0,0 +1,111 @@
+package gdocs
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// targetRe matches the link shapes the crawler follows: editor links, with
+// or without a Workspace /a/<domain>/ prefix, and the open?id=, uc?id= and
+// drive.google.com/file/d/ forms that name a Drive file without its type
+var targetRe = regexp.MustCompile(`^https?://(?:docs|drive)\.google\.com/(?:a/[^/?#]+/)?(?:(document|spreadsheets|file)/d/([\w-]+)|(?:open|uc)\?(?:[^#]*?&)?id=([\w-]+))`)
+
+// redirectorRe matches Google's link redirector
+var redirectorRe = regexp.MustCompile(`^https?://(?:www\.)?google\.com/url\?`)
+
+// Target is the Google doc or sheet a link points to
+type Target struct {
+	// Kind is "document" or "spreadsheets", or "" for links that name a
+	// Drive file without saying which
+	Kind string
+	ID   string
+}
+
+// Keys returns the id_map keys ("doc:<id>", "sheet:<id>") the target may be
+// saved under: one, or both for a Drive file link
+func (t Target) Keys() []string {
+	switch t.Kind {
+	case "document":
+		return []string{"doc:" + t.ID}
+	case "spreadsheets":
+		return []string{"sheet:" + t.ID}
+	}
+	return []string{"doc:" + t.ID, "sheet:" + t.ID}
+}
+
+// KindOf returns the link kind of an id_map key's document type
+func KindOf(key string) string {
+	if strings.HasPrefix(key, "sheet:") {
+		return "spreadsheets"
+	}
+	return "document"
+}
+
+// URL returns the target's plain editor URL without /edit,
+// https://docs.google.com/<kind>/d/<id>; kind replaces an unknown Kind
+func (t Target) URL(kind string) string {
+	if t.Kind != "" {
+		kind = t.Kind
+	}
+	return "https://docs.google.com/" + kind + "/d/" + t.ID
+}
+
+// ParseTarget returns the doc or sheet link points to, through Google's
+// redirector. It reports false for other links, including published
+// (/d/e/<token>) ones, which don't carry the file ID. Drive shortcuts are
+// files of their own, so their links keep the shortcut's ID.
+func ParseTarget(link string) (Target, bool) {
+	for i := 0; i < 3 && redirectorRe.MatchString(link); i++ {
+		u, err := url.Parse(link)
+		if err != nil || u.Query().Get("q") == "" {
+			break
+		}
+		link = u.Query().Get("q")
+	}
+	m := targetRe.FindStringSubmatch(link)
+	switch {
+	case m == nil:
+		return Target{}, false
+	case m[3] != "":
+		return Target{ID: m[3]}, true
+	case m[1] == "file":
+		return Target{ID: m[2]}, true
+	case m[2] == "e":
+		// published link
+		return Target{}, false
+	}
+	return Target{Kind: m[1], ID: m[2]}, true
+}
+
+// FindTargets returns the docs and sheets the links of an HTML export point
+// to, in order. The export wraps links in Google's redirector, escaping
+// them, so they are read from each anchor rather than the raw bytes.
+func FindTargets(content []byte) []Target {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	var targets []Target
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, a := range n.Attr {
+				if a.Key != "href" {
+					continue
+				}
+				if t, ok := ParseTarget(a.Val); ok {
+					targets = append(targets, t)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return targets
+}
@@ -0,0 +1,42 @@
+package gdocs_test
+
+import (
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := map[string]gdocs.Target{
+		"https://docs.google.com/document/d/abc_1-2/edit#heading=h.x":                       {Kind: "document", ID: "abc_1-2"},
+		"https://docs.google.com/a/example.com/spreadsheets/d/sheet/edit":                   {Kind: "spreadsheets", ID: "sheet"},
+		"https://docs.google.com/open?id=opened":                                            {ID: "opened"},
+		"https://drive.google.com/uc?export=download&id=downloaded":                         {ID: "downloaded"},
+		"https://drive.google.com/file/d/filed/view":                                        {ID: "filed"},
+		"https://www.google.com/url?q=https://docs.google.com/document/d/wrapped/edit&sa=D": {Kind: "document", ID: "wrapped"},
+	}
+	for link, want := range tests {
+		got, ok := gdocs.ParseTarget(link)
+		assert.True(t, ok, link)
+		assert.Equal(t, want, got, link)
+	}
+
+	for _, link := range []string{
+		"https://docs.google.com/document/d/e/2PACX-token/pub",
+		"https://example.com/?u=https://docs.google.com/document/d/abc",
+		"https://docs.google.com/forms/d/form/edit",
+	} {
+		_, ok := gdocs.ParseTarget(link)
+		assert.False(t, ok, link)
+	}
+}
+
+func TestFindTargets(t *testing.T) {
+	html := []byte(`<a href="https://www.google.com/url?q=https://docs.google.com/document/d/doc1/edit&amp;sa=D">a</a>` +
+		`<a href="https://drive.google.com/open?authuser=0&amp;id=file1">b</a>`)
+	assert.Equal(t, []gdocs.Target{{Kind: "document", ID: "doc1"}, {ID: "file1"}}, gdocs.FindTargets(html))
+
+	assert.Equal(t, []string{"doc:file1", "sheet:file1"}, gdocs.Target{ID: "file1"}.Keys())
+	assert.Equal(t, "https://docs.google.com/spreadsheets/d/file1", gdocs.Target{ID: "file1"}.URL("spreadsheets"))
+}
@@ -0,0 +1,251 @@
+// Package htmlclean rewrites the HTML Google exports documents as.
+package htmlclean
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// keptAttrs are the attributes Clean leaves on elements; ids stay so
+// in-document links (table of contents, footnotes) keep working
+var keptAttrs = map[string]bool{
+	"href":    true,
+	"src":     true,
+	"alt":     true,
+	"title":   true,
+	"id":      true,
+	"colspan": true,
+	"rowspan": true,
+}
+
+// classRuleRe matches the single-class rules of the export's stylesheet
+var classRuleRe = regexp.MustCompile(`\.([A-Za-z0-9_-]+)\{([^}]*)\}`)
+
+// Clean strips the generated classes, inline CSS and wrapper spans of a
+// Google Docs HTML export, keeping its semantic markup. Bold and italic
+// text, which the export only expresses through classes, become <strong>
+// and <em>; links wrapped in Google's redirector point at their target.
+// Empty headings, which the export leaves for blank heading-styled lines,
+// are dropped unless a link in the document points at them.
+func Clean(content []byte) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	styles := classStyles(root)
+	cleanNode(root, styles)
+	dropEmptyHeadings(root, anchors(root))
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// classStyles maps each class of the export's stylesheets to its declarations
+func classStyles(root *html.Node) map[string]string {
+	styles := make(map[string]string)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				for _, m := range classRuleRe.FindAllStringSubmatch(c.Data, -1) {
+					styles[m[1]] += m[2] + ";"
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return styles
+}
+
+// cleanNode cleans the children of n
+func cleanNode(n *html.Node, styles map[string]string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != html.ElementNode {
+			c = next
+			continue
+		}
+
+		switch c.DataAtom {
+		case atom.Style, atom.Script, atom.Meta, atom.Link:
+			n.RemoveChild(c)
+			c = next
+			continue
+		}
+
+		decl := inlineStyle(c, styles)
+		cleanNode(c, styles)
+		c.Attr = keptAttributes(c)
+
+		if c.DataAtom == atom.Span {
+			// spans only carry styling; lift their content out
+			c = wrapEmphasis(c, decl)
+			if c.DataAtom == atom.Span {
+				unwrap(c)
+			}
+		}
+		c = next
+	}
+}
+
+// inlineStyle returns the CSS declarations applying to n through its
+// classes and style attribute
+func inlineStyle(n *html.Node, styles map[string]string) string {
+	var decl strings.Builder
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "class":
+			for _, class := range strings.Fields(a.Val) {
+				decl.WriteString(styles[class])
+			}
+		case "style":
+			decl.WriteString(a.Val + ";")
+		}
+	}
+	return strings.ReplaceAll(decl.String(), " ", "")
+}
+
+// keptAttributes drops every attribute of n but those in keptAttrs,
+// unwrapping redirected links on the way
+func keptAttributes(n *html.Node) []html.Attribute {
+	var kept []html.Attribute
+	for _, a := range n.Attr {
+		if !keptAttrs[a.Key] {
+			continue
+		}
+		if a.Key == "href" {
+			a.Val = unwrapRedirect(a.Val)
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// wrapEmphasis turns a span styled bold or italic into <strong> / <em>
+// (nested when both) and returns the outermost element
+func wrapEmphasis(span *html.Node, decl string) *html.Node {
+	bold := strings.Contains(decl, "font-weight:700") || strings.Contains(decl, "font-weight:bold")
+	italic := strings.Contains(decl, "font-style:italic")
+	if !bold && !italic {
+		return span
+	}
+
+	if bold {
+		span.Data, span.DataAtom = "strong", atom.Strong
+	} else {
+		span.Data, span.DataAtom = "em", atom.Em
+	}
+	if bold && italic {
+		em := &html.Node{Type: html.ElementNode, Data: "em", DataAtom: atom.Em}
+		for c := span.FirstChild; c != nil; {
+			next := c.NextSibling
+			span.RemoveChild(c)
+			em.AppendChild(c)
+			c = next
+		}
+		span.AppendChild(em)
+	}
+	return span
+}
+
+// headings are the elements dropEmptyHeadings looks at
+var headings = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// anchors returns the fragments in-document links point at
+func anchors(root *html.Node) map[string]bool {
+	targets := make(map[string]bool)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			for _, a := range n.Attr {
+				if a.Key == "href" && strings.HasPrefix(a.Val, "#") {
+					targets[a.Val[1:]] = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return targets
+}
+
+// dropEmptyHeadings removes the headings below n that hold no text or
+// image and aren't the target of a link
+func dropEmptyHeadings(n *html.Node, targets map[string]bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && headings[c.DataAtom] && isEmpty(c) && !targets[attr(c, "id")] {
+			n.RemoveChild(c)
+		} else {
+			dropEmptyHeadings(c, targets)
+		}
+		c = next
+	}
+}
+
+// isEmpty reports whether n holds nothing but whitespace
+func isEmpty(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) != "":
+			return false
+		case c.Type == html.ElementNode && c.DataAtom == atom.Img:
+			return false
+		case !isEmpty(c):
+			return false
+		}
+	}
+	return true
+}
+
+// attr returns the value of n's attribute key, or ""
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// unwrap replaces n with its children
+func unwrap(n *html.Node) {
+	parent := n.Parent
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		n.RemoveChild(c)
+		parent.InsertBefore(c, n)
+		c = next
+	}
+	parent.RemoveChild(n)
+}
+
+// unwrapRedirect returns the target of a link through
+// https://www.google.com/url?q=…, or the link unchanged
+func unwrapRedirect(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || (u.Host != "www.google.com" && u.Host != "google.com") || u.Path != "/url" {
+		return link
+	}
+	if q := u.Query().Get("q"); q != "" {
+		return q
+	}
+	return link
+}
@@ -0,0 +1,47 @@
+package htmlclean_test
+
+import (
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClean(t *testing.T) {
+	in := `<html><head><meta content="text/html"><style>.c1{font-weight:700}.c2{font-style:italic;color:#000}.c3{margin:0}</style><title>Doc</title></head>` +
+		`<body class="c3"><h1 id="h.x" class="c3"><span class="c3">Heading</span></h1>` +
+		`<p class="c3" style="margin:0"><span class="c1">bold</span> <span class="c1 c2">both</span> <span class="c3">plain</span> ` +
+		`<a class="c3" href="https://www.google.com/url?q=https://example.com/a&amp;sa=D">link</a></p></body></html>`
+
+	out, err := htmlclean.Clean([]byte(in))
+	require.NoError(t, err)
+	assert.Equal(t, `<html><head><title>Doc</title></head>`+
+		`<body><h1 id="h.x">Heading</h1>`+
+		`<p><strong>bold</strong> <strong><em>both</em></strong> plain `+
+		`<a href="https://example.com/a">link</a></p></body></html>`, string(out))
+}
+
+func TestCleanDropsEmptyHeadings(t *testing.T) {
+	in := `<html><head></head><body><a href="#h.toc">contents</a>` +
+		`<h2 id="h.a"><span class="c1"> </span></h2><h2 id="h.toc"></h2><h3 id="h.b"><img src="x.png"></h3><h3>Kept</h3></body></html>`
+
+	out, err := htmlclean.Clean([]byte(in))
+	require.NoError(t, err)
+	assert.Equal(t, `<html><head></head><body><a href="#h.toc">contents</a>`+
+		`<h2 id="h.toc"></h2><h3 id="h.b"><img src="x.png"/></h3><h3>Kept</h3></body></html>`, string(out))
+}
+
+func TestSanitize(t *testing.T) {
+	in := `<html><head><meta http-equiv="refresh" content="0;url=https://evil.example"><link rel="stylesheet" href="https://fonts.googleapis.com/css">` +
+		`<style>@import url(https://fonts.googleapis.com/css?family=Roboto);.c1{color:red;background:url(https://t.example/p.gif)}</style></head>` +
+		`<body><script>alert(1)</script><p onclick="steal()" class="c1">text <a href="javascript:alert(1)">x</a> <a href="https://example.com">ok</a></p>` +
+		`<img src="https://t.example/pixel.gif" width="1" height="1"><img src="data:image/png;base64,AAAA" alt="inline"><iframe src="https://example.com"></iframe></body></html>`
+
+	out, removed, err := htmlclean.Sanitize([]byte(in))
+	require.NoError(t, err)
+	assert.Equal(t, `<html><head><style>.c1{color:red;background:none}</style></head>`+
+		`<body><p class="c1">text <a>x</a> <a href="https://example.com">ok</a></p>`+
+		`<img src="data:image/png;base64,AAAA" alt="inline"/></body></html>`, string(out))
+	assert.Equal(t, 9, removed)
+}
@@ -0,0 +1,160 @@
+package htmlclean
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// droppedElements are removed from sanitized HTML along with their content
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Base:     true,
+	atom.Link:     true,
+}
+
+var (
+	// CSS rules pulling in external stylesheets and fonts
+	cssImportRe   = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssFontFaceRe = regexp.MustCompile(`(?i)@font-face\s*\{[^}]*\}`)
+	// external resources referenced from CSS values
+	cssURLRe = regexp.MustCompile(`(?i)url\(\s*['"]?\s*(?:https?:)?//[^)]*\)`)
+	// schemes that run code when a link is followed
+	scriptSchemeRe = regexp.MustCompile(`(?i)^\s*(?:javascript|vbscript|data):`)
+)
+
+// Sanitize removes from HTML everything that runs code or loads content
+// from elsewhere when the document is imported or opened: scripts, frames
+// and plugins, event handler attributes, script links, external
+// stylesheets, fonts and CSS resources, and 1×1 tracking images. It
+// returns the sanitized HTML and how many items were removed.
+func Sanitize(content []byte) ([]byte, int, error) {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	removed := sanitizeNode(root)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), removed, nil
+}
+
+// sanitizeNode sanitizes the children of n and returns how many items it removed
+func sanitizeNode(n *html.Node) int {
+	removed := 0
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != html.ElementNode {
+			c = next
+			continue
+		}
+
+		if droppedElements[c.DataAtom] || isRefresh(c) || isTrackingPixel(c) {
+			n.RemoveChild(c)
+			removed++
+			c = next
+			continue
+		}
+
+		if c.DataAtom == atom.Style {
+			for t := c.FirstChild; t != nil; t = t.NextSibling {
+				css, count := sanitizeCSS(t.Data)
+				t.Data = css
+				removed += count
+			}
+		}
+
+		kept := c.Attr[:0]
+		for _, a := range c.Attr {
+			switch {
+			case strings.HasPrefix(strings.ToLower(a.Key), "on"):
+				removed++
+				continue
+			case (a.Key == "href" || a.Key == "src" || a.Key == "action") && scriptSchemeRe.MatchString(a.Val):
+				// images may still be inlined
+				if !(c.DataAtom == atom.Img && a.Key == "src" && strings.HasPrefix(strings.TrimSpace(strings.ToLower(a.Val)), "data:image/")) {
+					removed++
+					continue
+				}
+			case a.Key == "style":
+				css, count := sanitizeCSS(a.Val)
+				a.Val = css
+				removed += count
+			}
+			kept = append(kept, a)
+		}
+		c.Attr = kept
+
+		removed += sanitizeNode(c)
+		c = next
+	}
+	return removed
+}
+
+// sanitizeCSS strips imports, font faces and external URLs from CSS
+func sanitizeCSS(css string) (string, int) {
+	removed := 0
+	for _, re := range []*regexp.Regexp{cssImportRe, cssFontFaceRe} {
+		removed += len(re.FindAllStringIndex(css, -1))
+		css = re.ReplaceAllString(css, "")
+	}
+	removed += len(cssURLRe.FindAllStringIndex(css, -1))
+	css = cssURLRe.ReplaceAllString(css, "none")
+	return css, removed
+}
+
+// isRefresh reports whether n is a <meta http-equiv="refresh"> redirect
+func isRefresh(n *html.Node) bool {
+	if n.DataAtom != atom.Meta {
+		return false
+	}
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, "http-equiv") && strings.EqualFold(a.Val, "refresh") {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrackingPixel reports whether n is a remote image at most 1×1 pixels
+func isTrackingPixel(n *html.Node) bool {
+	if n.DataAtom != atom.Img {
+		return false
+	}
+	var src, width, height string
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "src":
+			src = a.Val
+		case "width":
+			width = a.Val
+		case "height":
+			height = a.Val
+		}
+	}
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return false
+	}
+	return tiny(width) && tiny(height)
+}
+
+// tiny reports whether an image dimension is set to at most one pixel
+func tiny(dim string) bool {
+	v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(dim), "px"))
+	return err == nil && v <= 1
+}
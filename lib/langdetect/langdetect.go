@@ -0,0 +1,127 @@
+// Package langdetect guesses the primary language of a text. It is a small
+// heuristic detector: the writing system settles most non-Latin languages,
+// and Latin-script text is scored against each language's most common words.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minScore is the number of stopword hits below which Latin-script text is
+// too short or too mixed to call
+const minScore = 3
+
+// stopwords holds very frequent, mostly language-specific function words
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "as", "was", "on", "are", "this", "be", "by", "have", "from", "or"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "se", "del", "las", "por", "un", "para", "con", "no", "una", "su", "es", "al", "como"},
+	"fr": {"le", "la", "de", "et", "les", "des", "est", "un", "une", "du", "que", "dans", "pour", "qui", "pas", "sur", "au", "avec", "ce", "sont"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "sich", "des", "auf", "für", "im", "dem", "auch", "es"},
+	"it": {"il", "di", "che", "la", "e", "per", "un", "una", "non", "del", "della", "sono", "con", "gli", "le", "si", "da", "nel", "anche", "è"},
+	"pt": {"o", "de", "que", "e", "do", "da", "em", "um", "para", "com", "não", "uma", "os", "no", "se", "na", "por", "mais", "as", "dos"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor", "met", "die", "ook", "maar", "aan", "er", "wordt", "bij"},
+}
+
+var stopwordIndex = buildIndex()
+
+func buildIndex() map[string][]string {
+	idx := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}
+
+// Detect returns the ISO 639-1 code of the text's primary language, or ""
+// when the text is too short or ambiguous to tell
+func Detect(text string) string {
+	if lang := detectScript(text); lang != "" {
+		return lang
+	}
+
+	scores := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, lang := range stopwordIndex[word] {
+			scores[lang]++
+		}
+	}
+
+	best, bestScore, runnerUp := "", 0, 0
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, runnerUp = lang, score, bestScore
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+	if bestScore < minScore || bestScore == runnerUp {
+		return ""
+	}
+	return best
+}
+
+// scripts maps writing systems used by (essentially) one language to it;
+// Han is checked after Kana so Japanese isn't reported as Chinese
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// detectScript returns the language of the dominant non-Latin script, if
+// letters of such a script outnumber Latin ones
+func detectScript(text string) string {
+	counts := make([]int, len(scripts))
+	latin := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for i, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total <= latin {
+		return ""
+	}
+
+	// any kana at all means Japanese, whatever the Han share
+	if counts[0]+counts[1] > 0 {
+		return "ja"
+	}
+	best := -1
+	for i, n := range counts {
+		if n > 0 && (best == -1 || n > counts[best]) {
+			best = i
+		}
+	}
+	return scripts[best].lang
+}
@@ -0,0 +1,25 @@
+package langdetect_test
+
+import (
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/langdetect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := map[string]string{
+		"The quarterly report is attached and the numbers for this year are in the second tab.":         "en",
+		"El informe trimestral está adjunto y los números de este año están en la segunda pestaña.":     "es",
+		"Le rapport trimestriel est joint et les chiffres de cette année sont dans le deuxième onglet.": "fr",
+		"Der Quartalsbericht ist beigefügt und die Zahlen für dieses Jahr sind auf der zweiten Seite.":  "de",
+		"Квартальный отчёт приложен, цифры за этот год на второй вкладке.":                              "ru",
+		"四半期報告書を添付します。今年の数字は二番目のタブにあります。":                                                               "ja",
+		"Budget": "",
+		"":       "",
+	}
+
+	for text, want := range tests {
+		assert.Equal(t, want, langdetect.Detect(text), text)
+	}
+}
@@ -0,0 +1,289 @@
+// Package markdown converts cleaned HTML exports to Markdown, for tools that
+// keep documents as plain text.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	spaceRe  = regexp.MustCompile(`\s+`)
+	escapeRe = regexp.MustCompile("([\\\\`*_\\[\\]<>|])")
+)
+
+// FromHTML converts an HTML document to Markdown. link rewrites each link
+// target; nil keeps them as they are.
+func FromHTML(content []byte, link func(string) string) (string, error) {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	if link == nil {
+		link = func(href string) string { return href }
+	}
+	c := &converter{link: link}
+	return strings.Join(c.blocks(root), "\n\n") + "\n", nil
+}
+
+// Table renders rows as a Markdown table, the first row being the header
+func Table(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i := range width {
+			cell := ""
+			if i < len(row) {
+				cell = escape(spaceRe.ReplaceAllString(row[i], " "))
+			}
+			b.WriteString(" " + strings.TrimSpace(cell) + " |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(rows[0])
+	b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return b.String()
+}
+
+type converter struct {
+	link func(string) string
+}
+
+// blocks renders the children of n as Markdown blocks, gathering runs of
+// inline content into paragraphs
+func (c *converter) blocks(n *html.Node) []string {
+	var out []string
+	var para strings.Builder
+	flush := func() {
+		if p := strings.TrimSpace(para.String()); p != "" {
+			out = append(out, p)
+		}
+		para.Reset()
+	}
+
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if !isBlock(ch) {
+			para.WriteString(c.inline(ch))
+			continue
+		}
+		flush()
+		out = append(out, c.block(ch)...)
+	}
+	flush()
+	return out
+}
+
+// block renders one block-level element
+func (c *converter) block(n *html.Node) []string {
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title:
+		return nil
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := strings.TrimSpace(c.inlineChildren(n))
+		if text == "" {
+			return nil
+		}
+		return []string{strings.Repeat("#", int(n.Data[1]-'0')) + " " + text}
+	case atom.Ul, atom.Ol:
+		if list := c.list(n, ""); list != "" {
+			return []string{list}
+		}
+		return nil
+	case atom.Table:
+		return []string{c.table(n)}
+	case atom.Pre:
+		return []string{"```\n" + strings.TrimRight(text(n), "\n") + "\n```"}
+	case atom.Hr:
+		return []string{"---"}
+	case atom.Blockquote:
+		var quoted []string
+		for _, b := range c.blocks(n) {
+			quoted = append(quoted, "> "+strings.ReplaceAll(b, "\n", "\n> "))
+		}
+		return []string{strings.Join(quoted, "\n>\n")}
+	}
+	return c.blocks(n)
+}
+
+// list renders a list, nesting sublists by indent
+func (c *converter) list(n *html.Node, indent string) string {
+	var lines []string
+	i := 0
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		i++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", i)
+		}
+
+		var item strings.Builder
+		var nested []string
+		for ch := li.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom == atom.Ul || ch.DataAtom == atom.Ol {
+				nested = append(nested, c.list(ch, indent+strings.Repeat(" ", len(marker))))
+				continue
+			}
+			if isBlock(ch) {
+				item.WriteString(" " + strings.Join(c.block(ch), " "))
+				continue
+			}
+			item.WriteString(c.inline(ch))
+		}
+		lines = append(lines, indent+marker+strings.TrimSpace(item.String()))
+		for _, sub := range nested {
+			if sub != "" {
+				lines = append(lines, sub)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// table renders a table; its first row becomes the header
+func (c *converter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom != atom.Tr {
+				walk(ch)
+				continue
+			}
+			var row []string
+			for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+					row = append(row, strings.Join(c.blocks(cell), " "))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+
+	// cells are already escaped inline content; only pipes need guarding
+	var b strings.Builder
+	for i, row := range rows {
+		b.WriteString("|")
+		for _, cell := range row {
+			b.WriteString(" " + strings.ReplaceAll(cell, "\n", " ") + " |")
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", len(row)) + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// inline renders a node within a paragraph
+func (c *converter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return escape(spaceRe.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\\\n"
+	case atom.Strong, atom.B:
+		return wrap(c.inlineChildren(n), "**")
+	case atom.Em, atom.I:
+		return wrap(c.inlineChildren(n), "*")
+	case atom.Code:
+		return "`" + text(n) + "`"
+	case atom.Img:
+		return fmt.Sprintf("![%s](%s)", escape(attr(n, "alt")), attr(n, "src"))
+	case atom.A:
+		label := c.inlineChildren(n)
+		href := attr(n, "href")
+		// anchors within the export don't survive the conversion
+		if href == "" || strings.HasPrefix(href, "#") || strings.TrimSpace(label) == "" {
+			return label
+		}
+		return fmt.Sprintf("[%s](%s)", label, c.link(href))
+	}
+	return c.inlineChildren(n)
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(c.inline(ch))
+	}
+	return b.String()
+}
+
+// wrap puts emphasis markers around s, outside its surrounding spaces
+// where Markdown wouldn't recognise them
+func wrap(s, marker string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	lead := s[:strings.Index(s, trimmed)]
+	trail := s[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// isBlock reports whether n starts a new Markdown block
+func isBlock(n *html.Node) bool {
+	if n.Type == html.DocumentNode {
+		return true
+	}
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.Html, atom.Head, atom.Body, atom.Style, atom.Script, atom.Title,
+		atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Table, atom.Pre, atom.Hr, atom.Blockquote:
+		return true
+	}
+	return false
+}
+
+func escape(s string) string {
+	return escapeRe.ReplaceAllString(s, `\$1`)
+}
+
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(text(ch))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
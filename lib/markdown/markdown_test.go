@@ -0,0 +1,35 @@
+package markdown_test
+
+import (
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/markdown"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromHTML(t *testing.T) {
+	in := `<html><head><title>Doc</title></head><body>` +
+		`<h1 id="h.x">Heading</h1>` +
+		`<p><strong>bold </strong>and <em>it_alic</em> <a href="https://docs.google.com/document/d/abc/edit">other doc</a> <a href="#h.x">top</a></p>` +
+		`<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>` +
+		`<table><tr><td><p>a</p></td><td>b|c</td></tr><tr><td>1</td><td>2</td></tr></table>` +
+		`<p></p></body></html>`
+
+	out, err := markdown.FromHTML([]byte(in), func(href string) string {
+		if href == "https://docs.google.com/document/d/abc/edit" {
+			return "../abc/index.md"
+		}
+		return href
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "# Heading\n\n"+
+		"**bold** and *it\\_alic* [other doc](../abc/index.md) top\n\n"+
+		"- one\n- two\n  1. nested\n\n"+
+		"| a | b\\|c |\n| --- | --- |\n| 1 | 2 |\n", out)
+}
+
+func TestTable(t *testing.T) {
+	assert.Equal(t, "| item | cost |\n| --- | --- |\n| rent | 100 |\n| note |  |\n",
+		markdown.Table([][]string{{"item", "cost"}, {"rent", "100"}, {"note"}}))
+}
@@ -0,0 +1,151 @@
+// Package progress counts the work of each component of a run — items
+// discovered, processed and failed — and shows it while the run goes on,
+// as periodic log entries or a redrawn terminal line.
+package progress
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Modes accepted by Render
+const (
+	ModeTTY  = "tty"
+	ModeLog  = "log"
+	ModeNone = "none"
+)
+
+// ValidMode reports whether mode is one Render knows
+func ValidMode(mode string) bool {
+	return slices.Contains([]string{ModeTTY, ModeLog, ModeNone}, mode)
+}
+
+// Tracker holds the counters of one run. Components report into their own
+// named Counter, so steps running at the same time (a streamed upload next
+// to its crawl) don't mix their numbers.
+type Tracker struct {
+	mu       sync.Mutex
+	counters []*Counter
+}
+
+// New returns a tracker without counters
+func New() *Tracker {
+	return &Tracker{}
+}
+
+// For returns the counter of the named component, creating it on first use.
+// A nil tracker hands out nil counters.
+func (t *Tracker) For(component string) *Counter {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.counters {
+		if c.name == component {
+			return c
+		}
+	}
+	c := &Counter{name: component}
+	t.counters = append(t.counters, c)
+	return c
+}
+
+// Snapshot returns the state of every counter that has seen work, in the
+// order the components were registered
+func (t *Tracker) Snapshot() []Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []Snapshot
+	for _, c := range t.counters {
+		if s := c.snapshot(); s.Found > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Counter is one component's share of a Tracker. A nil Counter counts
+// nothing, so components work without progress reporting.
+type Counter struct {
+	name    string
+	started atomic.Int64
+	found   atomic.Int64
+	done    atomic.Int64
+	failed  atomic.Int64
+}
+
+// Found adds n items the component has discovered and will process
+func (c *Counter) Found(n int) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.started.CompareAndSwap(0, time.Now().UnixNano())
+	c.found.Add(int64(n))
+}
+
+// Done records an item processed successfully
+func (c *Counter) Done() {
+	if c != nil {
+		c.done.Add(1)
+	}
+}
+
+// Failed records an item that couldn't be processed
+func (c *Counter) Failed() {
+	if c != nil {
+		c.failed.Add(1)
+	}
+}
+
+func (c *Counter) snapshot() Snapshot {
+	s := Snapshot{
+		Component: c.name,
+		Found:     c.found.Load(),
+		Done:      c.done.Load(),
+		Failed:    c.failed.Load(),
+	}
+	if started := c.started.Load(); started != 0 {
+		s.Elapsed = time.Since(time.Unix(0, started))
+	}
+	return s
+}
+
+// Snapshot is a counter's state at one moment
+type Snapshot struct {
+	Component string
+	Found     int64
+	Done      int64
+	Failed    int64
+	Elapsed   time.Duration
+}
+
+// Remaining is the number of items found but not processed yet
+func (s Snapshot) Remaining() int64 {
+	return max(s.Found-s.Done-s.Failed, 0)
+}
+
+// ETA extrapolates the time left from the pace so far; it is 0 until the
+// first item is processed
+func (s Snapshot) ETA() time.Duration {
+	processed := s.Done + s.Failed
+	if processed == 0 {
+		return 0
+	}
+	return time.Duration(float64(s.Elapsed) / float64(processed) * float64(s.Remaining())).Round(time.Second)
+}
+
+// String renders the snapshot as "crawler 120/340 (2 failed) eta 1m30s"
+func (s Snapshot) String() string {
+	line := fmt.Sprintf("%s %d/%d", s.Component, s.Done+s.Failed, s.Found)
+	if s.Failed > 0 {
+		line += fmt.Sprintf(" (%d failed)", s.Failed)
+	}
+	if eta := s.ETA(); eta > 0 {
+		line += " eta " + eta.String()
+	}
+	return line
+}
@@ -0,0 +1,37 @@
+package progress_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerCountsPerComponent(t *testing.T) {
+	tr := progress.New()
+	crawler := tr.For("crawler")
+	crawler.Found(4)
+	crawler.Done()
+	crawler.Failed()
+	tr.For("uploader")
+
+	var none *progress.Counter
+	none.Found(1)
+	none.Done()
+
+	snaps := tr.Snapshot()
+	require.Len(t, snaps, 1, "components without work aren't shown")
+	assert.Same(t, crawler, tr.For("crawler"))
+	assert.Equal(t, "crawler", snaps[0].Component)
+	assert.EqualValues(t, 2, snaps[0].Remaining())
+}
+
+func TestStatusLine(t *testing.T) {
+	snaps := []progress.Snapshot{
+		{Component: "crawler", Found: 10, Done: 10, Elapsed: time.Minute},
+		{Component: "uploader", Found: 10, Done: 4, Failed: 1, Elapsed: 10 * time.Second},
+	}
+	assert.Equal(t, "crawler 10/10 · [==========          ] uploader 5/10 (1 failed) eta 10s", progress.StatusLine(snaps))
+}
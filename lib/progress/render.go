@@ -0,0 +1,110 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// logInterval and ttyInterval are how often each mode shows the counters
+const (
+	logInterval = 10 * time.Second
+	ttyInterval = 250 * time.Millisecond
+)
+
+// barWidth is the number of cells of the terminal progress bar
+const barWidth = 20
+
+// Render shows t's counters until the returned stop function is called:
+// ModeLog logs every counter that moved every 10 s, ModeTTY redraws one
+// status line on w, ModeNone shows nothing.
+func Render(ctx context.Context, t *Tracker, mode string, w io.Writer) (stop func()) {
+	if mode == ModeNone || mode == "" {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if mode == ModeTTY {
+			renderTTY(ctx, t, w)
+		} else {
+			renderLog(ctx, t)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// renderLog logs the counters that changed since the last tick
+func renderLog(ctx context.Context, t *Tracker) {
+	ticker := time.NewTicker(logInterval)
+	defer ticker.Stop()
+	last := make(map[string]Snapshot)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, s := range t.Snapshot() {
+			if prev, ok := last[s.Component]; ok && prev.Found == s.Found && prev.Done == s.Done && prev.Failed == s.Failed {
+				continue
+			}
+			last[s.Component] = s
+			slog.Info("progress",
+				slog.String("component", s.Component),
+				slog.Int64("found", s.Found),
+				slog.Int64("done", s.Done),
+				slog.Int64("failed", s.Failed),
+				slog.Int64("remaining", s.Remaining()),
+				slog.Duration("eta", s.ETA()))
+		}
+	}
+}
+
+// renderTTY redraws the status line in place and ends it with a newline
+func renderTTY(ctx context.Context, t *Tracker, w io.Writer) {
+	ticker := time.NewTicker(ttyInterval)
+	defer ticker.Stop()
+	for {
+		line := StatusLine(t.Snapshot())
+		fmt.Fprintf(w, "\r\033[K%s", line)
+		select {
+		case <-ctx.Done():
+			if line != "" {
+				fmt.Fprintln(w)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StatusLine renders snapshots as one terminal line, the last component
+// (the one currently working) with a bar
+func StatusLine(snaps []Snapshot) string {
+	parts := make([]string, len(snaps))
+	for i, s := range snaps {
+		parts[i] = s.String()
+		if i == len(snaps)-1 {
+			parts[i] = bar(s) + " " + parts[i]
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// bar draws the share of s's items processed, e.g. [=======             ]
+func bar(s Snapshot) string {
+	filled := 0
+	if s.Found > 0 {
+		filled = int(int64(barWidth) * (s.Done + s.Failed) / s.Found)
+	}
+	filled = min(filled, barWidth)
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "]"
+}
@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Tuning of the adaptive limiter: each rate-limit response halves the rate
+// (at most once per cooldown, since concurrent requests tend to fail
+// together), and every recoverAfter successes in a row give back a tenth of
+// the configured rate
+const (
+	decreaseFactor = 0.5
+	floorFraction  = 0.05
+	increaseStep   = 0.1
+	recoverAfter   = 50
+	cooldown       = time.Second
+)
+
+// Adaptive is a token bucket whose rate follows the responses Google sends:
+// it slows down when requests are rejected for exceeding the quota and
+// speeds back up to its configured maximum while they succeed
+type Adaptive struct {
+	limiter *rate.Limiter
+	max     float64
+	min     float64
+
+	mu           sync.Mutex
+	successes    int
+	lastDecrease time.Time
+	now          func() time.Time
+}
+
+// NewAdaptive returns an adaptive limiter starting at, and never exceeding,
+// maxQPS requests per second
+func NewAdaptive(maxQPS float64, burst int) *Adaptive {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Adaptive{
+		limiter: rate.NewLimiter(rate.Limit(maxQPS), burst),
+		max:     maxQPS,
+		min:     maxQPS * floorFraction,
+		now:     time.Now,
+	}
+}
+
+func (a *Adaptive) Wait(ctx context.Context) error {
+	return a.limiter.Wait(ctx)
+}
+
+// Rate returns the current requests per second
+func (a *Adaptive) Rate() float64 {
+	return float64(a.limiter.Limit())
+}
+
+// Throttled records a rate-limit response and slows down
+func (a *Adaptive) Throttled() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.successes = 0
+	now := a.now()
+	if now.Sub(a.lastDecrease) < cooldown {
+		return
+	}
+	a.lastDecrease = now
+
+	next := max(a.Rate()*decreaseFactor, a.min)
+	a.limiter.SetLimit(rate.Limit(next))
+	slog.Warn("API rate limited, slowing down", slog.Float64("qps", next))
+}
+
+// Succeeded records a successful response, speeding up after enough of them
+func (a *Adaptive) Succeeded() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.Rate() >= a.max {
+		return
+	}
+	a.successes++
+	if a.successes < recoverAfter {
+		return
+	}
+	a.successes = 0
+
+	next := min(a.Rate()+a.max*increaseStep, a.max)
+	a.limiter.SetLimit(rate.Limit(next))
+	slog.Debug("API rate recovering", slog.Float64("qps", next))
+}
+
+// Observe wraps rt so every response it carries is reported to a
+func (a *Adaptive) Observe(rt http.RoundTripper) http.RoundTripper {
+	return &observingTransport{base: rt, adaptive: a}
+}
+
+// observingTransport reports rate-limit responses to an Adaptive limiter
+type observingTransport struct {
+	base     http.RoundTripper
+	adaptive *Adaptive
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		t.adaptive.Throttled()
+	case resp.StatusCode == http.StatusForbidden:
+		// 403 also means a denied permission; only the quota reasons count
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		if readErr == nil && isRateLimitBody(body) {
+			t.adaptive.Throttled()
+		}
+	case resp.StatusCode < 400:
+		t.adaptive.Succeeded()
+	}
+	return resp, nil
+}
+
+// isRateLimitBody reports whether a 403 error body names a quota reason
+func isRateLimitBody(body []byte) bool {
+	for _, reason := range []string{"rateLimitExceeded", "userRateLimitExceeded", "RATE_LIMIT_EXCEEDED"} {
+		if bytes.Contains(body, []byte(reason)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveFollowsRateLimitResponses(t *testing.T) {
+	status, body := http.StatusOK, ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	a := ratelimit.NewAdaptive(10, 1)
+	client := &http.Client{Transport: a.Observe(http.DefaultTransport)}
+	get := func() string {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var b [64]byte
+		n, _ := resp.Body.Read(b[:])
+		return string(b[:n])
+	}
+
+	status = http.StatusTooManyRequests
+	get()
+	assert.Equal(t, 5.0, a.Rate())
+
+	// failures arriving together only count once
+	get()
+	assert.Equal(t, 5.0, a.Rate())
+
+	// a permission error isn't a rate limit, and its body is still readable
+	status, body = http.StatusForbidden, `{"error":{"errors":[{"reason":"insufficientPermissions"}]}}`
+	assert.Equal(t, body, get())
+	assert.Equal(t, 5.0, a.Rate())
+
+	status, body = http.StatusOK, ""
+	for range 50 {
+		get()
+	}
+	assert.Equal(t, 6.0, a.Rate())
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+)
+
+// Budget is the process-wide Google API budget. Every component calling a
+// Google API (in any step or concurrent pipeline) draws from the same token
+// bucket through its own named Limiter, so together they stay under the
+// per-user quota however many of them run at once.
+type Budget struct {
+	limiter Limiter
+	// Set when the rate adapts to rate-limit responses
+	adaptive *Adaptive
+
+	mu    sync.Mutex
+	usage map[string]int64
+}
+
+// NewBudget returns a budget of qps requests per second with the given
+// burst. A qps <= 0 disables limiting but still counts usage.
+func NewBudget(qps float64, burst int) *Budget {
+	return &Budget{
+		limiter: New(qps, burst),
+		usage:   make(map[string]int64),
+	}
+}
+
+// NewAdaptiveBudget returns a budget starting at qps requests per second
+// that slows down when Google answers with rate-limit errors, as seen
+// through Observe. A qps <= 0 has no rate to adapt and behaves like
+// NewBudget.
+func NewAdaptiveBudget(qps float64, burst int) *Budget {
+	if qps <= 0 {
+		return NewBudget(qps, burst)
+	}
+	a := NewAdaptive(qps, burst)
+	return &Budget{
+		limiter:  a,
+		adaptive: a,
+		usage:    make(map[string]int64),
+	}
+}
+
+// Observe wraps the transport API clients use so an adaptive budget sees
+// their responses; other budgets return rt unchanged
+func (b *Budget) Observe(rt http.RoundTripper) http.RoundTripper {
+	if b.adaptive == nil {
+		return rt
+	}
+	return b.adaptive.Observe(rt)
+}
+
+// For returns the limiter a component draws from. Components sharing a name
+// share a usage counter.
+func (b *Budget) For(component string) Limiter {
+	return &componentLimiter{budget: b, component: component}
+}
+
+// Usage returns the number of requests each component has made so far
+func (b *Budget) Usage() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return maps.Clone(b.usage)
+}
+
+// componentLimiter draws from a Budget on behalf of one component
+type componentLimiter struct {
+	budget    *Budget
+	component string
+}
+
+func (l *componentLimiter) Wait(ctx context.Context) error {
+	if err := l.budget.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	l.budget.mu.Lock()
+	l.budget.usage[l.component]++
+	l.budget.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,42 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetCountsUsagePerComponent(t *testing.T) {
+	b := ratelimit.NewBudget(0, 1)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"uploader", "patcher", "uploader"} {
+		l := b.For(name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				require.NoError(t, l.Wait(ctx))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int64{"uploader": 20, "patcher": 10}, b.Usage())
+}
+
+func TestBudgetStopsOnCancelledContext(t *testing.T) {
+	b := ratelimit.NewBudget(0.001, 1)
+	l := b.For("crawler")
+	require.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, l.Wait(ctx))
+	assert.Equal(t, int64(1), b.Usage()["crawler"])
+}
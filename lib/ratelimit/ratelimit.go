@@ -0,0 +1,30 @@
+package ratelimit
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter is the rate budget that Google-API-calling components draw from.
+// Every call site waits on it before issuing a request.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// New returns a token-bucket limiter allowing qps requests per second with the
+// given burst. A qps <= 0 disables limiting.
+func New(qps float64, burst int) Limiter {
+	if qps <= 0 {
+		return Unlimited()
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// Unlimited returns a limiter that never blocks
+func Unlimited() Limiter {
+	return rate.NewLimiter(rate.Inf, 0)
+}
@@ -0,0 +1,164 @@
+// Package retry is the retry policy shared by every step talking to Google:
+// which failures are retried, how often and how long to wait between tries.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Policy decides whether and when a failed call is tried again
+type Policy struct {
+	// MaxAttempts is the total number of tries, the first one included
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; it doubles every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two tries
+	MaxDelay time.Duration
+	// Codes are the HTTP status codes worth retrying
+	Codes []int
+}
+
+// DefaultCodes are the statuses Google answers transient failures with
+var DefaultCodes = []int{429, 500, 502, 503, 504}
+
+// Default returns the policy steps use unless configured otherwise
+func Default() Policy {
+	return Policy{
+		MaxAttempts: 6,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Codes:       DefaultCodes,
+	}
+}
+
+// StatusError is a failed HTTP response outside the Google API clients, so
+// plain HTTP fetches can be retried by status like API calls
+type StatusError struct {
+	URL    string
+	Code   int
+	Status string
+	// RetryAfter is how long the server asked to wait before trying again
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// ParseCodes parses a comma-separated list of HTTP status codes
+func ParseCodes(s string) ([]int, error) {
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid HTTP status code %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// Retryable reports whether err is a failure the policy retries
+func (p Policy) Retryable(err error) bool {
+	code := statusCode(err)
+	return code != 0 && slices.Contains(p.Codes, code)
+}
+
+// Do calls fn until it succeeds, fails with an error the policy doesn't
+// retry, or runs out of attempts. op names the call in logs.
+func (p Policy) Do(ctx context.Context, op string, fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || !p.Retryable(err) {
+			return err
+		}
+		if i+1 >= attempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+		}
+
+		delay := max(p.backoff(i), retryAfter(err))
+		slog.Info("retrying",
+			slog.String("op", op),
+			slog.Int("status", statusCode(err)),
+			slog.Int("attempt", i+1),
+			slog.Int("max_attempts", attempts),
+			slog.Duration("delay", delay))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the wait before retry i (0-based): exponential, capped at
+// MaxDelay, plus up to half again of jitter so clients don't retry in step
+func (p Policy) backoff(i int) time.Duration {
+	delay := p.BaseDelay << min(i, 30)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// ParseRetryAfter reads a Retry-After header, given in seconds or as an HTTP
+// date, as a wait from now. It is 0 when the header is missing or invalid.
+func ParseRetryAfter(h string, now time.Time) time.Duration {
+	h = strings.TrimSpace(h)
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// retryAfter is the wait a failed call's server asked for, or 0
+func retryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Header != nil {
+		return ParseRetryAfter(apiErr.Header.Get("Retry-After"), time.Now())
+	}
+	return 0
+}
+
+// statusCode extracts the HTTP status of a failed call, or 0
+func statusCode(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return 0
+}
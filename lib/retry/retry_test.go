@@ -0,0 +1,79 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/retry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestPolicyDo(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 3, Codes: []int{503}}
+	ctx := context.Background()
+
+	calls := 0
+	err := p.Do(ctx, "test", func() error {
+		calls++
+		if calls < 3 {
+			return &googleapi.Error{Code: 503}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.Do(ctx, "test", func() error {
+		calls++
+		return &retry.StatusError{URL: "https://docs.google.com/x", Code: 503, Status: "503 Service Unavailable"}
+	})
+	assert.ErrorContains(t, err, "failed after 3 attempts")
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	notFound := &googleapi.Error{Code: 404}
+	err = p.Do(ctx, "test", func() error {
+		calls++
+		return notFound
+	})
+	assert.True(t, errors.Is(err, notFound))
+	assert.Equal(t, 1, calls)
+}
+
+func TestParseCodes(t *testing.T) {
+	codes, err := retry.ParseCodes("429, 503,")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{429, 503}, codes)
+
+	_, err = retry.ParseCodes("429,abc")
+	assert.Error(t, err)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 7*time.Second, retry.ParseRetryAfter("7", now))
+	assert.Equal(t, 90*time.Second, retry.ParseRetryAfter("Fri, 01 Mar 2024 12:01:30 GMT", now))
+	assert.Zero(t, retry.ParseRetryAfter("Fri, 01 Mar 2024 11:00:00 GMT", now))
+	assert.Zero(t, retry.ParseRetryAfter("", now))
+	assert.Zero(t, retry.ParseRetryAfter("soon", now))
+}
+
+func TestPolicyDoWaitsRetryAfter(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 2, Codes: []int{429}}
+	start := time.Now()
+	calls := 0
+	err := p.Do(context.Background(), "test", func() error {
+		calls++
+		if calls == 1 {
+			return &retry.StatusError{Code: 429, Status: "429 Too Many Requests", RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
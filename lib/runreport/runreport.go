@@ -0,0 +1,97 @@
+// Package runreport writes report.json, a machine-readable summary of a
+// pipeline run: how each step went, its stats and how long it took.
+package runreport
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+)
+
+// File is the report written at the output root
+const File = "report.json"
+
+// Outcomes of a step or run
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Report is the content of File
+type Report struct {
+	RunID      string        `json:"run_id"`
+	Status     string        `json:"status"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	Steps      []Step        `json:"steps"`
+	Errors     []string      `json:"errors,omitempty"`
+}
+
+// Step is one step's part of the run
+type Step struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+	Stats    any           `json:"stats,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Recorder collects the events of a run and writes the report when it ends.
+// It implements pipeline.Notifier; a recorder is reused across the runs of
+// a recurring pipeline, each run replacing the previous report.
+type Recorder struct {
+	runID string
+	store storage.Storage
+
+	mu     sync.Mutex
+	report Report
+}
+
+// New returns a recorder writing the report of run runID to store
+func New(runID string, store storage.Storage) *Recorder {
+	return &Recorder{runID: runID, store: store}
+}
+
+// Notify implements pipeline.Notifier
+func (r *Recorder) Notify(ctx context.Context, ev pipeline.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev.Type {
+	case pipeline.EventStepStarted:
+		if r.report.StartedAt.IsZero() {
+			r.report = Report{RunID: r.runID, StartedAt: time.Now().UTC(), Steps: []Step{}}
+		}
+	case pipeline.EventStepCompleted:
+		r.report.Steps = append(r.report.Steps, Step{Name: ev.Step, Status: StatusCompleted, Duration: ev.Duration, Stats: ev.Stats})
+	case pipeline.EventStepFailed:
+		r.report.Steps = append(r.report.Steps, Step{Name: ev.Step, Status: StatusFailed, Duration: ev.Duration, Stats: ev.Stats, Error: ev.Error})
+	case pipeline.EventRunCompleted, pipeline.EventRunFailed:
+		r.report.Status = StatusCompleted
+		if ev.Type == pipeline.EventRunFailed {
+			r.report.Status = StatusFailed
+			r.report.Errors = append(r.report.Errors, ev.Error)
+		}
+		r.report.FinishedAt = time.Now().UTC()
+		r.report.Duration = ev.Duration
+		if err := r.write(ctx); err != nil {
+			slog.Warn("failed to write run report", slog.Any("error", err))
+		}
+		r.report = Report{}
+	}
+}
+
+// write saves the report; callers must hold r.mu
+func (r *Recorder) write(ctx context.Context) error {
+	data, err := json.MarshalIndent(r.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return r.store.WriteFile(ctx, File, data)
+}
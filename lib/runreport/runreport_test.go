@@ -0,0 +1,51 @@
+package runreport_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/runreport"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type step struct {
+	name  string
+	err   error
+	stats any
+}
+
+func (s step) Name() string                  { return s.name }
+func (s step) Run(ctx context.Context) error { return s.err }
+func (s step) Stats() any                    { return s.stats }
+
+func TestRecorderWritesReport(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+
+	pipe := pipeline.NewPipeline(
+		step{name: "crawler", stats: map[string]int{"docs": 3}},
+		step{name: "uploader", err: errors.New("quota exceeded")},
+		step{name: "patcher"},
+	)
+	pipe.AddNotifier(runreport.New("r1", store))
+	require.Error(t, pipe.RunFrom(ctx, 0))
+
+	data, err := store.ReadFile(ctx, runreport.File)
+	require.NoError(t, err)
+	var report runreport.Report
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.Equal(t, "r1", report.RunID)
+	assert.Equal(t, runreport.StatusFailed, report.Status)
+	require.Len(t, report.Steps, 2)
+	assert.Equal(t, runreport.StatusCompleted, report.Steps[0].Status)
+	assert.Equal(t, map[string]any{"docs": float64(3)}, report.Steps[0].Stats)
+	assert.Equal(t, "quota exceeded", report.Steps[1].Error)
+	require.Len(t, report.Errors, 1)
+	assert.Contains(t, report.Errors[0], "step uploader failed")
+}
@@ -0,0 +1,113 @@
+// Package runstate keeps pipeline_state.json, the steps of the output's
+// pipeline that have completed, so a re-run can resume at the first one
+// that hasn't.
+package runstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+)
+
+// File is the state written at the output root
+const File = "pipeline_state.json"
+
+// State is the content of File
+type State struct {
+	// Completed are the steps that completed since the first of them last
+	// started, in execution order
+	Completed []string  `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Load reads the state of store; a missing file is an empty state
+func Load(ctx context.Context, store storage.Storage) (State, error) {
+	var s State
+	data, err := store.ReadFile(ctx, File)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading %s: %w", File, err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("parsing %s: %w", File, err)
+	}
+	return s, nil
+}
+
+// Resume returns the index of the first of steps that hasn't completed, or 0
+// when none or all of them have
+func (s State) Resume(steps []string) int {
+	for i, name := range steps {
+		if !slices.Contains(s.Completed, name) {
+			return i
+		}
+	}
+	return 0
+}
+
+// Recorder keeps File up to date as the steps of a pipeline run. It
+// implements pipeline.Notifier. A step that starts drops itself and every
+// later step from the state, since their results no longer follow from the
+// earlier ones; once every step has completed the file is removed, so the
+// next run starts over.
+type Recorder struct {
+	store storage.Storage
+	steps []string
+
+	mu    sync.Mutex
+	state State
+}
+
+// New returns a recorder for a pipeline of steps, continuing from prev
+func New(store storage.Storage, steps []string, prev State) *Recorder {
+	return &Recorder{store: store, steps: steps, state: prev}
+}
+
+// Notify implements pipeline.Notifier
+func (r *Recorder) Notify(ctx context.Context, ev pipeline.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev.Type {
+	case pipeline.EventStepStarted:
+		idx := slices.Index(r.steps, ev.Step)
+		r.state.Completed = slices.DeleteFunc(r.state.Completed, func(name string) bool {
+			i := slices.Index(r.steps, name)
+			return i < 0 || i >= idx
+		})
+	case pipeline.EventStepCompleted:
+		r.state.Completed = append(r.state.Completed, ev.Step)
+	default:
+		return
+	}
+
+	if err := r.write(ctx); err != nil {
+		slog.Warn("failed to write pipeline state", slog.Any("error", err))
+	}
+}
+
+// write saves the state, or removes it once every step has completed;
+// callers must hold r.mu
+func (r *Recorder) write(ctx context.Context) error {
+	if len(r.state.Completed) == len(r.steps) {
+		r.state = State{}
+		return r.store.RemoveAll(ctx, File)
+	}
+	r.state.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return r.store.WriteFile(ctx, File, data)
+}
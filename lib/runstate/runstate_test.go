@@ -0,0 +1,68 @@
+package runstate_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/runstate"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type step struct {
+	name string
+	err  *error
+}
+
+func (s step) Name() string { return s.name }
+func (s step) Run(ctx context.Context) error {
+	if s.err != nil {
+		return *s.err
+	}
+	return nil
+}
+
+func TestRecorderResumesAtFirstIncompleteStep(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+
+	uploadErr := errors.New("quota exceeded")
+	names := []string{"crawler", "uploader", "patcher"}
+	run := func() error {
+		pipe := pipeline.NewPipeline(step{name: "crawler"}, step{name: "uploader", err: &uploadErr}, step{name: "patcher"})
+		state, err := runstate.Load(ctx, store)
+		require.NoError(t, err)
+		pipe.AddNotifier(runstate.New(store, pipe.Names(), state))
+		return pipe.RunFrom(ctx, state.Resume(pipe.Names()))
+	}
+
+	require.Error(t, run())
+	state, err := runstate.Load(ctx, store)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crawler"}, state.Completed)
+	assert.Equal(t, 1, state.Resume(names))
+
+	// the re-run starts at the uploader and, once everything completed,
+	// leaves no state behind
+	uploadErr = nil
+	require.NoError(t, run())
+	_, err = store.ReadFile(ctx, runstate.File)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestRecorderDropsLaterStepsWhenOneRestarts(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+
+	names := []string{"crawler", "uploader", "patcher"}
+	r := runstate.New(store, names, runstate.State{Completed: []string{"crawler", "uploader"}})
+	r.Notify(ctx, pipeline.Event{Type: pipeline.EventStepStarted, Step: "uploader"})
+
+	state, err := runstate.Load(ctx, store)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crawler"}, state.Completed)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	gcs "google.golang.org/api/storage/v1"
+)
+
+// GCS stores files as objects under a prefix of a Google Cloud Storage bucket
+type GCS struct {
+	svc    *gcs.Service
+	bucket string
+	prefix string
+}
+
+// NewGCS returns a store for gs://bucket/prefix
+func NewGCS(ctx context.Context, bucket, prefix string, opts ...option.ClientOption) (*GCS, error) {
+	svc, err := gcs.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Cloud Storage service: %w", err)
+	}
+	return &GCS{svc: svc, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (g *GCS) object(name string) string {
+	return path.Join(g.prefix, name)
+}
+
+func (g *GCS) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	resp, err := g.svc.Objects.Get(g.bucket, g.object(name)).Context(ctx).Download()
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("gs://%s/%s: %w", g.bucket, g.object(name), fs.ErrNotExist)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (g *GCS) WriteFile(ctx context.Context, name string, data []byte) error {
+	_, err := g.svc.Objects.Insert(g.bucket, &gcs.Object{Name: g.object(name)}).
+		Media(bytes.NewReader(data)).
+		Fields("name").
+		Context(ctx).
+		Do()
+	return err
+}
+
+func (g *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	full := g.object(prefix)
+	if full != "" {
+		full += "/"
+	}
+
+	var names []string
+	err := g.svc.Objects.List(g.bucket).
+		Prefix(full).
+		Fields("nextPageToken", "items(name)").
+		Pages(ctx, func(objs *gcs.Objects) error {
+			for _, o := range objs.Items {
+				rel := strings.TrimPrefix(o.Name, g.prefix)
+				names = append(names, strings.TrimPrefix(rel, "/"))
+			}
+			return nil
+		})
+	sort.Strings(names)
+	return names, err
+}
+
+func (g *GCS) RemoveAll(ctx context.Context, prefix string) error {
+	if g.prefix == "" && prefix == "" {
+		return ErrBucketRoot
+	}
+	names, err := g.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		names = append(names, prefix) // prefix may name a single file
+	}
+	for _, name := range names {
+		err := g.svc.Objects.Delete(g.bucket, g.object(name)).Context(ctx).Do()
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GCS) String() string {
+	return "gs://" + path.Join(g.bucket, g.prefix)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
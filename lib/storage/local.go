@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Local stores files under a directory on local disk
+type Local struct {
+	root string
+}
+
+// NewLocal returns a store rooted at dir
+func NewLocal(dir string) *Local {
+	return &Local{root: dir}
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(name))
+}
+
+func (l *Local) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(l.path(name))
+}
+
+// WriteFile writes atomically, so a crash never leaves a truncated file
+// behind for later steps to choke on
+func (l *Local) WriteFile(ctx context.Context, name string, data []byte) error {
+	return WriteAtomic(l.path(name), data)
+}
+
+// tmpPrefix starts the names of files still being written
+const tmpPrefix = ".tmp-"
+
+// WriteAtomic writes data to a temporary file next to path and renames it
+// into place once it is safely on disk
+func WriteAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(l.path(prefix), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// skip directories and the leftovers of interrupted writes
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	sort.Strings(names)
+	return names, err
+}
+
+func (l *Local) RemoveAll(ctx context.Context, prefix string) error {
+	return os.RemoveAll(l.path(prefix))
+}
+
+func (l *Local) String() string {
+	return l.root
+}
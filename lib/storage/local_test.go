@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewLocal(t.TempDir())
+
+	require.NoError(t, s.WriteFile(ctx, "id_map.json", []byte("{}")))
+	require.NoError(t, s.WriteFile(ctx, "a/metadata.json", []byte("{}")))
+	require.NoError(t, s.WriteFile(ctx, "a/b/content.html", []byte("<p>hi</p>")))
+
+	names, err := s.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b/content.html", "a/metadata.json", "id_map.json"}, names)
+
+	data, err := s.ReadFile(ctx, "a/b/content.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>hi</p>", string(data))
+
+	require.NoError(t, s.RemoveAll(ctx, "a"))
+	_, err = s.ReadFile(ctx, "a/metadata.json")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	names, err = s.List(ctx, "a")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestLocalListSkipsInterruptedWrites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := storage.NewLocal(dir)
+
+	require.NoError(t, s.WriteFile(ctx, "a/metadata.json", []byte(`{"title":"A"}`)))
+	// what a crash between write and rename leaves behind
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", ".tmp-123"), []byte(`{"tit`), 0o644))
+
+	names, err := s.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/metadata.json"}, names)
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores files as objects under a prefix of an S3 (or S3-compatible,
+// e.g. MinIO) bucket
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 returns a store for s3://bucket/prefix. Credentials come from the
+// usual AWS sources (environment, shared credentials file, instance role);
+// AWS_ENDPOINT_URL points it at an S3-compatible server such as MinIO.
+func NewS3(bucket, prefix string) (*S3, error) {
+	endpoint, secure := "s3.amazonaws.com", true
+	if raw := os.Getenv("AWS_ENDPOINT_URL"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL %q", raw)
+		}
+		endpoint, secure = u.Host, u.Scheme != "http"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure: secure,
+		Region: os.Getenv("AWS_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating S3 client: %w", err)
+	}
+	return &S3{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (s *S3) object(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *S3) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.object(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.mapErr(name, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, s.mapErr(name, err)
+	}
+	return data, nil
+}
+
+func (s *S3) WriteFile(ctx context.Context, name string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.object(name),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	full := s.object(prefix)
+	if full != "" {
+		full += "/"
+	}
+
+	var names []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: full, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		rel := strings.TrimPrefix(obj.Key, s.prefix)
+		names = append(names, strings.TrimPrefix(rel, "/"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *S3) RemoveAll(ctx context.Context, prefix string) error {
+	if s.prefix == "" && prefix == "" {
+		return ErrBucketRoot
+	}
+	names, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		names = append(names, prefix) // prefix may name a single file
+	}
+	for _, name := range names {
+		// deleting a missing key succeeds in S3
+		if err := s.client.RemoveObject(ctx, s.bucket, s.object(name), minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+// mapErr turns missing-key errors into fs.ErrNotExist
+func (s *S3) mapErr(name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("s3://%s/%s: %w", s.bucket, s.object(name), fs.ErrNotExist)
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+// Package storage abstracts where the pipeline keeps its output tree: a
+// local directory or an object store bucket. Files are addressed by
+// slash-separated names relative to the store's root.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/api/option"
+)
+
+// ErrBucketRoot is returned when removing everything from a store at the
+// root of a bucket, which would delete objects the pipeline never wrote
+var ErrBucketRoot = errors.New("refusing to remove every object of a bucket")
+
+// Storage holds the crawl output: one directory per document with its
+// content and metadata.json, plus run-level files such as id_map.json.
+// Reading a missing file returns an error wrapping fs.ErrNotExist.
+type Storage interface {
+	ReadFile(ctx context.Context, name string) ([]byte, error)
+	WriteFile(ctx context.Context, name string, data []byte) error
+	// List returns the names of every file under prefix ("" for all), sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	// RemoveAll deletes the file or every file under prefix ("" for all)
+	RemoveAll(ctx context.Context, prefix string) error
+	// String describes the location for logs
+	String() string
+}
+
+// Open returns the store for location: gs://bucket/prefix for Google Cloud
+// Storage, s3://bucket/prefix for S3 and S3-compatible servers, anything
+// else is a local directory. Object store locations need a prefix, since a
+// fresh crawl clears its output. The client options are used by the Cloud
+// Storage backend.
+func Open(ctx context.Context, location string, opts ...option.ClientOption) (Storage, error) {
+	scheme, rest, remote := strings.Cut(location, "://")
+	if !remote || !IsRemote(location) {
+		return NewLocal(location), nil
+	}
+
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid location %q: missing bucket", location)
+	}
+	if strings.Trim(prefix, "/") == "" {
+		return nil, fmt.Errorf("invalid location %q: missing prefix, such as %s://%s/gdocs", location, scheme, bucket)
+	}
+	if scheme == "s3" {
+		return NewS3(bucket, prefix)
+	}
+	return NewGCS(ctx, bucket, prefix, opts...)
+}
+
+// IsRemote reports whether location names an object store rather than a
+// local directory
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "gs://") || strings.HasPrefix(location, "s3://")
+}
+
+// Dir returns the directory part of a file name ("" at the root)
+func Dir(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
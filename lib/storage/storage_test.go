@@ -0,0 +1,38 @@
+package storage_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func TestOpenRequiresObjectStorePrefix(t *testing.T) {
+	for _, location := range []string{"s3://bucket", "gs://bucket", "gs://bucket/", "s3://bucket//"} {
+		_, err := storage.Open(context.Background(), location)
+		assert.ErrorContains(t, err, "missing prefix", location)
+	}
+	_, err := storage.Open(context.Background(), "gs://bucket/imports", option.WithoutAuthentication())
+	assert.NoError(t, err)
+}
+
+func TestRemoveAllRefusesBucketRoot(t *testing.T) {
+	ctx := context.Background()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	}))
+	defer api.Close()
+
+	gcs, err := storage.NewGCS(ctx, "bucket", "", option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	assert.ErrorIs(t, gcs.RemoveAll(ctx, ""), storage.ErrBucketRoot)
+
+	s3, err := storage.NewS3("bucket", "/")
+	require.NoError(t, err)
+	assert.ErrorIs(t, s3.RemoveAll(ctx, ""), storage.ErrBucketRoot)
+}
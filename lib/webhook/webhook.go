@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+// with the shared secret and prefixed with "sha256="
+const SignatureHeader = "X-Signature-256"
+
+// queueSize caps the deliveries waiting for a slow receiver; step events
+// past it are dropped
+const queueSize = 64
+
+// deliverTimeout bounds one delivery, retries included. Deliveries outlive
+// the run's context, so a cancelled run still reports run.failed.
+const deliverTimeout = time.Minute
+
+// Payload is the JSON body posted to every callback URL
+type Payload struct {
+	RunID     string    `json:"run_id"`
+	Timestamp time.Time `json:"timestamp"`
+	pipeline.Event
+}
+
+// Notifier posts signed pipeline events to the callback URLs of one run
+type Notifier struct {
+	runID      string
+	urls       []string
+	secret     []byte
+	httpClient *http.Client
+	attempts   int
+
+	// Guards queue and sent, which are replaced for every run
+	mu sync.Mutex
+	// Deliveries waiting for the sender goroutine; nil between runs
+	queue chan delivery
+	// Closed once the sender has delivered everything queued
+	sent chan struct{}
+}
+
+// delivery is one event to post to one callback URL
+type delivery struct {
+	ctx   context.Context
+	url   string
+	event string
+	body  []byte
+}
+
+// NewNotifier creates a notifier for the given run. An empty secret sends
+// unsigned payloads.
+func NewNotifier(runID string, urls []string, secret string) *Notifier {
+	return &Notifier{
+		runID:      runID,
+		urls:       urls,
+		secret:     []byte(secret),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		attempts:   3,
+	}
+}
+
+// Notify implements pipeline.Notifier. Events are queued for a background
+// sender, so a slow receiver doesn't hold up the steps; the run's final
+// event waits for everything queued to be delivered. Delivery failures are
+// logged, never returned, so a broken receiver can't fail the run.
+func (n *Notifier) Notify(ctx context.Context, ev pipeline.Event) {
+	if ev.Type == pipeline.EventStepStarted {
+		return // callbacks only care about outcomes
+	}
+
+	body, err := json.Marshal(Payload{
+		RunID:     n.runID,
+		Timestamp: time.Now().UTC(),
+		Event:     ev,
+	})
+	if err != nil {
+		slog.Warn("failed to marshal webhook payload", slog.Any("error", err))
+		return
+	}
+
+	final := ev.Type == pipeline.EventRunCompleted || ev.Type == pipeline.EventRunFailed
+	ctx = context.WithoutCancel(ctx)
+
+	n.mu.Lock()
+	if n.queue == nil {
+		n.queue = make(chan delivery, queueSize)
+		n.sent = make(chan struct{})
+		go n.send(n.queue, n.sent)
+	}
+	for _, u := range n.urls {
+		d := delivery{ctx: ctx, url: u, event: ev.Type, body: body}
+		if final {
+			n.queue <- d
+			continue
+		}
+		select {
+		case n.queue <- d:
+		default:
+			slog.Warn("webhook queue full, dropping event",
+				slog.String("url", u),
+				slog.String("event", ev.Type))
+		}
+	}
+	if !final {
+		n.mu.Unlock()
+		return
+	}
+	queue, sent := n.queue, n.sent
+	n.queue, n.sent = nil, nil
+	n.mu.Unlock()
+
+	close(queue)
+	<-sent
+}
+
+// send delivers the queued events in order until the queue is closed
+func (n *Notifier) send(queue <-chan delivery, sent chan<- struct{}) {
+	defer close(sent)
+	for d := range queue {
+		ctx, cancel := context.WithTimeout(d.ctx, deliverTimeout)
+		err := n.deliver(ctx, d.url, d.event, d.body)
+		cancel()
+		if err != nil {
+			slog.Warn("webhook delivery failed",
+				slog.String("url", d.url),
+				slog.String("event", d.event),
+				slog.Any("error", err))
+		}
+	}
+}
+
+// deliver posts body to url, retrying with a linear backoff on network
+// errors and 5xx responses
+func (n *Notifier) deliver(ctx context.Context, url, event string, body []byte) error {
+	var lastErr error
+	for i := 0; i < n.attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(i) * time.Second):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Event", event)
+		if len(n.secret) > 0 {
+			req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, body))
+		}
+
+		resp, err := n.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("POST %s: %s", url, resp.Status)
+		if resp.StatusCode < 500 {
+			return lastErr // the receiver rejected it, retrying won't help
+		}
+	}
+	return lastErr
+}
+
+// JobSecret derives the secret one run's payloads are signed with from the
+// server's secret, so the receivers of one run can't forge another's events
+func JobSecret(secret, runID string) string {
+	if secret == "" {
+		return ""
+	}
+	return Sign([]byte(secret), []byte(runID))
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with secret, so receivers
+// can verify the signature header
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package webhook_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/webhook"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// request is a delivery a receiver got
+type request struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// receiver answers deliveries with the given statuses in turn, then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []request
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, request{
+		event:     req.Header.Get("X-Webhook-Event"),
+		signature: req.Header.Get(webhook.SignatureHeader),
+		body:      body,
+	})
+	if len(r.statuses) > 0 {
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func (r *receiver) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []string
+	for _, g := range r.got {
+		events = append(events, g.event)
+	}
+	return events
+}
+
+func TestPayloadsAreSignedWithTheSecret(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	n := webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret")
+	n.Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	require.Len(t, rcv.got, 1)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(rcv.got[0].body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), rcv.got[0].signature)
+
+	var p webhook.Payload
+	require.NoError(t, json.Unmarshal(rcv.got[0].body, &p))
+	assert.Equal(t, "run-1", p.RunID)
+	assert.Equal(t, pipeline.EventRunCompleted, p.Type)
+}
+
+func TestUnsignedWithoutSecret(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	webhook.NewNotifier("run-1", []string{srv.URL}, "").
+		Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	require.Len(t, rcv.got, 1)
+	assert.Empty(t, rcv.got[0].signature)
+}
+
+func TestStepStartedIsNotDelivered(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	n := webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret")
+	ctx := context.Background()
+	n.Notify(ctx, pipeline.Event{Type: pipeline.EventStepStarted, Step: "crawler"})
+	n.Notify(ctx, pipeline.Event{Type: pipeline.EventStepCompleted, Step: "crawler"})
+	n.Notify(ctx, pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	assert.Equal(t, []string{pipeline.EventStepCompleted, pipeline.EventRunCompleted}, rcv.events())
+}
+
+func TestServerErrorsAreRetried(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret").
+		Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	assert.Equal(t, []string{pipeline.EventRunCompleted, pipeline.EventRunCompleted}, rcv.events())
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusBadRequest, http.StatusBadRequest}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret").
+		Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	assert.Equal(t, []string{pipeline.EventRunCompleted}, rcv.events())
+}
+
+func TestCancelledRunStillReportsFailure(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret").
+		Notify(ctx, pipeline.Event{Type: pipeline.EventRunFailed, Error: "context canceled"})
+
+	assert.Equal(t, []string{pipeline.EventRunFailed}, rcv.events())
+}
+
+func TestNotifierIsReusedAcrossRuns(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	// scheduled runs share one notifier
+	n := webhook.NewNotifier("run-1", []string{srv.URL}, "s3cret")
+	n.Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunFailed})
+	n.Notify(context.Background(), pipeline.Event{Type: pipeline.EventRunCompleted})
+
+	assert.Equal(t, []string{pipeline.EventRunFailed, pipeline.EventRunCompleted}, rcv.events())
+}
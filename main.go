@@ -2,114 +2,894 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/rasha-hantash/gdoc-pipeline/lib/config"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gapi"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/httptransport"
 	"github.com/rasha-hantash/gdoc-pipeline/lib/logger"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/retry"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/runreport"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/runstate"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/webhook"
 	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/rasha-hantash/gdoc-pipeline/server"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/archive"
 	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
-	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/gitmirror"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/importer"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/index"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/linkcheck"
 	"github.com/rasha-hantash/gdoc-pipeline/steps/patcher"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/planner"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/stream"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/verifier"
+	"github.com/rasha-hantash/gdoc-pipeline/watcher"
+	"github.com/robfig/cron/v3"
 
-	"google.golang.org/api/docs/v1"
-	"google.golang.org/api/option"
-	"google.golang.org/api/sheets/v4"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/forms/v1"
 )
 
+// runConfig holds the per-run settings needed to build a pipeline
+type runConfig struct {
+	url         string
+	out         string
+	depth       int
+	projectID   string
+	driveFolder string
+	// subfolder names each run's own folder inside driveFolder
+	subfolder string
+	runID     string
+	// duplicates is the uploader's policy for documents already in the folder
+	duplicates string
+	// sheetLocale and sheetTimeZone are applied to converted sheets
+	sheetLocale   string
+	sheetTimeZone string
+	// shares are granted on the top-level Drive folder
+	shares []uploader.Share
+	// copyPermissions grants each copy the permissions of its source
+	copyPermissions bool
+	// uploadClean uploads docs cleaned of the export's styling
+	uploadClean bool
+	// rewriteLinks points links at already-uploaded copies before upload
+	rewriteLinks bool
+	// leavesFirst uploads documents after the documents they link to
+	leavesFirst bool
+	// imageAssets re-uploads doc images to Drive before uploading the docs
+	imageAssets bool
+	// publicImages shares re-hosted images with anyone holding the link
+	publicImages bool
+	// chunkSizeMB is the piece size, in MiB, of resumable uploads
+	chunkSizeMB int
+	// redirectIndex maintains a Doc mapping original URLs to their copies
+	redirectIndex bool
+	// verify adds a step failing the run when patched docs still link to sources
+	verify bool
+	// checkLinks adds a final step checking every link of the uploaded docs
+	checkLinks bool
+	// plan crawls and estimates the upload and patch instead of running them
+	plan bool
+	// seedFolder is a Drive folder whose documents seed the crawl instead of url
+	seedFolder string
+	// seeds are more depth-0 URLs crawled next to url, from the -config file
+	seeds []string
+	// manifest replaces the crawl with pre-downloaded documents it
+	// describes (empty = crawl -url)
+	manifest string
+	// gitRepo is a repository each run's output is committed to as
+	// Markdown (empty = off), under gitPath; gitPush names a remote to push to
+	gitRepo string
+	gitPath string
+	gitPush string
+	// archive crawls and stitches the output into one EPUB or PDF instead of
+	// uploading it (empty = off)
+	archive string
+	// apiQPS is the shared API budget, which plans are estimated against
+	apiQPS float64
+	// apiBurst is how many requests the budget lets through at once
+	apiBurst int
+	// patchDelay is an extra pause of the patcher after each doc
+	patchDelay time.Duration
+	// patchWorkers is the number of docs patched concurrently
+	patchWorkers int
+
+	// store holds the output tree; nil means the local directory out
+	store storage.Storage
+
+	// transport is the HTTP transport shared by every component, and
+	// clients the Google API services built once over it for every step
+	transport http.RoundTripper
+	clients   *gapi.Clients
+	// compression requests gzip-compressed responses, exports included
+	compression bool
+	// progress counts the work of a single run's steps; nil counts nothing
+	progress *progress.Tracker
+	// failures collects the items each step gave up on; nil records nothing
+	failures *failures.Log
+	// index rebuilds index.db from the output when a run ends
+	index bool
+	// retryUploads and retryPatches limit the uploader and patcher to the
+	// directories the previous run failed on, for -retry-failed
+	retryUploads []string
+	retryPatches []string
+	// retryPolicy governs retries of fetches, uploads and patches alike
+	retryPolicy retry.Policy
+
+	// frontier is shared with other crawler processes in distributed mode
+	frontier crawler.Frontier
+	// formsSvc is set when linked forms' response sheets should be crawled
+	formsSvc *forms.Service
+	// driveSvc looks up owners of documents the crawler can't read
+	driveSvc *drive.Service
+	// revisions saves each document's revision listing
+	revisions bool
+	// charts saves fresh renders of embedded Sheets charts
+	charts bool
+	// images downloads doc images to <doc>/assets at crawl time
+	images bool
+	// sheetTabs saves every worksheet of a sheet as its own CSV
+	sheetTabs bool
+	// suggestions picks how docs show pending suggestions; empty keeps the export
+	suggestions string
+
+	// cacheDir keeps exports across runs (empty = no cache)
+	cacheDir string
+	// frontierSpill is the queue size past which the crawler spills to disk
+	frontierSpill int
+	// stream uploads documents while crawling, buffering this many (0 = off)
+	stream int
+	// contentNames are the content file templates by document type
+	contentNames map[string]string
+	// formats are the export formats by document type that differ from
+	// the default
+	formats map[string]string
+	// csvDelimiter separates the fields of saved sheets
+	csvDelimiter rune
+	// cleanHTML saves a copy of each doc without the export's styling
+	cleanHTML bool
+	// markdown saves a Markdown conversion of each doc
+	markdown bool
+	// owners limits the crawl to documents of these emails or domains
+	owners []string
+	// include and exclude limit the crawl to linked documents whose URL, ID
+	// or title matches
+	include []crawler.Pattern
+	exclude []crawler.Pattern
+	// allowDomains limits the crawl to linked documents owned by or shared
+	// within these Workspace domains
+	allowDomains []string
+	// sharingAudit reports every discovered document's sharing state
+	sharingAudit bool
+	// resume continues an interrupted crawl from its checkpoint
+	resume bool
+	// incremental keeps the previous output and only processes documents
+	// changed since
+	incremental bool
+	// dryRun reports what the upload and patch would do instead of doing it
+	dryRun bool
+	// userAuth fetches exports as the user the clients are authorized as,
+	// so their private documents can be crawled
+	userAuth bool
+
+	// maxElements marks docs the patcher treats as oversized (0 = no limit)
+	maxElements int
+	oversized   string
+	// copyOnDenied patches a copy of docs the patcher can't edit
+	copyOnDenied bool
+}
+
+// stepSet is one crawler/uploader/patcher trio sharing a run configuration
+type stepSet struct {
+	crawler  *crawler.Crawler
+	uploader *uploader.Uploader
+	patcher  *patcher.Patcher
+	// verifier and checker are nil unless enabled
+	verifier *verifier.Verifier
+	checker  *linkcheck.Checker
+	// mirror commits the crawl to a Git repository when set
+	mirror *gitmirror.Mirror
+	// importer replaces the crawler when set
+	importer *importer.Importer
+	// stream replaces the crawler and uploader steps when set
+	stream *stream.Step
+	// planner replaces every step after the crawler when set
+	planner *planner.Planner
+	// exporter replaces every step after the crawler when set
+	exporter *archive.Exporter
+}
+
+// pipeline returns the steps in execution order
+func (s *stepSet) pipeline() *pipeline.Pipeline {
+	var first pipeline.Step = s.crawler
+	if s.importer != nil {
+		first = s.importer
+	}
+	if s.stream != nil {
+		first = s.stream
+	}
+	steps := []pipeline.Step{first}
+	if s.mirror != nil {
+		steps = append(steps, s.mirror)
+	}
+	switch {
+	case s.planner != nil:
+		return pipeline.NewPipeline(append(steps, s.planner)...)
+	case s.exporter != nil:
+		return pipeline.NewPipeline(append(steps, s.exporter)...)
+	case s.stream != nil:
+		steps = append(steps, s.patcher)
+	default:
+		steps = append(steps, s.uploader, s.patcher)
+	}
+	if s.verifier != nil {
+		steps = append(steps, s.verifier)
+	}
+	if s.checker != nil {
+		steps = append(steps, s.checker)
+	}
+	return pipeline.NewPipeline(steps...)
+}
+
 // -----------------------------------------------------------------------------
 // CLI entry‑point
 // -----------------------------------------------------------------------------
 
+// exitPartialFailure is the exit code of a run that completed but failed to
+// upload or patch some documents, listed in errors.json
+const exitPartialFailure = 2
+
 func main() {
 	var (
-		url         string
-		out         string
-		depth       int
-		retry       string
-		projectID   string
-		driveFolder string
-		// timeout     time.Duration
+		cfg         runConfig
+		retryStep   string
+		untilStep   string
+		retryFailed bool
+		schedule    string
+		watch       bool
+		watchEvery  time.Duration
+		serveAddr   string
+		queueSize   int
+		workers     int
+		tenantJobs  int
+		adaptiveQPS bool
+		webhooks    string
+		hookSecret  string
+		hookHosts   string
+		shareSpec   string
+		contentName string
+		csvDelim    string
+		docFormat   string
+		sheetFormat string
+		retryCodes  string
+		ownersSpec  string
+		includeSpec string
+		excludeSpec string
+		domainsSpec string
+		pprofAddr   string
+		dbPath      string
+		frontierDB  string
+		workerID    string
+		followForm  bool
+		oauthClient string
+		oauthToken  string
+		credentials string
+		progressArg string
+		impersonate string
+		timeout     time.Duration
+		stepTimeout string
+		configPath  string
 	)
 
-	flag.StringVar(&url, "url", "", "root Google Doc URL to crawl")
-	flag.StringVar(&out, "out", "./out", "output directory")
-	flag.IntVar(&depth, "depth", 5, "crawl depth")
-	flag.StringVar(&retry, "retry", "", "name of the step to retry (crawler|uploader|patcher)")
-	// flag.DurationVar(&timeout, "timeout", 60*time.Minute, "overall pipeline timeout (0 = none)")
-	flag.StringVar(&projectID, "project", "", "GCP quota-project (optional)")
-	flag.StringVar(&driveFolder, "folder", "Imported Docs", "Drive folder (created if absent)")
+	flag.StringVar(&configPath, "config", "", "YAML or JSON file setting flags by name, more seed URLs and per-step overrides; command-line flags take precedence")
+	flag.StringVar(&cfg.url, "url", "", "root Google Doc URL to crawl")
+	flag.StringVar(&cfg.out, "out", "./out", "output directory, or gs://bucket/prefix or s3://bucket/prefix")
+	flag.IntVar(&cfg.depth, "depth", 5, "crawl depth")
+	flag.StringVar(&retryStep, "from", "", "name of the step to start at (crawler|uploader|patcher|…); default resumes after the steps pipeline_state.json records as completed")
+	flag.StringVar(&retryStep, "retry", "", "alias of -from")
+	flag.StringVar(&untilStep, "until", "", "name of the last step to run (default: every step)")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "only upload and patch again the documents errors.json lists as failed by the previous run")
+	flag.DurationVar(&timeout, "timeout", 0, "fail a pipeline run that takes longer than this (0 = none)")
+	flag.StringVar(&stepTimeout, "step-timeout", "", "fail a step that takes longer than its limit, as comma-separated step=duration pairs, e.g. crawler=30m,uploader=2h")
+	flag.StringVar(&cfg.projectID, "project", "", "GCP quota-project (optional)")
+	flag.StringVar(&oauthClient, "oauth-client", "", "OAuth client secret JSON of a desktop app: authorize as yourself in the browser and crawl the private documents you can open (empty = application default credentials)")
+	flag.StringVar(&oauthToken, "oauth-token", gapi.DefaultTokenFile(), "where -oauth-client caches the authorized token")
+	flag.StringVar(&credentials, "credentials", "", "service account JSON key to authenticate with instead of the application default credentials")
+	flag.StringVar(&impersonate, "impersonate", "", "with -credentials, act as this Workspace user through domain-wide delegation, e.g. admin@example.com")
+	flag.StringVar(&cfg.driveFolder, "folder", "Imported Docs", `Drive folder, or a path of nested folders like Migrations/2024/Q3 (created if absent); a template may use {root-title}, {root-id}, {date}, {time} and {runID}, e.g. "{root-title} import {date}"`)
+	flag.StringVar(&cfg.subfolder, "subfolder", "", `per-run subfolder of -folder, e.g. "{date}-{runID}" (same fields as -folder)`)
+	flag.StringVar(&cfg.duplicates, "duplicates", uploader.DuplicateCreate, "uploader: what to do when a copy already exists (create|skip|replace|version)")
+	flag.StringVar(&cfg.duplicates, "on-existing", uploader.DuplicateCreate, "alias of -duplicates; also accepts update (replace) and duplicate (create)")
+	flag.StringVar(&cfg.sheetLocale, "sheet-locale", "", `uploader: locale converted sheets parse dates and numbers with, e.g. "de_DE"`)
+	flag.StringVar(&cfg.sheetTimeZone, "sheet-timezone", "", `uploader: time zone of converted sheets, e.g. "Europe/Berlin"`)
+	flag.StringVar(&shareSpec, "share", "", "comma-separated permissions for the Drive folder: anyone:<role> or domain:<domain>:<role> (reader|commenter)")
+	flag.BoolVar(&cfg.copyPermissions, "copy-permissions", false, "grant each new copy the permissions of its source document, when the credentials can read them")
+	flag.IntVar(&cfg.chunkSizeMB, "upload-chunk-size", uploader.DefaultChunkSize>>20, "uploader: MiB per piece of resumable uploads; larger files are sent in pieces retried one by one")
+	flag.BoolVar(&cfg.imageAssets, "upload-images", false, "uploader: re-host doc images in Drive so they outlive googleusercontent URLs")
+	flag.BoolVar(&cfg.redirectIndex, "redirect-index", false, `uploader: keep a "Redirect index" Doc listing each original URL and its copy`)
+	flag.BoolVar(&cfg.verify, "verify", false, "after patching, fail if any uploaded doc still links to a source document (writes patch_verification.json)")
+	flag.BoolVar(&cfg.dryRun, "dry-run", false, "crawl, then list the Drive folders and files the uploader would create and the batch updates the patcher would send in dry_run.json, without changing Drive")
+	flag.BoolVar(&cfg.plan, "plan", false, "crawl, then write plan.json estimating the documents, bytes, API calls and time the upload and patch would take, without touching Drive")
+	flag.StringVar(&cfg.seedFolder, "folder-id", "", "crawl every doc and sheet in this Drive folder and its subfolders instead of -url (a folder link as -url works too)")
+	flag.StringVar(&cfg.manifest, "manifest", "", "upload pre-downloaded documents described by this manifest instead of crawling -url")
+	flag.StringVar(&cfg.gitRepo, "git-repo", "", "commit each run's output, converted to Markdown, to this Git repository (created if absent)")
+	flag.StringVar(&cfg.gitPath, "git-path", gitmirror.DefaultPath, "directory of -git-repo the documents are mirrored to; replaced on every run")
+	flag.StringVar(&cfg.gitPush, "git-push", "", "push -git-repo commits to this remote, e.g. origin (empty = don't push)")
+	flag.StringVar(&cfg.archive, "archive", "", "crawl, then stitch the documents into a single archive.epub or archive.pdf with a table of contents instead of uploading them (epub|pdf)")
+	flag.BoolVar(&cfg.checkLinks, "check-links", false, "after patching, check every link of the uploaded docs and write link_report.json")
+	flag.StringVar(&schedule, "schedule", "", `cron expression for recurring runs, e.g. "0 2 * * *" (empty = run once); runs are incremental unless -incremental=false`)
+	flag.StringVar(&progressArg, "progress", progress.ModeLog, "show how far the run is: log (a progress entry every 10s), tty (a redrawn status line) or none")
+	flag.BoolVar(&watch, "watch", false, "keep running and re-sync documents that change at the source")
+	flag.DurationVar(&watchEvery, "watch-interval", 5*time.Minute, "how often -watch polls the Drive changes feed")
+	flag.StringVar(&pprofAddr, "pprof-addr", "", "serve net/http/pprof profiles on this address, e.g. localhost:6060 (empty = off)")
+	flag.StringVar(&serveAddr, "serve", "", "run as an HTTP job server on this address, e.g. :8080")
+	flag.IntVar(&queueSize, "queue-size", 100, "server mode: maximum number of pending jobs")
+	flag.IntVar(&workers, "workers", 4, "server mode: number of jobs run concurrently")
+	flag.IntVar(&tenantJobs, "tenant-concurrency", 1, "server mode: maximum running jobs per tenant")
+	flag.StringVar(&hookHosts, "callback-hosts", "", "server mode: comma-separated hosts job callbacks may be sent to (empty = callbacks refused); needs -webhook-secret")
+	flag.Float64Var(&cfg.apiQPS, "api-qps", 10, "Google requests per second, exports and API calls alike, shared by every step and, in server mode, every job (0 = unlimited)")
+	flag.IntVar(&cfg.apiBurst, "api-burst", 1, "requests -api-qps lets through at once after a quiet spell")
+	flag.IntVar(&cfg.patchWorkers, "patch-workers", 4, "patcher: docs patched concurrently, all drawing from -api-qps")
+	flag.DurationVar(&cfg.patchDelay, "patch-delay", 0, "patcher: extra pause after each patched doc, on top of -api-qps")
+	flag.BoolVar(&adaptiveQPS, "adaptive-qps", false, "slow the API budget down on rate-limit errors and speed it back up to -api-qps as requests succeed")
+	flag.StringVar(&dbPath, "db", "./out/runs.db", "server mode: run history database")
+	flag.IntVar(&cfg.stream, "stream", 0, "upload documents while the crawl runs, buffering up to N saved documents (0 = upload after the crawl)")
+	flag.IntVar(&cfg.frontierSpill, "frontier-spill", 100000, "crawl queue and document entries kept in memory before spilling to a temporary SQLite file (0 = never)")
+	flag.StringVar(&frontierDB, "frontier", "", "shared SQLite frontier for distributed crawling; only the crawler step runs")
+	flag.StringVar(&workerID, "worker-id", defaultWorkerID(), "name identifying this crawler in a distributed crawl")
+	flag.BoolVar(&cfg.revisions, "revisions", false, "save each document's revision history (who, when) to revisions.json")
+	flag.BoolVar(&cfg.charts, "charts", false, "save embedded Sheets charts as PNGs under <doc>/assets")
+	flag.BoolVar(&cfg.sheetTabs, "sheet-tabs", false, "also save every worksheet of a sheet as tab-<name>.csv (the export only holds the first)")
+	flag.BoolVar(&cfg.publicImages, "public-images", false, "share images re-hosted by -upload-images with anyone holding the link, so Docs can fetch them on import; images of restricted docs become public")
+	flag.BoolVar(&cfg.images, "download-images", false, "save doc images under <doc>/assets while crawling and re-host them in Drive on upload (implies -upload-images)")
+	flag.StringVar(&cfg.suggestions, "suggestions", "", "render docs via the Docs API with suggestions accepted|rejected|preserved (empty = anonymous export)")
+	flag.StringVar(&cfg.cacheDir, "cache-dir", "", "reuse exports of unchanged documents across runs from this directory")
+	flag.BoolVar(&cfg.compression, "http-compression", true, "request compressed responses from Google (turn off to save CPU on fast links)")
+	flag.BoolVar(&cfg.cleanHTML, "clean-html", false, "also save each doc without the export's classes and inline CSS as content.clean.html")
+	flag.BoolVar(&cfg.rewriteLinks, "rewrite-links", false, "point each doc's links at the copies already uploaded before Drive converts it, leaving the patcher only links to docs uploaded later")
+	flag.BoolVar(&cfg.leavesFirst, "leaves-first", false, "upload documents after the documents they link to, so with -rewrite-links only link cycles are left to patch")
+	flag.BoolVar(&cfg.uploadClean, "upload-clean-html", false, "upload docs cleaned of the export's inline CSS, span soup, redirector links and empty headings, so they convert faithfully")
+	flag.BoolVar(&cfg.markdown, "markdown", false, "also save each doc converted to Markdown as content.md")
+	cfg.retryPolicy = retry.Default()
+	flag.IntVar(&cfg.retryPolicy.MaxAttempts, "retry-attempts", cfg.retryPolicy.MaxAttempts, "tries of a fetch, upload or patch failing with a retryable status, the first included")
+	flag.DurationVar(&cfg.retryPolicy.BaseDelay, "retry-base-delay", cfg.retryPolicy.BaseDelay, "wait before the first retry; doubles on every further retry")
+	flag.DurationVar(&cfg.retryPolicy.MaxDelay, "retry-max-delay", cfg.retryPolicy.MaxDelay, "longest wait between two tries")
+	flag.StringVar(&retryCodes, "retry-codes", "429,500,502,503,504", "HTTP status codes that are retried")
+	flag.BoolVar(&cfg.incremental, "incremental", false, "keep the previous run's output and only download, upload and patch documents new or modified since (by Drive modifiedTime, else content hash)")
+	flag.BoolVar(&cfg.resume, "resume", false, "continue an interrupted crawl from crawl_state.json instead of wiping -out and starting over")
+	flag.BoolVar(&cfg.sharingAudit, "sharing-audit", false, "write sharing_report.json: whether each discovered document is public, domain-shared or restricted, and its external collaborators")
+	flag.StringVar(&ownersSpec, "owners", "", "only crawl documents owned by these comma-separated emails or domains, listing the rest in skipped_documents.json")
+	flag.StringVar(&includeSpec, "include-pattern", "", "only crawl linked documents whose URL, ID or title matches one of these comma-separated globs or /regexps/, listing the rest in skipped_documents.json")
+	flag.StringVar(&excludeSpec, "exclude-pattern", "", "don't crawl linked documents whose URL, ID or title matches one of these comma-separated globs or /regexps/")
+	flag.StringVar(&domainsSpec, "allow-domains", "", "only follow links to documents owned by or shared within these comma-separated Workspace domains, listing the rest in skipped_external.json")
+	flag.StringVar(&csvDelim, "csv-delimiter", ",", `field separator of saved sheets, e.g. ";" or "tab" (exports are converted to UTF-8 either way)`)
+	flag.StringVar(&docFormat, "doc-format", "html", "export format of docs: html|docx|pdf|txt|md (non-HTML docs also keep their HTML export for links)")
+	flag.StringVar(&sheetFormat, "sheet-format", "csv", "export format of sheets: csv|xlsx|ods")
+	flag.StringVar(&contentName, "content-name", "", `content file template, e.g. "{slug}.{ext}", or per type "doc=...,sheet=..." (default "content.{ext}")`)
+	flag.IntVar(&cfg.maxElements, "max-elements", 0, "patcher: element count above which a doc is oversized (0 = no limit)")
+	flag.StringVar(&cfg.oversized, "oversized", patcher.OversizedChunk, "patcher: what to do with oversized docs (chunk|flag)")
+	flag.BoolVar(&cfg.copyOnDenied, "copy-on-denied", false, "patcher: copy docs it can't edit, patch the copy and update id_map.json")
+	flag.BoolVar(&followForm, "follow-forms", false, "also crawl the response spreadsheets of linked Google Forms")
+	flag.BoolVar(&cfg.index, "index", false, "write index.db, a SQLite index of the output, when a run ends")
+	flag.StringVar(&webhooks, "webhook", "", "comma-separated callback URLs notified when steps and the run finish")
+	flag.StringVar(&hookSecret, "webhook-secret", os.Getenv("GDOC_WEBHOOK_SECRET"), "HMAC secret used to sign webhook payloads")
 	flag.Parse()
 
-	if url == "" {
+	configTimeouts := map[string]time.Duration{}
+	if configPath != "" {
+		file, err := config.Load(configPath)
+		if err != nil {
+			slog.Error("failed to load -config", slog.Any("error", err))
+			os.Exit(1)
+		}
+		if err := file.Apply(flag.CommandLine); err != nil {
+			slog.Error("invalid -config", slog.String("path", configPath), slog.Any("error", err))
+			os.Exit(1)
+		}
+		cfg.seeds = file.URLs
+		configTimeouts = file.StepTimeouts()
+	}
+	if cfg.url == "" && len(cfg.seeds) > 0 {
+		cfg.url, cfg.seeds = cfg.seeds[0], cfg.seeds[1:]
+	}
+
+	if cfg.url == "" && cfg.seedFolder == "" && cfg.manifest == "" && serveAddr == "" {
 		slog.Error("url flag is required")
 		os.Exit(1)
 	}
 
-	ctx := context.Background()
+	if credentials != "" && oauthClient != "" {
+		slog.Error("-credentials and -oauth-client cannot be combined")
+		os.Exit(1)
+	}
+	if impersonate != "" && credentials == "" {
+		slog.Error("-impersonate needs a service account key in -credentials")
+		os.Exit(1)
+	}
+
+	if cfg.manifest != "" {
+		if frontierDB != "" {
+			slog.Error("-manifest can't be combined with -frontier")
+			os.Exit(1)
+		}
+		// fail before authenticating rather than after the first step starts
+		if _, err := importer.LoadManifest(cfg.manifest); err != nil {
+			slog.Error("invalid manifest", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	if cfg.suggestions != "" && !crawler.ValidSuggestionsMode(cfg.suggestions) {
+		slog.Error("invalid suggestions mode",
+			slog.String("suggestions", cfg.suggestions),
+			slog.String("valid_values", "accepted, rejected, preserved"))
+		os.Exit(1)
+	}
+
+	contentNames, err := crawler.ParseContentNames(contentName)
+	if err != nil {
+		slog.Error("invalid content name", slog.Any("error", err))
+		os.Exit(1)
+	}
+	cfg.contentNames = contentNames
+
+	if cfg.patchWorkers <= 0 {
+		slog.Error("-patch-workers must be positive")
+		os.Exit(1)
+	}
+
+	if cfg.chunkSizeMB <= 0 {
+		slog.Error("-upload-chunk-size must be positive")
+		os.Exit(1)
+	}
+
+	cfg.csvDelimiter, err = crawler.ParseCSVDelimiter(csvDelim)
+	if err != nil {
+		slog.Error("invalid CSV delimiter", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	for docType, format := range map[string]string{"doc": docFormat, "sheet": sheetFormat} {
+		if !crawler.ValidFormat(docType, format) {
+			slog.Error("invalid export format",
+				slog.String("type", docType),
+				slog.String("format", format),
+				slog.String("valid_values", strings.Join(crawler.ExportFormats[docType], ", ")))
+			os.Exit(1)
+		}
+		if format != crawler.ExportFormats[docType][0] {
+			if cfg.formats == nil {
+				cfg.formats = make(map[string]string)
+			}
+			cfg.formats[docType] = format
+		}
+	}
+	if docFormat != "html" && cfg.suggestions != "" {
+		slog.Error("-suggestions renders HTML and can't be combined with -doc-format", slog.String("doc_format", docFormat))
+		os.Exit(1)
+	}
+	if docFormat == "md" && cfg.markdown {
+		slog.Error("-markdown would overwrite the content.md export of -doc-format=md; drop one of them")
+		os.Exit(1)
+	}
+	if sheetFormat != "csv" && cfg.csvDelimiter != ',' {
+		slog.Error("-csv-delimiter only applies to -sheet-format=csv", slog.String("sheet_format", sheetFormat))
+		os.Exit(1)
+	}
+
+	if cfg.archive != "" && !archive.ValidFormat(cfg.archive) {
+		slog.Error("invalid archive format",
+			slog.String("archive", cfg.archive),
+			slog.String("valid_values", "epub, pdf"))
+		os.Exit(1)
+	}
+
+	if ownersSpec != "" {
+		cfg.owners = strings.Split(ownersSpec, ",")
+	}
+	if domainsSpec != "" {
+		cfg.allowDomains = strings.Split(domainsSpec, ",")
+	}
+	if cfg.include, err = crawler.ParsePatterns(includeSpec); err != nil {
+		slog.Error("invalid -include-pattern", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if cfg.exclude, err = crawler.ParsePatterns(excludeSpec); err != nil {
+		slog.Error("invalid -exclude-pattern", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	cfg.retryPolicy.Codes, err = retry.ParseCodes(retryCodes)
+	if err != nil {
+		slog.Error("invalid -retry-codes", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if timeout < 0 {
+		slog.Error("-timeout must not be negative", slog.Duration("timeout", timeout))
+		os.Exit(1)
+	}
+	stepTimeouts, err := pipeline.ParseStepTimeouts(stepTimeout)
+	if err != nil {
+		slog.Error("invalid -step-timeout", slog.Any("error", err))
+		os.Exit(1)
+	}
+	for name, d := range configTimeouts {
+		if _, ok := stepTimeouts[name]; !ok {
+			stepTimeouts[name] = d
+		}
+	}
+
+	if shareSpec != "" {
+		for _, spec := range strings.Split(shareSpec, ",") {
+			share, err := uploader.ParseShare(strings.TrimSpace(spec))
+			if err != nil {
+				slog.Error("invalid share", slog.Any("error", err))
+				os.Exit(1)
+			}
+			cfg.shares = append(cfg.shares, share)
+		}
+	}
+
+	if !uploader.ValidDuplicatePolicy(cfg.duplicates) {
+		slog.Error("invalid duplicate policy",
+			slog.String("duplicates", cfg.duplicates),
+			slog.String("valid_values", "create, skip, replace, version, update, duplicate"))
+		os.Exit(1)
+	}
+
+	if cfg.oversized != patcher.OversizedChunk && cfg.oversized != patcher.OversizedFlag {
+		slog.Error("invalid oversized mode",
+			slog.String("oversized", cfg.oversized),
+			slog.String("valid_values", "chunk, flag"))
+		os.Exit(1)
+	}
+
+	if !progress.ValidMode(progressArg) {
+		slog.Error("invalid progress mode",
+			slog.String("progress", progressArg),
+			slog.String("valid_values", "tty, log, none"))
+		os.Exit(1)
+	}
+
+	if serveAddr != "" && storage.IsRemote(cfg.out) {
+		slog.Error("server mode needs a local -out directory")
+		os.Exit(1)
+	}
+
+	if hookHosts != "" && (serveAddr == "" || hookSecret == "") {
+		slog.Error("-callback-hosts needs -serve and -webhook-secret")
+		os.Exit(1)
+	}
+
+	if watch && schedule != "" {
+		slog.Error("-watch and -schedule cannot be combined")
+		os.Exit(1)
+	}
+
+	if cfg.incremental && frontierDB != "" {
+		slog.Error("-incremental can't be combined with -frontier")
+		os.Exit(1)
+	}
+
+	if cfg.dryRun && (watch || serveAddr != "" || cfg.archive != "") {
+		slog.Error("-dry-run cannot be combined with -watch, -serve or -archive")
+		os.Exit(1)
+	}
+
+	var sched cron.Schedule
+	if schedule != "" {
+		s, err := cron.ParseStandard(schedule)
+		if err != nil {
+			slog.Error("invalid schedule", slog.String("schedule", schedule), slog.Any("error", err))
+			os.Exit(1)
+		}
+		sched = s
+		if !cfg.incremental && frontierDB == "" && !flagSet("incremental") {
+			// a full run per tick would upload every document again
+			slog.Info("scheduled runs are incremental; set -incremental=false for full runs")
+			cfg.incremental = true
+		}
+	}
+
+	// stop long-running modes cleanly on Ctrl-C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// load configuration
 	slogHandler := &logger.ContextHandler{Handler: slog.NewJSONHandler(os.Stdout, nil)}
 	slog.SetDefault(slog.New(slogHandler))
 
-	slog.Info("starting pipeline",
-		slog.String("url", url),
-		slog.String("output_dir", out),
-		slog.Int("max_depth", depth))
+	if pprofAddr != "" {
+		go servePprof(pprofAddr)
+	}
 
-		// --- build shared Google API clients ------------------------------------
-		var opts []option.ClientOption
-		if projectID != "" {
-			opts = append(opts, option.WithQuotaProject(projectID))
-		}
-	
-		docsSvc, err := docs.NewService(ctx, opts...)
+	// every step, and in server mode every job, draws from the same API
+	// budget, so concurrent work can't exceed the per-user quota together
+	budget := ratelimit.NewBudget(cfg.apiQPS, cfg.apiBurst)
+	if adaptiveQPS {
+		budget = ratelimit.NewAdaptiveBudget(cfg.apiQPS, cfg.apiBurst)
+	}
+
+	// --- build shared Google API clients ------------------------------------
+	// one pooled transport for the crawler, the steps and every API client
+	shared := httptransport.New(cfg.compression)
+	var authOpts []gapi.Option
+	if oauthClient != "" {
+		ts, err := gapi.UserCredentials(ctx, oauthClient, oauthToken)
 		if err != nil {
-			slog.Error("failed to create Docs service", slog.Any("error", err))
+			slog.Error("failed to authorize", slog.Any("error", err))
 			return
 		}
-	
-		sheetsSvc, err := sheets.NewService(ctx, opts...)
+		authOpts = append(authOpts, gapi.WithTokenSource(ts))
+		cfg.userAuth = true
+	}
+	if credentials != "" {
+		ts, err := gapi.ServiceAccountCredentials(ctx, credentials, impersonate)
 		if err != nil {
-			slog.Error("failed to create Sheets service", slog.Any("error", err))
+			slog.Error("failed to load service account", slog.Any("error", err))
 			return
-		}	
+		}
+		authOpts = append(authOpts, gapi.WithTokenSource(ts))
+	}
+	clients, err := gapi.New(ctx, budget.Observe(shared), cfg.projectID, authOpts...)
+	if err != nil {
+		slog.Error("failed to create Google API clients", slog.Any("error", err))
+		return
+	}
+	cfg.transport = shared
+	cfg.clients = clients
+	cfg.driveSvc = clients.Drive
+	if followForm {
+		cfg.formsSvc = clients.Forms
+	}
 
-	// instantiate the crawler, uploader, and patcher
-	crawler := crawler.NewCrawler(depth, 15*time.Second, url, out, docsSvc, sheetsSvc)
-	
-	uploader, err := uploader.NewUploader(ctx, projectID, driveFolder, out)
+	if serveAddr != "" {
+		store, err := server.OpenBoltStore(dbPath)
+		if err != nil {
+			slog.Error("failed to open run history", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer store.Close()
+
+		queue := server.NewQueue(cfg.out, queueSize, workers, tenantJobs, store, func(ctx context.Context, job *server.Job, events pipeline.Notifier) error {
+			jobCfg := cfg
+			jobCfg.url = job.Spec.URL
+			jobCfg.seeds = nil
+			jobCfg.runID = job.ID
+			jobCfg.out = job.OutDir
+			jobCfg.failures = failures.New(job.ID, storage.NewLocal(job.OutDir))
+			if job.Spec.Folder != "" {
+				jobCfg.driveFolder = job.Spec.Folder
+			}
+			if job.Spec.Depth > 0 {
+				jobCfg.depth = job.Spec.Depth
+			}
+
+			ctx = logger.AppendCtx(ctx, slog.String("job_id", job.ID), slog.String("tenant", job.Spec.Tenant))
+			steps, err := buildSteps(ctx, jobCfg, budget)
+			if err != nil {
+				return err
+			}
+			pipe := steps.pipeline()
+			setTimeouts(pipe, timeout, stepTimeouts)
+			pipe.AddNotifier(events)
+			pipe.AddNotifier(runreport.New(job.ID, storage.NewLocal(job.OutDir)))
+			pipe.AddNotifier(jobCfg.failures)
+			if jobCfg.index {
+				pipe.AddNotifier(index.NewNotifier(storage.NewLocal(job.OutDir)))
+			}
+			if len(job.Spec.Callbacks) > 0 {
+				pipe.AddNotifier(webhook.NewNotifier(job.ID, job.Spec.Callbacks, webhook.JobSecret(hookSecret, job.ID)))
+			}
+			return pipe.RunFrom(ctx, 0)
+		})
+
+		if err := queue.Restore(); err != nil {
+			slog.Error("failed to restore run history", slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		var serverOpts []server.Option
+		if hookHosts != "" {
+			serverOpts = append(serverOpts, server.WithCallbacks(hookSecret, strings.Split(hookHosts, ",")...))
+		}
+		if err := server.NewServer(serveAddr, queue, serverOpts...).Run(ctx); err != nil {
+			slog.Error("server failed", slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	slog.Info("starting pipeline",
+		slog.String("url", cfg.url),
+		slog.String("output_dir", cfg.out),
+		slog.Int("max_depth", cfg.depth))
+
+	if frontierDB != "" {
+		frontier, err := crawler.NewSQLiteFrontier(frontierDB, workerID)
+		if err != nil {
+			slog.Error("failed to open frontier", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer frontier.Close()
+		cfg.frontier = frontier
+	}
+
+	cfg.store, err = storage.Open(ctx, cfg.out, clients.Options()...)
 	if err != nil {
-		slog.Error("failed to create uploader", slog.Any("error", err))
+		slog.Error("failed to open output location", slog.Any("error", err))
 		os.Exit(1)
 	}
-	patcher, err := patcher.NewPatcher(ctx, projectID, 1100*time.Millisecond, 6, out)
+
+	if retryFailed {
+		if retryStep != "" || sched != nil || watch || cfg.frontier != nil {
+			slog.Error("-retry-failed can't be combined with -from, -schedule, -watch or -frontier")
+			os.Exit(1)
+		}
+		manifest, err := failures.Load(ctx, cfg.store)
+		if err != nil {
+			slog.Error("failed to load the previous run's failures", slog.Any("error", err))
+			os.Exit(1)
+		}
+		cfg.retryUploads = manifest.Items("uploader")
+		cfg.retryPatches = append(manifest.Items("patcher"), cfg.retryUploads...)
+		switch {
+		case len(cfg.retryUploads) > 0:
+			retryStep = "uploader"
+		case len(cfg.retryPatches) > 0:
+			retryStep = "patcher"
+		default:
+			slog.Info("no failed uploads or patches to retry", slog.String("run_id", manifest.RunID))
+			return
+		}
+		slog.Info("retrying failed documents",
+			slog.String("run_id", manifest.RunID),
+			slog.Int("uploads", len(cfg.retryUploads)),
+			slog.Int("patches", len(cfg.retryPatches)))
+	}
+
+	cfg.runID = newRunID()
+	if sched == nil && !watch {
+		// recurring runs would add up in one tracker
+		cfg.progress = progress.New()
+	}
+	if cfg.frontier == nil {
+		// workers sharing a frontier would overwrite each other's manifest
+		cfg.failures = failures.New(cfg.runID, cfg.store)
+	}
+
+	// instantiate the crawler, uploader, and patcher
+	steps, err := buildSteps(ctx, cfg, budget)
 	if err != nil {
-		slog.Error("failed to create patcher", slog.Any("error", err))
+		slog.Error("failed to create steps", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	steps := []pipeline.Step{
-		crawler,
-		uploader,
-		patcher,
+	switch {
+	case steps.stream == nil, cfg.frontier != nil:
+	case untilStep == "crawler":
+		// stop between the crawl and the upload
+		steps.stream = nil
+	case retryStep == "uploader":
+		// the crawl is already on disk; upload it in one pass
+		steps.stream = nil
+	case retryStep == "crawler":
+		retryStep = "stream"
+	}
+	if steps.stream != nil && untilStep == "uploader" {
+		untilStep = "stream"
 	}
 
-	pipe := pipeline.NewPipeline(steps...)
+	pipe := steps.pipeline()
+	if cfg.frontier != nil {
+		// distributed workers only crawl; upload and patch the merged output
+		// once, after every worker has finished
+		pipe = pipeline.NewPipeline(steps.crawler)
+	} else {
+		// workers sharing a frontier would overwrite each other's report
+		pipe.AddNotifier(runreport.New(cfg.runID, cfg.store))
+		pipe.AddNotifier(cfg.failures)
+		if cfg.index {
+			pipe.AddNotifier(index.NewNotifier(cfg.store))
+		}
+	}
+	if webhooks != "" {
+		pipe.AddNotifier(webhook.NewNotifier(cfg.runID, strings.Split(webhooks, ","), hookSecret))
+	}
+	setTimeouts(pipe, timeout, stepTimeouts)
 
-	idx := 0
-	if retry != "" {
-		idx = pipe.FindIndex(retry)
-		if idx == -1 {
+	idx, end := 0, len(pipe.Names())-1
+	names := []string{retryStep, untilStep}
+	for name := range stepTimeouts {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if name != "" && pipe.FindIndex(name) == -1 {
 			slog.Error("unknown step",
-				slog.String("step", retry),
-				slog.String("valid_values", "crawler, uploader, patcher"))
+				slog.String("step", name),
+				slog.Any("valid_values", pipe.Names()))
 			os.Exit(1)
 		}
 	}
+	if untilStep != "" {
+		end = pipe.FindIndex(untilStep)
+	}
+	if retryStep != "" {
+		idx = pipe.FindIndex(retryStep)
+	}
+	// recurring runs and distributed workers always run every step
+	if sched == nil && !watch && cfg.frontier == nil {
+		state, err := runstate.Load(ctx, cfg.store)
+		if err != nil {
+			slog.Error("failed to load pipeline state", slog.Any("error", err))
+			os.Exit(1)
+		}
+		if retryStep == "" {
+			idx = state.Resume(pipe.Names())
+			if idx > end {
+				slog.Info("steps already completed; pass -from to run them again",
+					slog.Any("completed", state.Completed))
+				return
+			}
+			if idx > 0 {
+				slog.Info("resuming pipeline",
+					slog.String("step", pipe.Names()[idx]),
+					slog.Any("completed", state.Completed))
+			}
+		}
+		pipe.AddNotifier(runstate.New(cfg.store, pipe.Names(), state))
+	}
+	if end < idx {
+		slog.Error("-until step runs before the first step",
+			slog.String("from", pipe.Names()[idx]),
+			slog.String("until", pipe.Names()[end]))
+		os.Exit(1)
+	}
+
+	if sched != nil {
+		runScheduled(ctx, pipe, idx, end, sched)
+		return
+	}
+
+	if watch {
+		// watch mode syncs an existing import; run the pipeline first if there is none yet
+		if _, err := cfg.store.ReadFile(ctx, "id_map.json"); err != nil {
+			if err := pipe.RunRange(ctx, idx, end); err != nil {
+				slog.Error("pipeline failed", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}
+
+		w := watcher.NewWatcher(cfg.driveSvc, watchEvery, cfg.store, steps.crawler, steps.uploader, steps.patcher)
+		if err := w.Run(ctx); err != nil {
+			slog.Error("watcher failed", slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err := pipe.RunFrom(ctx, idx); err != nil {
+	stopProgress := progress.Render(ctx, cfg.progress, progressArg, os.Stderr)
+	err = pipe.RunRange(ctx, idx, end)
+	stopProgress()
+	if err != nil {
 		var pathErr *os.PathError
 		if errors.As(err, &pathErr) {
 			slog.Error("filesystem error", slog.Any("error", pathErr))
@@ -118,7 +898,327 @@ func main() {
 		slog.Error("pipeline failed", slog.Any("error", err))
 		os.Exit(1)
 	}
+	if n := cfg.failures.Count("uploader", "patcher"); n > 0 {
+		slog.Error("pipeline completed with failed uploads or patches",
+			slog.Int("failures", n),
+			slog.String("manifest", failures.File),
+			slog.Any("api_requests", budget.Usage()))
+		os.Exit(exitPartialFailure)
+	}
+
+	slog.Info("pipeline completed successfully", slog.Any("api_requests", budget.Usage()))
+}
+
+// buildSteps instantiates the crawler, uploader and patcher for one run
+func buildSteps(ctx context.Context, cfg runConfig, budget *ratelimit.Budget) (*stepSet, error) {
+	docsSvc, sheetsSvc := cfg.clients.Docs, cfg.clients.Sheets
+
+	crawlerOpts := []crawler.Option{
+		crawler.WithRetryPolicy(cfg.retryPolicy),
+		crawler.WithLimiter(budget.For("crawler")),
+		crawler.WithProgress(cfg.progress.For("crawler")),
+		crawler.WithFailures(cfg.failures.For("crawler")),
+	}
+	uploaderOpts := []uploader.Option{
+		uploader.WithLimiter(budget.For("uploader")),
+		uploader.WithProgress(cfg.progress.For("uploader")),
+		uploader.WithFailures(cfg.failures.For("uploader")),
+		uploader.WithDuplicatePolicy(cfg.duplicates),
+		uploader.WithRetryPolicy(cfg.retryPolicy),
+		uploader.WithChunkSize(cfg.chunkSizeMB << 20),
+		uploader.WithRunID(cfg.runID),
+	}
+	patcherOpts := []patcher.Option{
+		patcher.WithRetryPolicy(cfg.retryPolicy),
+		patcher.WithWorkers(cfg.patchWorkers),
+	}
+	if cfg.retryUploads != nil {
+		uploaderOpts = append(uploaderOpts, uploader.WithOnly(cfg.retryUploads))
+	}
+	if cfg.retryPatches != nil {
+		patcherOpts = append(patcherOpts, patcher.WithOnly(cfg.retryPatches))
+	}
+	if cfg.transport != nil {
+		crawlerOpts = append(crawlerOpts,
+			crawler.WithHTTPTransport(cfg.transport),
+			crawler.WithExportCompression(cfg.compression))
+		uploaderOpts = append(uploaderOpts, uploader.WithHTTPTransport(cfg.transport))
+	}
+	crawlerOpts = append(crawlerOpts, crawler.WithClients(cfg.clients))
+	if cfg.userAuth {
+		crawlerOpts = append(crawlerOpts, crawler.WithAuthenticatedExports(cfg.clients.HTTP))
+	}
+	uploaderOpts = append(uploaderOpts, uploader.WithClients(cfg.clients))
+	patcherOpts = append(patcherOpts, patcher.WithClients(cfg.clients))
+	if cfg.redirectIndex {
+		uploaderOpts = append(uploaderOpts, uploader.WithRedirectIndex())
+	}
+	// local images only reach the imported doc through Drive copies
+	if cfg.imageAssets || cfg.images {
+		uploaderOpts = append(uploaderOpts, uploader.WithImageAssets())
+		if cfg.publicImages {
+			uploaderOpts = append(uploaderOpts, uploader.WithPublicImages())
+		}
+	}
+	if len(cfg.shares) > 0 {
+		uploaderOpts = append(uploaderOpts, uploader.WithSharing(cfg.shares...))
+	}
+	if cfg.copyPermissions {
+		uploaderOpts = append(uploaderOpts, uploader.WithCopyPermissions())
+	}
+	if cfg.uploadClean {
+		uploaderOpts = append(uploaderOpts, uploader.WithCleanHTML())
+	}
+	if cfg.rewriteLinks {
+		uploaderOpts = append(uploaderOpts, uploader.WithLinkRewrite())
+	}
+	if cfg.leavesFirst {
+		uploaderOpts = append(uploaderOpts, uploader.WithLeavesFirst())
+	}
+	if cfg.sheetLocale != "" || cfg.sheetTimeZone != "" {
+		uploaderOpts = append(uploaderOpts, uploader.WithSheetLocale(sheetsSvc, cfg.sheetLocale, cfg.sheetTimeZone))
+	}
+	if cfg.subfolder != "" {
+		uploaderOpts = append(uploaderOpts, uploader.WithSubfolder(cfg.subfolder, cfg.runID))
+	}
+	patcherOpts = append(patcherOpts,
+		patcher.WithLimiter(budget.For("patcher")),
+		patcher.WithProgress(cfg.progress.For("patcher")),
+		patcher.WithFailures(cfg.failures.For("patcher")),
+		patcher.WithMaxElements(cfg.maxElements, cfg.oversized),
+	)
+	if cfg.copyOnDenied {
+		patcherOpts = append(patcherOpts, patcher.WithCopyOnDenied(cfg.driveSvc))
+	}
+	if cfg.store != nil {
+		crawlerOpts = append(crawlerOpts, crawler.WithStorage(cfg.store))
+		uploaderOpts = append(uploaderOpts, uploader.WithStorage(cfg.store))
+		patcherOpts = append(patcherOpts, patcher.WithStorage(cfg.store))
+	}
+	if cfg.frontier != nil {
+		crawlerOpts = append(crawlerOpts, crawler.WithFrontier(cfg.frontier))
+	}
+	if cfg.frontierSpill > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithFrontierSpill(cfg.frontierSpill, ""))
+	}
+	if cfg.formsSvc != nil {
+		crawlerOpts = append(crawlerOpts, crawler.WithFormsService(cfg.formsSvc))
+	}
+	if cfg.driveSvc != nil {
+		crawlerOpts = append(crawlerOpts, crawler.WithDriveService(cfg.driveSvc))
+	}
+	if cfg.seedFolder != "" {
+		crawlerOpts = append(crawlerOpts, crawler.WithFolderSeed(cfg.seedFolder))
+	}
+	if len(cfg.seeds) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithExtraSeeds(cfg.seeds...))
+	}
+	if cfg.revisions {
+		crawlerOpts = append(crawlerOpts, crawler.WithRevisions())
+	}
+	if cfg.cacheDir != "" {
+		crawlerOpts = append(crawlerOpts, crawler.WithCache(cfg.cacheDir))
+	}
+	if cfg.charts {
+		crawlerOpts = append(crawlerOpts, crawler.WithCharts())
+	}
+	if cfg.images {
+		crawlerOpts = append(crawlerOpts, crawler.WithImages())
+	}
+	if cfg.sheetTabs {
+		crawlerOpts = append(crawlerOpts, crawler.WithSheetTabs())
+	}
+	if cfg.suggestions != "" {
+		crawlerOpts = append(crawlerOpts, crawler.WithSuggestions(cfg.suggestions))
+	}
+	if cfg.cleanHTML {
+		crawlerOpts = append(crawlerOpts, crawler.WithCleanHTML())
+	}
+	if cfg.markdown {
+		crawlerOpts = append(crawlerOpts, crawler.WithMarkdown())
+	}
+	if cfg.resume {
+		crawlerOpts = append(crawlerOpts, crawler.WithResume())
+	}
+	if cfg.incremental {
+		crawlerOpts = append(crawlerOpts, crawler.WithIncremental())
+	}
+	if cfg.sharingAudit {
+		crawlerOpts = append(crawlerOpts, crawler.WithSharingAudit())
+	}
+	if len(cfg.owners) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithOwnerFilter(cfg.owners))
+	}
+	if len(cfg.allowDomains) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithDomainAllowlist(cfg.allowDomains))
+	}
+	if len(cfg.include) > 0 || len(cfg.exclude) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithLinkFilter(cfg.include, cfg.exclude))
+	}
+	if cfg.csvDelimiter != ',' {
+		crawlerOpts = append(crawlerOpts, crawler.WithCSVDelimiter(cfg.csvDelimiter))
+	}
+	if len(cfg.contentNames) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithContentNames(cfg.contentNames))
+	}
+	if len(cfg.formats) > 0 {
+		crawlerOpts = append(crawlerOpts, crawler.WithFormats(cfg.formats))
+	}
+	if cfg.dryRun {
+		report := dryrun.New()
+		crawlerOpts = append(crawlerOpts, crawler.WithDryRun(report))
+		uploaderOpts = append(uploaderOpts, uploader.WithDryRun(report))
+		patcherOpts = append(patcherOpts, patcher.WithDryRun(report))
+	}
+	c := crawler.NewCrawler(cfg.depth, 15*time.Second, cfg.url, cfg.out, docsSvc, sheetsSvc, crawlerOpts...)
 
-	slog.Info("pipeline completed successfully")
+	u, err := uploader.NewUploader(ctx, cfg.projectID, cfg.driveFolder, cfg.out, uploaderOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating uploader: %w", err)
+	}
+
+	// recreate uploaded docs deleted before the patcher reaches them
+	patcherOpts = append(patcherOpts, patcher.WithReuploader(u))
+	p, err := patcher.NewPatcher(ctx, cfg.projectID, cfg.patchDelay, cfg.retryPolicy.MaxAttempts, cfg.out, patcherOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating patcher: %w", err)
+	}
+
+	set := &stepSet{crawler: c, uploader: u, patcher: p}
+	if cfg.plan {
+		plannerOpts := []planner.Option{planner.WithPatchWorkers(cfg.patchWorkers)}
+		if cfg.store != nil {
+			plannerOpts = append(plannerOpts, planner.WithStorage(cfg.store))
+		}
+		set.planner = planner.NewPlanner(cfg.out, cfg.apiQPS, cfg.patchDelay, plannerOpts...)
+	}
+	if cfg.archive != "" {
+		archiveOpts := []archive.Option{
+			archive.WithDriveService(cfg.driveSvc),
+			archive.WithLimiter(budget.For("archive")),
+		}
+		if cfg.store != nil {
+			archiveOpts = append(archiveOpts, archive.WithStorage(cfg.store))
+		}
+		set.exporter = archive.NewExporter(cfg.out, cfg.archive, archiveOpts...)
+	}
+	if cfg.gitRepo != "" {
+		mirrorOpts := []gitmirror.Option{
+			gitmirror.WithPath(cfg.gitPath),
+			gitmirror.WithRunID(cfg.runID),
+			gitmirror.WithPush(cfg.gitPush),
+		}
+		if cfg.store != nil {
+			mirrorOpts = append(mirrorOpts, gitmirror.WithStorage(cfg.store))
+		}
+		set.mirror = gitmirror.NewMirror(cfg.out, cfg.gitRepo, mirrorOpts...)
+	}
+	if cfg.manifest != "" {
+		var importerOpts []importer.Option
+		if cfg.store != nil {
+			importerOpts = append(importerOpts, importer.WithStorage(cfg.store))
+		}
+		set.importer = importer.NewImporter(cfg.manifest, cfg.out, importerOpts...)
+	}
+	// planning and archiving don't upload, and imports have no crawl to stream
+	if cfg.stream > 0 && set.importer == nil && set.planner == nil && set.exporter == nil {
+		set.stream = stream.NewStep(c, u, cfg.stream)
+	}
+	// a dry run leaves nothing in Drive to verify or check
+	if cfg.verify && !cfg.dryRun {
+		verifierOpts := []verifier.Option{
+			verifier.WithLimiter(budget.For("verifier")),
+			verifier.WithFailures(cfg.failures.For("verifier")),
+		}
+		if cfg.store != nil {
+			verifierOpts = append(verifierOpts, verifier.WithStorage(cfg.store))
+		}
+		set.verifier = verifier.NewVerifier(docsSvc, cfg.out, verifierOpts...)
+	}
+	if cfg.checkLinks && !cfg.dryRun {
+		checkerOpts := []linkcheck.Option{linkcheck.WithLimiter(budget.For("linkcheck"))}
+		if cfg.transport != nil {
+			checkerOpts = append(checkerOpts, linkcheck.WithHTTPTransport(cfg.transport))
+		}
+		if cfg.store != nil {
+			checkerOpts = append(checkerOpts, linkcheck.WithStorage(cfg.store))
+		}
+		set.checker = linkcheck.NewChecker(docsSvc, cfg.driveSvc, cfg.out, checkerOpts...)
+	}
+	return set, nil
 }
 
+// setTimeouts applies -timeout to every run of pipe and -step-timeout to its
+// steps
+func setTimeouts(pipe *pipeline.Pipeline, timeout time.Duration, stepTimeouts map[string]time.Duration) {
+	pipe.SetTimeout(timeout)
+	for name, d := range stepTimeouts {
+		pipe.SetStepTimeout(name, d)
+	}
+}
+
+// servePprof exposes runtime profiles for diagnosing slow runs; it is
+// opt-in since profiles reveal internals
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	slog.Info("serving pprof", slog.String("addr", addr))
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("pprof server stopped", slog.Any("error", err))
+	}
+}
+
+// defaultWorkerID identifies this process as host-pid
+func defaultWorkerID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// newRunID returns a random identifier for a CLI run
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// flagSet reports whether the named flag was given on the command line or
+// in the -config file
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// runScheduled re-runs the pipeline's steps from start to end every time the
+// cron schedule fires until the context is cancelled. A failed run is logged
+// and does not stop the schedule; the next tick simply tries again.
+func runScheduled(ctx context.Context, pipe *pipeline.Pipeline, start, end int, sched cron.Schedule) {
+	for {
+		next := sched.Next(time.Now())
+		slog.Info("waiting for next scheduled run", slog.Time("next_run", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("scheduler stopped")
+			return
+		case <-timer.C:
+		}
+
+		if err := pipe.RunRange(ctx, start, end); err != nil {
+			slog.Error("scheduled run failed", slog.Any("error", err))
+			continue
+		}
+		slog.Info("scheduled run completed", slog.Time("next_run", sched.Next(time.Now())))
+	}
+}
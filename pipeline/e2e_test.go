@@ -0,0 +1,135 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/patcher"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/docs/v1"
+)
+
+// page is a doc export linking to each of links, with the link's index as
+// its text
+func page(title string, links ...string) string {
+	var b strings.Builder
+	b.WriteString("<html><head><title>" + title + "</title></head><body>")
+	for i, l := range links {
+		fmt.Fprintf(&b, `<p><a href="%s">link %d</a></p>`, l, i)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+const (
+	rootURL  = "https://docs.google.com/document/d/root/edit"
+	childURL = "https://docs.google.com/document/d/child/edit"
+	sheetURL = "https://docs.google.com/spreadsheets/d/budget/edit"
+)
+
+// runPipeline crawls, uploads, patches and verifies the fake Google's
+// documents, returning the ID map and the uploader and verifier for their
+// stats
+func runPipeline(t *testing.T, google *fakegoogle.Server, opts ...uploader.Option) (map[string]string, *uploader.Uploader, *verifier.Verifier) {
+	t.Helper()
+	ctx := context.Background()
+	google.AddDoc("root", page("Handbook", childURL, sheetURL, "https://example.com/"))
+	google.AddDoc("child", page("Onboarding", rootURL))
+	google.AddSheet("budget", "Budget", "item,cost\nlaptop,1000\n")
+
+	out := t.TempDir()
+	c := crawler.NewCrawler(3, time.Second, rootURL, out, nil, nil,
+		crawler.WithHTTPTransport(google.Transport()))
+	u, err := uploader.NewUploader(ctx, "", "Imported Docs", out,
+		append([]uploader.Option{uploader.WithClientOptions(google.ClientOptions()...)}, opts...)...)
+	require.NoError(t, err)
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(google.ClientOptions()...))
+	require.NoError(t, err)
+	docsSvc, err := docs.NewService(ctx, google.ClientOptions()...)
+	require.NoError(t, err)
+	v := verifier.NewVerifier(docsSvc, out)
+
+	require.NoError(t, pipeline.NewPipeline(c, u, p, v).RunFrom(ctx, 0))
+
+	data, err := os.ReadFile(filepath.Join(out, "id_map.json"))
+	require.NoError(t, err)
+	var idMap map[string]string
+	require.NoError(t, json.Unmarshal(data, &idMap))
+	require.Len(t, idMap, 3)
+	return idMap, u, v
+}
+
+func TestPipelineEndToEnd(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	idMap, _, v := runPipeline(t, google)
+
+	// a folder and one file per document
+	files := google.Files()
+	require.Len(t, files, 4)
+	assert.Equal(t, "Imported Docs", files[0].Name)
+	for _, f := range files[1:] {
+		assert.Equal(t, []string{files[0].ID}, f.Parents)
+	}
+
+	// links between uploaded documents point at the copies; others are kept
+	root := google.Links(idMap["doc:root"])
+	require.Len(t, root, 3)
+	assert.Contains(t, root[0], "/d/"+idMap["doc:child"])
+	assert.Contains(t, root[1], "/d/"+idMap["sheet:budget"])
+	assert.Equal(t, "https://example.com/", root[2])
+	child := google.Links(idMap["doc:child"])
+	require.Len(t, child, 1)
+	assert.Contains(t, child[0], "/d/"+idMap["doc:root"])
+	assert.Equal(t, 1, google.Updates(idMap["doc:root"]))
+
+	assert.Equal(t, 2, v.Stats().(verifier.VerifyStats).DocsChecked)
+	assert.Zero(t, v.Stats().(verifier.VerifyStats).Leftovers)
+}
+
+func TestPipelineEndToEndWithLinkRewrite(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	idMap, u, v := runPipeline(t, google, uploader.WithLinkRewrite())
+
+	// the doc uploaded second links to the first one's copy from the start,
+	// so only the first needs a patch
+	rewritten := u.Stats().(uploader.UploadStats).LinksRewritten
+	assert.Positive(t, rewritten)
+	assert.Equal(t, 1, google.Updates(idMap["doc:root"])+google.Updates(idMap["doc:child"]))
+
+	root := google.Links(idMap["doc:root"])
+	require.Len(t, root, 3)
+	assert.Contains(t, root[0], "/d/"+idMap["doc:child"])
+	assert.Contains(t, root[1], "/d/"+idMap["sheet:budget"])
+	child := google.Links(idMap["doc:child"])
+	require.Len(t, child, 1)
+	assert.Contains(t, child[0], "/d/"+idMap["doc:root"])
+	assert.Zero(t, v.Stats().(verifier.VerifyStats).Leftovers)
+}
+
+func TestPipelineEndToEndLeavesFirst(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	idMap, u, _ := runPipeline(t, google, uploader.WithLinkRewrite(), uploader.WithLeavesFirst())
+
+	// the crawl saves the child ahead of the root, but the child links to
+	// the root, so the root goes first and only its link to the child,
+	// around the cycle, is left to patch
+	assert.Equal(t, 2, u.Stats().(uploader.UploadStats).LinksRewritten)
+	assert.Equal(t, 1, google.Updates(idMap["doc:root"]))
+	assert.Zero(t, google.Updates(idMap["doc:child"]))
+}
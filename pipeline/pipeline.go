@@ -2,8 +2,10 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -14,42 +16,184 @@ type Step interface {
 	Run(ctx context.Context) error
 }
 
+// StatsReporter is implemented by steps that can summarise their last run.
+type StatsReporter interface {
+	Stats() any
+}
+
+// Event types emitted while a pipeline runs.
+const (
+	EventStepStarted   = "step.started"
+	EventStepCompleted = "step.completed"
+	EventStepFailed    = "step.failed"
+	EventRunCompleted  = "run.completed"
+	EventRunFailed     = "run.failed"
+)
+
+// Event describes a step or run outcome.
+type Event struct {
+	Type     string        `json:"event"`
+	Step     string        `json:"step,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	Stats    any           `json:"stats,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Notifier receives pipeline events. Notify must not fail the run, so
+// delivery problems are the notifier's to log.
+type Notifier interface {
+	Notify(ctx context.Context, ev Event)
+}
+
 // Pipeline orchestrates a fixed list of steps.
 type Pipeline struct {
-	steps []Step
+	steps     []Step
+	notifiers []Notifier
+	// timeout bounds each run and stepTimeouts each named step; zero means
+	// no limit
+	timeout      time.Duration
+	stepTimeouts map[string]time.Duration
 }
 
 func NewPipeline(steps ...Step) *Pipeline {
 	return &Pipeline{steps: steps}
 }
 
+// AddNotifier registers a receiver for step and run events.
+func (p *Pipeline) AddNotifier(n Notifier) {
+	p.notifiers = append(p.notifiers, n)
+}
+
+// SetTimeout bounds every run of the pipeline. A run that takes longer fails
+// with context.DeadlineExceeded; zero removes the limit.
+func (p *Pipeline) SetTimeout(d time.Duration) {
+	p.timeout = d
+}
+
+// SetStepTimeout bounds every run of the named step; zero removes the limit.
+func (p *Pipeline) SetStepTimeout(name string, d time.Duration) {
+	if p.stepTimeouts == nil {
+		p.stepTimeouts = make(map[string]time.Duration)
+	}
+	p.stepTimeouts[name] = d
+}
+
+// ParseStepTimeouts parses a comma-separated list of step=duration pairs,
+// e.g. "crawler=30m,uploader=2h"
+func ParseStepTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid step timeout %q, want step=duration", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid timeout %q of step %s", value, name)
+		}
+		timeouts[strings.TrimSpace(name)] = d
+	}
+	return timeouts, nil
+}
+
+func (p *Pipeline) notify(ctx context.Context, ev Event) {
+	for _, n := range p.notifiers {
+		n.Notify(ctx, ev)
+	}
+}
+
 // RunFrom executes steps starting at the provided index.
 // If any step returns an error, execution stops and the error bubbles up.
 func (p *Pipeline) RunFrom(ctx context.Context, start int) error {
+	return p.RunRange(ctx, start, len(p.steps)-1)
+}
+
+// RunRange executes the steps from start to end, both included, like RunFrom.
+// Steps run under the pipeline and step timeouts; events are delivered with
+// ctx, so notifiers still report a run that timed out.
+func (p *Pipeline) RunRange(ctx context.Context, start, end int) error {
 	if start < 0 || start >= len(p.steps) {
 		return fmt.Errorf("start index %d out of range", start)
 	}
+	if end < start || end >= len(p.steps) {
+		return fmt.Errorf("end index %d out of range", end)
+	}
+
+	runCtx := ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
 
-	for i := start; i < len(p.steps); i++ {
+	runStart := time.Now()
+	for i := start; i <= end; i++ {
 		step := p.steps[i]
-		slog.Info("running step",
+		slog.InfoContext(ctx, "running step",
 			slog.String("step", step.Name()),
 			slog.Int("current", i+1),
 			slog.Int("total", len(p.steps)))
+		p.notify(ctx, Event{Type: EventStepStarted, Step: step.Name()})
 		t0 := time.Now()
 
-		if err := step.Run(ctx); err != nil {
-			return fmt.Errorf("step %s failed after %s: %w", step.Name(), time.Since(t0).Truncate(time.Millisecond), err)
+		if err := p.runStep(runCtx, step); err != nil {
+			elapsed := time.Since(t0).Truncate(time.Millisecond)
+			if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("pipeline timeout of %s exceeded: %w", p.timeout, err)
+			}
+			p.notify(ctx, Event{Type: EventStepFailed, Step: step.Name(), Duration: elapsed, Stats: stepStats(step), Error: err.Error()})
+			err = fmt.Errorf("step %s failed after %s: %w", step.Name(), elapsed, err)
+			p.notify(ctx, Event{Type: EventRunFailed, Duration: time.Since(runStart), Error: err.Error()})
+			return err
 		}
 
-		slog.Info("completed step",
+		elapsed := time.Since(t0).Truncate(time.Millisecond)
+		slog.InfoContext(ctx, "completed step",
 			slog.String("step", step.Name()),
-			slog.Duration("duration", time.Since(t0).Truncate(time.Millisecond)))
+			slog.Duration("duration", elapsed))
+		p.notify(ctx, Event{Type: EventStepCompleted, Step: step.Name(), Duration: elapsed, Stats: stepStats(step)})
+	}
+
+	p.notify(ctx, Event{Type: EventRunCompleted, Duration: time.Since(runStart)})
+	return nil
+}
+
+// runStep runs step under its timeout, if it has one
+func (p *Pipeline) runStep(ctx context.Context, step Step) error {
+	d := p.stepTimeouts[step.Name()]
+	if d <= 0 {
+		return step.Run(ctx)
 	}
+	stepCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	err := step.Run(stepCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("step timeout of %s exceeded: %w", d, err)
+	}
+	return err
+}
 
+// stepStats returns the step's stats if it reports any
+func stepStats(step Step) any {
+	if r, ok := step.(StatsReporter); ok {
+		return r.Stats()
+	}
 	return nil
 }
 
+// Names returns the names of the steps in execution order.
+func (p *Pipeline) Names() []string {
+	names := make([]string, len(p.steps))
+	for i, s := range p.steps {
+		names[i] = s.Name()
+	}
+	return names
+}
+
 // FindIndex returns the position of a step by name or ‑1 if not found.
 func (p *Pipeline) FindIndex(name string) int {
 	for i, s := range p.steps {
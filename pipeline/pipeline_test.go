@@ -0,0 +1,72 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stuck blocks until its context is done
+type stuck struct{ name string }
+
+func (s stuck) Name() string { return s.name }
+func (s stuck) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// instant completes at once
+type instant struct{ name string }
+
+func (s instant) Name() string                  { return s.name }
+func (s instant) Run(ctx context.Context) error { return nil }
+
+// recorder keeps the events it is notified of
+type recorder struct{ events []pipeline.Event }
+
+func (r *recorder) Notify(ctx context.Context, ev pipeline.Event) {
+	r.events = append(r.events, ev)
+}
+
+func TestStepTimeoutFailsStuckStep(t *testing.T) {
+	pipe := pipeline.NewPipeline(instant{name: "crawler"}, stuck{name: "uploader"}, instant{name: "patcher"})
+	pipe.SetStepTimeout("uploader", 20*time.Millisecond)
+	rec := &recorder{}
+	pipe.AddNotifier(rec)
+
+	err := pipe.RunFrom(context.Background(), 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "step uploader failed")
+	assert.Contains(t, err.Error(), "step timeout of 20ms exceeded")
+
+	last := rec.events[len(rec.events)-1]
+	assert.Equal(t, pipeline.EventRunFailed, last.Type)
+	assert.Equal(t, pipeline.EventStepFailed, rec.events[len(rec.events)-2].Type)
+	assert.Equal(t, "uploader", rec.events[len(rec.events)-2].Step)
+}
+
+func TestTimeoutBoundsWholeRun(t *testing.T) {
+	pipe := pipeline.NewPipeline(instant{name: "crawler"}, stuck{name: "uploader"})
+	pipe.SetTimeout(20 * time.Millisecond)
+	// the step's own limit is longer, so the run's applies
+	pipe.SetStepTimeout("uploader", time.Hour)
+
+	err := pipe.RunFrom(context.Background(), 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "pipeline timeout of 20ms exceeded")
+}
+
+func TestParseStepTimeouts(t *testing.T) {
+	timeouts, err := pipeline.ParseStepTimeouts("crawler=30m, uploader=2h")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"crawler": 30 * time.Minute, "uploader": 2 * time.Hour}, timeouts)
+
+	for _, bad := range []string{"crawler", "=1h", "crawler=soon", "crawler=-1m"} {
+		_, err := pipeline.ParseStepTimeouts(bad)
+		assert.Error(t, err, bad)
+	}
+}
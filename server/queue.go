@@ -0,0 +1,354 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+)
+
+// ErrQueueFull is returned by Submit when the queue is at capacity
+var ErrQueueFull = errors.New("job queue is full")
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// JobSpec describes one pipeline run submitted through the API
+type JobSpec struct {
+	Tenant string `json:"tenant"`
+	URL    string `json:"url"`
+	Folder string `json:"folder,omitempty"`
+	Depth  int    `json:"depth,omitempty"`
+
+	// Callbacks receive signed step and run events
+	Callbacks []string `json:"callbacks,omitempty"`
+}
+
+// Job is a submitted pipeline run and its current state
+type Job struct {
+	ID          string    `json:"id"`
+	Spec        JobSpec   `json:"spec"`
+	Status      Status    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	OutDir      string    `json:"out_dir"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+
+	// CurrentStep is the step a running job is executing
+	CurrentStep string `json:"current_step,omitempty"`
+	// Steps records the outcome of every step that finished
+	Steps []StepRecord `json:"steps,omitempty"`
+	// Artifacts lists the files the run left in OutDir
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// StepRecord is the outcome of one pipeline step of a job
+type StepRecord struct {
+	Step     string        `json:"step"`
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+	Stats    any           `json:"stats,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// RunFunc executes a single job's pipeline, reporting step outcomes to events
+type RunFunc func(ctx context.Context, job *Job, events pipeline.Notifier) error
+
+// Queue is a bounded FIFO of jobs executed by a fixed number of workers. A
+// tenant never has more than maxPerTenant jobs running at once; its other
+// jobs wait while jobs of other tenants are allowed to overtake them.
+type Queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	outDir       string
+	pending      []*Job
+	jobs         map[string]*Job
+	running      map[string]int // running jobs per tenant
+	capacity     int
+	maxPerTenant int
+	workers      int
+	closed       bool
+
+	store Store
+	run   RunFunc
+}
+
+// NewQueue creates a queue holding at most capacity pending jobs. Every job
+// gets its own output directory below outDir/runs. A nil store keeps the run
+// history in memory only.
+func NewQueue(outDir string, capacity, workers, maxPerTenant int, store Store, run RunFunc) *Queue {
+	q := &Queue{
+		outDir:       outDir,
+		jobs:         make(map[string]*Job),
+		running:      make(map[string]int),
+		capacity:     capacity,
+		maxPerTenant: maxPerTenant,
+		workers:      workers,
+		store:        store,
+		run:          run,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Restore loads the run history from the store. Jobs that were still queued
+// are queued again; jobs that were running when the server stopped are
+// marked failed since their pipeline was cut short.
+func (q *Queue) Restore() error {
+	if q.store == nil {
+		return nil
+	}
+
+	jobs, err := q.store.List()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range jobs {
+		job := &jobs[i]
+		switch job.Status {
+		case StatusQueued:
+			q.pending = append(q.pending, job)
+		case StatusRunning:
+			job.Status = StatusFailed
+			job.Error = "interrupted by server restart"
+			job.FinishedAt = time.Now().UTC()
+			q.persist(job)
+		}
+		q.jobs[job.ID] = job
+	}
+	// the store lists jobs by ID, which is random; run them in the order
+	// they were submitted
+	slices.SortStableFunc(q.pending, func(a, b *Job) int {
+		return a.SubmittedAt.Compare(b.SubmittedAt)
+	})
+
+	slog.Info("restored run history",
+		slog.Int("runs", len(jobs)),
+		slog.Int("requeued", len(q.pending)))
+	return nil
+}
+
+// Start launches the workers; they stop once ctx is cancelled and the
+// currently running jobs return
+func (q *Queue) Start(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		q.cond.Broadcast()
+	}()
+	return &wg
+}
+
+// Submit enqueues a new job and returns it
+func (q *Queue) Submit(spec JobSpec) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) >= q.capacity {
+		return nil, ErrQueueFull
+	}
+
+	id := newJobID()
+	job := &Job{
+		ID:          id,
+		Spec:        spec,
+		Status:      StatusQueued,
+		OutDir:      filepath.Join(q.outDir, "runs", id),
+		SubmittedAt: time.Now().UTC(),
+	}
+	q.pending = append(q.pending, job)
+	q.jobs[job.ID] = job
+	q.persist(job)
+	q.cond.Signal()
+
+	slog.Info("job queued",
+		slog.String("job_id", job.ID),
+		slog.String("tenant", spec.Tenant),
+		slog.Int("pending", len(q.pending)))
+	return job, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of every known job
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// work runs jobs until the queue is closed
+func (q *Queue) work(ctx context.Context) {
+	for {
+		job := q.next()
+		if job == nil {
+			return
+		}
+
+		err := q.run(ctx, job, &stepRecorder{queue: q, job: job})
+		artifacts := listArtifacts(job.OutDir)
+
+		q.mu.Lock()
+		job.FinishedAt = time.Now().UTC()
+		job.Artifacts = artifacts
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = StatusSucceeded
+		}
+		q.running[job.Spec.Tenant]--
+		q.persist(job)
+		q.mu.Unlock()
+		// a tenant slot was freed, a waiting job may now be runnable
+		q.cond.Broadcast()
+
+		slog.Info("job finished",
+			slog.String("job_id", job.ID),
+			slog.String("tenant", job.Spec.Tenant),
+			slog.String("status", string(job.Status)))
+	}
+}
+
+// next blocks until a job is runnable and marks it running, or returns nil
+// once the queue is closed
+func (q *Queue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil
+		}
+		for i, job := range q.pending {
+			if q.running[job.Spec.Tenant] >= q.maxPerTenant {
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.running[job.Spec.Tenant]++
+			job.Status = StatusRunning
+			job.StartedAt = time.Now().UTC()
+			q.persist(job)
+			return job
+		}
+		q.cond.Wait()
+	}
+}
+
+// persist saves the job to the store; callers must hold q.mu
+func (q *Queue) persist(job *Job) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(*job); err != nil {
+		slog.Warn("failed to persist run",
+			slog.String("job_id", job.ID),
+			slog.Any("error", err))
+	}
+}
+
+// stepRecorder appends step outcomes to a job as the pipeline reports them
+type stepRecorder struct {
+	queue *Queue
+	job   *Job
+}
+
+// Notify implements pipeline.Notifier
+func (r *stepRecorder) Notify(ctx context.Context, ev pipeline.Event) {
+	r.queue.mu.Lock()
+	defer r.queue.mu.Unlock()
+
+	var status Status
+	switch ev.Type {
+	case pipeline.EventStepStarted:
+		r.job.CurrentStep = ev.Step
+		r.queue.persist(r.job)
+		return
+	case pipeline.EventStepCompleted:
+		status = StatusSucceeded
+	case pipeline.EventStepFailed:
+		status = StatusFailed
+	default:
+		return // run outcomes are recorded by the worker
+	}
+
+	r.job.CurrentStep = ""
+	r.job.Steps = append(r.job.Steps, StepRecord{
+		Step:     ev.Step,
+		Status:   status,
+		Duration: ev.Duration,
+		Stats:    ev.Stats,
+		Error:    ev.Error,
+	})
+	r.queue.persist(r.job)
+}
+
+// listArtifacts returns the names of the files a run left at the top of its
+// output directory (id_map.json, reports, …)
+func listArtifacts(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
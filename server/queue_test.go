@@ -0,0 +1,132 @@
+package server_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/rasha-hantash/gdoc-pipeline/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuePerTenantConcurrency(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running = map[string]int{}
+		peak    = map[string]int{}
+		done    sync.WaitGroup
+	)
+
+	queue := server.NewQueue(t.TempDir(), 10, 4, 1, nil, func(ctx context.Context, job *server.Job, _ pipeline.Notifier) error {
+		defer done.Done()
+		mu.Lock()
+		running[job.Spec.Tenant]++
+		peak[job.Spec.Tenant] = max(peak[job.Spec.Tenant], running[job.Spec.Tenant])
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running[job.Spec.Tenant]--
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx)
+
+	for _, tenant := range []string{"a", "a", "a", "b", "b"} {
+		done.Add(1)
+		_, err := queue.Submit(server.JobSpec{Tenant: tenant, URL: "https://docs.google.com/document/d/x"})
+		require.NoError(t, err)
+	}
+	done.Wait()
+
+	assert.Equal(t, 1, peak["a"], "tenant a must never run more than one job at a time")
+	assert.Equal(t, 1, peak["b"], "tenant b must never run more than one job at a time")
+}
+
+func TestQueueRejectsWhenFull(t *testing.T) {
+	queue := server.NewQueue(t.TempDir(), 1, 1, 1, nil, func(ctx context.Context, job *server.Job, _ pipeline.Notifier) error {
+		return nil
+	})
+
+	_, err := queue.Submit(server.JobSpec{Tenant: "a", URL: "u"})
+	require.NoError(t, err)
+
+	// no workers started, so the first job is still pending
+	_, err = queue.Submit(server.JobSpec{Tenant: "a", URL: "u"})
+	assert.ErrorIs(t, err, server.ErrQueueFull)
+}
+
+func TestQueueRestoresHistory(t *testing.T) {
+	dir := t.TempDir()
+	store, err := server.OpenBoltStore(dir + "/runs.db")
+	require.NoError(t, err)
+
+	noop := func(ctx context.Context, job *server.Job, _ pipeline.Notifier) error { return nil }
+
+	first := server.NewQueue(dir, 10, 1, 1, store, noop)
+	job, err := first.Submit(server.JobSpec{Tenant: "a", URL: "u"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// a new process sees the queued job and queues it again
+	store, err = server.OpenBoltStore(dir + "/runs.db")
+	require.NoError(t, err)
+	defer store.Close()
+
+	second := server.NewQueue(dir, 10, 1, 1, store, noop)
+	require.NoError(t, second.Restore())
+
+	restored, ok := second.Get(job.ID)
+	require.True(t, ok)
+	assert.Equal(t, server.StatusQueued, restored.Status)
+	assert.Equal(t, "a", restored.Spec.Tenant)
+}
+
+func TestQueueRestoresPendingJobsInSubmissionOrder(t *testing.T) {
+	dir := t.TempDir()
+	store, err := server.OpenBoltStore(dir + "/runs.db")
+	require.NoError(t, err)
+
+	noop := func(ctx context.Context, job *server.Job, _ pipeline.Notifier) error { return nil }
+	first := server.NewQueue(dir, 10, 1, 1, store, noop)
+	var submitted []string
+	for range 6 {
+		job, err := first.Submit(server.JobSpec{Tenant: "a", URL: "u"})
+		require.NoError(t, err)
+		submitted = append(submitted, job.ID)
+	}
+	require.NoError(t, store.Close())
+
+	store, err = server.OpenBoltStore(dir + "/runs.db")
+	require.NoError(t, err)
+	defer store.Close()
+
+	var (
+		mu   sync.Mutex
+		ran  []string
+		done sync.WaitGroup
+	)
+	done.Add(len(submitted))
+	second := server.NewQueue(dir, 10, 1, 1, store, func(ctx context.Context, job *server.Job, _ pipeline.Notifier) error {
+		defer done.Done()
+		mu.Lock()
+		ran = append(ran, job.ID)
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, second.Restore())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	second.Start(ctx)
+	done.Wait()
+
+	assert.Equal(t, submitted, ran)
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/webhook"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// Server exposes the job queue over a small JSON HTTP API. It doesn't
+// authenticate clients: tenants are whatever a client names, so it belongs
+// behind an authenticating proxy.
+type Server struct {
+	addr  string
+	queue *Queue
+
+	// Hosts jobs may send callbacks to; none accepts no callbacks
+	callbackHosts []string
+	// Secret the per-job callback secrets are derived from
+	hookSecret string
+}
+
+// Option configures optional Server behaviour
+type Option func(*Server)
+
+// WithCallbacks accepts job callbacks to the given hosts, signing each job's
+// payloads with a secret derived from secret and returned on submission
+func WithCallbacks(secret string, hosts ...string) Option {
+	return func(s *Server) {
+		s.hookSecret = secret
+		s.callbackHosts = hosts
+	}
+}
+
+// NewServer creates a new server listening on addr
+func NewServer(addr string, queue *Queue, opts ...Option) *Server {
+	s := &Server{addr: addr, queue: queue}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run serves the API until the context is cancelled, then waits for the
+// running jobs to stop
+func (s *Server) Run(ctx context.Context) error {
+	workers := s.queue.Start(ctx)
+
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", slog.String("addr", s.addr))
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	workers.Wait()
+	return nil
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handleSubmit)
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleGet)
+	mux.HandleFunc("GET /runs/{id}/artifacts/{name}", s.handleArtifact)
+
+	ui, _ := fs.Sub(uiFiles, "ui")
+	mux.Handle("GET /", http.FileServerFS(ui))
+	return mux
+}
+
+// handleSubmit queues a new run
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var spec JobSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if spec.URL == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	if spec.Tenant == "" {
+		spec.Tenant = "default"
+	}
+	if err := s.checkCallbacks(spec.Callbacks); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := s.queue.Submit(spec)
+	if errors.Is(err, ErrQueueFull) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	snapshot, _ := s.queue.Get(job.ID)
+	if len(spec.Callbacks) == 0 {
+		writeJSON(w, http.StatusAccepted, snapshot)
+		return
+	}
+	// only the submitter learns the secret; GET /runs never shows it
+	writeJSON(w, http.StatusAccepted, struct {
+		Job
+		CallbackSecret string `json:"callback_secret"`
+	}{snapshot, webhook.JobSecret(s.hookSecret, job.ID)})
+}
+
+// checkCallbacks rejects callback URLs outside the allowed hosts, so clients
+// can't make the server post to internal addresses
+func (s *Server) checkCallbacks(callbacks []string) error {
+	if len(callbacks) > 0 && len(s.callbackHosts) == 0 {
+		return errors.New("callbacks are not enabled on this server")
+	}
+	for _, c := range callbacks {
+		u, err := url.Parse(c)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("invalid callback URL %q", c)
+		}
+		if !slices.ContainsFunc(s.callbackHosts, func(h string) bool { return strings.EqualFold(h, u.Hostname()) }) {
+			return fmt.Errorf("callback host %q is not allowed", u.Hostname())
+		}
+	}
+	return nil
+}
+
+// handleList returns every known run, newest first
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	jobs := s.queue.List()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].SubmittedAt.After(jobs[j].SubmittedAt)
+	})
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleGet returns a single run
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleArtifact serves one of the files a run left in its output directory
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	// only files recorded as artifacts are served, never arbitrary paths
+	name := r.PathValue("name")
+	if !slices.Contains(job.Artifacts, name) {
+		writeError(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(job.OutDir, name))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", slog.Any("error", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
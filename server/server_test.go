@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/webhook"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// submit posts a job with the given callbacks and returns the response
+func submit(t *testing.T, s *Server, callbacks ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(JobSpec{Tenant: "eng", URL: "https://docs.google.com/document/d/root/edit", Callbacks: callbacks})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/runs", strings.NewReader(string(body))))
+	return w
+}
+
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	queue := NewQueue(t.TempDir(), 10, 1, 1, nil, func(context.Context, *Job, pipeline.Notifier) error { return nil })
+	return NewServer(":0", queue, opts...)
+}
+
+func TestCallbacksAreRefusedUnlessEnabled(t *testing.T) {
+	s := newTestServer(t)
+
+	assert.Equal(t, http.StatusAccepted, submit(t, s).Code)
+	w := submit(t, s, "https://hooks.example.com/run")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not enabled")
+}
+
+func TestCallbacksOnlyReachAllowedHosts(t *testing.T) {
+	s := newTestServer(t, WithCallbacks("s3cret", "hooks.example.com"))
+
+	for _, callback := range []string{
+		"http://169.254.169.254/latest/meta-data",
+		"http://localhost:8080/runs",
+		"https://hooks.example.com.evil.test/run",
+		"file:///etc/passwd",
+	} {
+		assert.Equal(t, http.StatusBadRequest, submit(t, s, callback).Code, callback)
+	}
+
+	w := submit(t, s, "https://HOOKS.example.com:8443/run")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var resp struct {
+		ID             string `json:"id"`
+		CallbackSecret string `json:"callback_secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, webhook.JobSecret("s3cret", resp.ID), resp.CallbackSecret)
+	assert.NotEqual(t, "s3cret", resp.CallbackSecret)
+
+	// other clients never see it
+	list := httptest.NewRecorder()
+	s.routes().ServeHTTP(list, httptest.NewRequest(http.MethodGet, "/runs", nil))
+	assert.NotContains(t, list.Body.String(), resp.CallbackSecret)
+}
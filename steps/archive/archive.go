@@ -0,0 +1,375 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	xhtml "golang.org/x/net/html"
+	"google.golang.org/api/drive/v3"
+)
+
+// Archive formats
+const (
+	FormatEPUB = "epub"
+	FormatPDF  = "pdf"
+)
+
+// ValidFormat reports whether f is an archive format
+func ValidFormat(f string) bool {
+	return f == FormatEPUB || f == FormatPDF
+}
+
+// FileName is the archive written at the output root for a format
+func FileName(format string) string {
+	return "archive." + format
+}
+
+// Exporter stitches the crawled documents, in link-tree order, into one
+// read-only EPUB or PDF with a table of contents
+type Exporter struct {
+	outDir string
+	format string
+	// Where the crawl output is read from; a local outDir unless configured
+	store storage.Storage
+	// Converts the combined HTML to PDF; needed for FormatPDF
+	driveService *drive.Service
+	// Shared budget every Drive API call draws from
+	limiter ratelimit.Limiter
+}
+
+// Option configures optional Exporter behaviour
+type Option func(*Exporter)
+
+// WithStorage reads the crawl output from the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(e *Exporter) {
+		e.store = s
+	}
+}
+
+// WithDriveService sets the Drive client PDF archives are rendered with
+func WithDriveService(svc *drive.Service) Option {
+	return func(e *Exporter) {
+		e.driveService = svc
+	}
+}
+
+// WithLimiter makes the exporter draw every Drive API call from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(e *Exporter) {
+		e.limiter = l
+	}
+}
+
+// NewExporter creates an exporter writing an archive in format
+func NewExporter(outDir, format string, opts ...Option) *Exporter {
+	e := &Exporter{
+		outDir:  outDir,
+		format:  format,
+		store:   storage.NewLocal(outDir),
+		limiter: ratelimit.Unlimited(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Name implements the Step interface
+func (e *Exporter) Name() string {
+	return "archive"
+}
+
+// Run writes archive.epub or archive.pdf from the crawl output
+func (e *Exporter) Run(ctx context.Context) error {
+	chapters, err := e.collect(ctx)
+	if err != nil {
+		return err
+	}
+	if len(chapters) == 0 {
+		slog.Warn("no documents to archive")
+		return nil
+	}
+	title := chapters[0].title
+
+	var data []byte
+	switch e.format {
+	case FormatEPUB:
+		data, err = buildEPUB(title, chapters)
+	case FormatPDF:
+		var page string
+		if page, err = buildHTML(title, chapters); err == nil {
+			data, err = e.renderPDF(ctx, title, page)
+		}
+	default:
+		return fmt.Errorf("unknown archive format %q", e.format)
+	}
+	if err != nil {
+		return fmt.Errorf("building %s archive: %w", e.format, err)
+	}
+
+	name := FileName(e.format)
+	if err := e.store.WriteFile(ctx, name, data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	slog.Info("archive written",
+		slog.String("file", name),
+		slog.Int("documents", len(chapters)),
+		slog.Int("bytes", len(data)))
+	return nil
+}
+
+// chapter is one document of the archive
+type chapter struct {
+	id    string
+	title string
+	// level is the document's depth in the link tree, the start document's
+	// being 0
+	level int
+	// file is the chapter's name inside an EPUB; anchor its ID in the
+	// combined HTML
+	file   string
+	anchor string
+	meta   *types.Metadata
+	raw    []byte
+	// body is the chapter's XHTML, with links to other chapters rewritten
+	body string
+}
+
+// collect loads every saved document ordered depth-first along the link
+// tree, which is how the output directories nest
+func (e *Exporter) collect(ctx context.Context) ([]*chapter, error) {
+	names, err := e.store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing output: %w", err)
+	}
+
+	var dirs []string
+	for _, name := range names {
+		if path.Base(name) == "metadata.json" {
+			dirs = append(dirs, storage.Dir(name))
+		}
+	}
+	// a parent sorts before its children, and siblings by name
+	slices.SortFunc(dirs, func(a, b string) int {
+		return slices.Compare(strings.Split(a, "/"), strings.Split(b, "/"))
+	})
+
+	var chapters []*chapter
+	rootLevel := -1
+	for _, dir := range dirs {
+		data, err := e.store.ReadFile(ctx, path.Join(dir, "metadata.json"))
+		if err != nil {
+			return nil, err
+		}
+		var m types.Metadata
+		if err := json.Unmarshal(data, &m); err != nil {
+			slog.Warn("skipping unreadable metadata", slog.String("dir", dir), slog.Any("error", err))
+			continue
+		}
+		if m.IsRedirect {
+			continue
+		}
+		if m.TextFileName() == "" {
+			slog.Warn("skipping document without a text export", slog.String("dir", dir), slog.String("format", m.ExportFormat()))
+			continue
+		}
+		raw, err := e.store.ReadFile(ctx, path.Join(dir, m.TextFileName()))
+		if err != nil {
+			slog.Warn("skipping document without content", slog.String("dir", dir), slog.Any("error", err))
+			continue
+		}
+
+		level := strings.Count(dir, "/")
+		if rootLevel < 0 {
+			rootLevel = level
+		}
+		n := len(chapters) + 1
+		ch := &chapter{
+			id:     m.ID,
+			title:  m.Title,
+			level:  max(level-rootLevel, 0),
+			file:   fmt.Sprintf("chapter-%04d.xhtml", n),
+			anchor: fmt.Sprintf("chapter-%04d", n),
+			meta:   &m,
+			raw:    raw,
+		}
+		chapters = append(chapters, ch)
+	}
+	return chapters, nil
+}
+
+// render fills in each chapter's body; target names where a link to
+// another chapter should point in the archive
+func render(chapters []*chapter, target func(*chapter) string) error {
+	byKey := make(map[string]*chapter, len(chapters))
+	for _, ch := range chapters {
+		byKey[ch.meta.Type+":"+ch.meta.ID] = ch
+	}
+	resolve := func(href string) string {
+		t, ok := gdocs.ParseTarget(href)
+		if !ok {
+			return href
+		}
+		for _, key := range t.Keys() {
+			if ch, ok := byKey[key]; ok {
+				return target(ch)
+			}
+		}
+		return href
+	}
+
+	for _, ch := range chapters {
+		var err error
+		switch ch.meta.Type {
+		case "sheet":
+			// the CSV carries no title of its own
+			ch.body, err = sheetTable(ch.raw, ch.meta.CSVDelimiter)
+			ch.body = "<h1>" + html.EscapeString(ch.title) + "</h1>" + ch.body
+		default:
+			ch.body, err = docBody(ch.raw, resolve)
+		}
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", ch.title, err)
+		}
+	}
+	return nil
+}
+
+// docBody returns the cleaned body of a doc export. Images are left out:
+// they live on Google's servers, which archive readers can't reach.
+func docBody(content []byte, resolve func(string) string) (string, error) {
+	cleaned, err := htmlclean.Clean(content)
+	if err != nil {
+		return "", err
+	}
+	safe, _, err := htmlclean.Sanitize(cleaned)
+	if err != nil {
+		return "", err
+	}
+	root, err := xhtml.Parse(bytes.NewReader(safe))
+	if err != nil {
+		return "", err
+	}
+	body := findBody(root)
+	if body == nil {
+		return "", nil
+	}
+	rewrite(body, resolve)
+
+	var b bytes.Buffer
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := xhtml.Render(&b, c); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func findBody(n *xhtml.Node) *xhtml.Node {
+	if n.Type == xhtml.ElementNode && n.Data == "body" {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if b := findBody(c); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// rewrite drops images, strips ids that could clash between chapters and
+// points links to crawled documents at their chapter
+func rewrite(n *xhtml.Node, resolve func(string) string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == xhtml.ElementNode && c.Data == "img" {
+			n.RemoveChild(c)
+			c = next
+			continue
+		}
+		if c.Type == xhtml.ElementNode {
+			attrs := c.Attr[:0]
+			for _, a := range c.Attr {
+				switch {
+				case a.Key == "href":
+					a.Val = resolve(a.Val)
+				case a.Key == "id":
+					continue
+				}
+				attrs = append(attrs, a)
+			}
+			c.Attr = attrs
+		}
+		rewrite(c, resolve)
+		c = next
+	}
+}
+
+// sheetTable renders a saved CSV as an HTML table
+func sheetTable(content []byte, delimiter string) (string, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	if d := []rune(delimiter); len(d) == 1 {
+		r.Comma = d[0]
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("<table>")
+	for _, row := range rows {
+		b.WriteString("<tr>")
+		for _, cell := range row {
+			b.WriteString("<td>" + html.EscapeString(cell) + "</td>")
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</table>")
+	return b.String(), nil
+}
+
+// toc renders the nested table of contents; href names a chapter's target
+func toc(chapters []*chapter, href func(*chapter) string) string {
+	var b strings.Builder
+	b.WriteString("<ol>")
+	prev := 0
+	for i, ch := range chapters {
+		// a level can only go one deeper than the previous entry's
+		level := min(ch.level, prev+1)
+		if i > 0 {
+			if level > prev {
+				b.WriteString("<ol>")
+			} else {
+				b.WriteString("</li>")
+				for ; prev > level; prev-- {
+					b.WriteString("</ol></li>")
+				}
+			}
+		}
+		fmt.Fprintf(&b, `<li><a href="%s">%s</a>`, html.EscapeString(href(ch)), html.EscapeString(ch.title))
+		prev = level
+	}
+	b.WriteString("</li>")
+	for ; prev > 0; prev-- {
+		b.WriteString("</ol></li>")
+	}
+	b.WriteString("</ol>")
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package archive_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/archive"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterEPUB(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := storage.NewLocal(dir)
+
+	write := func(name string, m types.Metadata, content string) {
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		require.NoError(t, s.WriteFile(ctx, name+"/metadata.json", data))
+		if content != "" {
+			require.NoError(t, s.WriteFile(ctx, name+"/"+m.ContentFileName(), []byte(content)))
+		}
+	}
+	write("handbook-d1", types.Metadata{ID: "d1", Type: "doc", Title: "Handbook"},
+		`<html><body><p id="h.x">See <a href="https://docs.google.com/spreadsheets/d/s1/edit">the budget</a><img src="https://lh3.googleusercontent.com/x"></p>`+
+			`<p><a href="https://www.google.com/url?q=https://docs.google.com/a/example.com/spreadsheets/d/s1/edit%23gid%3D0&amp;sa=D">wrapped</a>`+
+			`<a href="https://drive.google.com/open?id=s1">open</a>`+
+			`<a href="https://drive.google.com/file/d/s1/view">file</a>`+
+			`<a href="https://docs.google.com/spreadsheets/d/e/2PACX-s1/pubhtml">published</a></p></body></html>`)
+	write("handbook-d1/budget-s1", types.Metadata{ID: "s1", Type: "sheet", Title: "Budget", DiscoveredBy: "doc:d1"}, "item,cost\nrent,100\n")
+	write("handbook-d1/budget-s1-redirect", types.Metadata{ID: "s1", Type: "sheet", DiscoveredBy: "doc:d1", IsRedirect: true}, "")
+
+	require.NoError(t, archive.NewExporter(dir, archive.FormatEPUB).Run(ctx))
+
+	data, err := s.ReadFile(ctx, archive.FileName(archive.FormatEPUB))
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	// readers identify the book by an uncompressed mimetype entry first
+	require.NotEmpty(t, zr.File)
+	assert.Equal(t, "mimetype", zr.File[0].Name)
+	assert.Equal(t, zip.Store, zr.File[0].Method)
+
+	read := func(name string) string {
+		f, err := zr.Open(name)
+		require.NoError(t, err)
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	nav := read("OEBPS/nav.xhtml")
+	assert.Contains(t, nav, `<li><a href="chapter-0001.xhtml">Handbook</a><ol><li><a href="chapter-0002.xhtml">Budget</a></li></ol></li>`)
+
+	doc := read("OEBPS/chapter-0001.xhtml")
+	assert.Equal(t, 4, strings.Count(doc, `href="chapter-0002.xhtml"`))
+	assert.Contains(t, doc, `/spreadsheets/d/e/2PACX-s1/pubhtml`)
+	assert.NotContains(t, doc, "<img")
+	assert.NotContains(t, doc, `id="h.x"`)
+
+	sheet := read("OEBPS/chapter-0002.xhtml")
+	assert.Contains(t, sheet, "<td>rent</td><td>100</td>")
+}
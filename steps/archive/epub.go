@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// xhtmlPage wraps a body in the XHTML document EPUB readers expect
+func xhtmlPage(title, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><meta charset="utf-8"/><title>` + html.EscapeString(title) + `</title></head>
+<body>` + body + `</body>
+</html>`
+}
+
+// buildEPUB packages the chapters as an EPUB 3 book with a navigation
+// document listing them along the link tree
+func buildEPUB(title string, chapters []*chapter) ([]byte, error) {
+	if err := render(chapters, func(ch *chapter) string { return ch.file }); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// the mimetype must come first and uncompressed
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	w.Write([]byte("application/epub+zip"))
+
+	files := map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      packageDocument(title, chapters),
+		"OEBPS/nav.xhtml": xhtmlPage(title, `<nav epub:type="toc" id="toc"><h1>`+html.EscapeString(title)+`</h1>`+
+			toc(chapters, func(ch *chapter) string { return ch.file })+`</nav>`),
+	}
+	for _, ch := range chapters {
+		files["OEBPS/"+ch.file] = xhtmlPage(ch.title, ch.body)
+	}
+	names := []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml"}
+	for _, ch := range chapters {
+		names = append(names, "OEBPS/"+ch.file)
+	}
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// packageDocument is the OPF file: metadata, manifest and reading order
+func packageDocument(title string, chapters []*chapter) string {
+	var manifest, spine strings.Builder
+	for i, ch := range chapters {
+		fmt.Fprintf(&manifest, `    <item id="c%d" href="%s" media-type="application/xhtml+xml"/>`+"\n", i+1, ch.file)
+		fmt.Fprintf(&spine, `    <itemref idref="c%d"/>`+"\n", i+1)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:gdoc-pipeline:` + html.EscapeString(chapters[0].id) + `</dc:identifier>
+    <dc:title>` + html.EscapeString(title) + `</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+` + manifest.String() + `  </manifest>
+  <spine>
+    <itemref idref="nav"/>
+` + spine.String() + `  </spine>
+</package>`
+}
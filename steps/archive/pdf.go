@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// buildHTML combines the chapters into one HTML page, each starting on a
+// new page after the table of contents
+func buildHTML(title string, chapters []*chapter) (string, error) {
+	if err := render(chapters, func(ch *chapter) string { return "#" + ch.anchor }); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>` + html.EscapeString(title) + `</title></head><body>`)
+	b.WriteString(`<h1>` + html.EscapeString(title) + `</h1>`)
+	b.WriteString(toc(chapters, func(ch *chapter) string { return "#" + ch.anchor }))
+	for _, ch := range chapters {
+		fmt.Fprintf(&b, `<div id="%s" style="page-break-before: always">%s</div>`, ch.anchor, ch.body)
+	}
+	b.WriteString(`</body></html>`)
+	return b.String(), nil
+}
+
+// renderPDF converts the combined HTML to a temporary Google Doc, exports
+// it as PDF and deletes the Doc again. Drive exports are limited to 10 MB.
+func (e *Exporter) renderPDF(ctx context.Context, title, page string) ([]byte, error) {
+	if e.driveService == nil {
+		return nil, fmt.Errorf("PDF archives need a Drive client")
+	}
+
+	if err := e.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	tmp, err := e.driveService.Files.Create(&drive.File{
+		Name:     title + " (archive)",
+		MimeType: "application/vnd.google-apps.document",
+	}).Media(strings.NewReader(page), googleapi.ContentType("text/html; charset=utf-8")).
+		Fields("id").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("converting archive to a Doc: %w", err)
+	}
+	defer func() {
+		if err := e.driveService.Files.Delete(tmp.Id).Context(context.WithoutCancel(ctx)).Do(); err != nil {
+			slog.Warn("failed to delete temporary archive Doc", slog.String("id", tmp.Id), slog.Any("error", err))
+		}
+	}()
+
+	if err := e.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := e.driveService.Files.Export(tmp.Id, "application/pdf").Context(ctx).Download()
+	if err != nil {
+		return nil, fmt.Errorf("exporting archive as PDF: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, resp.Body); err != nil {
+		return nil, fmt.Errorf("reading PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// InaccessibleFile lists the documents whose export returned 401 or 403,
+// with the documents linking to each: the access to get before re-running
+const InaccessibleFile = "inaccessible.json"
+
+// AccessRequestsFile lists the documents the crawler couldn't read. It is
+// the manifest of access to ask for: the Drive API's accessproposals can
+// only be listed and resolved by a document's owners, and there is no call
+// to file one as the requester.
+const AccessRequestsFile = "access_requests.json"
+
+// errRestricted marks exports Google refused because the document isn't
+// shared publicly
+var errRestricted = errors.New("document is not publicly readable")
+
+// restrictedError is errRestricted with the HTTP status of the refusal; a
+// redirect to the sign-in page has none
+type restrictedError struct {
+	status int
+}
+
+func (e *restrictedError) Error() string { return errRestricted.Error() }
+func (e *restrictedError) Unwrap() error { return errRestricted }
+
+// recordRestricted notes a document the crawler couldn't read, looking up
+// its owners when a Drive client is configured and allowed to see them.
+// Further links to a recorded document only add their referrer.
+func (c *Crawler) recordRestricted(ctx context.Context, task types.Links, docType, id, cleanURL string, cause error) {
+	for i := range c.accessRequests {
+		r := &c.accessRequests[i]
+		if r.ID != id {
+			continue
+		}
+		if task.Parent != r.LinkedFrom && !slices.Contains(r.AlsoLinkedFrom, task.Parent) {
+			r.AlsoLinkedFrom = append(r.AlsoLinkedFrom, task.Parent)
+		}
+		return
+	}
+
+	req := types.AccessRequest{
+		ID:      id,
+		Type:    docType,
+		URL:     cleanURL,
+		FoundAt: time.Now().UTC(),
+	}
+	req.LinkedFrom = task.Parent
+	var re *restrictedError
+	if errors.As(cause, &re) {
+		req.Status = re.status
+	}
+
+	if c.driveSvc != nil && c.limiter.Wait(ctx) == nil {
+		f, err := c.driveSvc.Files.Get(id).
+			Fields("name", "owners(displayName,emailAddress)").
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			slog.Debug("owner lookup failed", slog.String("id", id), slog.Any("error", err))
+		} else {
+			req.Title = f.Name
+			for _, o := range f.Owners {
+				req.Owners = append(req.Owners, types.Owner{Name: o.DisplayName, Email: o.EmailAddress})
+			}
+		}
+	}
+	if req.Title == "" {
+		req.Title = c.titles[id] // prefetched with the linking document
+	}
+
+	slog.Warn("document not accessible, recorded for access request",
+		slog.String("url", cleanURL),
+		slog.Int("status", req.Status),
+		slog.Int("owners", len(req.Owners)))
+	c.accessRequests = append(c.accessRequests, req)
+	c.auditRestricted(req)
+}
+
+// writeAccessRequests merges the restricted documents found in this run into
+// access_requests.json, keeping entries other crawl workers already wrote
+func (c *Crawler) writeAccessRequests(ctx context.Context) error {
+	return writeMerged(ctx, c.store, AccessRequestsFile, c.accessRequests, func(e types.AccessRequest) (string, string) {
+		return e.ID, e.URL
+	})
+}
+
+// writeInaccessible merges the restricted documents found in this run into
+// inaccessible.json, naming each referrer by the source URL and title saved
+// in its metadata
+func (c *Crawler) writeInaccessible(ctx context.Context) error {
+	docs := make([]types.InaccessibleDoc, 0, len(c.accessRequests))
+	for _, r := range c.accessRequests {
+		doc := types.InaccessibleDoc{URL: r.URL, Title: r.Title, Status: r.Status}
+		for _, dir := range append([]string{r.LinkedFrom}, r.AlsoLinkedFrom...) {
+			ref := types.Referrer{Dir: dir}
+			if m, err := c.loadMetadata(ctx, dir); err == nil {
+				ref.URL, ref.Title = m.SourceURL, m.Title
+			}
+			doc.ReferredBy = append(doc.ReferredBy, ref)
+		}
+		docs = append(docs, doc)
+	}
+	return writeMerged(ctx, c.store, InaccessibleFile, docs, func(e types.InaccessibleDoc) (string, string) {
+		return e.URL, e.URL
+	})
+}
@@ -0,0 +1,61 @@
+package crawler_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictedDocumentsListEveryReferrer(t *testing.T) {
+	docs := exports{
+		"root": `<html><head><title>Root</title></head><body>` +
+			link("https://docs.google.com/document/d/child/edit") +
+			link("https://docs.google.com/document/d/private/edit") +
+			`</body></html>`,
+		"child": `<html><head><title>Child</title></head><body>` +
+			link("https://docs.google.com/document/d/private/edit") +
+			`</body></html>`,
+		"private": "forbidden",
+	}
+
+	out := t.TempDir()
+	c := crawler.NewCrawler(2, time.Second, "https://docs.google.com/document/d/root/edit", out, nil, nil,
+		crawler.WithHTTPTransport(docs))
+	require.NoError(t, c.Run(context.Background()))
+
+	data, err := os.ReadFile(filepath.Join(out, crawler.AccessRequestsFile))
+	require.NoError(t, err)
+	var reqs []types.AccessRequest
+	require.NoError(t, json.Unmarshal(data, &reqs))
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "private", reqs[0].ID)
+	assert.Equal(t, 403, reqs[0].Status)
+	assert.NotEmpty(t, reqs[0].LinkedFrom)
+	require.Len(t, reqs[0].AlsoLinkedFrom, 1)
+	assert.NotEqual(t, reqs[0].LinkedFrom, reqs[0].AlsoLinkedFrom[0])
+
+	data, err = os.ReadFile(filepath.Join(out, crawler.InaccessibleFile))
+	require.NoError(t, err)
+	var listed []types.InaccessibleDoc
+	require.NoError(t, json.Unmarshal(data, &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "https://docs.google.com/document/d/private/edit", listed[0].URL)
+	assert.Equal(t, 403, listed[0].Status)
+	var referrers []string
+	for _, ref := range listed[0].ReferredBy {
+		assert.NotEmpty(t, ref.Title, "referrer %s", ref.Dir)
+		referrers = append(referrers, ref.URL)
+	}
+	assert.ElementsMatch(t, []string{
+		"https://docs.google.com/document/d/root/edit",
+		"https://docs.google.com/document/d/child/edit",
+	}, referrers)
+}
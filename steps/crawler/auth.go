@@ -0,0 +1,30 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WithAuthenticatedExports fetches exports with client, an HTTP client
+// authorized as a user (see gapi.UserCredentials), so private documents
+// that user can open are crawled like public ones. Requests to hosts other
+// than Google's keep going out anonymously.
+func WithAuthenticatedExports(client *http.Client) Option {
+	return func(c *Crawler) {
+		// same timeout as anonymous fetches
+		c.authClient = &http.Client{Transport: client.Transport, Timeout: c.httpClient.Timeout}
+	}
+}
+
+// clientFor picks the HTTP client a request is sent with
+func (c *Crawler) clientFor(req *http.Request) *http.Client {
+	if c.authClient == nil || !isGoogleHost(req.URL.Hostname()) {
+		return c.httpClient
+	}
+	return c.authClient
+}
+
+// isGoogleHost reports whether credentials may be sent to host
+func isGoogleHost(host string) bool {
+	return host == "google.com" || strings.HasSuffix(host, ".google.com")
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientForKeepsCredentialsOnGoogleHosts(t *testing.T) {
+	authed := &http.Client{Transport: http.DefaultTransport}
+	c := NewCrawler(1, 5*time.Second, "", t.TempDir(), nil, nil, WithAuthenticatedExports(authed))
+
+	for url, wantAuth := range map[string]bool{
+		"https://docs.google.com/document/d/abc/export?format=html": true,
+		"https://google.com/url?q=x":                                true,
+		"https://example.com/page":                                  false,
+		"https://docs.google.com.example.com/document/d/abc":        false,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		got := c.clientFor(req)
+		assert.Equal(t, wantAuth, got != c.httpClient, url)
+	}
+	assert.Equal(t, 5*time.Second, c.authClient.Timeout)
+}
+
+func TestSendDrawsFromLimiter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	budget := ratelimit.NewBudget(0, 1)
+	c := NewCrawler(1, 5*time.Second, "", t.TempDir(), nil, nil, WithLimiter(budget.For("crawler")))
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := c.send(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int64(3), budget.Usage()["crawler"])
+}
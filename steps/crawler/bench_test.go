@@ -0,0 +1,52 @@
+package crawler_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+)
+
+// benchDoc builds an export-like document with n paragraphs, every other one
+// holding a link to another doc wrapped in Google's redirector
+func benchDoc(n int) []byte {
+	var sb strings.Builder
+	sb.WriteString(`<html><head><style>.c1{font-weight:700}</style></head><body class="c2">`)
+	for i := range n {
+		if i%2 == 0 {
+			fmt.Fprintf(&sb, `<p class="c1"><span class="c3"><a class="c4" href="https://www.google.com/url?q=https://docs.google.com/document/d/doc%06d/edit&amp;sa=D">link %d</a></span></p>`, i, i)
+		} else {
+			fmt.Fprintf(&sb, `<p class="c1"><span class="c3">paragraph %d of plain text</span></p>`, i)
+		}
+	}
+	sb.WriteString(`</body></html>`)
+	return []byte(sb.String())
+}
+
+func BenchmarkExtractLinks(b *testing.B) {
+	c := crawler.NewCrawler(5, time.Second, "", b.TempDir(), nil, nil)
+	content := benchDoc(2000)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := c.ExtractLinks(content, "doc", "https://docs.google.com/document/d/root000000/edit", 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCanonicalizeURL(b *testing.B) {
+	c := crawler.NewCrawler(5, time.Second, "", b.TempDir(), nil, nil)
+	urls := []string{
+		"https://docs.google.com/document/d/1AbCdEfGhIjKlMnOp/edit?usp=sharing",
+		"https://www.google.com/url?q=https://docs.google.com/spreadsheets/d/1AbCdEfGhIjKlMnOp/edit%23gid%3D0&sa=D",
+		"https://docs.google.com/document/u/0/d/1AbCdEfGhIjKlMnOp/preview",
+		"https://example.com/not-a-doc",
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		c.CanonicalizeURL(urls[i%len(urls)])
+	}
+}
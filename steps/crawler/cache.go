@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+)
+
+// exportCache keeps exported documents on local disk across runs. Content is
+// stored once per SHA-256 under blobs/; index/ maps a document export to the
+// Drive version it was downloaded at and the hash of its content. Files are
+// written via rename so pipelines sharing the cache never see partial writes.
+type exportCache struct {
+	dir string
+}
+
+// cacheEntry is one index record
+type cacheEntry struct {
+	Version int64  `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+func (e *exportCache) indexPath(key string) string {
+	return filepath.Join(e.dir, "index", key+".json")
+}
+
+func (e *exportCache) blobPath(sum string) string {
+	return filepath.Join(e.dir, "blobs", sum[:2], sum)
+}
+
+// get returns the cached export for key if it was downloaded at version
+func (e *exportCache) get(key string, version int64) ([]byte, bool) {
+	data, err := os.ReadFile(e.indexPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != version {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(e.blobPath(entry.SHA256))
+	if err != nil {
+		return nil, false
+	}
+	// guard against a corrupted blob
+	if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != entry.SHA256 {
+		return nil, false
+	}
+	return content, true
+}
+
+// put stores an export downloaded at version
+func (e *exportCache) put(key string, version int64, content []byte) error {
+	sum := sha256.Sum256(content)
+	entry := cacheEntry{Version: version, SHA256: hex.EncodeToString(sum[:])}
+
+	blob := e.blobPath(entry.SHA256)
+	if _, err := os.Stat(blob); err != nil {
+		if err := storage.WriteAtomic(blob, content); err != nil {
+			return err
+		}
+	}
+
+	index, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return storage.WriteAtomic(e.indexPath(key), index)
+}
+
+// cachedExport downloads an export unless the cache already holds it at the
+// document's current Drive version. Without a Drive client the version is
+// unknown and the cache is bypassed.
+func (c *Crawler) cachedExport(ctx context.Context, config docConfig, id string) ([]byte, error) {
+	if c.cache == nil || c.driveSvc == nil {
+		return c.fetchExport(ctx, config, id)
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	f, err := c.driveSvc.Files.Get(id).Fields("version").SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		slog.Debug("version lookup failed, bypassing cache", slog.String("id", id), slog.Any("error", err))
+		return c.fetchExport(ctx, config, id)
+	}
+
+	key := id + "-" + config.ext
+	if content, ok := c.cache.get(key, f.Version); ok {
+		slog.Debug("export cache hit", slog.String("id", id), slog.Int64("version", f.Version))
+		return content, nil
+	}
+
+	content, err := c.fetchExport(ctx, config, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cache.put(key, f.Version, content); err != nil {
+		slog.Warn("failed to cache export", slog.String("id", id), slog.Any("error", err))
+	}
+	return content, nil
+}
@@ -0,0 +1,236 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+
+	"golang.org/x/net/html"
+	"google.golang.org/api/docs/v1"
+)
+
+// AssetsDir holds the images saved next to a document's content
+const AssetsDir = "assets"
+
+// chartImageURL renders a chart of a link-shared spreadsheet as PNG
+const chartImageURL = "https://docs.google.com/spreadsheets/d/%s/embed/oimg?id=%d&oid=%d&format=image"
+
+// linkedChart is a Sheets chart embedded in a doc
+type linkedChart struct {
+	// position among the doc's inline images, in document order
+	index         int
+	spreadsheetID string
+	chartID       int64
+	// the image the doc itself holds, possibly stale
+	contentURI string
+}
+
+// captureCharts saves a fresh render of every Sheets chart embedded in the
+// doc to dir/assets and points the matching <img> of the saved HTML at it. The
+// HTML export only carries the image the doc last cached, or nothing at all.
+func (c *Crawler) captureCharts(ctx context.Context, dir, docID string) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	doc, err := c.docsSvc.Documents.Get(docID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("getting document: %w", err)
+	}
+
+	charts, inlineImages := findLinkedCharts(doc)
+	if len(charts) == 0 {
+		return nil
+	}
+
+	assets := make(map[int]string)
+	saved := make(map[string][]byte)
+	for _, chart := range charts {
+		title := c.chartTitle(ctx, chart)
+		name := fmt.Sprintf("chart-%s-%d.png", chart.spreadsheetID, chart.chartID)
+		data, err := c.saveChart(ctx, chart, path.Join(dir, AssetsDir, name))
+		if err != nil {
+			slog.Warn("failed to capture chart",
+				slog.String("spreadsheet_id", chart.spreadsheetID),
+				slog.Int64("chart_id", chart.chartID),
+				slog.Any("error", err))
+			continue
+		}
+		assets[chart.index] = AssetsDir + "/" + name
+		saved[AssetsDir+"/"+name] = data
+		slog.Info("captured chart",
+			slog.String("dir", dir),
+			slog.String("title", title),
+			slog.String("file", name))
+	}
+
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	filename := m.TextFileName()
+	content, err := c.linkChartImages(ctx, path.Join(dir, filename), inlineImages, assets)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		saved[filename] = content
+	}
+	return c.recordChecksums(ctx, dir, saved)
+}
+
+// findLinkedCharts walks the doc body in order, returning its linked charts
+// and the total number of inline images
+func findLinkedCharts(doc *docs.Document) ([]linkedChart, int) {
+	var charts []linkedChart
+	count := 0
+
+	var walk func([]*docs.StructuralElement)
+	walk = func(content []*docs.StructuralElement) {
+		for _, el := range content {
+			if el.Table != nil {
+				for _, row := range el.Table.TableRows {
+					for _, cell := range row.TableCells {
+						walk(cell.Content)
+					}
+				}
+			}
+			if el.Paragraph == nil {
+				continue
+			}
+			for _, pe := range el.Paragraph.Elements {
+				if pe.InlineObjectElement == nil {
+					continue
+				}
+				index := count
+				count++
+
+				obj, ok := doc.InlineObjects[pe.InlineObjectElement.InlineObjectId]
+				if !ok || obj.InlineObjectProperties == nil || obj.InlineObjectProperties.EmbeddedObject == nil {
+					continue
+				}
+				embedded := obj.InlineObjectProperties.EmbeddedObject
+				if embedded.LinkedContentReference == nil || embedded.LinkedContentReference.SheetsChartReference == nil {
+					continue
+				}
+				ref := embedded.LinkedContentReference.SheetsChartReference
+				chart := linkedChart{index: index, spreadsheetID: ref.SpreadsheetId, chartID: ref.ChartId}
+				if embedded.ImageProperties != nil {
+					chart.contentURI = embedded.ImageProperties.ContentUri
+				}
+				charts = append(charts, chart)
+			}
+		}
+	}
+
+	if doc.Body != nil {
+		walk(doc.Body.Content)
+	}
+	return charts, count
+}
+
+// chartTitle looks the chart up in its spreadsheet; an empty title means the
+// spreadsheet can't be read or the chart no longer exists there
+func (c *Crawler) chartTitle(ctx context.Context, chart linkedChart) string {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return ""
+	}
+	ss, err := c.sheetsSvc.Spreadsheets.Get(chart.spreadsheetID).
+		Fields("sheets(charts(chartId,spec(title)))").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return ""
+	}
+	for _, sheet := range ss.Sheets {
+		for _, ch := range sheet.Charts {
+			if ch.ChartId == chart.chartID && ch.Spec != nil {
+				return ch.Spec.Title
+			}
+		}
+	}
+	return ""
+}
+
+// saveChart downloads a current render of the chart, falling back to the
+// image cached in the doc when the spreadsheet isn't link-shared, and
+// returns the saved image
+func (c *Crawler) saveChart(ctx context.Context, chart linkedChart, name string) ([]byte, error) {
+	urls := []string{fmt.Sprintf(chartImageURL, chart.spreadsheetID, chart.chartID, chart.chartID)}
+	if chart.contentURI != "" {
+		urls = append(urls, chart.contentURI)
+	}
+
+	var lastErr error
+	for _, u := range urls {
+		resp, err := c.httpGet(ctx, u)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return data, c.store.WriteFile(ctx, name, data)
+	}
+	return nil, lastErr
+}
+
+// linkChartImages points the <img> elements at the given inline image
+// positions at the saved assets. The export lists inline images in document
+// order; if its count differs from the API's the mapping is unknown, so the
+// HTML is left alone. It returns the rewritten HTML, or nil if unchanged.
+func (c *Crawler) linkChartImages(ctx context.Context, htmlPath string, inlineImages int, assets map[int]string) ([]byte, error) {
+	if len(assets) == 0 {
+		return nil, nil
+	}
+
+	content, err := c.store.ReadFile(ctx, htmlPath)
+	if err != nil {
+		return nil, err
+	}
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var imgs []*html.Node
+	var dfs func(*html.Node)
+	dfs = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			imgs = append(imgs, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			dfs(child)
+		}
+	}
+	dfs(root)
+
+	if len(imgs) != inlineImages {
+		slog.Warn("chart images saved but not linked: export and document disagree on image count",
+			slog.String("path", htmlPath),
+			slog.Int("export_images", len(imgs)),
+			slog.Int("document_images", inlineImages))
+		return nil, nil
+	}
+
+	for index, src := range assets {
+		img := imgs[index]
+		for i := range img.Attr {
+			if img.Attr[i].Key == "src" {
+				img.Attr[i].Val = src
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), c.store.WriteFile(ctx, htmlPath, buf.Bytes())
+}
@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// CheckpointFile holds the state of an unfinished crawl at the output root
+const CheckpointFile = "crawl_state.json"
+
+// checkpointInterval is how often a running crawl saves its state
+const checkpointInterval = 10 * time.Second
+
+// crawlState is what a crawl needs to continue where it stopped: the links
+// still to process, the documents already saved, and the reports gathered
+type crawlState struct {
+	StartURL   string            `json:"start_url"`
+	SeedFolder string            `json:"seed_folder,omitempty"`
+	Pending    []types.Links     `json:"pending"`
+	Processed  map[string]string `json:"processed"`
+
+	AccessRequests []types.AccessRequest   `json:"access_requests,omitempty"`
+	Skipped        []types.SkippedDocument `json:"skipped,omitempty"`
+	External       []types.SkippedDocument `json:"external,omitempty"`
+	Sharing        []types.SharingEntry    `json:"sharing,omitempty"`
+	SavedAt        time.Time               `json:"saved_at"`
+}
+
+// WithResume continues the crawl recorded in crawl_state.json instead of
+// wiping the output and starting over. Without a checkpoint the crawl
+// starts from scratch.
+func WithResume() Option {
+	return func(c *Crawler) {
+		c.resume = true
+	}
+}
+
+// loadCheckpoint restores an interrupted crawl into f, reporting whether
+// there was one to restore
+func (c *Crawler) loadCheckpoint(ctx context.Context, f *memoryFrontier) (bool, error) {
+	data, err := c.store.ReadFile(ctx, CheckpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading %s: %w", CheckpointFile, err)
+	}
+	var state crawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return false, fmt.Errorf("parsing %s: %w", CheckpointFile, err)
+	}
+	if state.StartURL != c.startURL || state.SeedFolder != c.seedFolder {
+		return false, fmt.Errorf("%s belongs to a crawl of %s%s, not this one", CheckpointFile, state.StartURL, state.SeedFolder)
+	}
+
+	// documents still reserved when the crawl stopped were never saved
+	for canonical, dir := range state.Processed {
+		if dir == "" {
+			delete(state.Processed, canonical)
+		}
+	}
+	f.pending = state.Pending
+	f.processed = state.Processed
+	if f.processed == nil {
+		f.processed = make(map[string]string)
+	}
+	c.accessRequests = state.AccessRequests
+	c.skipped = state.Skipped
+	c.external = state.External
+	c.sharing = state.Sharing
+
+	slog.Info("resuming crawl",
+		slog.Time("checkpoint", state.SavedAt),
+		slog.Int("pending", len(state.Pending)),
+		slog.Int("documents", len(state.Processed)))
+	return true, f.maybeSpill(ctx)
+}
+
+// saveCheckpoint writes the crawl's state so -resume can pick it up. A link
+// interrupted mid-processing is put back at the head of the queue, and its
+// document forgotten so the resumed crawl saves it again.
+func (c *Crawler) saveCheckpoint(ctx context.Context, f *memoryFrontier, interrupted ...types.Links) {
+	if err := c.writeCheckpoint(ctx, f, interrupted); err != nil {
+		slog.Warn("failed to save crawl checkpoint", slog.Any("error", err))
+	}
+}
+
+func (c *Crawler) writeCheckpoint(ctx context.Context, f *memoryFrontier, interrupted []types.Links) error {
+	pending, processed, err := f.snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("snapshotting frontier: %w", err)
+	}
+	if len(interrupted) > 0 {
+		// a spilled frontier still lists the links it handed out
+		pending = slices.DeleteFunc(slices.Clone(pending), func(p types.Links) bool {
+			return slices.ContainsFunc(interrupted, func(l types.Links) bool {
+				return l.Link == p.Link && l.Form == p.Form
+			})
+		})
+		pending = append(slices.Clone(interrupted), pending...)
+		processed = maps.Clone(processed)
+		for _, l := range interrupted {
+			canonical, _ := c.CanonicalizeURL(l.Link)
+			delete(processed, c.resolvedKey(canonical))
+		}
+	}
+	data, err := json.Marshal(crawlState{
+		StartURL:       c.startURL,
+		SeedFolder:     c.seedFolder,
+		Pending:        pending,
+		Processed:      processed,
+		AccessRequests: c.accessRequests,
+		Skipped:        c.skipped,
+		External:       c.external,
+		Sharing:        c.sharing,
+		SavedAt:        time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	// an interrupted run still saves its state
+	return c.store.WriteFile(context.WithoutCancel(ctx), CheckpointFile, data)
+}
+
+// snapshot returns the links still to process and the saved documents
+func (f *memoryFrontier) snapshot(ctx context.Context) ([]types.Links, map[string]string, error) {
+	if f.disk != nil {
+		return f.disk.snapshot(context.WithoutCancel(ctx))
+	}
+	return f.pending, f.processed, nil
+}
+
+// queued returns the number of links still to process
+func (f *memoryFrontier) queued(ctx context.Context) (int, error) {
+	if f.disk != nil {
+		return f.disk.queued(ctx)
+	}
+	return len(f.pending), nil
+}
+
+// queued returns the number of links no worker has finished
+func (f *SQLiteFrontier) queued(ctx context.Context) (int, error) {
+	var n int
+	err := f.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM frontier WHERE status != 'done'`).Scan(&n)
+	return n, err
+}
+
+// snapshot returns the links no worker has finished and the saved documents
+func (f *SQLiteFrontier) snapshot(ctx context.Context) ([]types.Links, map[string]string, error) {
+	rows, err := f.db.QueryContext(ctx,
+		`SELECT link, depth, parent, form, discovered_by FROM frontier WHERE status != 'done' ORDER BY id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var pending []types.Links
+	for rows.Next() {
+		var l types.Links
+		if err := rows.Scan(&l.Link, &l.Depth, &l.Parent, &l.Form, &l.DiscoveredBy); err != nil {
+			return nil, nil, err
+		}
+		pending = append(pending, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// the database has a single connection, which rows holds until closed
+	rows.Close()
+
+	docs, err := f.db.QueryContext(ctx, `SELECT canonical, dir FROM documents WHERE dir != ''`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer docs.Close()
+	processed := make(map[string]string)
+	for docs.Next() {
+		var canonical, dir string
+		if err := docs.Scan(&canonical, &dir); err != nil {
+			return nil, nil, err
+		}
+		processed[canonical] = dir
+	}
+	return pending, processed, docs.Err()
+}
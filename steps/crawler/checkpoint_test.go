@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	start := "https://docs.google.com/document/d/root/edit"
+	c := &Crawler{startURL: start, store: store}
+
+	f := newMemoryFrontier()
+	f.pending = []types.Links{{Link: "https://docs.google.com/document/d/next/edit", Depth: 1, Parent: "root-dir"}}
+	f.processed = map[string]string{
+		"doc:root":   "root-dir",
+		"doc:half":   "root-dir/half",
+		"doc:failed": "",
+	}
+	c.accessRequests = []types.AccessRequest{{ID: "secret", Type: "doc"}}
+	half := types.Links{Link: "https://docs.google.com/document/d/half/edit", Depth: 1, Parent: "root-dir"}
+	c.saveCheckpoint(ctx, f, half)
+
+	resumed := &Crawler{startURL: start, store: store}
+	g := newMemoryFrontier()
+	ok, err := resumed.loadCheckpoint(ctx, g)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// the interrupted link comes first and its document is saved again
+	require.Len(t, g.pending, 2)
+	assert.Equal(t, half.Link, g.pending[0].Link)
+	assert.Equal(t, map[string]string{"doc:root": "root-dir"}, g.processed)
+	assert.Equal(t, c.accessRequests, resumed.accessRequests)
+
+	other := &Crawler{startURL: "https://docs.google.com/document/d/other/edit", store: store}
+	_, err = other.loadCheckpoint(ctx, newMemoryFrontier())
+	assert.ErrorContains(t, err, "belongs to a crawl of")
+
+	none := &Crawler{startURL: start, store: storage.NewLocal(t.TempDir())}
+	ok, err = none.loadCheckpoint(ctx, newMemoryFrontier())
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCheckpointOfSpilledFrontier(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	start := "https://docs.google.com/document/d/root/edit"
+	c := &Crawler{startURL: start, store: store}
+
+	f := newMemoryFrontier()
+	f.spillAt, f.spillDir = 1, t.TempDir()
+	defer f.close()
+	half := types.Links{Link: "https://docs.google.com/document/d/half/edit", Depth: 1, Parent: "root-dir"}
+	next := types.Links{Link: "https://docs.google.com/document/d/next/edit", Depth: 1, Parent: "root-dir"}
+	require.NoError(t, f.Push(ctx, half, next))
+	require.NotNil(t, f.disk)
+	claimed, ok, err := f.Next(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, half.Link, claimed.Link)
+	c.saveCheckpoint(ctx, f, claimed)
+
+	// the claimed link is listed once, and counted once when spilled again
+	resumed := &Crawler{startURL: start, store: store}
+	g := newMemoryFrontier()
+	g.spillAt, g.spillDir = 1, t.TempDir()
+	defer g.close()
+	ok, err = resumed.loadCheckpoint(ctx, g)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, g.disk)
+	n, err := g.queued(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	pending, _, err := g.snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, half.Link, pending[0].Link)
+	assert.Equal(t, next.Link, pending[1].Link)
+}
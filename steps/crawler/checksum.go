@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// checksum returns the hex SHA-256 recorded for a saved file
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// setChecksum records the checksum of a file saved in a document's
+// directory; name is relative to that directory
+func setChecksum(m *types.Metadata, name string, data []byte) {
+	if m.Checksums == nil {
+		m.Checksums = make(map[string]string)
+	}
+	m.Checksums[name] = checksum(data)
+}
+
+// recordChecksums updates the metadata of dir with the checksums of files
+// rewritten after the metadata was first saved
+func (c *Crawler) recordChecksums(ctx context.Context, dir string, files map[string][]byte) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	for name, data := range files {
+		setChecksum(m, name, data)
+	}
+	c.writeMetadata(ctx, dir, *m)
+	return nil
+}
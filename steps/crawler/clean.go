@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+)
+
+// WithCleanHTML saves, next to each doc's export, a copy stripped of the
+// export's generated classes and inline CSS (content.clean.html for
+// content.html) for consumers that want readable markup
+func WithCleanHTML() Option {
+	return func(c *Crawler) {
+		c.cleanHTML = true
+	}
+}
+
+// CleanFileName returns the name of the cleaned copy of a doc's content file
+func CleanFileName(contentFile string) string {
+	return strings.TrimSuffix(contentFile, path.Ext(contentFile)) + ".clean.html"
+}
+
+// writeCleanHTML saves the cleaned copy of the doc in dir
+func (c *Crawler) writeCleanHTML(ctx context.Context, dir string) error {
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	content, err := c.store.ReadFile(ctx, path.Join(dir, m.TextFileName()))
+	if err != nil {
+		return err
+	}
+
+	clean, err := htmlclean.Clean(content)
+	if err != nil {
+		return fmt.Errorf("cleaning HTML: %w", err)
+	}
+	name := CleanFileName(m.ContentFileName())
+	if err := c.store.WriteFile(ctx, path.Join(dir, name), clean); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return c.recordChecksums(ctx, dir, map[string][]byte{name: clean})
+}
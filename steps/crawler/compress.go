@@ -0,0 +1,32 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// WithExportCompression sets whether exports are requested gzip-compressed
+// (the default). Exports are requested with an explicit Accept-Encoding and
+// decompressed by the crawler, so they stay compressed even over transports
+// that don't negotiate compression themselves; turn it off to save CPU on
+// fast links.
+func WithExportCompression(enabled bool) Option {
+	return func(c *Crawler) {
+		c.gzipExports = enabled
+	}
+}
+
+// readBody reads a response body, decompressing it when the server sent it
+// gzip-encoded in answer to an explicit Accept-Encoding
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return io.ReadAll(resp.Body)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchExportDecompressesGzip(t *testing.T) {
+	const page = "<html><body><p>Quarterly plan</p></body></html>"
+
+	var acceptEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(page))
+		gz.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	// a transport that leaves compression to the caller
+	c := NewCrawler(0, 5*time.Second, "", t.TempDir(), nil, nil,
+		WithHTTPTransport(&http.Transport{DisableCompression: true}))
+
+	content, err := c.fetchExport(context.Background(), docConfig{exportURLTemplate: srv.URL + "/%s"}, "doc1")
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", acceptEncoding)
+	assert.Equal(t, page, string(content))
+}
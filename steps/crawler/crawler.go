@@ -5,45 +5,73 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gapi"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/retry"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
 	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
 	"golang.org/x/net/html"
 	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/forms/v1"
 	"google.golang.org/api/sheets/v4"
 )
 
 // CrawlStats holds statistics about the crawling process
 type CrawlStats struct {
-	TotalDocs   int
-	TotalSheets int
+	TotalDocs   int `json:"total_docs"`
+	TotalSheets int `json:"total_sheets"`
+	// Redirects counts links to documents already saved under another link
+	Redirects int `json:"redirects"`
+	// Skipped counts links that aren't Google documents, lie beyond the
+	// maximum depth or lead to documents the owner filter, link filter or
+	// domain allowlist excludes
+	Skipped int `json:"skipped"`
+	// Restricted counts documents the crawler wasn't allowed to read
+	Restricted int `json:"restricted"`
+	// Errors counts links that failed for any other reason
+	Errors int `json:"errors"`
+	// Forms counts the Google Forms docs link to, once per linking doc
+	Forms int `json:"forms,omitempty"`
+	// Reused counts documents an incremental crawl kept from the last run
+	Reused int `json:"reused,omitempty"`
+	// BytesDownloaded is the size of the exports fetched, before conversion
+	BytesDownloaded int64 `json:"bytes_downloaded"`
 }
 
 // Document type configuration
 type docConfig struct {
 	exportURLTemplate string
-	filename          string
+	ext               string
 	canExtractLinks   bool
 }
 
 var docConfigs = map[string]docConfig{
 	"doc": {
 		exportURLTemplate: "https://docs.google.com/document/d/%s/export?format=html",
-		filename:          "content.html",
+		ext:               "html",
 		canExtractLinks:   true,
 	},
 	"sheet": {
 		exportURLTemplate: "https://docs.google.com/spreadsheets/d/%s/export?format=csv",
-		filename:          "content.csv",
+		ext:               "csv",
 		canExtractLinks:   false,
 	},
 }
@@ -51,7 +79,7 @@ var docConfigs = map[string]docConfig{
 // Global regex patterns
 var (
 	redirectRe   = regexp.MustCompile(`^https?://(www\.)?google\.com/url`)
-	googleDocsRe = regexp.MustCompile(`docs\.google\.com/(document|spreadsheets)/d/([^/?#]+)`)
+	googleDocsRe = regexp.MustCompile(`docs\.google\.com/(?:a/[^/]+/)?(document|spreadsheets)/d/([^/?#]+)`)
 	nonAlphaNum  = regexp.MustCompile(`[^a-z0-9]+`)
 	multiHyphen  = regexp.MustCompile(`-{2,}`)
 	titleTrimRE  = regexp.MustCompile(`\s*-\s*Google (Docs?|Sheets?)\s*$`)
@@ -64,21 +92,264 @@ type Crawler struct {
 	startURL   string
 	outDir     string
 
+	// Where the output tree is written; a local outDir unless configured
+	store storage.Storage
+
 	// Cached Google API services (initialized lazily)
 	docsSvc   *docs.Service
 	sheetsSvc *sheets.Service
+
+	// Shared frontier for distributed crawls; nil means a fresh in-memory
+	// frontier per run
+	frontier Frontier
+
+	// Forms API client used to follow forms to their response sheets; nil
+	// leaves form links alone
+	formsSvc *forms.Service
+
+	// Drive API client used to look up the owners of restricted documents
+	driveSvc *drive.Service
+	// Exports kept across runs, keyed by Drive version (needs driveSvc)
+	cache *exportCache
+	// Content file name templates by document type
+	contentNames map[string]string
+	// Export format per document type; types without one use the default
+	formats map[string]string
+	// Field separator of saved sheets
+	csvDelimiter rune
+	// Whether to save a cleaned copy of each doc's HTML
+	cleanHTML bool
+	// Whether to save a Markdown conversion of each doc
+	markdown bool
+	// Whether exports are requested gzip-compressed
+	gzipExports bool
+	// How failed fetches are retried
+	retryPolicy retry.Policy
+	// Shared budget every request, export or API call, draws from
+	limiter ratelimit.Limiter
+	// Counts links queued and processed; nil counts nothing
+	progress *progress.Counter
+	// Records the links that couldn't be processed; nil records nothing
+	failures *failures.Recorder
+	// Entries the in-memory frontier holds before spilling to spillDir
+	spillAt  int
+	spillDir string
+	// Whether to save each document's revision listing (needs driveSvc)
+	revisions bool
+	// Whether to save fresh renders of embedded Sheets charts
+	charts bool
+	// Whether to download the images docs reference to their assets/
+	images bool
+	// Whether to save every worksheet of a sheet as its own CSV
+	sheetTabs bool
+	// How docs show pending suggestions (accepted, rejected, preserved);
+	// empty keeps the anonymous export
+	suggestions string
+
+	// Statistics of the current or last run
+	statsMu sync.Mutex
+	stats   CrawlStats
+
+	// Documents found this run that the crawler wasn't allowed to read
+	accessRequests []types.AccessRequest
+	// Owners (emails or domains) documents must belong to; empty allows all
+	owners []string
+	// Owner filter results by document ID, and the documents it or the
+	// link filter left out
+	ownerDecisions map[string]bool
+	skipped        []types.SkippedDocument
+	// Patterns linked documents must match one of (when set) and none of,
+	// and the link filter results by document ID
+	include       []Pattern
+	exclude       []Pattern
+	linkDecisions map[string]bool
+	// Domains linked documents must be owned by or shared within; empty
+	// allows all. Results by document ID, and the documents left out.
+	domains         []string
+	domainDecisions map[string]bool
+	external        []types.SkippedDocument
+	// Whether to report every document's sharing state, and the entries so far
+	sharingAudit bool
+	sharing      []types.SharingEntry
+	// Drive titles by document ID, resolved in batches (needs driveSvc)
+	titles map[string]string
+	// doc: or sheet: keys of the files shortcut links name, by file ID; ""
+	// when a file is neither or couldn't be resolved
+	shortcuts map[string]string
+	// Titles of form pages by URL, so forms many docs link to are fetched once
+	formTitles map[string]string
+	// Receives each saved directory during RunStreaming; nil otherwise
+	saved chan<- string
+	// Drive folder whose documents seed the crawl instead of startURL
+	seedFolder string
+	// More depth-0 URLs crawled next to startURL or seedFolder
+	extraSeeds []string
+	// Whether Run continues from crawl_state.json instead of starting over
+	resume bool
+	// Sends requests to Google as the authorized user; nil crawls anonymously
+	authClient *http.Client
+	// Collects the exported documents of a dry run; nil otherwise
+	dryRun *dryrun.Report
+	// Whether Run keeps the previous output and skips unchanged documents;
+	// previous indexes that output by canonical key, and visited holds the
+	// directories saved this run
+	incremental bool
+	previous    map[string]previousDoc
+	visited     map[string]bool
+}
+
+// Option configures optional Crawler behaviour
+type Option func(*Crawler)
+
+// WithFrontier makes the crawler take its work from a frontier shared with
+// other crawler processes. The output directory is shared too, so it is not
+// wiped at the start of the run.
+func WithFrontier(f Frontier) Option {
+	return func(c *Crawler) {
+		c.frontier = f
+	}
+}
+
+// WithFormsService makes the crawler follow links to Google Forms to their
+// linked response spreadsheets (when the credentials can read the form)
+func WithFormsService(svc *forms.Service) Option {
+	return func(c *Crawler) {
+		c.formsSvc = svc
+	}
+}
+
+// WithDriveService lets the crawler look up who owns the documents it can't
+// read, so access_requests.json says whom to ask
+func WithDriveService(svc *drive.Service) Option {
+	return func(c *Crawler) {
+		c.driveSvc = svc
+	}
+}
+
+// WithClients makes the crawler use the Docs, Sheets and Drive services of
+// a shared client set instead of those passed to NewCrawler
+func WithClients(cl *gapi.Clients) Option {
+	return func(c *Crawler) {
+		c.docsSvc, c.sheetsSvc, c.driveSvc = cl.Docs, cl.Sheets, cl.Drive
+	}
+}
+
+// WithRevisions saves each document's revision listing (who edited it and
+// when) to revisions.json. It needs a Drive client with read access to the
+// history, see WithDriveService.
+func WithRevisions() Option {
+	return func(c *Crawler) {
+		c.revisions = true
+	}
+}
+
+// WithCharts saves a current PNG of every Sheets chart embedded in a doc to
+// its assets/ folder and links the exported HTML to it
+func WithCharts() Option {
+	return func(c *Crawler) {
+		c.charts = true
+	}
+}
+
+// WithSuggestions renders docs through the Docs API with suggestions
+// accepted, rejected or preserved as <ins>/<del> markup, instead of using the
+// anonymous export (which always shows them accepted). See
+// ValidSuggestionsMode.
+func WithSuggestions(mode string) Option {
+	return func(c *Crawler) {
+		c.suggestions = mode
+	}
+}
+
+// WithFrontierSpill moves the in-memory crawl queue and the set of saved
+// documents into a temporary SQLite database in dir ("" for the system temp
+// directory) once they hold more than threshold entries. It has no effect
+// with WithFrontier.
+func WithFrontierSpill(threshold int, dir string) Option {
+	return func(c *Crawler) {
+		c.spillAt, c.spillDir = threshold, dir
+	}
+}
+
+// WithHTTPTransport sends the crawler's export and preview requests through
+// rt, typically the transport shared with the API clients
+func WithHTTPTransport(rt http.RoundTripper) Option {
+	return func(c *Crawler) {
+		c.httpClient.Transport = rt
+	}
+}
+
+// WithRetryPolicy sets how export, preview and chart fetches that fail
+// transiently are retried
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(c *Crawler) {
+		c.retryPolicy = p
+	}
+}
+
+// WithLimiter makes every request of the crawler, exports and page fetches
+// as well as API calls, draw from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(c *Crawler) {
+		c.limiter = l
+	}
+}
+
+// WithProgress reports the links the crawl queues and processes to c
+func WithProgress(c *progress.Counter) Option {
+	return func(cr *Crawler) {
+		cr.progress = c
+	}
+}
+
+// WithFailures records every link the crawl gives up on to r
+func WithFailures(r *failures.Recorder) Option {
+	return func(c *Crawler) {
+		c.failures = r
+	}
+}
+
+// WithStorage writes the output tree to the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(c *Crawler) {
+		c.store = s
+	}
+}
+
+// WithCache reuses exports downloaded by earlier runs, kept in dir, when the
+// document's Drive version hasn't changed. It needs WithDriveService to look
+// versions up.
+func WithCache(dir string) Option {
+	return func(c *Crawler) {
+		c.cache = &exportCache{dir: dir}
+	}
 }
 
 // NewCrawler creates a new crawler with the given configuration
-func NewCrawler(maxDepth int, httpTimeout time.Duration, startURL, outDir string, docSvc *docs.Service, sheetSvc *sheets.Service) *Crawler {
-	return &Crawler{
-		httpClient: &http.Client{Timeout: httpTimeout},
-		MaxDepth:   maxDepth,
-		startURL:   startURL,
-		outDir:     outDir,
-		docsSvc:    docSvc,
-		sheetsSvc:  sheetSvc,
+func NewCrawler(maxDepth int, httpTimeout time.Duration, startURL, outDir string, docSvc *docs.Service, sheetSvc *sheets.Service, opts ...Option) *Crawler {
+	c := &Crawler{
+		httpClient:      &http.Client{Timeout: httpTimeout},
+		MaxDepth:        maxDepth,
+		startURL:        startURL,
+		outDir:          outDir,
+		docsSvc:         docSvc,
+		sheetsSvc:       sheetSvc,
+		store:           storage.NewLocal(outDir),
+		csvDelimiter:    ',',
+		gzipExports:     true,
+		retryPolicy:     retry.Default(),
+		limiter:         ratelimit.Unlimited(),
+		titles:          make(map[string]string),
+		shortcuts:       make(map[string]string),
+		formTitles:      make(map[string]string),
+		ownerDecisions:  make(map[string]bool),
+		linkDecisions:   make(map[string]bool),
+		domainDecisions: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // Name implements the Step interface
@@ -86,64 +357,224 @@ func (c *Crawler) Name() string {
 	return "crawler"
 }
 
+// Stats returns the statistics of the current or last run
+func (c *Crawler) Stats() any {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
+}
+
+// count updates the run's statistics
+func (c *Crawler) count(f func(*CrawlStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	f(&c.stats)
+}
+
 // Run implements the Step interface and starts the crawling process
 func (c *Crawler) Run(ctx context.Context) error {
-	// Clean and create output directory
-	if err := os.RemoveAll(c.outDir); err != nil {
-		return fmt.Errorf("failed to remove output directory: %w", err)
-	}
-	if err := os.MkdirAll(c.outDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
 	start := time.Now()
-	stats := &CrawlStats{}
+	c.count(func(s *CrawlStats) { *s = CrawlStats{} })
+	c.accessRequests = nil
+	c.skipped = nil
+	c.sharing = nil
+	c.ownerDecisions = make(map[string]bool)
+	c.linkDecisions = make(map[string]bool)
+	c.domainDecisions = make(map[string]bool)
+	c.external = nil
+	// titles may have changed since the last run
+	c.titles = make(map[string]string)
+	c.shortcuts = make(map[string]string)
+	c.formTitles = make(map[string]string)
+	c.previous = make(map[string]previousDoc)
+	c.visited = nil
+
+	frontier := c.frontier
+	// local is the single crawler's own frontier, checkpointed as it goes;
+	// shared frontiers keep their state themselves
+	var local *memoryFrontier
+	resumed := false
+	if frontier == nil {
+		local = newMemoryFrontier()
+		local.spillAt, local.spillDir = c.spillAt, c.spillDir
+		defer local.close()
+		frontier = local
+
+		if c.resume {
+			var err error
+			if resumed, err = c.loadCheckpoint(ctx, local); err != nil {
+				return err
+			}
+		}
+		switch {
+		case c.incremental:
+			if err := c.loadPrevious(ctx); err != nil {
+				return err
+			}
+			if !resumed {
+				// what a resumed crawl saved before the interruption was
+				// never seen by this process, so it can't prune
+				c.visited = make(map[string]bool)
+			}
+		case !resumed:
+			// Clean output directory, a single crawler owns it
+			if err := c.store.RemoveAll(ctx, ""); err != nil {
+				return fmt.Errorf("failed to remove output directory: %w", err)
+			}
+		}
+	}
 
-	pendingLinks := []types.Links{{Link: c.startURL, Depth: 0, Parent: c.outDir}}
-	processedURLs := make(map[string]string)
+	if !resumed {
+		seeds, err := c.seeds(ctx)
+		if err != nil {
+			return err
+		}
+		if err := frontier.Seed(ctx, seeds...); err != nil {
+			return fmt.Errorf("seeding frontier: %w", err)
+		}
+		c.progress.Found(len(seeds))
+	} else if local != nil {
+		// a large checkpoint is spilled to disk as it loads
+		n, err := local.queued(ctx)
+		if err != nil {
+			return fmt.Errorf("counting queued links: %w", err)
+		}
+		c.progress.Found(n)
+	}
 
 	slog.Info("starting crawl",
 		slog.String("start_url", c.startURL),
-		slog.String("output_dir", c.outDir),
+		slog.String("output_dir", c.store.String()),
 		slog.Int("max_depth", c.MaxDepth))
 
-	for len(pendingLinks) > 0 {
-		currentLink := c.popLink(&pendingLinks)
+	lastCheckpoint := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			if local != nil {
+				c.saveCheckpoint(ctx, local)
+			}
+			return err
+		}
+		if local != nil && time.Since(lastCheckpoint) >= checkpointInterval {
+			c.saveCheckpoint(ctx, local)
+			lastCheckpoint = time.Now()
+		}
+		currentLink, ok, err := frontier.Next(ctx)
+		if err != nil {
+			return fmt.Errorf("claiming next link: %w", err)
+		}
+		if !ok {
+			break
+		}
 
-		if currentLink.Depth > c.MaxDepth {
-			continue
+		if currentLink.Depth <= c.MaxDepth {
+			if err := c.processUrl(ctx, frontier, currentLink); err != nil {
+				slog.Warn("error processing url",
+					slog.String("url", currentLink.Link),
+					slog.Any("error", err))
+				c.count(func(s *CrawlStats) { s.Errors++ })
+				c.progress.Failed()
+				c.failures.Add(currentLink.Link, err)
+			} else {
+				c.progress.Done()
+			}
+		} else {
+			c.count(func(s *CrawlStats) { s.Skipped++ })
+			c.progress.Done()
+		}
+		if err := ctx.Err(); err != nil && local != nil {
+			// the link may be half done; the resumed crawl starts with it
+			c.saveCheckpoint(ctx, local, currentLink)
+			return err
 		}
 
-		if err := c.processUrl(ctx, currentLink, processedURLs, &pendingLinks); err != nil {
-			slog.Warn("error processing url",
-				slog.String("url", currentLink.Link),
-				slog.Any("error", err))
-			continue
+		if err := frontier.Done(ctx, currentLink); err != nil {
+			return fmt.Errorf("completing link: %w", err)
 		}
 	}
 
+	if err := c.writeAccessRequests(ctx); err != nil {
+		return fmt.Errorf("writing access requests: %w", err)
+	}
+	if err := c.writeInaccessible(ctx); err != nil {
+		return fmt.Errorf("writing %s: %w", InaccessibleFile, err)
+	}
+	if err := c.writeSharingReport(ctx); err != nil {
+		return fmt.Errorf("writing sharing report: %w", err)
+	}
+	if err := c.writeSkippedDocuments(ctx); err != nil {
+		return fmt.Errorf("writing skipped documents: %w", err)
+	}
+	if err := c.writeSkippedExternal(ctx); err != nil {
+		return fmt.Errorf("writing skipped external documents: %w", err)
+	}
+	if c.visited != nil {
+		if err := c.pruneUnvisited(ctx); err != nil {
+			return fmt.Errorf("pruning output: %w", err)
+		}
+	}
+	if err := c.writeInventory(ctx); err != nil {
+		return fmt.Errorf("writing inventory: %w", err)
+	}
+	if err := c.writeGraph(ctx); err != nil {
+		return fmt.Errorf("writing link graph: %w", err)
+	}
+	if c.dryRun != nil {
+		if err := c.dryRun.Write(ctx, c.store); err != nil {
+			return fmt.Errorf("writing %s: %w", dryrun.File, err)
+		}
+	}
+	if local != nil {
+		if err := c.store.RemoveAll(ctx, CheckpointFile); err != nil {
+			return fmt.Errorf("removing %s: %w", CheckpointFile, err)
+		}
+	}
+
+	stats := c.Stats().(CrawlStats)
 	slog.Info("crawl completed",
 		slog.Duration("duration", time.Since(start)),
 		slog.Int("total_docs", stats.TotalDocs),
-		slog.Int("total_sheets", stats.TotalSheets))
+		slog.Int("total_sheets", stats.TotalSheets),
+		slog.Int("redirects", stats.Redirects),
+		slog.Int("skipped", stats.Skipped),
+		slog.Int("restricted", stats.Restricted),
+		slog.Int("forms", stats.Forms),
+		slog.Int("errors", stats.Errors),
+		slog.Int64("bytes_downloaded", stats.BytesDownloaded))
 	return nil
 }
 
-// popLink removes and returns the first link from the queue (FIFO)
-func (c *Crawler) popLink(pendingLinks *[]types.Links) types.Links {
-	link := (*pendingLinks)[0]
-	*pendingLinks = (*pendingLinks)[1:]
-	return link
-}
-
-func (c *Crawler) processUrl(ctx context.Context, task types.Links, processedURLs map[string]string, pendingLinks *[]types.Links) error {
+func (c *Crawler) processUrl(ctx context.Context, frontier Frontier, task types.Links) error {
 	canonical, cleanURL := c.CanonicalizeURL(task.Link)
 	if canonical == "" {
+		c.count(func(s *CrawlStats) { s.Skipped++ })
 		return nil // Not a Google Doc/Sheet, skip
 	}
+	if strings.HasPrefix(canonical, fileKeyPrefix) {
+		if canonical = c.resolveFile(ctx, extractID(canonical)); canonical == "" {
+			c.count(func(s *CrawlStats) { s.Skipped++ })
+			return nil
+		}
+	}
+
+	dir, reserved, err := frontier.Reserve(ctx, canonical)
+	if err != nil {
+		return fmt.Errorf("reserving document: %w", err)
+	}
+
+	// Another worker is still saving this document; revisit the link later
+	if !reserved && dir == "" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		c.progress.Found(1)
+		return frontier.Push(ctx, types.Links{Link: task.Link, Depth: task.Depth, Parent: task.Parent, Form: task.Form, DiscoveredBy: task.DiscoveredBy})
+	}
 
 	// Check for URLs that have already been processed and redirect to a different URL
-	if dir, duplicate := processedURLs[canonical]; duplicate {
+	if !reserved {
 		targetRel, _ := filepath.Rel(task.Parent, dir)
 		// Determine underlying document type (doc or sheet) for redirect metadata
 		parts := strings.SplitN(canonical, ":", 2)
@@ -152,82 +583,185 @@ func (c *Crawler) processUrl(ctx context.Context, task types.Links, processedURL
 			docType = parts[0]
 		}
 
-		c.writeMetadata(filepath.Join(task.Parent, filepath.Base(dir)+"-redirect"), types.Metadata{
-			Title:      filepath.Base(dir),
-			ID:         extractID(canonical),
-			SourceURL:  task.Link,
-			Depth:      task.Depth,
-			Type:       docType,
-			IsRedirect: true,
-			RedirectTo: targetRel,
+		redirectDir := path.Join(task.Parent, path.Base(dir)+"-redirect")
+		c.writeMetadata(ctx, redirectDir, types.Metadata{
+			Title:        path.Base(dir),
+			ID:           extractID(canonical),
+			SourceURL:    task.Link,
+			Depth:        task.Depth,
+			Type:         docType,
+			DiscoveredBy: task.DiscoveredBy,
+			IsRedirect:   true,
+			RedirectTo:   targetRel,
+			RedirectKey:  canonical,
+			LinkedForm:   task.Form,
 		})
 		slog.Info("duplicate url",
 			slog.String("url", canonical),
 			slog.String("redirect_to", targetRel))
-		return nil
+		c.count(func(s *CrawlStats) { s.Redirects++ })
+		return c.announce(ctx, redirectDir)
 	}
 
 	// Process based on type
 	if strings.HasPrefix(canonical, "doc:") || strings.HasPrefix(canonical, "sheet:") {
 		docType := strings.SplitN(canonical, ":", 2)[0]
+		if !c.linkAllowed(ctx, task, docType, extractID(canonical), cleanURL) ||
+			!c.ownerAllowed(ctx, task, docType, extractID(canonical), cleanURL) ||
+			!c.domainAllowed(ctx, task, docType, extractID(canonical), cleanURL) {
+			// free the key so the decision, not a pending reservation, answers later links
+			c.count(func(s *CrawlStats) { s.Skipped++ })
+			return frontier.Release(ctx, canonical)
+		}
 		links, dir, err := c.scrapeContent(ctx, task, docType, canonical, cleanURL)
 		if err != nil {
+			// Let a later link to the same document try again
+			if relErr := frontier.Release(ctx, canonical); relErr != nil {
+				slog.Warn("failed to release document", slog.String("url", canonical), slog.Any("error", relErr))
+			}
+			if errors.Is(err, errRestricted) {
+				c.recordRestricted(ctx, task, docType, extractID(canonical), cleanURL, err)
+				c.count(func(s *CrawlStats) { s.Restricted++ })
+				return nil
+			}
 			return err
 		}
-		processedURLs[canonical] = dir
+		c.count(func(s *CrawlStats) {
+			if docType == "doc" {
+				s.TotalDocs++
+			} else {
+				s.TotalSheets++
+			}
+		})
+		if err := frontier.Complete(ctx, canonical, dir); err != nil {
+			return fmt.Errorf("recording document: %w", err)
+		}
+		c.auditSharing(ctx, docType, extractID(canonical), cleanURL, dir)
+		c.reportFetch(ctx, dir)
+
+		if c.revisions && c.driveSvc != nil {
+			if err := c.writeRevisions(ctx, dir, extractID(canonical)); err != nil {
+				// public documents usually hide their history from non-editors
+				slog.Info("revision history not available",
+					slog.String("url", canonical),
+					slog.Any("error", err))
+			}
+		}
 
 		// Only docs extract links for further crawling
 		if docType == "doc" {
-			*pendingLinks = append(*pendingLinks, links...)
+			if c.charts {
+				if err := c.captureCharts(ctx, dir, extractID(canonical)); err != nil {
+					slog.Warn("failed to capture charts",
+						slog.String("url", canonical),
+						slog.Any("error", err))
+				}
+			}
+			if c.images {
+				if err := c.saveImages(ctx, dir); err != nil {
+					slog.Warn("failed to save images",
+						slog.String("url", canonical),
+						slog.Any("error", err))
+				}
+			}
+			if c.cleanHTML {
+				if err := c.writeCleanHTML(ctx, dir); err != nil {
+					slog.Warn("failed to save clean HTML",
+						slog.String("url", canonical),
+						slog.Any("error", err))
+				}
+			}
+			if c.markdown {
+				if err := c.writeMarkdown(ctx, dir); err != nil {
+					slog.Warn("failed to save Markdown",
+						slog.String("url", canonical),
+						slog.Any("error", err))
+				}
+			}
+			links = append(links, c.recordForms(ctx, dir, canonical, task.Depth+1)...)
+			if err := c.announce(ctx, dir); err != nil {
+				return err
+			}
+			c.progress.Found(len(links))
+			return frontier.Push(ctx, links...)
 		}
-		return nil
+		if c.sheetTabs {
+			if err := c.saveTabs(ctx, dir, extractID(canonical)); err != nil {
+				slog.Warn("failed to save sheet tabs",
+					slog.String("url", canonical),
+					slog.Any("error", err))
+			}
+		}
+		return c.announce(ctx, dir)
 	}
 
 	return nil
 }
 
+// RunStreaming runs the crawl like Run, sending the directory of every
+// document and redirect to saved as soon as it is completely written. A
+// full channel pauses the crawl. saved is closed when the crawl ends.
+func (c *Crawler) RunStreaming(ctx context.Context, saved chan<- string) error {
+	defer close(saved)
+	c.saved = saved
+	defer func() { c.saved = nil }()
+	return c.Run(ctx)
+}
+
+// announce hands a finished directory to the streaming consumer, if any
+func (c *Crawler) announce(ctx context.Context, dir string) error {
+	if c.saved == nil {
+		return nil
+	}
+	select {
+	case c.saved <- dir:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // CanonicalizeURL normalizes any Google Docs/Sheets link so the crawler sees each logical
 // document exactly once. Links to the same file can look wildly different:
 //   - Google's redirector (`https://www.google.com/url?q=...`)
 //   - Trailing path modifiers (`/edit`, `/view`, `/preview` …)
 //   - Tracking query-string parameters (`?usp=sharing`, `&pli=1` …)
 //   - Fragment identifiers (`#heading=h.gjdgxs`)
+//   - Workspace domain prefixes (`docs.google.com/a/<domain>/document/d/…`)
+//   - Shortcut forms (`docs.google.com/open?id=<ID>`, `drive.google.com/file/d/<ID>/view`)
 //
 // If we compared raw URLs we would store duplicates and re-crawl the same file many times.
 // Instead we collapse every variant to a *canonical key* and a cleaned URL:
 //
-//	key   →  "doc:<ID>" | "sheet:<ID>"
+//	key   →  "doc:<ID>" | "sheet:<ID>" | "file:<ID>"
 //	clean →  absolute URL without redirector, params or fragments
 //
 // The key feeds the `processedURLs` map so duplicates become lightweight redirect entries
-// and are skipped on subsequent visits. See crawler_test.go for concrete examples.
+// and are skipped on subsequent visits. Shortcut forms don't say whether they name a doc
+// or a sheet, so they get a "file:" key that processUrl resolves before reserving the
+// document. See crawler_test.go for concrete examples.
 func (c *Crawler) CanonicalizeURL(rawURL string) (canonicalKey, cleanURL string) {
 	// Step 1: If a URL is a redirect of a another URL then unwrap redirects (max 3 levels)
-	cleanURL = rawURL
-	for i := 0; i < 3 && redirectRe.MatchString(cleanURL); i++ {
-		parsed, err := url.Parse(cleanURL)
-		if err != nil {
-			break
-		}
-		q := parsed.Query().Get("q")
-		if q == "" {
-			break
-		}
-		unescaped, err := url.QueryUnescape(q)
-		if err != nil {
-			break
-		}
-		cleanURL = unescaped
-	}
+	cleanURL = unwrapRedirect(rawURL)
 
 	// Step 2: Extract type and ID in one pass
 	matches := googleDocsRe.FindStringSubmatch(cleanURL)
 	if len(matches) < 3 {
+		// open?id= and drive.google.com/file links don't say what they
+		// point to; processUrl resolves their file: key
+		if id := shortcutID(cleanURL); id != "" {
+			return fileKeyPrefix + id, cleanURL
+		}
 		return "", cleanURL // Not a Google Doc/Sheet
 	}
 
 	docType := matches[1] // "document" or "spreadsheets"
 	docID := matches[2]
+	if docID == "e" {
+		// published (/d/e/<token>/pub) links carry a publish token, not the
+		// file ID, and can't be exported
+		return "", cleanURL
+	}
 
 	// Step 3: Create canonical key
 	switch docType {
@@ -242,6 +776,28 @@ func (c *Crawler) CanonicalizeURL(rawURL string) (canonicalKey, cleanURL string)
 	return canonicalKey, cleanURL
 }
 
+// unwrapRedirect strips up to three levels of Google's redirector
+// (`https://www.google.com/url?q=...`) from a link
+func unwrapRedirect(rawURL string) string {
+	cleanURL := rawURL
+	for i := 0; i < 3 && redirectRe.MatchString(cleanURL); i++ {
+		parsed, err := url.Parse(cleanURL)
+		if err != nil {
+			break
+		}
+		q := parsed.Query().Get("q")
+		if q == "" {
+			break
+		}
+		unescaped, err := url.QueryUnescape(q)
+		if err != nil {
+			break
+		}
+		cleanURL = unescaped
+	}
+	return cleanURL
+}
+
 // extractID extracts just the ID from a canonical key
 func extractID(canonicalKey string) string {
 	parts := strings.SplitN(canonicalKey, ":", 2)
@@ -257,45 +813,68 @@ func (c *Crawler) scrapeContent(ctx context.Context, t types.Links, docType, can
 		return nil, "", fmt.Errorf("could not extract %s ID from canonical %s", docType, canonical)
 	}
 
-	config, exists := docConfigs[docType]
+	format := c.format(docType)
+	config, exists := exportConfig(docType, format)
 	if !exists {
 		return nil, "", fmt.Errorf("unsupported document type: %s", docType)
 	}
 
-	// Build export URL and fetch content
-	exportURL := fmt.Sprintf(config.exportURLTemplate, id)
-	resp, err := c.httpGet(ctx, exportURL)
-	if err != nil {
-		return nil, "", err
+	var title, sourceEncoding string
+	var err error
+	content, modified, reused := c.reuseUnchanged(ctx, canonical, id)
+	if reused {
+		// saved content is already normalized
+		sourceEncoding = c.previous[canonical].meta.SourceEncoding
+		c.count(func(s *CrawlStats) { s.Reused++ })
+	} else {
+		content, title, err = c.fetchContent(ctx, docType, config, id)
+		if err != nil {
+			return nil, "", err
+		}
+		c.count(func(s *CrawlStats) { s.BytesDownloaded += int64(len(content)) })
+		if format == "csv" {
+			content, sourceEncoding, err = NormalizeCSV(content, c.csvDelimiter)
+			if err != nil {
+				return nil, "", err
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", fmt.Errorf("reading content: %w", err)
+	// page is the HTML export links, title and text are read from
+	page := content
+	if docType == "doc" && format != "html" {
+		if page, err = c.htmlPage(ctx, canonical, id, reused); err != nil {
+			return nil, "", err
+		}
 	}
 
 	// Extract title and links (if applicable)
-	var title string
 	var links []types.Links
-	if docConfigs[docType].canExtractLinks {
-		links, err = c.ExtractLinks(content, docType, cleanURL, t.Depth)
+	var selfLinks []string
+	if config.canExtractLinks {
+		links, selfLinks, err = c.extractLinks(page, cleanURL, t.Depth+1)
 		if err != nil {
 			return nil, "", err
 		}
+		c.prefetchTitles(ctx, links)
 	}
 
 	// Extract title based on document type
 	switch docType {
 	case "sheet":
-		// For sheets, extract title from preview page (CSV doesn't contain title)
-		title, err = c.fetchSheetTitle(ctx, id)
-		if err != nil {
-			return nil, "", err
+		// CSV doesn't contain the title; ask Drive, then the preview page
+		title = c.lookupTitle(ctx, id)
+		if title == "" {
+			title, err = c.fetchSheetTitle(ctx, id)
+			if err != nil {
+				return nil, "", err
+			}
 		}
 	case "doc":
-		// Try to extract title from HTML content first
-		title = c.extractTitleFromHTML(content)
+		// Try to extract title from HTML content first, unless the API gave it
+		if title == "" {
+			title = c.extractTitleFromHTML(page)
+		}
 		// If HTML extraction fails, try API as fallback
 		if title == "" {
 			title, err = c.fetchDocTitle(ctx, id)
@@ -311,16 +890,20 @@ func (c *Crawler) scrapeContent(ctx context.Context, t types.Links, docType, can
 	}
 
 	slug := c.makeSlug(title, id)
-	dir := filepath.Join(t.Parent, slug)
-
-	// Create directory and write content
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return nil, "", fmt.Errorf("creating directory: %w", err)
-	}
+	dir := path.Join(t.Parent, slug)
+	filename := c.contentFileName(docType, slug, id)
 
-	if err := os.WriteFile(filepath.Join(dir, config.filename), content, 0o644); err != nil {
+	// Write content
+	if err := c.store.WriteFile(ctx, path.Join(dir, filename), content); err != nil {
 		return nil, "", fmt.Errorf("writing content: %w", err)
 	}
+	var htmlFile string
+	if docType == "doc" && format != "html" {
+		htmlFile = HTMLFileName(filename)
+		if err := c.store.WriteFile(ctx, path.Join(dir, htmlFile), page); err != nil {
+			return nil, "", fmt.Errorf("writing %s: %w", htmlFile, err)
+		}
+	}
 
 	// Update links parent directory now that we know the final dir
 	for i := range links {
@@ -328,13 +911,35 @@ func (c *Crawler) scrapeContent(ctx context.Context, t types.Links, docType, can
 	}
 
 	// Write metadata
-	c.writeMetadata(dir, types.Metadata{
-		Title:     title,
-		ID:        id,
-		SourceURL: t.Link,
-		Depth:     t.Depth,
-		Type:      docType,
-	})
+	m := types.Metadata{
+		Title:        title,
+		ID:           id,
+		SourceURL:    t.Link,
+		Depth:        t.Depth,
+		DiscoveredBy: t.DiscoveredBy,
+		Type:         docType,
+		LinkedForm:   t.Form,
+		SelfLinks:    selfLinks,
+		LinksTo:      c.linkedKeys(links),
+		ContentFile:  filename,
+		HTMLFile:     htmlFile,
+	}
+	if format != types.DefaultFormats[docType] {
+		m.Format = format
+	}
+	c.recordEncoding(&m, sourceEncoding)
+	if docType == "doc" || format == "csv" {
+		describeContent(&m, page)
+	}
+	setChecksum(&m, filename, content)
+	if htmlFile != "" {
+		setChecksum(&m, htmlFile, page)
+	}
+	if c.incremental {
+		m.ModifiedTime = modified
+		m.Change = c.changeOf(canonical, content, reused)
+	}
+	c.writeMetadata(ctx, dir, m)
 
 	slog.Info("saved url",
 		slog.String("url", t.Link),
@@ -343,10 +948,177 @@ func (c *Crawler) scrapeContent(ctx context.Context, t types.Links, docType, can
 	return links, dir, nil
 }
 
+// linkedKeys returns the canonical keys of the documents links point at,
+// each once, in link order
+func (c *Crawler) linkedKeys(links []types.Links) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, l := range links {
+		key, _ := c.CanonicalizeURL(l.Link)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// extractHrefs returns the raw href of every anchor in the HTML content
+func (c *Crawler) extractHrefs(content []byte) []string {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var hrefs []string
+	var dfs func(*html.Node)
+	dfs = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key == "href" {
+					hrefs = append(hrefs, attr.Val)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			dfs(child)
+		}
+	}
+
+	dfs(root)
+	return hrefs
+}
+
+// fetchContent returns a document's content, rendered through the Docs API
+// when a suggestions mode is set and exported anonymously otherwise. The
+// title is only known in the former case.
+func (c *Crawler) fetchContent(ctx context.Context, docType string, config docConfig, id string) ([]byte, string, error) {
+	if docType == "doc" && c.suggestions != "" {
+		return c.renderDoc(ctx, id)
+	}
+	content, err := c.cachedExport(ctx, config, id)
+	return content, "", err
+}
+
+// fetchExport downloads the exported content of a document
+func (c *Crawler) fetchExport(ctx context.Context, config docConfig, id string) ([]byte, error) {
+	exportURL := fmt.Sprintf(config.exportURLTemplate, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, exportURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if c.gzipExports {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("reading content: %w", err)
+	}
+	return content, nil
+}
+
+// Refresh re-exports an already crawled document into its existing directory.
+// The title and slug are kept as-is so later steps find the document where
+// they left it; only the content and crawl timestamp change.
+func (c *Crawler) Refresh(ctx context.Context, dir string) error {
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+
+	config, exists := exportConfig(m.Type, m.ExportFormat())
+	if !exists {
+		return fmt.Errorf("unsupported document type: %s", m.Type)
+	}
+
+	content, _, err := c.fetchContent(ctx, m.Type, config, m.ID)
+	if err != nil {
+		return err
+	}
+	if m.ExportFormat() == "csv" {
+		var sourceEncoding string
+		content, sourceEncoding, err = NormalizeCSV(content, c.csvDelimiter)
+		if err != nil {
+			return err
+		}
+		c.recordEncoding(m, sourceEncoding)
+	}
+
+	filename := m.ContentFileName()
+	if err := c.store.WriteFile(ctx, path.Join(dir, filename), content); err != nil {
+		return fmt.Errorf("writing content: %w", err)
+	}
+	page := content
+	if m.HTMLFile != "" {
+		htmlConfig, _ := exportConfig(m.Type, "html")
+		if page, err = c.cachedExport(ctx, htmlConfig, m.ID); err != nil {
+			return err
+		}
+		if err := c.store.WriteFile(ctx, path.Join(dir, m.HTMLFile), page); err != nil {
+			return fmt.Errorf("writing %s: %w", m.HTMLFile, err)
+		}
+		setChecksum(m, m.HTMLFile, page)
+	}
+	if m.TextFileName() != "" {
+		describeContent(m, page)
+	}
+	setChecksum(m, filename, content)
+	// the refresh, not the last incremental crawl, decides what's changed
+	m.Change = ""
+	c.writeMetadata(ctx, dir, *m)
+
+	if c.images && m.Type == "doc" {
+		if err := c.saveImages(ctx, dir); err != nil {
+			return err
+		}
+	}
+	if c.sheetTabs && m.Type == "sheet" {
+		if err := c.saveTabs(ctx, dir, m.ID); err != nil {
+			return err
+		}
+	}
+	if c.cleanHTML && m.Type == "doc" {
+		if err := c.writeCleanHTML(ctx, dir); err != nil {
+			return err
+		}
+	}
+	if c.markdown && m.Type == "doc" {
+		if err := c.writeMarkdown(ctx, dir); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("refreshed url",
+		slog.String("url", m.SourceURL),
+		slog.String("dir", dir))
+	return nil
+}
+
+// loadMetadata loads metadata from a crawled directory
+func (c *Crawler) loadMetadata(ctx context.Context, dir string) (*types.Metadata, error) {
+	data, err := c.store.ReadFile(ctx, path.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata types.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// fetchDocTitle is the fallback when the HTML export has no title: the
+// Drive title, usually already prefetched with the linking document's batch
 func (c *Crawler) fetchDocTitle(ctx context.Context, docID string) (string, error) {
-	// Extract title from HTML content instead of using API
-	// This is a fallback method when API is not available
-	return "", nil // Return empty string to trigger fallback
+	return c.lookupTitle(ctx, docID), nil
 }
 
 // extractTitleFromHTML extracts the document title from HTML content
@@ -433,13 +1205,10 @@ func (c *Crawler) extractHTMLTitle(root *html.Node) string {
 	return strings.TrimSpace(title)
 }
 
-func (c *Crawler) writeMetadata(dir string, m types.Metadata) {
+func (c *Crawler) writeMetadata(ctx context.Context, dir string, m types.Metadata) {
 	m.CrawledAt = time.Now().UTC()
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		slog.Warn("failed to create metadata directory",
-			slog.String("dir", dir),
-			slog.Any("error", err))
-		return
+	if c.visited != nil {
+		c.visited[dir] = true
 	}
 
 	b, err := json.MarshalIndent(m, "", "  ")
@@ -450,7 +1219,7 @@ func (c *Crawler) writeMetadata(dir string, m types.Metadata) {
 		return
 	}
 
-	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), b, 0o644); err != nil {
+	if err := c.store.WriteFile(ctx, path.Join(dir, "metadata.json"), b); err != nil {
 		slog.Warn("failed to write metadata",
 			slog.String("dir", dir),
 			slog.Any("error", err))
@@ -464,20 +1233,60 @@ func (c *Crawler) httpGet(ctx context.Context, u string) (*http.Response, error)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	return c.do(req)
+}
+
+// do sends req, retrying transient failures under the retry policy
+func (c *Crawler) do(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	err := c.retryPolicy.Do(req.Context(), "GET "+req.URL.Host, func() error {
+		var err error
+		resp, err = c.send(req)
+		return err
+	})
+	return resp, err
+}
 
-	resp, err := c.httpClient.Do(req)
+// send sends req once, turning restricted and failed responses into errors
+func (c *Crawler) send(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	u := req.URL.String()
+	resp, err := c.clientFor(req).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("executing request: %w", err)
 	}
 
+	// Private documents answer with 401/403 or bounce to the sign-in page
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+		resp.Request.URL.Host == "accounts.google.com" {
+		resp.Body.Close()
+		status := resp.StatusCode
+		if status == http.StatusOK {
+			status = 0 // landed on the sign-in page
+		}
+		return nil, fmt.Errorf("GET %s: %w", u, &restrictedError{status: status})
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+		return nil, &retry.StatusError{
+			URL:        u,
+			Code:       resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 	return resp, nil
 }
 
 func (c *Crawler) makeSlug(title, id string) string {
+	return Slug(title, id)
+}
+
+// Slug names a document's directory after its title and ID
+func Slug(title, id string) string {
 	s := strings.ToLower(title)
 	s = nonAlphaNum.ReplaceAllString(s, "-")
 	s = multiHyphen.ReplaceAllString(s, "-")
@@ -489,7 +1298,7 @@ func (c *Crawler) makeSlug(title, id string) string {
 		sum := sha1.Sum([]byte(id))
 		s = fmt.Sprintf("%x", sum[:6])
 	}
-	return fmt.Sprintf("%s-%s", s, id[:6])
+	return fmt.Sprintf("%s-%s", s, id[:min(len(id), 6)])
 }
 
 func (c *Crawler) resolve(base, href string) string {
@@ -511,31 +1320,83 @@ func (c *Crawler) resolve(base, href string) string {
 	return b.ResolveReference(u).String()
 }
 
+// linkTarget returns the URL an element points at: an anchor's href, an
+// embedded frame's src (published docs and Sites pages embed other documents
+// this way), or an open-graph/canonical URL in the page head
+func linkTarget(n *html.Node) string {
+	if n.Type != html.ElementNode {
+		return ""
+	}
+
+	attr := func(key string) string {
+		for _, a := range n.Attr {
+			if a.Key == key {
+				return a.Val
+			}
+		}
+		return ""
+	}
+
+	switch n.Data {
+	case "a":
+		return attr("href")
+	case "iframe", "embed":
+		return attr("src")
+	case "meta":
+		if attr("property") == "og:url" {
+			return attr("content")
+		}
+	case "link":
+		if slices.Contains(strings.Fields(strings.ToLower(attr("rel"))), "canonical") {
+			return attr("href")
+		}
+	}
+	return ""
+}
+
 func (c *Crawler) ExtractLinks(content []byte, docType, cleanURL string, depth int) ([]types.Links, error) {
+	links, _, err := c.extractLinks(content, cleanURL, depth)
+	return links, err
+}
+
+// extractLinks returns the links to other documents separately from the
+// document's links to itself (table of contents, cross-references), which
+// must not be crawled again. The links are given depth, one more than the
+// document's own.
+func (c *Crawler) extractLinks(content []byte, pageURL string, depth int) ([]types.Links, []string, error) {
 	var links []types.Links
+	var selfLinks []string
 
 	// Only process HTML content for docs
 	root, err := html.Parse(bytes.NewReader(content))
 	if err != nil {
-		return nil, fmt.Errorf("parsing HTML: %w", err)
+		return nil, nil, fmt.Errorf("parsing HTML: %w", err)
 	}
 
+	self, _ := c.CanonicalizeURL(pageURL)
+	seenSelf := make(map[string]bool)
+
 	var dfs func(*html.Node)
 
 	dfs = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					resolvedURL := c.resolve(cleanURL, attr.Val)
-					canonical, cleanURL := c.CanonicalizeURL(resolvedURL)
-					if canonical != "" {
-						links = append(links, types.Links{
-							Link:   cleanURL,
-							Depth:  depth,
-							Parent: "",
-						})
-					}
+		if target := linkTarget(n); target != "" {
+			resolvedURL := c.resolve(pageURL, target)
+			canonical, cleanURL := c.CanonicalizeURL(resolvedURL)
+			switch {
+			case canonical == "":
+				// not a Google Doc/Sheet
+			case canonical == self:
+				if !seenSelf[resolvedURL] {
+					seenSelf[resolvedURL] = true
+					selfLinks = append(selfLinks, resolvedURL)
 				}
+			default:
+				links = append(links, types.Links{
+					Link:         cleanURL,
+					Depth:        depth,
+					Parent:       "",
+					DiscoveredBy: self,
+				})
 			}
 		}
 		for child := n.FirstChild; child != nil; child = child.NextSibling {
@@ -545,6 +1406,7 @@ func (c *Crawler) ExtractLinks(content []byte, docType, cleanURL string, depth i
 
 	dfs(root)
 
-	// For sheets and other types, return empty title (will use fallback)
-	return links, nil
+	// links are queued in document order, but self links are a set
+	sort.Strings(selfLinks)
+	return links, selfLinks, nil
 }
@@ -57,6 +57,50 @@ func TestExtractTitleAndLinks(t *testing.T) {
 	}
 }
 
+func TestExtractLinksSkipsSelfReferences(t *testing.T) {
+	page := "https://docs.google.com/document/d/self-id/edit"
+	htmlData := []byte(`<html><body>
+		<a href="#heading=h.intro">Intro</a>
+		<a href="https://docs.google.com/document/d/self-id/edit#heading=h.usage">Usage</a>
+		<a href="https://docs.google.com/document/d/other-id/edit">Other</a>
+	</body></html>`)
+
+	crawlerStep := crawler.NewCrawler(1, 15*time.Second, page, "testdata", nil, nil)
+	links, err := crawlerStep.ExtractLinks(htmlData, "doc", page, 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "https://docs.google.com/document/d/other-id/edit", links[0].Link)
+}
+
+func TestExtractLinksFromEmbeds(t *testing.T) {
+	htmlData := []byte(`<html><head>
+		<meta property="og:url" content="https://docs.google.com/spreadsheets/d/og-sheet/edit">
+	</head><body>
+		<iframe src="https://docs.google.com/document/d/embedded-doc/preview"></iframe>
+		<iframe src="https://docs.google.com/document/d/e/2PACX-published/pub?embedded=true"></iframe>
+	</body></html>`)
+
+	crawlerStep := crawler.NewCrawler(1, 15*time.Second, "https://example.com/doc", "testdata", nil, nil)
+	links, err := crawlerStep.ExtractLinks(htmlData, "doc", "https://example.com/doc", 1)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "https://docs.google.com/spreadsheets/d/og-sheet/edit", links[0].Link)
+	assert.Equal(t, "https://docs.google.com/document/d/embedded-doc/preview", links[1].Link)
+}
+
+func TestExtractLinksFromCanonicalLink(t *testing.T) {
+	htmlData := []byte(`<html><head>
+		<link rel="stylesheet" href="https://docs.google.com/document/d/not-a-link/edit">
+		<link rel="Canonical" href="https://docs.google.com/document/d/canonical-doc/edit">
+	</head><body></body></html>`)
+
+	crawlerStep := crawler.NewCrawler(1, 15*time.Second, "https://example.com/doc", "testdata", nil, nil)
+	links, err := crawlerStep.ExtractLinks(htmlData, "doc", "https://example.com/doc", 1)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "https://docs.google.com/document/d/canonical-doc/edit", links[0].Link)
+}
+
 func TestCanonicalizeURL(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -212,6 +256,48 @@ func TestCanonicalizeURL(t *testing.T) {
 			expectedClean: "http://docs.google.com/document/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit",
 			description:   "Google Doc URL using HTTP instead of HTTPS",
 		},
+		{
+			name:          "Workspace domain Google Doc URL",
+			inputURL:      "https://docs.google.com/a/example.com/document/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit",
+			expectedKey:   "doc:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://docs.google.com/a/example.com/document/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit",
+			description:   "Google Doc URL with a Workspace domain prefix",
+		},
+		{
+			name:          "Workspace domain Google Sheet URL",
+			inputURL:      "https://docs.google.com/a/example.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit#gid=0",
+			expectedKey:   "sheet:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://docs.google.com/a/example.com/spreadsheets/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit#gid=0",
+			description:   "Google Sheet URL with a Workspace domain prefix",
+		},
+		{
+			name:          "Open link",
+			inputURL:      "https://docs.google.com/open?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedKey:   "file:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://docs.google.com/open?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			description:   "open?id= link that doesn't say whether it names a doc or a sheet",
+		},
+		{
+			name:          "Drive open link with other parameters",
+			inputURL:      "https://drive.google.com/open?usp=sharing&id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedKey:   "file:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://drive.google.com/open?usp=sharing&id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			description:   "drive.google.com open link with the ID after another parameter",
+		},
+		{
+			name:          "Drive file link",
+			inputURL:      "https://drive.google.com/file/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/view?usp=sharing",
+			expectedKey:   "file:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://drive.google.com/file/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/view?usp=sharing",
+			description:   "drive.google.com/file link",
+		},
+		{
+			name:          "Redirected open link",
+			inputURL:      "https://www.google.com/url?q=https%3A%2F%2Fdocs.google.com%2Fopen%3Fid%3D1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedKey:   "file:1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			expectedClean: "https://docs.google.com/open?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms",
+			description:   "open?id= link behind Google's redirector",
+		},
 		{
 			name:          "Google redirect with malformed URL in q parameter",
 			inputURL:      "https://www.google.com/url?q=not-a-valid-url",
@@ -234,3 +320,60 @@ func TestCanonicalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestParseContentNames(t *testing.T) {
+	names, err := crawler.ParseContentNames("{slug}.{ext}")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"doc": "{slug}.{ext}", "sheet": "{slug}.{ext}"}, names)
+
+	names, err = crawler.ParseContentNames("doc={slug}.html, sheet=data.{ext}")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"doc": "{slug}.html", "sheet": "data.{ext}"}, names)
+
+	for _, spec := range []string{"slides={slug}.{ext}", "doc=a/{slug}.html", "metadata.json", "doc="} {
+		_, err := crawler.ParseContentNames(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestDerivedFileNames(t *testing.T) {
+	assert.Equal(t, "content.md", crawler.MarkdownFileName("content.html"))
+	assert.Equal(t, "handbook-1AbC.md", crawler.MarkdownFileName("handbook-1AbC.html"))
+	assert.Equal(t, "content.clean.html", crawler.CleanFileName("content.html"))
+}
+
+func TestNormalizeCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        []byte
+		delimiter rune
+		want      string
+		encoding  string
+	}{
+		{"plain", []byte("a,b\n1,2\n"), ',', "a,b\n1,2\n", crawler.EncodingUTF8},
+		{"bom", []byte("\xEF\xBB\xBFa,b\n"), ',', "a,b\n", crawler.EncodingUTF8BOM},
+		{"semicolons", []byte("a;b\n\"1,5\";2\n"), ',', "a,b\n\"1,5\",2\n", crawler.EncodingUTF8},
+		{"custom delimiter", []byte("a,b\n1,2\n"), ';', "a;b\n1;2\n", crawler.EncodingUTF8},
+		{"windows-1252", []byte("caf\xe9,b\n"), ',', "café,b\n", crawler.EncodingWindows1252},
+		{"utf-16le", []byte("\xFF\xFEa\x00,\x00b\x00\n\x00"), ',', "a,b\n", crawler.EncodingUTF16LE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, enc, err := crawler.NormalizeCSV(tt.in, tt.delimiter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+			assert.Equal(t, tt.encoding, enc)
+		})
+	}
+}
+
+func TestExtractLinksRecordsDiscoverer(t *testing.T) {
+	c := crawler.NewCrawler(5, time.Second, "", t.TempDir(), nil, nil)
+	content := []byte(`<a href="https://docs.google.com/document/d/child123456/edit">child</a>`)
+
+	links, err := c.ExtractLinks(content, "doc", "https://docs.google.com/document/d/parent123456/edit", 2)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, 2, links[0].Depth)
+	assert.Equal(t, "doc:parent123456", links[0].DiscoveredBy)
+}
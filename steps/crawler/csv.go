@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encodings a sheet export may arrive in, as recorded in metadata
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF8BOM = "utf-8-bom"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	// Windows-1252 is assumed for exports that aren't valid UTF-8
+	EncodingWindows1252 = "windows-1252"
+)
+
+// WithCSVDelimiter separates the fields of saved sheets with delimiter
+// instead of a comma. The uploader converts them back before import.
+func WithCSVDelimiter(delimiter rune) Option {
+	return func(c *Crawler) {
+		c.csvDelimiter = delimiter
+	}
+}
+
+// ParseCSVDelimiter parses the -csv-delimiter flag: a single character, or
+// "tab"
+func ParseCSVDelimiter(s string) (rune, error) {
+	if s == "tab" || s == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return 0, fmt.Errorf("CSV delimiter %q must be a single character", s)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("CSV delimiter %q is not allowed", s)
+	}
+	return r, nil
+}
+
+// NormalizeCSV converts a sheet export to UTF-8 without BOM, with delimiter
+// between fields, and returns the encoding it arrived in. Exports already in
+// that form are returned unchanged.
+func NormalizeCSV(content []byte, delimiter rune) ([]byte, string, error) {
+	content, enc, err := decodeCSV(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding %s export: %w", enc, err)
+	}
+
+	source := sniffDelimiter(content)
+	if source == delimiter {
+		return content, enc, nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = source
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing export: %w", err)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+	if err := w.WriteAll(records); err != nil {
+		return nil, "", fmt.Errorf("rewriting export: %w", err)
+	}
+	return buf.Bytes(), enc, nil
+}
+
+// recordEncoding notes in a sheet's metadata the encoding its export arrived
+// in and the delimiter it was saved with, when that isn't a comma
+func (c *Crawler) recordEncoding(m *types.Metadata, sourceEncoding string) {
+	if m.Type != "sheet" {
+		return
+	}
+	m.SourceEncoding = sourceEncoding
+	m.CSVDelimiter = ""
+	if c.csvDelimiter != ',' {
+		m.CSVDelimiter = string(c.csvDelimiter)
+	}
+}
+
+// decodeCSV detects the encoding of an export by its BOM, or its validity
+// as UTF-8, and returns it decoded to UTF-8
+func decodeCSV(content []byte) ([]byte, string, error) {
+	var dec *encoding.Decoder
+	var enc string
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return content[3:], EncodingUTF8BOM, nil
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		dec, enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder(), EncodingUTF16LE
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		dec, enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder(), EncodingUTF16BE
+	case utf8.Valid(content):
+		return content, EncodingUTF8, nil
+	default:
+		dec, enc = charmap.Windows1252.NewDecoder(), EncodingWindows1252
+	}
+
+	out, err := dec.Bytes(content)
+	return out, enc, err
+}
+
+// sniffDelimiter guesses the field separator of a CSV from its first
+// record: whichever of comma, semicolon and tab occurs most outside quotes.
+// Locales that use a decimal comma export with semicolons.
+func sniffDelimiter(content []byte) rune {
+	counts := map[rune]int{}
+	quoted := false
+	for _, r := range string(content) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '\n':
+			return pickDelimiter(counts)
+		case r == ',' || r == ';' || r == '\t':
+			counts[r]++
+		}
+	}
+	return pickDelimiter(counts)
+}
+
+// pickDelimiter returns the most frequent candidate, preferring a comma on ties
+func pickDelimiter(counts map[rune]int) rune {
+	best := ','
+	for _, r := range []rune{';', '\t'} {
+		if counts[r] > counts[best] {
+			best = r
+		}
+	}
+	return best
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"google.golang.org/api/drive/v3"
+)
+
+// SkippedExternalFile lists the documents the domain allowlist left out
+const SkippedExternalFile = "skipped_external.json"
+
+// WithDomainAllowlist only follows links to documents owned by someone in
+// one of domains, or shared within one of them: with the whole domain or
+// with a user or group in it. Other documents are neither saved nor
+// followed, and are listed in skipped_external.json. It needs
+// WithDriveService to read owners and permissions. The start URL and other
+// seeds are always crawled.
+func WithDomainAllowlist(domains []string) Option {
+	return func(c *Crawler) {
+		for _, d := range domains {
+			if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")); d != "" {
+				c.domains = append(c.domains, d)
+			}
+		}
+	}
+}
+
+// domainAllowed reports whether the document passes the domain allowlist,
+// recording it in skipped_external.json when it doesn't. Decisions are
+// remembered, so further links to an external document cost no lookup.
+func (c *Crawler) domainAllowed(ctx context.Context, task types.Links, docType, id, cleanURL string) bool {
+	if len(c.domains) == 0 || c.driveSvc == nil || task.Depth == 0 {
+		return true
+	}
+	if allowed, ok := c.domainDecisions[id]; ok {
+		return allowed
+	}
+
+	skip := types.SkippedDocument{ID: id, Type: docType, URL: cleanURL, LinkedFrom: task.Parent}
+	if err := c.limiter.Wait(ctx); err != nil {
+		// cancelled: the crawl is stopping, don't record a decision
+		return false
+	}
+	f, err := c.driveSvc.Files.Get(id).
+		Fields("name", "owners(displayName,emailAddress)", "permissions(type,domain,emailAddress)").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		skip.Reason = fmt.Sprintf("owner lookup failed: %v", err)
+	} else {
+		skip.Title = f.Name
+		for _, o := range f.Owners {
+			skip.Owners = append(skip.Owners, types.Owner{Name: o.DisplayName, Email: o.EmailAddress})
+		}
+		if c.internal(f) {
+			c.domainDecisions[id] = true
+			return true
+		}
+		skip.Reason = "neither owned by nor shared within an allowed domain"
+	}
+
+	slog.Info("skipping external document",
+		slog.String("url", cleanURL),
+		slog.String("reason", skip.Reason))
+	c.domainDecisions[id] = false
+	c.external = append(c.external, skip)
+	return false
+}
+
+// internal reports whether an owner of f is in an allowed domain, or f is
+// shared with one of the domains or someone in them. Permissions are only
+// listed to editors, so for other documents the owners decide.
+func (c *Crawler) internal(f *drive.File) bool {
+	for _, o := range f.Owners {
+		if c.domainListed(emailDomain(o.EmailAddress)) {
+			return true
+		}
+	}
+	for _, p := range f.Permissions {
+		switch p.Type {
+		case "domain":
+			if c.domainListed(strings.ToLower(p.Domain)) {
+				return true
+			}
+		case "user", "group":
+			if c.domainListed(emailDomain(p.EmailAddress)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// domainListed reports whether domain is on the allowlist
+func (c *Crawler) domainListed(domain string) bool {
+	return slices.Contains(c.domains, domain)
+}
+
+// writeSkippedExternal merges the external documents skipped this run into
+// skipped_external.json, keeping entries other crawl workers already wrote
+func (c *Crawler) writeSkippedExternal(ctx context.Context) error {
+	return writeMerged(ctx, c.store, SkippedExternalFile, c.external, func(e types.SkippedDocument) (string, string) {
+		return e.ID, e.URL
+	})
+}
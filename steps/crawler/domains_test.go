@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestDomainAllowlist(t *testing.T) {
+	files := map[string]map[string]any{
+		"owned": {"name": "Owned", "owners": []map[string]any{{"emailAddress": "ana@Example.com"}}},
+		"domain": {"name": "Shared with domain", "owners": []map[string]any{{"emailAddress": "bo@gmail.com"}},
+			"permissions": []map[string]any{{"type": "domain", "domain": "example.com"}}},
+		"member": {"name": "Shared with a member", "owners": []map[string]any{{"emailAddress": "bo@gmail.com"}},
+			"permissions": []map[string]any{{"type": "user", "emailAddress": "cy@example.com"}}},
+		"external": {"name": "External", "owners": []map[string]any{{"displayName": "Bo", "emailAddress": "bo@gmail.com"}},
+			"permissions": []map[string]any{{"type": "anyone"}}},
+	}
+	var lookups int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		f, ok := files[path.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f)
+	}))
+	defer api.Close()
+
+	svc, err := drive.NewService(context.Background(), option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	c := &Crawler{driveSvc: svc, limiter: ratelimit.Unlimited(), domainDecisions: make(map[string]bool)}
+	WithDomainAllowlist([]string{" @Example.com"})(c)
+
+	ctx := context.Background()
+	linked := types.Links{Depth: 1, Parent: "root"}
+	for id, want := range map[string]bool{"owned": true, "domain": true, "member": true, "external": false} {
+		assert.Equal(t, want, c.domainAllowed(ctx, linked, "doc", id, "https://docs.google.com/document/d/"+id), id)
+	}
+	// decisions are remembered, and seeds aren't checked
+	assert.False(t, c.domainAllowed(ctx, linked, "doc", "external", "https://docs.google.com/document/d/external"))
+	assert.True(t, c.domainAllowed(ctx, types.Links{}, "doc", "external", "https://docs.google.com/document/d/external"))
+	assert.Equal(t, 4, lookups)
+
+	require.Len(t, c.external, 1)
+	assert.Equal(t, "External", c.external[0].Title)
+	assert.Equal(t, []types.Owner{{Name: "Bo", Email: "bo@gmail.com"}}, c.external[0].Owners)
+	assert.Equal(t, "root", c.external[0].LinkedFrom)
+}
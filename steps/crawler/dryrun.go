@@ -0,0 +1,41 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+)
+
+// WithDryRun records every document the crawl exports in r. The crawl itself
+// runs as usual: it only reads documents and writes the output directory,
+// and the later steps of a dry run plan from what it saved.
+func WithDryRun(r *dryrun.Report) Option {
+	return func(c *Crawler) {
+		c.dryRun = r
+	}
+}
+
+// reportFetch adds the document saved in dir to the dry-run report
+func (c *Crawler) reportFetch(ctx context.Context, dir string) {
+	if c.dryRun == nil {
+		return
+	}
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		slog.Warn("dry run: unreadable metadata", slog.String("dir", dir), slog.Any("error", err))
+		return
+	}
+	c.dryRun.AddFetch(dryrun.Fetch{
+		ID:    m.ID,
+		Type:  m.Type,
+		Title: m.Title,
+		URL:   m.SourceURL,
+		Depth: m.Depth,
+		Dir:   dir,
+	})
+	slog.Info("dry run: fetched",
+		slog.String("type", m.Type),
+		slog.String("title", m.Title),
+		slog.Int("depth", m.Depth))
+}
@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// Pattern matches the URL, ID or title of a linked document
+type Pattern struct {
+	spec string
+	re   *regexp.Regexp
+}
+
+// String returns the pattern as it was written
+func (p Pattern) String() string {
+	return p.spec
+}
+
+// ParsePatterns parses a comma-separated list of patterns. A pattern
+// between slashes is a regular expression ("/archive|old/"); anything else
+// is a glob that must match the whole value, where * matches any run of
+// characters and ? one character ("*Archive*"). Both ignore case.
+func ParsePatterns(s string) ([]Pattern, error) {
+	var patterns []Pattern
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var expr string
+		if len(part) > 2 && strings.HasPrefix(part, "/") && strings.HasSuffix(part, "/") {
+			expr = part[1 : len(part)-1]
+		} else {
+			expr = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(part)) + "$"
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", part, err)
+		}
+		patterns = append(patterns, Pattern{spec: part, re: re})
+	}
+	return patterns, nil
+}
+
+// WithLinkFilter limits the crawl to linked documents whose URL, ID or
+// title matches one of include (when given) and none of exclude. Other
+// documents are neither saved nor followed, and are listed in
+// skipped_documents.json. Titles are looked up with WithDriveService, and
+// only when a pattern didn't match the URL or ID already. The start URL and
+// other seeds are always crawled.
+func WithLinkFilter(include, exclude []Pattern) Option {
+	return func(c *Crawler) {
+		c.include = include
+		c.exclude = exclude
+	}
+}
+
+// linkAllowed reports whether the document passes the link filter,
+// recording it in skipped_documents.json when it doesn't. Decisions are
+// remembered, so further links to a skipped document are skipped at once.
+func (c *Crawler) linkAllowed(ctx context.Context, task types.Links, docType, id, cleanURL string) bool {
+	if len(c.include) == 0 && len(c.exclude) == 0 || task.Depth == 0 {
+		return true
+	}
+	if allowed, ok := c.linkDecisions[id]; ok {
+		return allowed
+	}
+
+	title, titled := "", false
+	lookup := func() string {
+		if !titled {
+			titled = true
+			title = c.lookupTitle(ctx, id)
+		}
+		return title
+	}
+	var reason string
+	if p, ok := matchAny(c.exclude, cleanURL, id, lookup); ok {
+		reason = fmt.Sprintf("matches -exclude-pattern %s", p)
+	} else if _, ok := matchAny(c.include, cleanURL, id, lookup); !ok && len(c.include) > 0 {
+		reason = "matches no -include-pattern"
+	}
+	if ctx.Err() != nil {
+		// cancelled: a title lookup may have failed, don't record a decision
+		return false
+	}
+	if reason == "" {
+		c.linkDecisions[id] = true
+		return true
+	}
+
+	slog.Info("skipping document outside the link filter",
+		slog.String("url", cleanURL),
+		slog.String("reason", reason))
+	c.linkDecisions[id] = false
+	c.skipped = append(c.skipped, types.SkippedDocument{
+		ID:         id,
+		Type:       docType,
+		URL:        cleanURL,
+		LinkedFrom: task.Parent,
+		Title:      title,
+		Reason:     reason,
+	})
+	return false
+}
+
+// matchAny returns the first pattern matching the URL or ID, or else the
+// title; title is only called when neither matched
+func matchAny(patterns []Pattern, url, id string, title func() string) (Pattern, bool) {
+	for _, p := range patterns {
+		if p.re.MatchString(url) || p.re.MatchString(id) {
+			return p, true
+		}
+	}
+	for _, p := range patterns {
+		if t := title(); t != "" && p.re.MatchString(t) {
+			return p, true
+		}
+	}
+	return Pattern{}, false
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns("*/document/d/*, /^arch(ive)?-/ ,")
+	require.NoError(t, err)
+	require.Len(t, patterns, 2)
+	assert.Equal(t, "*/document/d/*", patterns[0].String())
+	assert.True(t, patterns[0].re.MatchString("https://docs.google.com/Document/d/abc/edit"))
+	assert.False(t, patterns[0].re.MatchString("https://docs.google.com/spreadsheets/d/abc/edit"))
+	assert.True(t, patterns[1].re.MatchString("Archive-2019"))
+
+	_, err = ParsePatterns("/(unclosed/")
+	assert.Error(t, err)
+}
+
+func TestLinkFilter(t *testing.T) {
+	include, err := ParsePatterns("*/document/d/*")
+	require.NoError(t, err)
+	exclude, err := ParsePatterns("old*")
+	require.NoError(t, err)
+	c := &Crawler{linkDecisions: make(map[string]bool)}
+	WithLinkFilter(include, exclude)(c)
+
+	ctx := context.Background()
+	linked := types.Links{Depth: 1, Parent: "root"}
+	assert.True(t, c.linkAllowed(ctx, linked, "doc", "abc", "https://docs.google.com/document/d/abc/edit"))
+	assert.False(t, c.linkAllowed(ctx, linked, "doc", "old123", "https://docs.google.com/document/d/old123/edit"))
+	assert.False(t, c.linkAllowed(ctx, linked, "sheet", "def", "https://docs.google.com/spreadsheets/d/def/edit"))
+	// seeds are always crawled
+	assert.True(t, c.linkAllowed(ctx, types.Links{}, "sheet", "ghi", "https://docs.google.com/spreadsheets/d/ghi/edit"))
+
+	// a second link to a skipped document isn't listed again
+	assert.False(t, c.linkAllowed(ctx, linked, "doc", "old123", "https://docs.google.com/document/d/old123/edit"))
+	require.Len(t, c.skipped, 2)
+	assert.Equal(t, "matches -exclude-pattern old*", c.skipped[0].Reason)
+	assert.Equal(t, "root", c.skipped[0].LinkedFrom)
+	assert.Equal(t, "matches no -include-pattern", c.skipped[1].Reason)
+}
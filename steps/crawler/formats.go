@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// ExportFormats are the formats each document type can be saved in; the
+// first is the default
+var ExportFormats = map[string][]string{
+	"doc":   {"html", "docx", "pdf", "txt", "md"},
+	"sheet": {"csv", "xlsx", "ods"},
+}
+
+// WithFormats saves each document type ("doc", "sheet") in the given export
+// format instead of HTML and CSV. Docs saved in another format than HTML
+// get their HTML export saved next to it (see HTMLFileName), since links,
+// the title and the text are read from it.
+func WithFormats(formats map[string]string) Option {
+	return func(c *Crawler) {
+		c.formats = formats
+	}
+}
+
+// ValidFormat reports whether docType can be exported in format
+func ValidFormat(docType, format string) bool {
+	return slices.Contains(ExportFormats[docType], format)
+}
+
+// HTMLFileName returns the name of the HTML export saved next to a doc's
+// content file in another format
+func HTMLFileName(contentFile string) string {
+	name := strings.TrimSuffix(contentFile, path.Ext(contentFile)) + ".html"
+	if name == contentFile {
+		name += ".html"
+	}
+	return name
+}
+
+// htmlPage returns the HTML export of a doc saved in another format: the
+// previous run's copy when an incremental crawl reused the doc, else a
+// fresh download
+func (c *Crawler) htmlPage(ctx context.Context, canonical, id string, reused bool) ([]byte, error) {
+	if prev, ok := c.previous[canonical]; reused && ok && prev.meta.HTMLFile != "" {
+		page, err := c.store.ReadFile(ctx, path.Join(prev.dir, prev.meta.HTMLFile))
+		if err == nil {
+			return page, nil
+		}
+	}
+	config, _ := exportConfig("doc", "html")
+	page, err := c.cachedExport(ctx, config, id)
+	if err != nil {
+		return nil, fmt.Errorf("downloading HTML export: %w", err)
+	}
+	c.count(func(s *CrawlStats) { s.BytesDownloaded += int64(len(page)) })
+	return page, nil
+}
+
+// format returns the export format docType is saved in
+func (c *Crawler) format(docType string) string {
+	if f, ok := c.formats[docType]; ok {
+		return f
+	}
+	return types.DefaultFormats[docType]
+}
+
+// exportConfig returns the export settings of docType in format. The
+// default templates end in their type's default format.
+func exportConfig(docType, format string) (docConfig, bool) {
+	config, ok := docConfigs[docType]
+	if !ok {
+		return config, false
+	}
+	config.exportURLTemplate = strings.TrimSuffix(config.exportURLTemplate, config.ext) + format
+	config.ext = format
+	return config, true
+}
@@ -0,0 +1,92 @@
+package crawler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formatExports answers export requests by document ID and format; requests
+// without a format, like sheet previews, get the HTML
+type formatExports map[string]map[string]string
+
+func (e formatExports) RoundTrip(req *http.Request) (*http.Response, error) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	code, body := http.StatusNotFound, ""
+	for id, byFormat := range e {
+		if content, ok := byFormat[format]; ok && strings.Contains(req.URL.Path, "/d/"+id+"/") {
+			code, body = http.StatusOK, content
+		}
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestCrawlExportFormats(t *testing.T) {
+	docs := formatExports{
+		"root": {
+			"html": `<html><head><title>Root</title></head><body>` +
+				link("https://docs.google.com/spreadsheets/d/sheet/edit") +
+				`</body></html>`,
+			"docx": "PK-docx",
+		},
+		"sheet": {"html": "<html></html>", "xlsx": "PK-xlsx"},
+	}
+
+	out := t.TempDir()
+	c := crawler.NewCrawler(2, time.Second, "https://docs.google.com/document/d/root/edit", out, nil, nil,
+		crawler.WithHTTPTransport(docs),
+		crawler.WithFormats(map[string]string{"doc": "docx", "sheet": "xlsx"}))
+	require.NoError(t, c.Run(context.Background()))
+
+	saved := make(map[string]types.Metadata)
+	dirs := make(map[string]string)
+	require.NoError(t, filepath.WalkDir(out, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.Name() != "metadata.json" {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		var m types.Metadata
+		require.NoError(t, json.Unmarshal(data, &m))
+		saved[m.ID], dirs[m.ID] = m, filepath.Dir(name)
+		return nil
+	}))
+	require.Contains(t, saved, "sheet", "links are read from the HTML export")
+
+	root := saved["root"]
+	assert.Equal(t, "docx", root.ExportFormat())
+	assert.Equal(t, "content.docx", root.ContentFileName())
+	assert.Equal(t, "content.html", root.TextFileName())
+	content, err := os.ReadFile(filepath.Join(dirs["root"], "content.docx"))
+	require.NoError(t, err)
+	assert.Equal(t, "PK-docx", string(content))
+	assert.Contains(t, root.Checksums, "content.html")
+
+	sheet := saved["sheet"]
+	assert.Equal(t, "content.xlsx", sheet.ContentFileName())
+	assert.Empty(t, sheet.TextFileName())
+	content, err = os.ReadFile(filepath.Join(dirs["sheet"], "content.xlsx"))
+	require.NoError(t, err)
+	assert.Equal(t, "PK-xlsx", string(content))
+}
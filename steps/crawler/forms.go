@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"golang.org/x/net/html"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// formLinkRe matches editor links (/forms/d/<ID>) and published ones
+// (/forms/d/e/<token>), whose responder token the Forms API doesn't accept
+var formLinkRe = regexp.MustCompile(`docs\.google\.com/forms/d/(e/)?([^/?#]+)`)
+
+// recordForms lists the Google Forms the saved doc in dir links to in its
+// metadata. With a Forms client each form's title and response sheet come
+// from the Forms API, and the response sheets are returned as links to
+// crawl; otherwise the title is the form's Drive title or that of its public
+// page. Forms the credentials can't read are recorded without a title.
+func (c *Crawler) recordForms(ctx context.Context, dir, canonical string, depth int) []types.Links {
+	content, err := c.readContent(ctx, dir)
+	if err != nil {
+		return nil
+	}
+
+	var forms []types.Form
+	var links []types.Links
+	seen := make(map[string]bool)
+	for _, href := range c.extractHrefs(content) {
+		m := formLinkRe.FindStringSubmatch(unwrapRedirect(href))
+		if m == nil || seen[m[0]] {
+			continue
+		}
+		seen[m[0]] = true
+
+		form := types.Form{URL: "https://" + m[0] + "/viewform"}
+		if m[1] == "" {
+			form.ID = m[2]
+			form.URL = fmt.Sprintf("https://docs.google.com/forms/d/%s/edit", form.ID)
+		}
+		if form.ID != "" && c.formsSvc != nil {
+			if sheet := c.describeForm(ctx, &form); sheet != "" {
+				links = append(links, types.Links{
+					Link:         sheet,
+					Depth:        depth,
+					Parent:       dir,
+					Form:         form.URL,
+					DiscoveredBy: canonical,
+				})
+			}
+		}
+		if form.Title == "" && form.ID != "" {
+			form.Title = c.lookupTitle(ctx, form.ID)
+		}
+		if form.Title == "" {
+			form.Title = c.formPageTitle(ctx, "https://"+m[0]+"/viewform")
+		}
+		forms = append(forms, form)
+	}
+	if len(forms) == 0 {
+		return links
+	}
+
+	md, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		slog.Warn("failed to record linked forms", slog.String("dir", dir), slog.Any("error", err))
+		return links
+	}
+	md.Forms = forms
+	c.writeMetadata(ctx, dir, *md)
+	c.count(func(s *CrawlStats) { s.Forms += len(forms) })
+	return links
+}
+
+// describeForm fills in the form's title and response sheet from the Forms
+// API, returning the sheet's URL when the form collects responses into one
+func (c *Crawler) describeForm(ctx context.Context, form *types.Form) string {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return ""
+	}
+	f, err := c.formsSvc.Forms.Get(form.ID).Context(ctx).Do()
+	if err != nil {
+		slog.Info("form not accessible, skipping its responses",
+			slog.String("form_id", form.ID),
+			slog.Any("error", err))
+		return ""
+	}
+	if f.Info != nil {
+		form.Title = f.Info.Title
+	}
+	if f.LinkedSheetId == "" {
+		return "" // form doesn't collect responses into a sheet
+	}
+
+	slog.Info("following form responses",
+		slog.String("form_id", form.ID),
+		slog.String("sheet_id", f.LinkedSheetId))
+	form.ResponseSheet = fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", f.LinkedSheetId)
+	return form.ResponseSheet
+}
+
+// formPageTitle reads the title of a form's public page; "" when the form
+// isn't open to anonymous responders
+func (c *Crawler) formPageTitle(ctx context.Context, pageURL string) string {
+	if title, ok := c.formTitles[pageURL]; ok {
+		return title
+	}
+	title := c.fetchFormPageTitle(ctx, pageURL)
+	c.formTitles[pageURL] = title
+	return title
+}
+
+// fetchFormPageTitle fetches the form's page and reads its <title>
+func (c *Crawler) fetchFormPageTitle(ctx context.Context, pageURL string) string {
+	resp, err := c.httpGet(ctx, pageURL)
+	if err != nil {
+		slog.Debug("form page not readable", slog.String("url", pageURL), slog.Any("error", err))
+		return ""
+	}
+	defer resp.Body.Close()
+
+	root, err := html.Parse(resp.Body)
+	if err != nil {
+		return ""
+	}
+	return c.extractHTMLTitle(root)
+}
@@ -0,0 +1,47 @@
+package crawler_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlRecordsLinkedForms(t *testing.T) {
+	docs := exports{
+		"root": `<html><head><title>Root</title></head><body>` +
+			link("https://docs.google.com/forms/d/signup/edit") +
+			link("https://www.google.com/url?q=https://docs.google.com/forms/d/signup/viewform") +
+			link("https://docs.google.com/forms/d/e/1FAIpQL/viewform?usp=sf_link") +
+			`</body></html>`,
+		// the form's public page
+		"signup": `<html><head><title>Team signup</title></head><body></body></html>`,
+	}
+
+	out := t.TempDir()
+	c := crawler.NewCrawler(1, time.Second, "https://docs.google.com/document/d/root/edit", out, nil, nil,
+		crawler.WithHTTPTransport(docs))
+	require.NoError(t, c.Run(context.Background()))
+
+	dirs, err := filepath.Glob(filepath.Join(out, "*", "metadata.json"))
+	require.NoError(t, err)
+	require.Len(t, dirs, 1)
+	data, err := os.ReadFile(dirs[0])
+	require.NoError(t, err)
+	var m types.Metadata
+	require.NoError(t, json.Unmarshal(data, &m))
+
+	assert.Equal(t, []types.Form{
+		{ID: "signup", URL: "https://docs.google.com/forms/d/signup/edit", Title: "Team signup"},
+		// published links carry no form ID, and this one isn't public
+		{URL: "https://docs.google.com/forms/d/e/1FAIpQL/viewform"},
+	}, m.Forms)
+	assert.Equal(t, 2, c.Stats().(crawler.CrawlStats).Forms)
+}
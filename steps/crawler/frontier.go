@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// Frontier holds the crawl queue and the set of documents already saved. The
+// default in-memory frontier serves a single crawler; a shared frontier lets
+// several crawler processes work through the same document tree.
+type Frontier interface {
+	// Seed enqueues the start links unless the crawl was already seeded
+	Seed(ctx context.Context, links ...types.Links) error
+	// Push enqueues newly discovered links
+	Push(ctx context.Context, links ...types.Links) error
+	// Next claims the next link to process; ok is false once the crawl is finished
+	Next(ctx context.Context) (link types.Links, ok bool, err error)
+	// Done marks a claimed link as processed
+	Done(ctx context.Context, link types.Links) error
+
+	// Reserve claims a canonical document key. If it is already owned, the
+	// owner's directory is returned instead; an empty dir means the owner is
+	// still saving the document.
+	Reserve(ctx context.Context, canonical string) (dir string, reserved bool, err error)
+	// Complete records the directory a reserved document was saved to
+	Complete(ctx context.Context, canonical, dir string) error
+	// Release drops a reservation after a failure so another link can retry it
+	Release(ctx context.Context, canonical string) error
+}
+
+// memoryFrontier is the single-process frontier: a FIFO slice and a map.
+// Past spillAt entries it moves both into a SQLite database in spillDir and
+// delegates to it, so very large crawls don't exhaust memory.
+type memoryFrontier struct {
+	pending   []types.Links
+	processed map[string]string
+
+	// Entries kept in memory before spilling to disk (0 = never)
+	spillAt  int
+	spillDir string
+	// Set once spilled; every call goes to it from then on
+	disk     *SQLiteFrontier
+	diskPath string
+}
+
+func newMemoryFrontier() *memoryFrontier {
+	return &memoryFrontier{processed: make(map[string]string)}
+}
+
+func (f *memoryFrontier) Seed(ctx context.Context, links ...types.Links) error {
+	if f.disk != nil {
+		return f.disk.Seed(ctx, links...)
+	}
+	f.pending = append(f.pending, links...)
+	return f.maybeSpill(ctx)
+}
+
+func (f *memoryFrontier) Push(ctx context.Context, links ...types.Links) error {
+	if f.disk != nil {
+		return f.disk.Push(ctx, links...)
+	}
+	f.pending = append(f.pending, links...)
+	return f.maybeSpill(ctx)
+}
+
+// Next removes and returns the first link from the queue (FIFO)
+func (f *memoryFrontier) Next(ctx context.Context) (types.Links, bool, error) {
+	if f.disk != nil {
+		return f.disk.Next(ctx)
+	}
+	if len(f.pending) == 0 {
+		return types.Links{}, false, nil
+	}
+	link := f.pending[0]
+	f.pending = f.pending[1:]
+	return link, true, nil
+}
+
+func (f *memoryFrontier) Done(ctx context.Context, link types.Links) error {
+	if f.disk != nil {
+		return f.disk.Done(ctx, link)
+	}
+	return nil
+}
+
+func (f *memoryFrontier) Reserve(ctx context.Context, canonical string) (string, bool, error) {
+	if f.disk != nil {
+		return f.disk.Reserve(ctx, canonical)
+	}
+	if dir, exists := f.processed[canonical]; exists {
+		return dir, false, nil
+	}
+	f.processed[canonical] = ""
+	return "", true, f.maybeSpill(ctx)
+}
+
+func (f *memoryFrontier) Complete(ctx context.Context, canonical, dir string) error {
+	if f.disk != nil {
+		return f.disk.Complete(ctx, canonical, dir)
+	}
+	f.processed[canonical] = dir
+	return nil
+}
+
+func (f *memoryFrontier) Release(ctx context.Context, canonical string) error {
+	if f.disk != nil {
+		return f.disk.Release(ctx, canonical)
+	}
+	delete(f.processed, canonical)
+	return nil
+}
+
+// maybeSpill moves the queue and the saved documents to disk once they
+// outgrow spillAt
+func (f *memoryFrontier) maybeSpill(ctx context.Context) error {
+	if f.spillAt <= 0 || len(f.pending)+len(f.processed) <= f.spillAt {
+		return nil
+	}
+
+	file, err := os.CreateTemp(f.spillDir, "frontier-*.db")
+	if err != nil {
+		return fmt.Errorf("creating frontier spill file: %w", err)
+	}
+	file.Close()
+
+	disk, err := NewSQLiteFrontier(file.Name(), "local")
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := disk.load(ctx, f.pending, f.processed); err != nil {
+		disk.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("spilling frontier: %w", err)
+	}
+
+	slog.Info("frontier spilled to disk",
+		slog.String("path", file.Name()),
+		slog.Int("pending", len(f.pending)),
+		slog.Int("documents", len(f.processed)))
+	f.disk, f.diskPath = disk, file.Name()
+	f.pending, f.processed = nil, nil
+	return nil
+}
+
+// close removes the spill database, if any
+func (f *memoryFrontier) close() {
+	if f.disk == nil {
+		return
+	}
+	f.disk.Close()
+	os.Remove(f.diskPath)
+}
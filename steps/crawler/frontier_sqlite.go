@@ -0,0 +1,242 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+const frontierSchema = `
+CREATE TABLE IF NOT EXISTS frontier (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	link       TEXT    NOT NULL,
+	depth      INTEGER NOT NULL,
+	parent     TEXT    NOT NULL,
+	form       TEXT    NOT NULL DEFAULT '',
+	discovered_by TEXT NOT NULL DEFAULT '',
+	status     TEXT    NOT NULL DEFAULT 'pending',
+	worker     TEXT,
+	claimed_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS frontier_status ON frontier(status, id);
+CREATE TABLE IF NOT EXISTS documents (
+	canonical TEXT PRIMARY KEY,
+	dir       TEXT NOT NULL DEFAULT ''
+);`
+
+// SQLiteFrontier is a Frontier shared by several crawler processes through a
+// SQLite database on storage every worker can reach. Links are claimed with a
+// lease so a crashed worker's claims are picked up again by the others.
+type SQLiteFrontier struct {
+	db       *sql.DB
+	workerID string
+	lease    time.Duration
+	poll     time.Duration
+}
+
+// NewSQLiteFrontier opens (or creates) the shared frontier database at path
+func NewSQLiteFrontier(path, workerID string) (*SQLiteFrontier, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000&_txlock=immediate&_journal_mode=DELETE")
+	if err != nil {
+		return nil, fmt.Errorf("opening frontier database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(frontierSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating frontier schema: %w", err)
+	}
+	// frontiers created before links recorded who discovered them
+	if _, err := db.Exec(`ALTER TABLE frontier ADD COLUMN discovered_by TEXT NOT NULL DEFAULT ''`); err != nil &&
+		!strings.Contains(err.Error(), "duplicate column name") {
+		db.Close()
+		return nil, fmt.Errorf("migrating frontier schema: %w", err)
+	}
+
+	return &SQLiteFrontier{
+		db:       db,
+		workerID: workerID,
+		lease:    10 * time.Minute,
+		poll:     time.Second,
+	}, nil
+}
+
+// Close releases the database
+func (f *SQLiteFrontier) Close() error {
+	return f.db.Close()
+}
+
+// Seed enqueues the start links only if no worker has seeded the crawl yet.
+// The worker whose first link lands enqueues the rest.
+func (f *SQLiteFrontier) Seed(ctx context.Context, links ...types.Links) error {
+	if len(links) == 0 {
+		return nil
+	}
+	link := links[0]
+	res, err := f.db.ExecContext(ctx,
+		`INSERT INTO frontier (link, depth, parent, form, discovered_by)
+		 SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM frontier)`,
+		link.Link, link.Depth, link.Parent, link.Form, link.DiscoveredBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	return f.Push(ctx, links[1:]...)
+}
+
+func (f *SQLiteFrontier) Push(ctx context.Context, links ...types.Links) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, l := range links {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO frontier (link, depth, parent, form, discovered_by) VALUES (?, ?, ?, ?, ?)`,
+			l.Link, l.Depth, l.Parent, l.Form, l.DiscoveredBy); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Next claims the oldest pending link. While other workers still hold claims
+// (and may push more links) it waits instead of reporting the crawl finished.
+func (f *SQLiteFrontier) Next(ctx context.Context) (types.Links, bool, error) {
+	for {
+		link, claimed, inFlight, err := f.claim(ctx)
+		if err != nil {
+			return types.Links{}, false, err
+		}
+		if claimed {
+			return link, true, nil
+		}
+		if inFlight == 0 {
+			return types.Links{}, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return types.Links{}, false, ctx.Err()
+		case <-time.After(f.poll):
+		}
+	}
+}
+
+// claim tries to take one pending link, returning the number of links other
+// workers are still processing when there is none
+func (f *SQLiteFrontier) claim(ctx context.Context) (types.Links, bool, int, error) {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Links{}, false, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// hand expired claims of crashed workers back to the queue
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE frontier SET status = 'pending', worker = NULL
+		 WHERE status = 'claimed' AND claimed_at < ?`,
+		now.Add(-f.lease).Unix()); err != nil {
+		return types.Links{}, false, 0, err
+	}
+
+	var (
+		id   int64
+		link types.Links
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, link, depth, parent, form, discovered_by FROM frontier WHERE status = 'pending' ORDER BY id LIMIT 1`).
+		Scan(&id, &link.Link, &link.Depth, &link.Parent, &link.Form, &link.DiscoveredBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		var inFlight int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM frontier WHERE status = 'claimed'`).Scan(&inFlight); err != nil {
+			return types.Links{}, false, 0, err
+		}
+		return types.Links{}, false, inFlight, tx.Commit()
+	}
+	if err != nil {
+		return types.Links{}, false, 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE frontier SET status = 'claimed', worker = ?, claimed_at = ? WHERE id = ?`,
+		f.workerID, now.Unix(), id); err != nil {
+		return types.Links{}, false, 0, err
+	}
+	link.ID = id
+	return link, true, 0, tx.Commit()
+}
+
+func (f *SQLiteFrontier) Done(ctx context.Context, link types.Links) error {
+	_, err := f.db.ExecContext(ctx, `UPDATE frontier SET status = 'done' WHERE id = ?`, link.ID)
+	return err
+}
+
+func (f *SQLiteFrontier) Reserve(ctx context.Context, canonical string) (string, bool, error) {
+	res, err := f.db.ExecContext(ctx,
+		`INSERT INTO documents (canonical) VALUES (?) ON CONFLICT (canonical) DO NOTHING`, canonical)
+	if err != nil {
+		return "", false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return "", true, nil
+	}
+
+	var dir string
+	if err := f.db.QueryRowContext(ctx,
+		`SELECT dir FROM documents WHERE canonical = ?`, canonical).Scan(&dir); err != nil {
+		return "", false, err
+	}
+	return dir, false, nil
+}
+
+func (f *SQLiteFrontier) Complete(ctx context.Context, canonical, dir string) error {
+	_, err := f.db.ExecContext(ctx, `UPDATE documents SET dir = ? WHERE canonical = ?`, dir, canonical)
+	return err
+}
+
+func (f *SQLiteFrontier) Release(ctx context.Context, canonical string) error {
+	_, err := f.db.ExecContext(ctx, `DELETE FROM documents WHERE canonical = ? AND dir = ''`, canonical)
+	return err
+}
+
+// load enqueues pending links and records saved documents in bulk, taking
+// over the state of an in-memory frontier
+func (f *SQLiteFrontier) load(ctx context.Context, pending []types.Links, processed map[string]string) error {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, l := range pending {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO frontier (link, depth, parent, form, discovered_by) VALUES (?, ?, ?, ?, ?)`,
+			l.Link, l.Depth, l.Parent, l.Form, l.DiscoveredBy); err != nil {
+			return err
+		}
+	}
+	for canonical, dir := range processed {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO documents (canonical, dir) VALUES (?, ?)`, canonical, dir); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
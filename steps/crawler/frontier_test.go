@@ -0,0 +1,63 @@
+package crawler_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteFrontierSharedBetweenWorkers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "frontier.db")
+
+	a, err := crawler.NewSQLiteFrontier(path, "worker-a")
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := crawler.NewSQLiteFrontier(path, "worker-b")
+	require.NoError(t, err)
+	defer b.Close()
+
+	// only the first seed counts
+	require.NoError(t, a.Seed(ctx, types.Links{Link: "root", Parent: "out"}))
+	require.NoError(t, b.Seed(ctx, types.Links{Link: "root", Parent: "out"}))
+
+	root, ok, err := a.Next(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "root", root.Link)
+
+	// a document is owned by whichever worker reserves it first
+	_, reserved, err := a.Reserve(ctx, "doc:root")
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	dir, reserved, err := b.Reserve(ctx, "doc:root")
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Empty(t, dir, "owner hasn't saved the document yet")
+
+	require.NoError(t, a.Complete(ctx, "doc:root", "out/root"))
+	require.NoError(t, a.Push(ctx, types.Links{Link: "child", Depth: 1, Parent: "out/root", DiscoveredBy: "doc:root"}))
+	require.NoError(t, a.Done(ctx, root))
+
+	dir, _, err = b.Reserve(ctx, "doc:root")
+	require.NoError(t, err)
+	assert.Equal(t, "out/root", dir)
+
+	child, ok, err := b.Next(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "child", child.Link)
+	assert.Equal(t, 1, child.Depth)
+	assert.Equal(t, "doc:root", child.DiscoveredBy)
+	require.NoError(t, b.Done(ctx, child))
+
+	// nothing pending and nothing in flight: the crawl is finished
+	_, ok, err = a.Next(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
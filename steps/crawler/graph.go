@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// Files the crawled document graph is written to
+const (
+	GraphFile    = "graph.json"
+	GraphDOTFile = "graph.dot"
+)
+
+// Graph is the link graph of the crawled documents
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a crawled document
+type GraphNode struct {
+	// Key is the document's canonical key ("doc:<id>")
+	Key   string `json:"key"`
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	// Path is the document's directory in the output
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	// LinkedFrom and LinksTo count the crawled documents linking to the
+	// document and linked from it; a linked document nothing links to
+	// anymore is orphaned
+	LinkedFrom int `json:"linked_from"`
+	LinksTo    int `json:"links_to"`
+}
+
+// GraphEdge is a hyperlink from one crawled document to another
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// writeGraph writes the links between the saved documents, as recorded in
+// each metadata.json, to graph.json and as Graphviz to graph.dot. Links to
+// documents that weren't saved are left out. Unreadable metadata was
+// quarantined by writeInventory and is skipped.
+func (c *Crawler) writeGraph(ctx context.Context) error {
+	names, err := c.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]*GraphNode)
+	links := make(map[string][]string)
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+		data, err := c.store.ReadFile(ctx, name)
+		if err != nil {
+			return err
+		}
+		var m types.Metadata
+		if json.Unmarshal(data, &m) != nil || m.IsRedirect {
+			continue
+		}
+		key := m.Type + ":" + m.ID
+		if _, ok := nodes[key]; ok {
+			continue
+		}
+		nodes[key] = &GraphNode{Key: key, ID: m.ID, Type: m.Type, Title: m.Title, Path: storage.Dir(name), Depth: m.Depth}
+		links[key] = m.LinksTo
+	}
+
+	var g Graph
+	for from, targets := range links {
+		for _, to := range targets {
+			if target, ok := nodes[to]; ok && to != from {
+				g.Edges = append(g.Edges, GraphEdge{From: from, To: to})
+				nodes[from].LinksTo++
+				target.LinkedFrom++
+			}
+		}
+	}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	slices.SortFunc(g.Nodes, func(a, b GraphNode) int { return strings.Compare(a.Key, b.Key) })
+	slices.SortFunc(g.Edges, func(a, b GraphEdge) int {
+		return cmp.Or(strings.Compare(a.From, b.From), strings.Compare(a.To, b.To))
+	})
+
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := c.store.WriteFile(ctx, GraphFile, data); err != nil {
+		return err
+	}
+	return c.store.WriteFile(ctx, GraphDOTFile, g.DOT())
+}
+
+// DOT renders the graph in Graphviz's DOT language: docs are boxes and
+// sheets notes, labelled with their titles and IDs
+func (g Graph) DOT() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph docs {\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Type == "sheet" {
+			shape = "note"
+		}
+		fmt.Fprintf(&buf, "  %s [label=%s, shape=%s];\n", dotQuote(n.Key), dotQuote(n.Title+"\n"+n.ID), shape)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// dotQuote returns s as a quoted DOT ID
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGraph(t *testing.T) {
+	ctx := context.Background()
+	c := NewCrawler(2, time.Second, "", t.TempDir(), nil, nil)
+	c.writeMetadata(ctx, "root", types.Metadata{ID: "root", Type: "doc", Title: `The "Handbook"`,
+		LinksTo: []string{"doc:a", "sheet:s", "doc:restricted"}})
+	c.writeMetadata(ctx, "root/a", types.Metadata{ID: "a", Type: "doc", Title: "A", Depth: 1, LinksTo: []string{"doc:root"}})
+	c.writeMetadata(ctx, "root/s", types.Metadata{ID: "s", Type: "sheet", Title: "S", Depth: 1})
+	c.writeMetadata(ctx, "root/a/root-redirect", types.Metadata{ID: "root", Type: "doc", IsRedirect: true, RedirectKey: "doc:root"})
+	require.NoError(t, c.writeGraph(ctx))
+
+	data, err := c.store.ReadFile(ctx, GraphFile)
+	require.NoError(t, err)
+	var g Graph
+	require.NoError(t, json.Unmarshal(data, &g))
+	assert.Equal(t, []GraphNode{
+		{Key: "doc:a", ID: "a", Type: "doc", Title: "A", Path: "root/a", Depth: 1, LinkedFrom: 1, LinksTo: 1},
+		{Key: "doc:root", ID: "root", Type: "doc", Title: `The "Handbook"`, Path: "root", LinkedFrom: 1, LinksTo: 2},
+		{Key: "sheet:s", ID: "s", Type: "sheet", Title: "S", Path: "root/s", Depth: 1, LinkedFrom: 1},
+	}, g.Nodes)
+	// the restricted document wasn't saved
+	assert.Equal(t, []GraphEdge{{"doc:a", "doc:root"}, {"doc:root", "doc:a"}, {"doc:root", "sheet:s"}}, g.Edges)
+
+	dot, err := c.store.ReadFile(ctx, GraphDOTFile)
+	require.NoError(t, err)
+	assert.Equal(t, `digraph docs {
+  "doc:a" [label="A\na", shape=box];
+  "doc:root" [label="The \"Handbook\"\nroot", shape=box];
+  "sheet:s" [label="S\ns", shape=note];
+  "doc:a" -> "doc:root";
+  "doc:root" -> "doc:a";
+  "doc:root" -> "sheet:s";
+}
+`, string(dot))
+}
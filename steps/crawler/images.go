@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxImageSize caps the images downloaded with a doc
+const maxImageSize = 25 << 20
+
+// WithImages downloads the images a doc's export references, which Google
+// serves from googleusercontent URLs that expire, into the doc's assets/
+// folder and points the saved HTML at the local copies
+func WithImages() Option {
+	return func(c *Crawler) {
+		c.images = true
+	}
+}
+
+// saveImages downloads every remote image of the doc in dir to dir/assets
+// and rewrites the <img> sources of its content to the saved files. Images
+// that can't be downloaded keep their original source.
+func (c *Crawler) saveImages(ctx context.Context, dir string) error {
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	filename := m.TextFileName()
+	content, err := c.store.ReadFile(ctx, path.Join(dir, filename))
+	if err != nil {
+		return err
+	}
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("parsing HTML: %w", err)
+	}
+
+	var imgs []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			imgs = append(imgs, n)
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+	}
+	walk(root)
+
+	local := make(map[string]string)
+	saved := make(map[string][]byte)
+	for _, img := range imgs {
+		for i := range img.Attr {
+			src := img.Attr[i].Val
+			if img.Attr[i].Key != "src" || !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+				continue
+			}
+			name, ok := local[src]
+			if !ok {
+				var data []byte
+				name, data, err = c.downloadImage(ctx, src)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					slog.Warn("failed to download image, keeping original",
+						slog.String("dir", dir),
+						slog.String("src", src),
+						slog.Any("error", err))
+					continue
+				}
+				if err := c.store.WriteFile(ctx, path.Join(dir, name), data); err != nil {
+					return fmt.Errorf("writing %s: %w", name, err)
+				}
+				local[src] = name
+				saved[name] = data
+			}
+			img.Attr[i].Val = name
+		}
+	}
+	if len(local) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return fmt.Errorf("rendering HTML: %w", err)
+	}
+	if err := c.store.WriteFile(ctx, path.Join(dir, filename), buf.Bytes()); err != nil {
+		return fmt.Errorf("writing content: %w", err)
+	}
+	saved[filename] = buf.Bytes()
+	slog.Info("saved images", slog.String("dir", dir), slog.Int("count", len(local)))
+	return c.recordChecksums(ctx, dir, saved)
+}
+
+// downloadImage fetches one image and returns the name, relative to the
+// doc's directory, it is saved under: identical images share one file
+func (c *Crawler) downloadImage(ctx context.Context, src string) (string, []byte, error) {
+	resp, err := c.httpGet(ctx, src)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", nil, fmt.Errorf("not an image: %s", contentType)
+	}
+	sum := sha256.Sum256(data)
+	name := "img-" + hex.EncodeToString(sum[:])[:16] + imageExt(contentType)
+	return AssetsDir + "/" + name, data, nil
+}
+
+// imageExt returns the file extension for an image content type
+func imageExt(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/bmp":
+		return ".bmp"
+	}
+	return ""
+}
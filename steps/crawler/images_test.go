@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveImages(t *testing.T) {
+	var pic bytes.Buffer
+	require.NoError(t, png.Encode(&pic, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(pic.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewCrawler(1, time.Second, "", t.TempDir(), nil, nil, WithImages())
+	c.writeMetadata(ctx, "doc", types.Metadata{ID: "d", Type: "doc", ContentFile: "content.html"})
+	content := `<html><body><img src="` + srv.URL + `/a"><img src="` + srv.URL + `/a"><img src="` + srv.URL + `/gone"></body></html>`
+	require.NoError(t, c.store.WriteFile(ctx, "doc/content.html", []byte(content)))
+
+	require.NoError(t, c.saveImages(ctx, "doc"))
+
+	saved, err := c.store.ReadFile(ctx, "doc/content.html")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(saved), `src="assets/img-`))
+	assert.Contains(t, string(saved), srv.URL+"/gone")
+
+	names, err := c.store.List(ctx, "doc/assets")
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+	assert.Equal(t, ".png", path.Ext(names[0]))
+
+	m, err := c.loadMetadata(ctx, "doc")
+	require.NoError(t, err)
+	assert.Contains(t, m.Checksums, "assets/"+path.Base(names[0]))
+}
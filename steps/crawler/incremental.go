@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// WithIncremental keeps the previous run's output instead of wiping it and
+// only downloads documents changed since: a document whose Drive
+// modifiedTime (or, without a Drive client, whose export's SHA-256) matches
+// its previous metadata is reused from disk. Each document's metadata
+// records the outcome in Change, which the uploader and patcher use to skip
+// unchanged documents; documents no longer reached are removed.
+func WithIncremental() Option {
+	return func(c *Crawler) {
+		c.incremental = true
+	}
+}
+
+// previousDoc is a document saved by the previous run
+type previousDoc struct {
+	dir  string
+	meta *types.Metadata
+}
+
+// loadPrevious indexes the documents the previous run saved and clears its
+// reports, which would otherwise keep entries of documents no longer reached
+func (c *Crawler) loadPrevious(ctx context.Context) error {
+	names, err := c.store.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("listing previous output: %w", err)
+	}
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+		dir := storage.Dir(name)
+		m, err := c.loadMetadata(ctx, dir)
+		if err != nil || m.IsRedirect {
+			continue
+		}
+		c.previous[m.Type+":"+m.ID] = previousDoc{dir: dir, meta: m}
+	}
+
+	for _, file := range []string{AccessRequestsFile, InaccessibleFile, SharingReportFile, SkippedDocumentsFile, SkippedExternalFile} {
+		if err := c.store.RemoveAll(ctx, file); err != nil {
+			return fmt.Errorf("removing %s: %w", file, err)
+		}
+	}
+	slog.Info("incremental crawl", slog.Int("previous_documents", len(c.previous)))
+	return nil
+}
+
+// reuseUnchanged returns the previously saved content of a document Drive
+// reports unmodified since, along with its current modifiedTime. ok is false
+// when the document has to be downloaded.
+func (c *Crawler) reuseUnchanged(ctx context.Context, canonical, id string) (content []byte, modified string, ok bool) {
+	if !c.incremental || c.driveSvc == nil {
+		return nil, "", false
+	}
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, "", false
+	}
+	f, err := c.driveSvc.Files.Get(id).Fields("modifiedTime").SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		slog.Debug("modified time lookup failed", slog.String("id", id), slog.Any("error", err))
+		return nil, "", false
+	}
+	prev, seen := c.previous[canonical]
+	if !seen || prev.meta.ModifiedTime == "" || prev.meta.ModifiedTime != f.ModifiedTime {
+		return nil, f.ModifiedTime, false
+	}
+	content, err = c.store.ReadFile(ctx, path.Join(prev.dir, prev.meta.ContentFileName()))
+	if err != nil {
+		slog.Warn("previous content unreadable, downloading again", slog.String("dir", prev.dir), slog.Any("error", err))
+		return nil, f.ModifiedTime, false
+	}
+	return content, f.ModifiedTime, true
+}
+
+// changeOf classifies a saved document against the previous run. Content
+// reused from disk is unchanged; otherwise the saved content's hash decides.
+func (c *Crawler) changeOf(canonical string, content []byte, reused bool) string {
+	prev, seen := c.previous[canonical]
+	switch {
+	case !seen:
+		return types.ChangeNew
+	case reused:
+		return types.ChangeUnchanged
+	}
+	sum := sha256.Sum256(content)
+	if prev.meta.Checksums[prev.meta.ContentFileName()] == hex.EncodeToString(sum[:]) {
+		return types.ChangeUnchanged
+	}
+	return types.ChangeModified
+}
+
+// pruneUnvisited removes the directories of documents the crawl didn't reach
+// this time. Every saved directory's parent was saved too, so this never
+// removes a directory a visited one lives in.
+func (c *Crawler) pruneUnvisited(ctx context.Context) error {
+	names, err := c.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+		dir := storage.Dir(name)
+		if c.visited[dir] {
+			continue
+		}
+		if err := c.store.RemoveAll(ctx, dir); err != nil {
+			return fmt.Errorf("removing %s: %w", dir, err)
+		}
+		removed++
+	}
+	if removed > 0 {
+		slog.Info("removed documents no longer linked", slog.Int("count", removed))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementalChangesAndPrune(t *testing.T) {
+	ctx := context.Background()
+	c := NewCrawler(2, time.Second, "", t.TempDir(), nil, nil, WithIncremental())
+	c.previous = make(map[string]previousDoc)
+
+	sum := sha256.Sum256([]byte("old"))
+	for _, m := range []types.Metadata{
+		{ID: "a", Type: "doc", ContentFile: "content.html", Checksums: map[string]string{"content.html": hex.EncodeToString(sum[:])}},
+		{ID: "b", Type: "doc", ContentFile: "content.html"},
+	} {
+		c.writeMetadata(ctx, "root/"+m.ID, m)
+	}
+	// reports of the last run are rebuilt, not merged into
+	for _, file := range []string{AccessRequestsFile, SkippedDocumentsFile, SkippedExternalFile} {
+		require.NoError(t, c.store.WriteFile(ctx, file, []byte(`[{"id":"gone"}]`)))
+	}
+	require.NoError(t, c.loadPrevious(ctx))
+	assert.Len(t, c.previous, 2)
+
+	assert.Equal(t, types.ChangeUnchanged, c.changeOf("doc:a", []byte("old"), false))
+	assert.Equal(t, types.ChangeModified, c.changeOf("doc:a", []byte("new"), false))
+	assert.Equal(t, types.ChangeUnchanged, c.changeOf("doc:b", nil, true))
+	assert.Equal(t, types.ChangeNew, c.changeOf("doc:c", []byte("new"), false))
+
+	// this run only reaches a
+	c.visited = make(map[string]bool)
+	c.writeMetadata(ctx, "root", types.Metadata{ID: "root", Type: "doc"})
+	c.writeMetadata(ctx, "root/a", types.Metadata{ID: "a", Type: "doc"})
+	require.NoError(t, c.pruneUnvisited(ctx))
+
+	names, err := c.store.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root/a/metadata.json", "root/metadata.json"}, names)
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"path"
+	"strconv"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/repair"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// InventoryFile lists every crawled document, one row each
+const InventoryFile = "inventory.csv"
+
+var inventoryHeader = []string{"path", "title", "type", "id", "source_url", "depth", "discovered_by", "language", "words", "characters", "pages"}
+
+// writeInventory summarises every saved document under the output directory
+// into inventory.csv, so the biggest documents can be found without opening
+// each metadata.json
+func (c *Crawler) writeInventory(ctx context.Context) error {
+	names, err := c.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(inventoryHeader); err != nil {
+		return err
+	}
+
+	var quarantined []repair.Entry
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+
+		data, err := c.store.ReadFile(ctx, name)
+		if err != nil {
+			return err
+		}
+		var m types.Metadata
+		if err := json.Unmarshal(data, &m); err != nil {
+			// left behind by an interrupted earlier crawl
+			slog.Warn("quarantining unreadable directory",
+				slog.String("path", name),
+				slog.Any("error", err))
+			quarantined = append(quarantined, repair.NewEntry(c.Name(), storage.Dir(name), err))
+			continue
+		}
+		if m.IsRedirect {
+			continue
+		}
+
+		if err := w.Write([]string{
+			storage.Dir(name), m.Title, m.Type, m.ID, m.SourceURL,
+			strconv.Itoa(m.Depth), m.DiscoveredBy, m.Language,
+			strconv.Itoa(m.Words), strconv.Itoa(m.Characters), strconv.Itoa(m.Pages),
+		}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := repair.Record(ctx, c.store, c.Name(), quarantined); err != nil {
+		return err
+	}
+	return c.store.WriteFile(ctx, InventoryFile, buf.Bytes())
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/markdown"
+)
+
+// WithMarkdown saves, next to each doc's export, a Markdown conversion
+// (content.md for content.html) keeping headings, lists, links and tables,
+// for static-site generators and text pipelines
+func WithMarkdown() Option {
+	return func(c *Crawler) {
+		c.markdown = true
+	}
+}
+
+// MarkdownFileName returns the name of the Markdown copy of a doc's content file
+func MarkdownFileName(contentFile string) string {
+	return strings.TrimSuffix(contentFile, path.Ext(contentFile)) + ".md"
+}
+
+// writeMarkdown saves the Markdown copy of the doc in dir. Links keep
+// pointing at the source documents, which cleaning unwraps from Google's
+// redirector.
+func (c *Crawler) writeMarkdown(ctx context.Context, dir string) error {
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	content, err := c.store.ReadFile(ctx, path.Join(dir, m.TextFileName()))
+	if err != nil {
+		return err
+	}
+
+	clean, err := htmlclean.Clean(content)
+	if err != nil {
+		return fmt.Errorf("cleaning HTML: %w", err)
+	}
+	md, err := markdown.FromHTML(clean, nil)
+	if err != nil {
+		return fmt.Errorf("converting to Markdown: %w", err)
+	}
+	name := MarkdownFileName(m.ContentFileName())
+	if err := c.store.WriteFile(ctx, path.Join(dir, name), []byte(md)); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return c.recordChecksums(ctx, dir, map[string][]byte{name: []byte(md)})
+}
@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// DefaultContentName is the template content files are named with unless
+// configured otherwise
+const DefaultContentName = "content.{ext}"
+
+// WithContentNames names each document type's content file after a
+// template, by type ("doc", "sheet"). Templates may use {slug}, {id}, {type}
+// and {ext}; types without a template use DefaultContentName. The chosen
+// name is recorded in metadata.json for later steps.
+func WithContentNames(templates map[string]string) Option {
+	return func(c *Crawler) {
+		c.contentNames = templates
+	}
+}
+
+// ParseContentNames parses the -content-name flag: either one template for
+// every type, or comma-separated type=template pairs
+func ParseContentNames(spec string) (map[string]string, error) {
+	templates := make(map[string]string)
+	if spec == "" {
+		return templates, nil
+	}
+
+	if !strings.Contains(spec, "=") {
+		for docType := range docConfigs {
+			templates[docType] = spec
+		}
+		return templates, validateContentNames(templates)
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		docType, tmpl, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("content name %q: want type=template", pair)
+		}
+		if _, known := docConfigs[docType]; !known {
+			return nil, fmt.Errorf("content name %q: unknown type %q", pair, docType)
+		}
+		templates[docType] = tmpl
+	}
+	return templates, validateContentNames(templates)
+}
+
+// validateContentNames rejects templates that can't name a file next to
+// metadata.json
+func validateContentNames(templates map[string]string) error {
+	for docType, tmpl := range templates {
+		name := expandContentName(tmpl, docType, "slug", "id", types.DefaultFormats[docType])
+		switch {
+		case tmpl == "":
+			return fmt.Errorf("content name for %s is empty", docType)
+		case strings.Contains(tmpl, "/"):
+			return fmt.Errorf("content name %q must not contain '/'", tmpl)
+		case name == "metadata.json" || strings.HasPrefix(name, "."):
+			return fmt.Errorf("content name %q is reserved", tmpl)
+		}
+	}
+	return nil
+}
+
+// contentFileName returns the file a document's export is saved as
+func (c *Crawler) contentFileName(docType, slug, id string) string {
+	tmpl, ok := c.contentNames[docType]
+	if !ok {
+		tmpl = DefaultContentName
+	}
+	return expandContentName(tmpl, docType, slug, id, c.format(docType))
+}
+
+// expandContentName fills in a content name template
+func expandContentName(tmpl, docType, slug, id, ext string) string {
+	return strings.NewReplacer(
+		"{slug}", slug,
+		"{id}", id,
+		"{type}", docType,
+		"{ext}", ext,
+	).Replace(tmpl)
+}
+
+// readContent reads the HTML or CSV export saved in dir, wherever its
+// metadata says it is
+func (c *Crawler) readContent(ctx context.Context, dir string) ([]byte, error) {
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("loading metadata: %w", err)
+	}
+	return c.store.ReadFile(ctx, path.Join(dir, m.TextFileName()))
+}
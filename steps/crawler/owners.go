@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// SkippedDocumentsFile lists the documents the owner filter left out
+const SkippedDocumentsFile = "skipped_documents.json"
+
+// WithOwnerFilter limits the crawl to documents owned by one of owners,
+// each an email address ("ana@example.com") or a domain ("example.com").
+// Other documents are neither saved nor followed, and are listed in
+// skipped_documents.json. It needs WithDriveService to look owners up.
+func WithOwnerFilter(owners []string) Option {
+	return func(c *Crawler) {
+		for _, o := range owners {
+			if o = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(o), "@")); o != "" {
+				c.owners = append(c.owners, o)
+			}
+		}
+	}
+}
+
+// ownerAllowed reports whether the document passes the owner filter,
+// recording it in skipped_documents.json when it doesn't. Decisions are
+// remembered, so further links to a skipped document cost no lookup.
+func (c *Crawler) ownerAllowed(ctx context.Context, task types.Links, docType, id, cleanURL string) bool {
+	if len(c.owners) == 0 || c.driveSvc == nil {
+		return true
+	}
+	if allowed, ok := c.ownerDecisions[id]; ok {
+		return allowed
+	}
+
+	skip := types.SkippedDocument{ID: id, Type: docType, URL: cleanURL, LinkedFrom: task.Parent}
+	if err := c.limiter.Wait(ctx); err != nil {
+		// cancelled: the crawl is stopping, don't record a decision
+		return false
+	}
+	f, err := c.driveSvc.Files.Get(id).
+		Fields("name", "owners(displayName,emailAddress)").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		skip.Reason = fmt.Sprintf("owner lookup failed: %v", err)
+	} else {
+		skip.Title = f.Name
+		for _, o := range f.Owners {
+			skip.Owners = append(skip.Owners, types.Owner{Name: o.DisplayName, Email: o.EmailAddress})
+			if c.ownerMatches(o.EmailAddress) {
+				c.ownerDecisions[id] = true
+				return true
+			}
+		}
+		skip.Reason = "not owned by a listed owner"
+		if len(f.Owners) == 0 {
+			skip.Reason = "in a shared drive, without an owner"
+		}
+	}
+
+	slog.Info("skipping document outside the owner filter",
+		slog.String("url", cleanURL),
+		slog.String("reason", skip.Reason))
+	c.ownerDecisions[id] = false
+	c.skipped = append(c.skipped, skip)
+	return false
+}
+
+// ownerMatches reports whether email is a listed owner or in a listed domain
+func (c *Crawler) ownerMatches(email string) bool {
+	email = strings.ToLower(email)
+	domain := emailDomain(email)
+	for _, o := range c.owners {
+		if o == email || o == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSkippedDocuments merges the documents skipped this run into
+// skipped_documents.json, keeping entries other crawl workers already wrote
+func (c *Crawler) writeSkippedDocuments(ctx context.Context) error {
+	return writeMerged(ctx, c.store, SkippedDocumentsFile, c.skipped, func(e types.SkippedDocument) (string, string) {
+		return e.ID, e.URL
+	})
+}
@@ -0,0 +1,18 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerMatches(t *testing.T) {
+	c := &Crawler{}
+	WithOwnerFilter([]string{"Ana@Example.com", " @docs-team.org", ""})(c)
+	assert.Equal(t, []string{"ana@example.com", "docs-team.org"}, c.owners)
+
+	assert.True(t, c.ownerMatches("ana@example.com"))
+	assert.True(t, c.ownerMatches("Bo@Docs-Team.org"))
+	assert.False(t, c.ownerMatches("bo@example.com"))
+	assert.False(t, c.ownerMatches("ana@sub.docs-team.org"))
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+)
+
+// writeMerged merges the entries found this run into the JSON list file,
+// keeping entries other crawl workers already wrote. key returns an entry's
+// document ID and URL; the list is sorted by URL, then ID.
+func writeMerged[T any](ctx context.Context, store storage.Storage, file string, found []T, key func(T) (id, url string)) error {
+	byID := make(map[string]T)
+	if data, err := store.ReadFile(ctx, file); err == nil {
+		var existing []T
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("parsing %s: %w", file, err)
+		}
+		for _, e := range existing {
+			id, _ := key(e)
+			byID[id] = e
+		}
+	}
+	if len(byID) == 0 && len(found) == 0 {
+		return nil
+	}
+
+	for _, e := range found {
+		id, _ := key(e)
+		if _, seen := byID[id]; !seen {
+			byID[id] = e
+		}
+	}
+
+	all := make([]T, 0, len(byID))
+	for _, e := range byID {
+		all = append(all, e)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		idI, urlI := key(all[i])
+		idJ, urlJ := key(all[j])
+		if urlI != urlJ {
+			return urlI < urlJ
+		}
+		return idI < idJ
+	})
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.WriteFile(ctx, file, data)
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"google.golang.org/api/drive/v3"
+)
+
+// RevisionsFile holds a document's revision listing next to its content
+const RevisionsFile = "revisions.json"
+
+// writeRevisions lists who edited the document and when into dir/revisions.json.
+// Copies made by the uploader start with a fresh history, so this file is the
+// only record of it that travels with the archive.
+func (c *Crawler) writeRevisions(ctx context.Context, dir, fileID string) error {
+	var revisions []types.Revision
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	err := c.driveSvc.Revisions.List(fileID).
+		Fields("nextPageToken", "revisions(id,modifiedTime,lastModifyingUser(displayName,emailAddress))").
+		Context(ctx).
+		Pages(ctx, func(page *drive.RevisionList) error {
+			for _, r := range page.Revisions {
+				rev := types.Revision{ID: r.Id}
+				if t, err := time.Parse(time.RFC3339, r.ModifiedTime); err == nil {
+					rev.ModifiedTime = t
+				}
+				if r.LastModifyingUser != nil {
+					rev.Author = types.Owner{
+						Name:  r.LastModifyingUser.DisplayName,
+						Email: r.LastModifyingUser.EmailAddress,
+					}
+				}
+				revisions = append(revisions, rev)
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("listing revisions: %w", err)
+	}
+
+	data, err := json.MarshalIndent(revisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.store.WriteFile(ctx, path.Join(dir, RevisionsFile), data)
+}
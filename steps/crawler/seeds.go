@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// driveFolderRe matches Drive folder links, capturing the folder ID
+var driveFolderRe = regexp.MustCompile(`drive\.google\.com/drive/(?:u/\d+/)?folders/([A-Za-z0-9_-]+)`)
+
+// Drive MIME types the folder walk recognises
+const (
+	folderMimeType   = "application/vnd.google-apps.folder"
+	docMimeType      = "application/vnd.google-apps.document"
+	sheetMimeType    = "application/vnd.google-apps.spreadsheet"
+	shortcutMimeType = "application/vnd.google-apps.shortcut"
+)
+
+// WithFolderSeed crawls every doc and sheet inside a Drive folder, its
+// subfolders included, instead of the start URL. Each is a depth-0 seed
+// whose links are followed as usual. It needs WithDriveService. A start URL
+// that is a folder link seeds the same way.
+func WithFolderSeed(folderID string) Option {
+	return func(c *Crawler) {
+		c.seedFolder = folderID
+	}
+}
+
+// WithExtraSeeds crawls these URLs too, each as a depth-0 seed next to the
+// start URL or folder
+func WithExtraSeeds(urls ...string) Option {
+	return func(c *Crawler) {
+		c.extraSeeds = urls
+	}
+}
+
+// FolderID returns the ID of a Drive folder link
+func FolderID(rawURL string) (string, bool) {
+	m := driveFolderRe.FindStringSubmatch(rawURL)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// seeds returns the links a crawl starts from
+func (c *Crawler) seeds(ctx context.Context) ([]types.Links, error) {
+	seeds, err := c.rootSeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range c.extraSeeds {
+		seeds = append(seeds, types.Links{Link: u, Depth: 0, Parent: ""})
+	}
+	return seeds, nil
+}
+
+// rootSeeds returns the start URL, or the documents of the seed folder
+func (c *Crawler) rootSeeds(ctx context.Context) ([]types.Links, error) {
+	folderID := c.seedFolder
+	if id, ok := FolderID(c.startURL); ok && folderID == "" {
+		folderID = id
+	}
+	if folderID == "" {
+		return []types.Links{{Link: c.startURL, Depth: 0, Parent: ""}}, nil
+	}
+	if c.driveSvc == nil {
+		return nil, fmt.Errorf("crawling a Drive folder needs a Drive client")
+	}
+
+	seeds, err := c.folderDocuments(ctx, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("listing Drive folder %s: %w", folderID, err)
+	}
+	slog.Info("seeding crawl from Drive folder",
+		slog.String("folder_id", folderID),
+		slog.Int("documents", len(seeds)))
+	return seeds, nil
+}
+
+// folderDocuments walks a folder tree breadth-first, returning a depth-0
+// link for every doc and sheet in it. Shortcuts to documents count; each
+// folder is listed once even if shortcuts lead back to it.
+func (c *Crawler) folderDocuments(ctx context.Context, rootID string) ([]types.Links, error) {
+	var seeds []types.Links
+	seenDocs := make(map[string]bool)
+	seenFolders := map[string]bool{rootID: true}
+	queue := []string{rootID}
+
+	add := func(id, mimeType string) {
+		var link string
+		switch mimeType {
+		case docMimeType:
+			link = fmt.Sprintf("https://docs.google.com/document/d/%s/edit", id)
+		case sheetMimeType:
+			link = fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", id)
+		default:
+			return
+		}
+		if !seenDocs[id] {
+			seenDocs[id] = true
+			seeds = append(seeds, types.Links{Link: link, Depth: 0, Parent: ""})
+		}
+	}
+
+	for len(queue) > 0 {
+		folderID := queue[0]
+		queue = queue[1:]
+
+		pageToken := ""
+		for {
+			call := c.driveSvc.Files.List().
+				Q(fmt.Sprintf("'%s' in parents and trashed=false", folderID)).
+				Fields("nextPageToken, files(id, name, mimeType, shortcutDetails)").
+				OrderBy("folder,name").
+				SupportsAllDrives(true).
+				IncludeItemsFromAllDrives(true).
+				PageSize(1000).
+				Context(ctx)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+			if err := c.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+			r, err := call.Do()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, f := range r.Files {
+				id, mimeType := f.Id, f.MimeType
+				if mimeType == shortcutMimeType && f.ShortcutDetails != nil {
+					id, mimeType = f.ShortcutDetails.TargetId, f.ShortcutDetails.TargetMimeType
+				}
+				if mimeType == folderMimeType {
+					if !seenFolders[id] {
+						seenFolders[id] = true
+						queue = append(queue, id)
+					}
+					continue
+				}
+				add(id, mimeType)
+			}
+
+			if r.NextPageToken == "" {
+				break
+			}
+			pageToken = r.NextPageToken
+		}
+	}
+	return seeds, nil
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestFolderSeeds(t *testing.T) {
+	folders := map[string][]map[string]any{
+		"root": {
+			{"id": "sub", "mimeType": folderMimeType},
+			{"id": "doc1", "mimeType": docMimeType},
+			{"id": "pdf1", "mimeType": "application/pdf"},
+		},
+		"sub": {
+			{"id": "sheet1", "mimeType": sheetMimeType},
+			{"id": "sc1", "mimeType": shortcutMimeType, "shortcutDetails": map[string]any{"targetId": "doc1", "targetMimeType": docMimeType}},
+			{"id": "sc2", "mimeType": shortcutMimeType, "shortcutDetails": map[string]any{"targetId": "root", "targetMimeType": folderMimeType}},
+		},
+	}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id string
+		for folder := range folders {
+			if r.URL.Query().Get("q") == "'"+folder+"' in parents and trashed=false" {
+				id = folder
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"files": folders[id]})
+	}))
+	defer api.Close()
+
+	svc, err := drive.NewService(context.Background(), option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	c := &Crawler{startURL: "https://drive.google.com/drive/u/0/folders/root?usp=sharing", driveSvc: svc, limiter: ratelimit.Unlimited()}
+	seeds, err := c.seeds(context.Background())
+	require.NoError(t, err)
+
+	var links []string
+	for _, s := range seeds {
+		assert.Zero(t, s.Depth)
+		links = append(links, s.Link)
+	}
+	assert.Equal(t, []string{
+		"https://docs.google.com/document/d/doc1/edit",
+		"https://docs.google.com/spreadsheets/d/sheet1/edit",
+	}, links)
+}
+
+func TestExtraSeedsFollowStartURL(t *testing.T) {
+	c := &Crawler{startURL: "https://docs.google.com/document/d/a/edit"}
+	WithExtraSeeds("https://docs.google.com/document/d/b/edit", "https://docs.google.com/spreadsheets/d/c/edit")(c)
+	seeds, err := c.seeds(context.Background())
+	require.NoError(t, err)
+
+	var links []string
+	for _, s := range seeds {
+		assert.Zero(t, s.Depth)
+		links = append(links, s.Link)
+	}
+	assert.Equal(t, []string{
+		"https://docs.google.com/document/d/a/edit",
+		"https://docs.google.com/document/d/b/edit",
+		"https://docs.google.com/spreadsheets/d/c/edit",
+	}, links)
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// SharingReportFile lists the sharing state of every discovered document
+const SharingReportFile = "sharing_report.json"
+
+// WithSharingAudit records for every discovered document whether it is
+// public, shared with a domain or restricted, and which collaborators are
+// outside its owners' domains, in sharing_report.json. Permissions are read
+// with WithDriveService's credentials; documents whose permissions they
+// can't read are reported from what the crawl saw.
+func WithSharingAudit() Option {
+	return func(c *Crawler) {
+		c.sharingAudit = true
+	}
+}
+
+// auditSharing records the sharing state of a saved document. The crawler
+// exported it anonymously, so without readable permissions it is public.
+func (c *Crawler) auditSharing(ctx context.Context, docType, id, cleanURL, dir string) {
+	if !c.sharingAudit {
+		return
+	}
+
+	entry := types.SharingEntry{ID: id, Type: docType, URL: cleanURL, Dir: dir, Visibility: types.VisibilityPublic}
+	if c.driveSvc != nil && c.limiter.Wait(ctx) == nil {
+		f, err := c.driveSvc.Files.Get(id).
+			Fields("name", "owners(emailAddress)", "permissions(type,role,domain,emailAddress)").
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			slog.Debug("permission lookup failed", slog.String("id", id), slog.Any("error", err))
+		} else {
+			entry.Title = f.Name
+			if len(f.Permissions) > 0 {
+				var owners []string
+				for _, o := range f.Owners {
+					owners = append(owners, emailDomain(o.EmailAddress))
+				}
+				entry.PermissionsListed = true
+				entry.Visibility = types.VisibilityRestricted
+				for _, p := range f.Permissions {
+					switch p.Type {
+					case "anyone":
+						entry.Visibility = types.VisibilityPublic
+					case "domain":
+						if entry.Visibility != types.VisibilityPublic {
+							entry.Visibility = types.VisibilityDomain
+						}
+						entry.Domains = append(entry.Domains, p.Domain)
+					case "user", "group":
+						if len(owners) > 0 && !slices.Contains(owners, emailDomain(p.EmailAddress)) {
+							entry.External = append(entry.External, fmt.Sprintf("%s (%s)", p.EmailAddress, p.Role))
+						}
+					}
+				}
+				slices.Sort(entry.Domains)
+				slices.Sort(entry.External)
+			}
+		}
+	}
+	c.sharing = append(c.sharing, entry)
+}
+
+// auditRestricted records a document the crawler couldn't read
+func (c *Crawler) auditRestricted(req types.AccessRequest) {
+	if !c.sharingAudit {
+		return
+	}
+	c.sharing = append(c.sharing, types.SharingEntry{
+		ID:         req.ID,
+		Type:       req.Type,
+		URL:        req.URL,
+		Title:      req.Title,
+		Visibility: types.VisibilityRestricted,
+	})
+}
+
+// writeSharingReport merges this run's entries into sharing_report.json
+func (c *Crawler) writeSharingReport(ctx context.Context) error {
+	if !c.sharingAudit {
+		return nil
+	}
+	return writeMerged(ctx, c.store, SharingReportFile, c.sharing, func(e types.SharingEntry) (string, string) {
+		return e.ID, e.URL
+	})
+}
+
+// emailDomain returns the lower-cased domain of an email address
+func emailDomain(email string) string {
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	return domain
+}
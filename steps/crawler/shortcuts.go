@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// fileKeyPrefix marks the canonical key of a link that names a Drive file
+// without saying whether it's a doc or a sheet
+const fileKeyPrefix = "file:"
+
+var (
+	// docs.google.com/open?id=<ID> and its drive.google.com and uc? forms
+	openLinkRe = regexp.MustCompile(`^https?://(?:docs|drive)\.google\.com/(?:a/[^/]+/)?(?:open|uc)\?(?:[^#]*&)?id=([^&#]+)`)
+	// drive.google.com/file/d/<ID>/view
+	driveFileRe = regexp.MustCompile(`^https?://drive\.google\.com/(?:a/[^/]+/)?file/d/([^/?#]+)`)
+)
+
+// shortcutID returns the file ID of an open?id= or drive.google.com/file
+// link, or "" for any other URL
+func shortcutID(cleanURL string) string {
+	for _, re := range []*regexp.Regexp{openLinkRe, driveFileRe} {
+		if m := re.FindStringSubmatch(cleanURL); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// resolveFile returns the doc: or sheet: key of the file a shortcut link
+// names, or "" when it isn't a doc or a sheet or can't be resolved. Drive
+// answers when a client is configured; otherwise the link is followed to the
+// editor URL Google redirects it to. Results are cached per run.
+func (c *Crawler) resolveFile(ctx context.Context, id string) string {
+	if key, ok := c.shortcuts[id]; ok {
+		return key
+	}
+	key := ""
+	if c.driveSvc != nil {
+		key = c.driveFileKey(ctx, id)
+	}
+	if key == "" {
+		key = c.followFileKey(ctx, id)
+	}
+	c.shortcuts[id] = key
+	return key
+}
+
+// driveFileKey asks Drive for the file's type, following Drive shortcuts to
+// their target
+func (c *Crawler) driveFileKey(ctx context.Context, id string) string {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return ""
+	}
+	f, err := c.driveSvc.Files.Get(id).
+		Fields("mimeType", "shortcutDetails").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		slog.Debug("file type lookup failed", slog.String("id", id), slog.Any("error", err))
+		return ""
+	}
+	mimeType := f.MimeType
+	if mimeType == shortcutMimeType && f.ShortcutDetails != nil {
+		id, mimeType = f.ShortcutDetails.TargetId, f.ShortcutDetails.TargetMimeType
+	}
+	switch mimeType {
+	case docMimeType:
+		return "doc:" + id
+	case sheetMimeType:
+		return "sheet:" + id
+	}
+	return ""
+}
+
+// followFileKey opens docs.google.com/open?id=<ID> and canonicalizes the
+// editor URL it redirects to
+func (c *Crawler) followFileKey(ctx context.Context, id string) string {
+	resp, err := c.httpGet(ctx, "https://docs.google.com/open?id="+url.QueryEscape(id))
+	if err != nil {
+		slog.Debug("could not resolve file link", slog.String("id", id), slog.Any("error", err))
+		return ""
+	}
+	resp.Body.Close()
+	m := googleDocsRe.FindStringSubmatch(resp.Request.URL.String())
+	if m == nil {
+		return ""
+	}
+	if m[1] == "spreadsheets" {
+		return "sheet:" + m[2]
+	}
+	return "doc:" + m[2]
+}
+
+// resolvedKey returns the key a file: key resolved to this run, or canonical
+// itself for any other key
+func (c *Crawler) resolvedKey(canonical string) string {
+	if id, ok := strings.CutPrefix(canonical, fileKeyPrefix); ok {
+		return c.shortcuts[id]
+	}
+	return canonical
+}
@@ -0,0 +1,71 @@
+package crawler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opens redirects open?id= links to the editor URL of the file they name
+// and answers everything else from exports
+type opens struct {
+	exports
+	editors map[string]string
+}
+
+func (o opens) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/open" {
+		return o.exports.RoundTrip(req)
+	}
+	code, header := http.StatusNotFound, make(http.Header)
+	if editor, ok := o.editors[req.URL.Query().Get("id")]; ok {
+		code = http.StatusFound
+		header.Set("Location", editor)
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestCrawlFollowsShortcutLinks(t *testing.T) {
+	transport := opens{
+		exports: exports{
+			"root": `<html><head><title>Root</title></head><body>` +
+				link("https://docs.google.com/open?id=child") +
+				link("https://drive.google.com/file/d/sheet/view?usp=sharing") +
+				link("https://docs.google.com/a/example.com/document/d/child/edit") +
+				link("https://drive.google.com/file/d/photo/view") +
+				`</body></html>`,
+			"child": `<html><head><title>Child</title></head><body></body></html>`,
+			"sheet": "a,b\n1,2\n",
+		},
+		editors: map[string]string{
+			"child": "https://docs.google.com/document/d/child/edit",
+			"sheet": "https://docs.google.com/spreadsheets/d/sheet/edit",
+			"photo": "https://drive.google.com/file/d/photo/view",
+		},
+	}
+
+	c := crawler.NewCrawler(2, time.Second, "https://docs.google.com/document/d/root/edit", t.TempDir(), nil, nil,
+		crawler.WithHTTPTransport(transport))
+	require.NoError(t, c.Run(context.Background()))
+
+	stats := c.Stats().(crawler.CrawlStats)
+	assert.Equal(t, 2, stats.TotalDocs)
+	assert.Equal(t, 1, stats.TotalSheets)
+	// the domain-prefixed link names the child again
+	assert.Equal(t, 1, stats.Redirects)
+	// the photo is neither a doc nor a sheet
+	assert.Equal(t, 1, stats.Skipped)
+	assert.Zero(t, stats.Errors)
+}
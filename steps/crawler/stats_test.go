@@ -0,0 +1,73 @@
+package crawler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exports answers Google export requests from a fixed set of documents
+type exports map[string]string
+
+func (e exports) RoundTrip(req *http.Request) (*http.Response, error) {
+	code, body := http.StatusNotFound, ""
+	for id, content := range e {
+		if strings.Contains(req.URL.Path, "/d/"+id+"/") {
+			code, body = http.StatusOK, content
+		}
+	}
+	if body == "forbidden" {
+		code = http.StatusForbidden
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func link(url string) string {
+	return `<a href="` + url + `">x</a>`
+}
+
+func TestCrawlStats(t *testing.T) {
+	docs := exports{
+		"root": `<html><head><title>Root</title></head><body>` +
+			link("https://docs.google.com/document/d/child/edit") +
+			link("https://docs.google.com/spreadsheets/d/sheet/edit") +
+			link("https://docs.google.com/document/d/private/edit") +
+			`</body></html>`,
+		"child": `<html><head><title>Child</title></head><body>` +
+			link("https://docs.google.com/spreadsheets/d/sheet/edit") +
+			link("https://docs.google.com/document/d/deep/edit") +
+			`</body></html>`,
+		// its link lies beyond the maximum depth
+		"deep": `<html><head><title>Deep</title></head><body>` +
+			link("https://docs.google.com/document/d/deeper/edit") +
+			`</body></html>`,
+		"sheet":   "a,b\n1,2\n",
+		"private": "forbidden",
+	}
+
+	c := crawler.NewCrawler(2, time.Second, "https://docs.google.com/document/d/root/edit", t.TempDir(), nil, nil,
+		crawler.WithHTTPTransport(docs))
+	require.NoError(t, c.Run(context.Background()))
+
+	stats := c.Stats().(crawler.CrawlStats)
+	assert.Equal(t, 3, stats.TotalDocs)
+	assert.Equal(t, 1, stats.TotalSheets)
+	assert.Equal(t, 1, stats.Redirects)
+	assert.Equal(t, 1, stats.Restricted)
+	assert.Equal(t, 1, stats.Skipped)
+	assert.Zero(t, stats.Errors)
+	assert.EqualValues(t, len(docs["root"])+len(docs["child"])+len(docs["deep"])+len(docs["sheet"]), stats.BytesDownloaded)
+}
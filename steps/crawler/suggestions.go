@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// suggestionModes maps the -suggestions values to the Docs API view modes
+var suggestionModes = map[string]string{
+	"accepted":  "PREVIEW_SUGGESTIONS_ACCEPTED",
+	"rejected":  "PREVIEW_WITHOUT_SUGGESTIONS",
+	"preserved": "SUGGESTIONS_INLINE",
+}
+
+// ValidSuggestionsMode reports whether mode is a known suggestions mode
+func ValidSuggestionsMode(mode string) bool {
+	_, ok := suggestionModes[mode]
+	return ok
+}
+
+// renderDoc fetches a doc through the Docs API in the configured suggestions
+// view mode and renders it to HTML. The anonymous export always shows the doc
+// with suggestions applied; the API lets us choose. Returns the HTML and the
+// doc's title.
+func (c *Crawler) renderDoc(ctx context.Context, docID string) ([]byte, string, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, "", err
+	}
+	doc, err := c.docsSvc.Documents.Get(docID).
+		SuggestionsViewMode(suggestionModes[c.suggestions]).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, "", fmt.Errorf("getting document: %w", err)
+	}
+
+	r := &docRenderer{doc: doc}
+	r.sb.WriteString("<html><head><meta charset=\"utf-8\"><title>")
+	r.sb.WriteString(html.EscapeString(doc.Title))
+	r.sb.WriteString("</title></head><body>")
+	if doc.Body != nil {
+		r.content(doc.Body.Content)
+	}
+	r.sb.WriteString("</body></html>")
+	return []byte(r.sb.String()), doc.Title, nil
+}
+
+// docRenderer turns a Docs API document into plain HTML: headings,
+// paragraphs, lists, tables, links and images. Suggested insertions and
+// deletions (present in "preserved" mode only) become <ins> and <del>.
+type docRenderer struct {
+	doc *docs.Document
+	sb  strings.Builder
+}
+
+var headingTags = map[string]string{
+	"TITLE":     "h1",
+	"SUBTITLE":  "h2",
+	"HEADING_1": "h1",
+	"HEADING_2": "h2",
+	"HEADING_3": "h3",
+	"HEADING_4": "h4",
+	"HEADING_5": "h5",
+	"HEADING_6": "h6",
+}
+
+func (r *docRenderer) content(elements []*docs.StructuralElement) {
+	inList := false
+	for _, el := range elements {
+		isItem := el.Paragraph != nil && el.Paragraph.Bullet != nil
+		if isItem && !inList {
+			r.sb.WriteString("<ul>")
+		}
+		if !isItem && inList {
+			r.sb.WriteString("</ul>")
+		}
+		inList = isItem
+
+		switch {
+		case el.Paragraph != nil:
+			r.paragraph(el.Paragraph)
+		case el.Table != nil:
+			r.table(el.Table)
+		case el.TableOfContents != nil:
+			r.sb.WriteString("<div>")
+			r.content(el.TableOfContents.Content)
+			r.sb.WriteString("</div>")
+		}
+	}
+	if inList {
+		r.sb.WriteString("</ul>")
+	}
+}
+
+func (r *docRenderer) paragraph(p *docs.Paragraph) {
+	tag := "p"
+	if p.ParagraphStyle != nil {
+		if h, ok := headingTags[p.ParagraphStyle.NamedStyleType]; ok {
+			tag = h
+		}
+	}
+	if p.Bullet != nil {
+		r.sb.WriteString("<li>")
+	}
+	r.sb.WriteString("<" + tag + ">")
+
+	for _, pe := range p.Elements {
+		switch {
+		case pe.TextRun != nil:
+			r.textRun(pe.TextRun)
+		case pe.InlineObjectElement != nil:
+			r.image(pe.InlineObjectElement.InlineObjectId)
+		}
+	}
+
+	r.sb.WriteString("</" + tag + ">")
+	if p.Bullet != nil {
+		r.sb.WriteString("</li>")
+	}
+}
+
+func (r *docRenderer) textRun(run *docs.TextRun) {
+	text := strings.TrimSuffix(run.Content, "\n")
+	if text == "" {
+		return
+	}
+	out := html.EscapeString(text)
+
+	if s := run.TextStyle; s != nil {
+		if s.Bold {
+			out = "<b>" + out + "</b>"
+		}
+		if s.Italic {
+			out = "<i>" + out + "</i>"
+		}
+		if s.Link != nil && s.Link.Url != "" {
+			out = `<a href="` + html.EscapeString(s.Link.Url) + `">` + out + "</a>"
+		}
+	}
+
+	switch {
+	case len(run.SuggestedInsertionIds) > 0:
+		out = "<ins>" + out + "</ins>"
+	case len(run.SuggestedDeletionIds) > 0:
+		out = "<del>" + out + "</del>"
+	}
+	r.sb.WriteString(out)
+}
+
+func (r *docRenderer) image(objectID string) {
+	src := ""
+	if obj, ok := r.doc.InlineObjects[objectID]; ok && obj.InlineObjectProperties != nil {
+		if e := obj.InlineObjectProperties.EmbeddedObject; e != nil && e.ImageProperties != nil {
+			src = e.ImageProperties.ContentUri
+		}
+	}
+	r.sb.WriteString(`<img src="` + html.EscapeString(src) + `">`)
+}
+
+func (r *docRenderer) table(t *docs.Table) {
+	r.sb.WriteString("<table>")
+	for _, row := range t.TableRows {
+		r.sb.WriteString("<tr>")
+		for _, cell := range row.TableCells {
+			r.sb.WriteString("<td>")
+			r.content(cell.Content)
+			r.sb.WriteString("</td>")
+		}
+		r.sb.WriteString("</tr>")
+	}
+	r.sb.WriteString("</table>")
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// tabExportURL exports one worksheet of a spreadsheet, picked by its gid
+const tabExportURL = "https://docs.google.com/spreadsheets/d/%%s/export?format=csv&gid=%d"
+
+// WithSheetTabs saves every worksheet of a sheet as its own CSV,
+// tab-<name>.csv next to the content file, which only holds the first one.
+// The tabs are listed through the Sheets API, so it needs a Sheets service.
+func WithSheetTabs() Option {
+	return func(c *Crawler) {
+		c.sheetTabs = true
+	}
+}
+
+// saveTabs exports every worksheet of the sheet in dir and records them in
+// its metadata as Tabs. Files of tabs that no longer exist are removed.
+func (c *Crawler) saveTabs(ctx context.Context, dir, id string) error {
+	if c.sheetsSvc == nil {
+		return errors.New("listing tabs needs the Sheets API")
+	}
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	ss, err := c.sheetsSvc.Spreadsheets.Get(id).
+		Fields("sheets(properties(sheetId,title))").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("listing tabs: %w", err)
+	}
+
+	m, err := c.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+	stale := make(map[string]bool)
+	for _, tab := range m.Tabs {
+		stale[tab.File] = true
+	}
+
+	var tabs []types.Tab
+	taken := make(map[string]bool)
+	for _, sheet := range ss.Sheets {
+		if sheet.Properties == nil {
+			continue
+		}
+		tab := types.Tab{
+			Title:   sheet.Properties.Title,
+			SheetID: sheet.Properties.SheetId,
+			File:    tabFileName(sheet.Properties.Title, sheet.Properties.SheetId, taken),
+		}
+		config := docConfig{
+			exportURLTemplate: fmt.Sprintf(tabExportURL, tab.SheetID),
+			ext:               fmt.Sprintf("gid%d.csv", tab.SheetID),
+		}
+		content, err := c.cachedExport(ctx, config, id)
+		if err != nil {
+			return fmt.Errorf("exporting tab %q: %w", tab.Title, err)
+		}
+		c.count(func(s *CrawlStats) { s.BytesDownloaded += int64(len(content)) })
+		if content, _, err = NormalizeCSV(content, c.csvDelimiter); err != nil {
+			return fmt.Errorf("normalizing tab %q: %w", tab.Title, err)
+		}
+		if err := c.store.WriteFile(ctx, path.Join(dir, tab.File), content); err != nil {
+			return fmt.Errorf("writing %s: %w", tab.File, err)
+		}
+		setChecksum(m, tab.File, content)
+		delete(stale, tab.File)
+		tabs = append(tabs, tab)
+	}
+
+	for name := range stale {
+		if err := c.store.RemoveAll(ctx, path.Join(dir, name)); err != nil {
+			return fmt.Errorf("removing %s: %w", name, err)
+		}
+		delete(m.Checksums, name)
+	}
+	m.Tabs = tabs
+	c.writeMetadata(ctx, dir, *m)
+	slog.Info("saved sheet tabs", slog.String("dir", dir), slog.Int("tabs", len(tabs)))
+	return nil
+}
+
+// tabFileName names a worksheet's CSV after its title, adding its gid when
+// the title has no usable characters or another tab already took the name
+func tabFileName(title string, sheetID int64, taken map[string]bool) string {
+	s := strings.ToLower(title)
+	s = nonAlphaNum.ReplaceAllString(s, "-")
+	s = multiHyphen.ReplaceAllString(s, "-")
+	s = strings.Trim(s, "-")
+	if len(s) > 60 {
+		s = s[:60]
+	}
+	name := "tab-" + s + ".csv"
+	if s == "" || taken[name] {
+		name = fmt.Sprintf("tab-%s-%d.csv", s, sheetID)
+		if s == "" {
+			name = fmt.Sprintf("tab-%d.csv", sheetID)
+		}
+	}
+	taken[name] = true
+	return name
+}
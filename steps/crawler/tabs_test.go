@@ -0,0 +1,80 @@
+package crawler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// tabExports answers the exports of one spreadsheet by worksheet gid; any
+// other request gets an empty page
+type tabExports map[string]string
+
+func (e tabExports) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := "<html></html>"
+	if gid := req.URL.Query().Get("gid"); gid != "" {
+		body = e[gid]
+	} else if req.URL.Query().Get("format") == "csv" {
+		body = e["0"]
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     http.StatusText(http.StatusOK),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestCrawlSheetTabs(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"sheets":[
+			{"properties":{"sheetId":0,"title":"Budget 2024"}},
+			{"properties":{"sheetId":7,"title":"Notes"}},
+			{"properties":{"sheetId":9,"title":"notes!"}}]}`))
+	}))
+	defer api.Close()
+	svc, err := sheets.NewService(context.Background(), option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	c := crawler.NewCrawler(1, time.Second, "https://docs.google.com/spreadsheets/d/sheet/edit", out, nil, svc,
+		crawler.WithHTTPTransport(tabExports{"0": "a,b\n1,2\n", "7": "note\nhi\n", "9": "x\n"}),
+		crawler.WithSheetTabs())
+	require.NoError(t, c.Run(context.Background()))
+
+	dirs, err := filepath.Glob(filepath.Join(out, "*", "metadata.json"))
+	require.NoError(t, err)
+	require.Len(t, dirs, 1)
+	data, err := os.ReadFile(dirs[0])
+	require.NoError(t, err)
+	var m types.Metadata
+	require.NoError(t, json.Unmarshal(data, &m))
+
+	assert.Equal(t, []types.Tab{
+		{Title: "Budget 2024", SheetID: 0, File: "tab-budget-2024.csv"},
+		{Title: "Notes", SheetID: 7, File: "tab-notes.csv"},
+		{Title: "notes!", SheetID: 9, File: "tab-notes-9.csv"},
+	}, m.Tabs)
+	for _, tab := range m.Tabs {
+		assert.Contains(t, m.Checksums, tab.File)
+	}
+	notes, err := os.ReadFile(filepath.Join(filepath.Dir(dirs[0]), "tab-notes.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "note\nhi\n", string(notes))
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/langdetect"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"golang.org/x/net/html"
+)
+
+// wordsPerPage is the usual estimate for a single-spaced page of prose
+const wordsPerPage = 500
+
+// describeContent fills in the metadata derived from a document's text:
+// its language and size
+func describeContent(m *types.Metadata, content []byte) {
+	text := extractText(content, m)
+
+	m.Language = langdetect.Detect(text)
+	m.Words = len(strings.Fields(text))
+	m.Characters = 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			m.Characters++
+		}
+	}
+
+	m.Pages = 0
+	if m.Type == "doc" {
+		m.Pages = (m.Words + wordsPerPage - 1) / wordsPerPage
+	}
+}
+
+// extractText returns the readable text of an exported document: the body
+// text of a doc's HTML, or the cells of a sheet's CSV
+func extractText(content []byte, m *types.Metadata) string {
+	if m.Type != "doc" {
+		r := csv.NewReader(bytes.NewReader(content))
+		r.FieldsPerRecord = -1
+		if m.CSVDelimiter != "" {
+			r.Comma, _ = utf8.DecodeRuneInString(m.CSVDelimiter)
+		}
+		records, err := r.ReadAll()
+		if err != nil {
+			return string(content)
+		}
+		var sb strings.Builder
+		for _, record := range records {
+			for _, cell := range record {
+				sb.WriteString(cell)
+				sb.WriteByte(' ')
+			}
+		}
+		return sb.String()
+	}
+
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	var dfs func(*html.Node)
+	dfs = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "style" || n.Data == "script" || n.Data == "head") {
+			return
+		}
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			dfs(child)
+		}
+	}
+
+	dfs(root)
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// titleLookupWorkers bounds the concurrent Drive calls of one title batch
+const titleLookupWorkers = 8
+
+// prefetchTitles resolves the titles of every linked document not looked up
+// yet with concurrent Drive calls, so processing the links later doesn't
+// fetch a preview page per sheet. Documents Drive can't see are remembered
+// as unknown and fall back to the preview page.
+func (c *Crawler) prefetchTitles(ctx context.Context, links []types.Links) {
+	if c.driveSvc == nil {
+		return
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, l := range links {
+		canonical, _ := c.CanonicalizeURL(l.Link)
+		if canonical == "" {
+			continue
+		}
+		id := extractID(canonical)
+		if _, known := c.titles[id]; known || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	resolved := make([]string, len(ids))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(titleLookupWorkers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				resolved[i] = c.driveTitle(ctx, ids[i])
+			}
+		}()
+	}
+	for i := range ids {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	found := 0
+	for i, id := range ids {
+		c.titles[id] = resolved[i]
+		if resolved[i] != "" {
+			found++
+		}
+	}
+	slog.Debug("resolved linked titles", slog.Int("ids", len(ids)), slog.Int("found", found))
+}
+
+// lookupTitle returns a document's Drive title, from the batch cache when
+// it was prefetched. Empty means Drive doesn't know it.
+func (c *Crawler) lookupTitle(ctx context.Context, id string) string {
+	if c.driveSvc == nil {
+		return ""
+	}
+	if title, ok := c.titles[id]; ok {
+		return title
+	}
+	title := c.driveTitle(ctx, id)
+	c.titles[id] = title
+	return title
+}
+
+// driveTitle asks Drive for one document's name
+func (c *Crawler) driveTitle(ctx context.Context, id string) string {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return ""
+	}
+	f, err := c.driveSvc.Files.Get(id).
+		Fields("name").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		slog.Debug("title lookup failed", slog.String("id", id), slog.Any("error", err))
+		return ""
+	}
+	return f.Name
+}
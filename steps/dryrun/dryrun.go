@@ -0,0 +1,138 @@
+// Package dryrun collects what a pipeline run with -dry-run would have done
+// to Drive, so its scope and cost can be checked before anything is written.
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"google.golang.org/api/docs/v1"
+)
+
+// File is the report written at the output root
+const File = "dry_run.json"
+
+// placeholderPrefix marks the IDs handed out for files that were not created
+const placeholderPrefix = "dry-run-"
+
+// Fetch is a document the crawler exported
+type Fetch struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	Dir   string `json:"dir"`
+}
+
+// Folder is a Drive folder the uploader would create
+type Folder struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// Upload is a Drive file the uploader would create
+type Upload struct {
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+	MimeType string `json:"mime_type"`
+	SourceID string `json:"source_id"`
+	Parent   string `json:"parent,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	// ID is the placeholder standing in for the file's Drive ID
+	ID string `json:"id"`
+}
+
+// Patch is a batch update the patcher would send
+type Patch struct {
+	Title    string          `json:"title"`
+	DocID    string          `json:"doc_id"`
+	Requests []*docs.Request `json:"requests"`
+}
+
+// Report is shared by the steps of one dry run; each adds what it would do
+type Report struct {
+	mu      sync.Mutex
+	Fetched []Fetch  `json:"fetched"`
+	Folders []Folder `json:"folders,omitempty"`
+	Uploads []Upload `json:"uploads"`
+	Patches []Patch  `json:"patches"`
+	// ids maps canonical keys ("doc:<id>") to their uploads' placeholders
+	ids map[string]string
+}
+
+// New returns an empty report
+func New() *Report {
+	return &Report{
+		Fetched: []Fetch{},
+		Uploads: []Upload{},
+		Patches: []Patch{},
+		ids:     make(map[string]string),
+	}
+}
+
+// Placeholder is the stand-in ID of a file that would be created for id
+func Placeholder(id string) string {
+	return placeholderPrefix + id
+}
+
+// IsPlaceholder reports whether id was handed out instead of creating a file
+func IsPlaceholder(id string) bool {
+	return strings.HasPrefix(id, placeholderPrefix)
+}
+
+// AddFetch records a document the crawler exported
+func (r *Report) AddFetch(f Fetch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Fetched = append(r.Fetched, f)
+}
+
+// AddFolder records a folder the uploader would create and returns its
+// placeholder ID
+func (r *Report) AddFolder(f Folder) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Folders = append(r.Folders, f)
+	return Placeholder("folder-" + f.Name)
+}
+
+// AddUpload records a file the uploader would create for the document key
+// and returns its placeholder ID
+func (r *Report) AddUpload(key string, u Upload) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u.ID = Placeholder(u.SourceID)
+	r.Uploads = append(r.Uploads, u)
+	r.ids[key] = u.ID
+	return u.ID
+}
+
+// AddPatch records a batch update the patcher would send
+func (r *Report) AddPatch(p Patch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Patches = append(r.Patches, p)
+}
+
+// IDMap returns the placeholders of the uploads so far, keyed like id_map.json
+func (r *Report) IDMap() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.ids)
+}
+
+// Write saves the report as it stands to File
+func (r *Report) Write(ctx context.Context, store storage.Storage) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return store.WriteFile(ctx, File, data)
+}
@@ -0,0 +1,349 @@
+package gitmirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/markdown"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// DefaultPath is the directory of the repository documents are mirrored to
+const DefaultPath = "docs"
+
+// Stats summarises the last mirror
+type Stats struct {
+	Documents int `json:"documents"`
+	// Commit is the hash of the run's commit; empty when nothing changed
+	Commit string `json:"commit,omitempty"`
+}
+
+// Mirror commits the crawl, converted to Markdown, to a Git repository so
+// every run's changes show up as one diff
+type Mirror struct {
+	outDir  string
+	repoDir string
+	// path is the directory of the repository the mirror owns; it is
+	// replaced on every run
+	path  string
+	store storage.Storage
+	runID string
+	// remote is pushed to after committing; empty = don't push
+	remote string
+
+	stats Stats
+}
+
+// Option configures optional Mirror behaviour
+type Option func(*Mirror)
+
+// WithStorage reads the crawl output from the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(m *Mirror) {
+		m.store = s
+	}
+}
+
+// WithPath mirrors into the given directory of the repository instead of DefaultPath
+func WithPath(p string) Option {
+	return func(m *Mirror) {
+		m.path = p
+	}
+}
+
+// WithRunID names the run in commit messages
+func WithRunID(id string) Option {
+	return func(m *Mirror) {
+		m.runID = id
+	}
+}
+
+// WithPush pushes each commit to remote
+func WithPush(remote string) Option {
+	return func(m *Mirror) {
+		m.remote = remote
+	}
+}
+
+// NewMirror mirrors the crawl in outDir to the repository at repoDir, which
+// is created if needed
+func NewMirror(outDir, repoDir string, opts ...Option) *Mirror {
+	m := &Mirror{
+		outDir:  outDir,
+		repoDir: repoDir,
+		path:    DefaultPath,
+		store:   storage.NewLocal(outDir),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Name implements the Step interface
+func (m *Mirror) Name() string {
+	return "gitmirror"
+}
+
+// Stats returns the statistics of the last run
+func (m *Mirror) Stats() any {
+	return m.stats
+}
+
+// document is one crawled doc or sheet to mirror
+type document struct {
+	meta    types.Metadata
+	dir     string
+	content []byte
+}
+
+// Run writes every crawled document as Markdown under the mirror's path and
+// commits the result, unless nothing changed since the last run
+func (m *Mirror) Run(ctx context.Context) error {
+	if !filepath.IsLocal(m.path) {
+		return fmt.Errorf("mirror path %q must be relative to the repository", m.path)
+	}
+	if err := m.ensureRepo(ctx); err != nil {
+		return err
+	}
+
+	docs, err := m.collect(ctx)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]string, len(docs))
+	for _, d := range docs {
+		byKey[d.meta.Type+":"+d.meta.ID] = d.dir
+	}
+
+	// the path is rewritten from scratch so deleted documents disappear;
+	// Git only records what actually changed
+	root := filepath.Join(m.repoDir, m.path)
+	if err := os.RemoveAll(root); err != nil {
+		return fmt.Errorf("clearing %s: %w", root, err)
+	}
+	m.stats = Stats{}
+	for _, d := range docs {
+		page, err := render(d, byKey)
+		if err != nil {
+			slog.Warn("skipping document that can't be converted",
+				slog.String("dir", d.dir), slog.Any("error", err))
+			continue
+		}
+		name := filepath.Join(root, filepath.FromSlash(d.dir), "index.md")
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, page, 0o644); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		m.stats.Documents++
+	}
+
+	return m.commit(ctx, docs)
+}
+
+// collect loads the metadata of every saved document, skipping redirects
+func (m *Mirror) collect(ctx context.Context) ([]document, error) {
+	names, err := m.store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing output: %w", err)
+	}
+
+	var docs []document
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+		data, err := m.store.ReadFile(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		var meta types.Metadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			slog.Warn("skipping unreadable metadata", slog.String("path", name), slog.Any("error", err))
+			continue
+		}
+		if meta.IsRedirect {
+			continue
+		}
+		dir := storage.Dir(name)
+		if meta.TextFileName() == "" {
+			slog.Warn("skipping document without a text export", slog.String("dir", dir), slog.String("format", meta.ExportFormat()))
+			continue
+		}
+		content, err := m.store.ReadFile(ctx, path.Join(dir, meta.TextFileName()))
+		if err != nil {
+			slog.Warn("skipping document without content", slog.String("dir", dir), slog.Any("error", err))
+			continue
+		}
+		docs = append(docs, document{meta: meta, dir: dir, content: content})
+	}
+	return docs, nil
+}
+
+// commit records the mirror's path as one commit and pushes it if configured
+func (m *Mirror) commit(ctx context.Context, docs []document) error {
+	if _, err := m.git(ctx, "add", "-A", "--", m.path); err != nil {
+		return err
+	}
+	// diff --quiet exits 1 when something is staged
+	if _, err := m.git(ctx, "diff", "--cached", "--quiet", "--", m.path); err == nil {
+		slog.Info("mirror unchanged, nothing to commit", slog.String("repo", m.repoDir))
+		return nil
+	}
+
+	subject := "Sync " + rootTitle(docs)
+	body := fmt.Sprintf("%d documents", m.stats.Documents)
+	if m.runID != "" {
+		body += ", run " + m.runID
+	}
+	if _, err := m.git(ctx, "commit", "-q", "-m", subject, "-m", body, "--", m.path); err != nil {
+		return err
+	}
+	hash, err := m.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	m.stats.Commit = hash
+
+	if m.remote != "" {
+		if _, err := m.git(ctx, "push", "-q", m.remote, "HEAD"); err != nil {
+			return err
+		}
+	}
+	slog.Info("mirror committed",
+		slog.String("repo", m.repoDir),
+		slog.String("commit", hash),
+		slog.Int("documents", m.stats.Documents))
+	return nil
+}
+
+// ensureRepo initialises repoDir unless it already is a repository
+func (m *Mirror) ensureRepo(ctx context.Context) error {
+	if err := os.MkdirAll(m.repoDir, 0o755); err != nil {
+		return err
+	}
+	if _, err := m.git(ctx, "rev-parse", "--git-dir"); err == nil {
+		return nil
+	}
+	slog.Info("initialising mirror repository", slog.String("repo", m.repoDir))
+	_, err := m.git(ctx, "init", "-q")
+	return err
+}
+
+// git runs a git command in the repository and returns its trimmed output.
+// Commits fall back to a pipeline identity where none is configured.
+func (m *Mirror) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = m.repoDir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+envOr("GIT_AUTHOR_NAME", "gdoc-pipeline"),
+		"GIT_AUTHOR_EMAIL="+envOr("GIT_AUTHOR_EMAIL", "gdoc-pipeline@localhost"),
+		"GIT_COMMITTER_NAME="+envOr("GIT_COMMITTER_NAME", "gdoc-pipeline"),
+		"GIT_COMMITTER_EMAIL="+envOr("GIT_COMMITTER_EMAIL", "gdoc-pipeline@localhost"),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// rootTitle names the run's commit after the start document
+func rootTitle(docs []document) string {
+	for _, d := range docs {
+		if d.meta.Depth == 0 {
+			return d.meta.Title
+		}
+	}
+	return "crawl"
+}
+
+// render converts a document to Markdown with YAML front matter; links to
+// other mirrored documents become relative links to their index.md. The
+// crawl time is left out so unchanged documents produce no diff.
+func render(d document, byKey map[string]string) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(d.meta.Title))
+	fmt.Fprintf(&b, "id: %s\n", strconv.Quote(d.meta.ID))
+	fmt.Fprintf(&b, "type: %s\n", d.meta.Type)
+	fmt.Fprintf(&b, "source_url: %s\n", strconv.Quote(d.meta.SourceURL))
+	b.WriteString("---\n\n")
+
+	content := d.content
+	switch d.meta.Type {
+	case "sheet":
+		r := csv.NewReader(bytes.NewReader(content))
+		if delim := []rune(d.meta.CSVDelimiter); len(delim) == 1 {
+			r.Comma = delim[0]
+		}
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("# " + d.meta.Title + "\n\n")
+		b.WriteString(markdown.Table(rows))
+	default:
+		cleaned, err := htmlclean.Clean(content)
+		if err != nil {
+			return nil, err
+		}
+		md, err := markdown.FromHTML(cleaned, func(href string) string {
+			t, ok := gdocs.ParseTarget(href)
+			if !ok {
+				return href
+			}
+			for _, key := range t.Keys() {
+				if target, ok := byKey[key]; ok {
+					return relativeLink(d.dir, target)
+				}
+			}
+			return href
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(md)
+	}
+	return []byte(b.String()), nil
+}
+
+// relativeLink is the link from the index.md in dir to the one in target
+func relativeLink(dir, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return target + "/index.md"
+	}
+	return filepath.ToSlash(rel) + "/index.md"
+}
@@ -0,0 +1,66 @@
+package gitmirror_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/gitmirror"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	out := t.TempDir()
+	s := storage.NewLocal(out)
+
+	write := func(name string, m types.Metadata, content string) {
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		require.NoError(t, s.WriteFile(ctx, name+"/metadata.json", data))
+		if content != "" {
+			require.NoError(t, s.WriteFile(ctx, name+"/"+m.ContentFileName(), []byte(content)))
+		}
+	}
+	write("handbook-d1", types.Metadata{ID: "d1", Type: "doc", Title: "Handbook"},
+		`<html><body><p>See <a href="https://docs.google.com/spreadsheets/d/s1/edit">the budget</a></p>`+
+			`<p><a href="https://www.google.com/url?q=https://docs.google.com/a/example.com/spreadsheets/d/s1/edit%23gid%3D0&amp;sa=D">wrapped</a> `+
+			`<a href="https://drive.google.com/open?id=s1">open</a> `+
+			`<a href="https://drive.google.com/file/d/s1/view">file</a></p></body></html>`)
+	write("handbook-d1/budget-s1", types.Metadata{ID: "s1", Type: "sheet", Title: "Budget", Depth: 1}, "item,cost\nrent,100\n")
+
+	repo := t.TempDir()
+	m := gitmirror.NewMirror(out, repo, gitmirror.WithRunID("run-1"))
+	require.NoError(t, m.Run(ctx))
+	first := m.Stats().(gitmirror.Stats)
+	assert.Equal(t, 2, first.Documents)
+	require.NotEmpty(t, first.Commit)
+
+	doc, err := os.ReadFile(filepath.Join(repo, "docs/handbook-d1/index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(doc), `title: "Handbook"`)
+	assert.Contains(t, string(doc), "See [the budget](budget-s1/index.md)")
+	assert.Contains(t, string(doc), "[wrapped](budget-s1/index.md) [open](budget-s1/index.md) [file](budget-s1/index.md)")
+
+	sheet, err := os.ReadFile(filepath.Join(repo, "docs/handbook-d1/budget-s1/index.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(sheet), "| rent | 100 |")
+
+	// an unchanged crawl makes no commit
+	require.NoError(t, m.Run(ctx))
+	assert.Empty(t, m.Stats().(gitmirror.Stats).Commit)
+
+	log, err := exec.Command("git", "-C", repo, "log", "--format=%s%n%b").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "Sync Handbook\n2 documents, run run-1", strings.TrimSpace(string(log)))
+}
@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// Stats summarises an import
+type Stats struct {
+	Documents int   `json:"documents"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// Importer stands in for the crawler: it lays out documents described by a
+// manifest the way a crawl would have saved them, so the uploader and
+// patcher can run on files downloaded elsewhere
+type Importer struct {
+	manifestPath string
+	outDir       string
+	store        storage.Storage
+
+	stats Stats
+}
+
+// Option configures optional Importer behaviour
+type Option func(*Importer)
+
+// WithStorage writes the output tree to the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(i *Importer) {
+		i.store = s
+	}
+}
+
+// NewImporter imports the documents of the manifest at manifestPath into outDir
+func NewImporter(manifestPath, outDir string, opts ...Option) *Importer {
+	i := &Importer{
+		manifestPath: manifestPath,
+		outDir:       outDir,
+		store:        storage.NewLocal(outDir),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Name implements the Step interface
+func (i *Importer) Name() string {
+	return "importer"
+}
+
+// Stats returns the statistics of the last run
+func (i *Importer) Stats() any {
+	return i.stats
+}
+
+// Run validates the manifest and writes each document's content and
+// metadata.json under outDir. Nothing is written unless the whole manifest
+// is valid.
+func (i *Importer) Run(ctx context.Context) error {
+	m, err := LoadManifest(i.manifestPath)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]Document, len(m.Documents))
+	for _, d := range m.Documents {
+		byID[d.ID] = d
+	}
+	// dirOf lays documents out like the crawler: each under the one linking to it
+	var dirOf func(d Document) (string, int)
+	dirOf = func(d Document) (string, int) {
+		parentDir, depth := "", 0
+		if d.Parent != "" {
+			parentDir, depth = dirOf(byID[d.Parent])
+			depth++
+		}
+		return path.Join(parentDir, crawler.Slug(title(d), d.ID)), depth
+	}
+
+	i.stats = Stats{}
+	now := time.Now()
+	for _, d := range m.Documents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := m.read(d)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", d.File, err)
+		}
+
+		dir, depth := dirOf(d)
+		filename := "content." + documentTypes[d.Type]
+		meta := types.Metadata{
+			Title:       title(d),
+			ID:          d.ID,
+			SourceURL:   d.SourceURL,
+			Depth:       depth,
+			Type:        d.Type,
+			CrawledAt:   d.DownloadedAt,
+			ContentFile: filename,
+			Checksums:   map[string]string{filename: checksum(content)},
+		}
+		if meta.SourceURL == "" {
+			meta.SourceURL = sourceURL(d)
+		}
+		if meta.CrawledAt.IsZero() {
+			meta.CrawledAt = now
+		}
+		if d.Parent != "" {
+			meta.DiscoveredBy = byID[d.Parent].Type + ":" + d.Parent
+		}
+
+		if err := i.store.WriteFile(ctx, path.Join(dir, filename), content); err != nil {
+			return fmt.Errorf("writing content: %w", err)
+		}
+		data, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := i.store.WriteFile(ctx, path.Join(dir, "metadata.json"), data); err != nil {
+			return fmt.Errorf("writing metadata: %w", err)
+		}
+
+		i.stats.Documents++
+		i.stats.Bytes += int64(len(content))
+		slog.Debug("imported document", slog.String("id", d.ID), slog.String("dir", dir))
+	}
+
+	slog.Info("manifest imported",
+		slog.String("manifest", i.manifestPath),
+		slog.Int("documents", i.stats.Documents),
+		slog.Int64("bytes", i.stats.Bytes))
+	return nil
+}
+
+// title falls back to the crawler's name for untitled documents
+func title(d Document) string {
+	if d.Title != "" {
+		return d.Title
+	}
+	if d.Type == "sheet" {
+		return "Untitled Sheet"
+	}
+	return "Untitled Doc"
+}
+
+// sourceURL is the docs.google.com URL of a document
+func sourceURL(d Document) string {
+	if d.Type == "sheet" {
+		return fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", d.ID)
+	}
+	return fmt.Sprintf("https://docs.google.com/document/d/%s/edit", d.ID)
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+package importer_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/importer"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeManifest saves files and a manifest listing docs in a temp directory
+func writeManifest(t *testing.T, files map[string]string, docs []importer.Document) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	data, err := json.Marshal(importer.Manifest{Version: importer.ManifestVersion, Documents: docs})
+	require.NoError(t, err)
+	name := filepath.Join(dir, "manifest.json")
+	require.NoError(t, os.WriteFile(name, data, 0o644))
+	return name
+}
+
+func TestImporter(t *testing.T) {
+	ctx := context.Background()
+	manifest := writeManifest(t, map[string]string{
+		"exports/handbook.html": "<p>handbook</p>",
+		"exports/budget.csv":    "a,b\n",
+	}, []importer.Document{
+		{ID: "sheet123", Type: "sheet", Title: "Budget", File: "exports/budget.csv", Parent: "doc123"},
+		{ID: "doc123", Type: "doc", Title: "Handbook", File: "exports/handbook.html"},
+	})
+
+	out := t.TempDir()
+	i := importer.NewImporter(manifest, out)
+	require.NoError(t, i.Run(ctx))
+	assert.Equal(t, importer.Stats{Documents: 2, Bytes: 19}, i.Stats())
+
+	s := storage.NewLocal(out)
+	data, err := s.ReadFile(ctx, "handbook-doc123/budget-sheet1/metadata.json")
+	require.NoError(t, err)
+	var m types.Metadata
+	require.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, "sheet123", m.ID)
+	assert.Equal(t, 1, m.Depth)
+	assert.Equal(t, "doc:doc123", m.DiscoveredBy)
+	assert.Equal(t, "https://docs.google.com/spreadsheets/d/sheet123/edit", m.SourceURL)
+	assert.Contains(t, m.Checksums, "content.csv")
+
+	content, err := s.ReadFile(ctx, "handbook-doc123/content.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<p>handbook</p>", string(content))
+}
+
+func TestLoadManifestReportsEveryProblem(t *testing.T) {
+	manifest := writeManifest(t, map[string]string{"a.html": "<p>a</p>"}, []importer.Document{
+		{ID: "a", Type: "doc", File: "a.html", SHA256: "00"},
+		{ID: "a", Type: "slides", File: "../outside.html"},
+		{ID: "b", Type: "doc", File: "missing.html", Parent: "c"},
+		{ID: "c", Type: "doc", File: "a.html", Parent: "b"},
+	})
+
+	_, err := importer.LoadManifest(manifest)
+	require.Error(t, err)
+	for _, want := range []string{
+		"documents[0]: checksum mismatch",
+		"documents[1]: id a already used",
+		"documents[1]: unknown type",
+		"documents[1]: file ../outside.html must be a relative path",
+		"documents[2]: open",
+		"documents[2]: parent chain loops back",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the manifest format this package reads
+const ManifestVersion = 1
+
+// Manifest describes a set of pre-downloaded documents to upload without
+// crawling them
+type Manifest struct {
+	Version   int        `json:"version"`
+	Documents []Document `json:"documents"`
+
+	// dir is where relative file paths are resolved from
+	dir string
+}
+
+// Document is one pre-downloaded doc or sheet
+type Document struct {
+	// ID is the source document's Drive ID; links to it are patched to point
+	// at its copy
+	ID string `json:"id"`
+	// Type is "doc" (an HTML export) or "sheet" (a CSV export)
+	Type  string `json:"type"`
+	Title string `json:"title,omitempty"`
+	// SourceURL defaults to the document's docs.google.com URL
+	SourceURL string `json:"source_url,omitempty"`
+	// File is the export, relative to the manifest
+	File string `json:"file"`
+	// SHA256 is the file's expected hex checksum, checked when set
+	SHA256 string `json:"sha256,omitempty"`
+	// Parent is the ID of the document linking here; the document is nested
+	// under it as the crawler would have. Empty for top-level documents.
+	Parent string `json:"parent,omitempty"`
+	// DownloadedAt is recorded as the crawl time; defaults to the import time
+	DownloadedAt time.Time `json:"downloaded_at,omitzero"`
+}
+
+// documentTypes maps each supported type to its export's extension
+var documentTypes = map[string]string{
+	"doc":   "html",
+	"sheet": "csv",
+}
+
+// LoadManifest reads and validates the manifest at name
+func LoadManifest(name string) (*Manifest, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", name, err)
+	}
+	m.dir = filepath.Dir(name)
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", name, err)
+	}
+	return &m, nil
+}
+
+// Validate checks the manifest describes a tree of readable documents,
+// reporting every problem found rather than just the first
+func (m *Manifest) Validate() error {
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("unsupported version %d, want %d", m.Version, ManifestVersion)
+	}
+	if len(m.Documents) == 0 {
+		return errors.New("no documents")
+	}
+
+	var errs []error
+	fail := func(i int, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("documents[%d]: %s", i, fmt.Sprintf(format, args...)))
+	}
+
+	byID := make(map[string]int, len(m.Documents))
+	for i, d := range m.Documents {
+		switch {
+		case d.ID == "":
+			fail(i, "missing id")
+		case strings.ContainsAny(d.ID, "/\\:"):
+			fail(i, "invalid id %q", d.ID)
+		default:
+			if j, dup := byID[d.ID]; dup {
+				fail(i, "id %s already used by documents[%d]", d.ID, j)
+			} else {
+				byID[d.ID] = i
+			}
+		}
+		if _, ok := documentTypes[d.Type]; !ok {
+			fail(i, "unknown type %q, want doc or sheet", d.Type)
+		}
+		if err := m.checkFile(d); err != nil {
+			fail(i, "%v", err)
+		}
+	}
+
+	for i, d := range m.Documents {
+		if d.Parent == "" {
+			continue
+		}
+		if _, ok := byID[d.Parent]; !ok {
+			fail(i, "parent %s is not in the manifest", d.Parent)
+		}
+	}
+	// parents must lead to a top-level document, or the tree can't be laid out
+	for i, d := range m.Documents {
+		seen := map[string]bool{d.ID: true}
+		for p := d.Parent; p != ""; {
+			if seen[p] {
+				fail(i, "parent chain loops back to %s", p)
+				break
+			}
+			seen[p] = true
+			j, ok := byID[p]
+			if !ok {
+				break
+			}
+			p = m.Documents[j].Parent
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkFile verifies a document's file is inside the manifest's directory,
+// readable and, when given, matches its checksum
+func (m *Manifest) checkFile(d Document) error {
+	if d.File == "" {
+		return errors.New("missing file")
+	}
+	if !filepath.IsLocal(filepath.FromSlash(d.File)) {
+		return fmt.Errorf("file %s must be a relative path inside the manifest's directory", d.File)
+	}
+	data, err := m.read(d)
+	if err != nil {
+		return err
+	}
+	if d.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, d.SHA256) {
+			return fmt.Errorf("checksum mismatch for %s: manifest says %s, found %s", d.File, d.SHA256, got)
+		}
+	}
+	return nil
+}
+
+// read returns a document's pre-downloaded export
+func (m *Manifest) read(d Document) ([]byte, error) {
+	return os.ReadFile(filepath.Join(m.dir, filepath.FromSlash(d.File)))
+}
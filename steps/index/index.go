@@ -0,0 +1,232 @@
+// Package index keeps index.db, a SQLite copy of the output tree: every
+// document's metadata, the ID map, what the patcher changed and what the
+// last run failed on, so questions such as "which docs failed to upload?"
+// are one query instead of a walk over metadata.json files. The JSON files
+// stay what the steps read and write; the index is rebuilt from them.
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/pipeline"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/patcher"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// File is the database written at the output root
+const File = "index.db"
+
+const schema = `
+CREATE TABLE documents (
+	dir           TEXT PRIMARY KEY,
+	key           TEXT NOT NULL,
+	id            TEXT NOT NULL,
+	type          TEXT NOT NULL,
+	title         TEXT NOT NULL,
+	source_url    TEXT NOT NULL,
+	depth         INTEGER NOT NULL,
+	discovered_by TEXT NOT NULL,
+	is_redirect   INTEGER NOT NULL,
+	redirect_key  TEXT NOT NULL,
+	content_file  TEXT NOT NULL,
+	language      TEXT NOT NULL,
+	words         INTEGER NOT NULL,
+	change        TEXT NOT NULL,
+	crawled_at    TEXT NOT NULL,
+	metadata      TEXT NOT NULL
+);
+CREATE INDEX documents_key ON documents(key);
+CREATE TABLE id_map (
+	key    TEXT PRIMARY KEY,
+	new_id TEXT NOT NULL
+);
+CREATE TABLE patches (
+	dir        TEXT PRIMARY KEY,
+	doc_id     TEXT NOT NULL,
+	patched_at TEXT NOT NULL,
+	links      INTEGER NOT NULL
+);
+CREATE TABLE failures (
+	step  TEXT NOT NULL,
+	item  TEXT NOT NULL,
+	error TEXT NOT NULL,
+	time  TEXT NOT NULL
+);`
+
+// Build writes File to store from the output tree it holds. The database is
+// assembled in a temporary file and written in one piece, so readers never
+// see a half-built index.
+func Build(ctx context.Context, store storage.Storage) error {
+	tmp, err := os.MkdirTemp("", "gdoc-index-")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dbPath := filepath.Join(tmp, File)
+	if err := build(ctx, store, dbPath); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		return fmt.Errorf("reading index: %w", err)
+	}
+	return store.WriteFile(ctx, File, data)
+}
+
+// build creates the database at dbPath and fills it in one transaction
+func build(ctx context.Context, store storage.Storage, dbPath string) error {
+	db, err := sql.Open("sqlite3", "file:"+dbPath)
+	if err != nil {
+		return fmt.Errorf("opening index: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("creating index schema: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	names, err := store.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("listing output: %w", err)
+	}
+	for _, name := range names {
+		switch path.Base(name) {
+		case "metadata.json":
+			err = addDocument(ctx, tx, store, name)
+		case patcher.PatchLogFile:
+			err = addPatches(ctx, tx, store, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := addIDMap(ctx, tx, store); err != nil {
+		return err
+	}
+	if err := addFailures(ctx, tx, store); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addDocument indexes the metadata.json called name
+func addDocument(ctx context.Context, tx *sql.Tx, store storage.Storage, name string) error {
+	data, err := store.ReadFile(ctx, name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	var m types.Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		slog.Warn("skipping unreadable metadata", slog.String("file", name), slog.Any("error", err))
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO documents VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		storage.Dir(name), m.Type+":"+m.ID, m.ID, m.Type, m.Title, m.SourceURL, m.Depth, m.DiscoveredBy,
+		m.IsRedirect, m.RedirectKey, m.ContentFileName(), m.Language, m.Words, m.Change,
+		m.CrawledAt.Format(time.RFC3339), string(data))
+	if err != nil {
+		return fmt.Errorf("indexing %s: %w", name, err)
+	}
+	return nil
+}
+
+// addPatches indexes the patch log called name
+func addPatches(ctx context.Context, tx *sql.Tx, store storage.Storage, name string) error {
+	data, err := store.ReadFile(ctx, name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	var log patcher.PatchLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		slog.Warn("skipping unreadable patch log", slog.String("file", name), slog.Any("error", err))
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO patches VALUES (?, ?, ?, ?)`,
+		storage.Dir(name), log.DocID, log.PatchedAt.Format(time.RFC3339), len(log.Changes))
+	if err != nil {
+		return fmt.Errorf("indexing %s: %w", name, err)
+	}
+	return nil
+}
+
+// addIDMap indexes id_map.json, which exists once the uploader has run
+func addIDMap(ctx context.Context, tx *sql.Tx, store storage.Storage) error {
+	data, err := store.ReadFile(ctx, "id_map.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading id_map.json: %w", err)
+	}
+	var idMap map[string]string
+	if err := json.Unmarshal(data, &idMap); err != nil {
+		return fmt.Errorf("parsing id_map.json: %w", err)
+	}
+	for key, newID := range idMap {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO id_map VALUES (?, ?)`, key, newID); err != nil {
+			return fmt.Errorf("indexing id_map.json: %w", err)
+		}
+	}
+	return nil
+}
+
+// addFailures indexes the failures of the last run
+func addFailures(ctx context.Context, tx *sql.Tx, store storage.Storage) error {
+	m, err := failures.Load(ctx, store)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Failures {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO failures VALUES (?, ?, ?, ?)`,
+			f.Step, f.Item, f.Error, f.Time.Format(time.RFC3339)); err != nil {
+			return fmt.Errorf("indexing %s: %w", failures.File, err)
+		}
+	}
+	return nil
+}
+
+// Notifier rebuilds the index when a run ends. It implements
+// pipeline.Notifier and must be added after the notifiers writing files it
+// indexes, such as the failures log.
+type Notifier struct {
+	store storage.Storage
+}
+
+// NewNotifier returns a notifier indexing the output in store
+func NewNotifier(store storage.Storage) *Notifier {
+	return &Notifier{store: store}
+}
+
+// Notify implements pipeline.Notifier
+func (n *Notifier) Notify(ctx context.Context, ev pipeline.Event) {
+	if ev.Type != pipeline.EventRunCompleted && ev.Type != pipeline.EventRunFailed {
+		return
+	}
+	if err := Build(ctx, n.store); err != nil {
+		slog.Warn("failed to build index", slog.Any("error", err))
+		return
+	}
+	slog.Info("indexed output", slog.String("file", File))
+}
@@ -0,0 +1,74 @@
+package index_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/index"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/patcher"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeJSON(t *testing.T, store storage.Storage, name string, v any) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(context.Background(), name, data))
+}
+
+func TestBuildIndexesOutput(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	writeJSON(t, store, "handbook-1/metadata.json", types.Metadata{ID: "a", Type: "doc", Title: "Handbook", Words: 120})
+	writeJSON(t, store, "handbook-1/budget-2/metadata.json", types.Metadata{ID: "b", Type: "sheet", Title: "Budget", Depth: 1})
+	writeJSON(t, store, "id_map.json", map[string]string{"doc:a": "new-a"})
+	writeJSON(t, store, "handbook-1/"+patcher.PatchLogFile, patcher.PatchLog{
+		DocID: "new-a", PatchedAt: time.Now(), Changes: []patcher.PatchChange{{OldURL: "x"}, {OldURL: "y"}},
+	})
+	writeJSON(t, store, failures.File, failures.Manifest{RunID: "r1", Failures: []failures.Failure{
+		{Step: "uploader", Item: "handbook-1/budget-2", Error: "quota exceeded"},
+	}})
+
+	require.NoError(t, index.Build(ctx, store))
+
+	db, err := sql.Open("sqlite3", filepath.Join(out, index.File))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// documents without a copy, and why
+	rows, err := db.Query(`SELECT d.title, f.error FROM documents d
+		LEFT JOIN id_map m ON m.key = d.key
+		LEFT JOIN failures f ON f.item = d.dir AND f.step = 'uploader'
+		WHERE m.new_id IS NULL`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var missing [][2]string
+	for rows.Next() {
+		var title, reason string
+		require.NoError(t, rows.Scan(&title, &reason))
+		missing = append(missing, [2]string{title, reason})
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, [][2]string{{"Budget", "quota exceeded"}}, missing)
+
+	var links int
+	require.NoError(t, db.QueryRow(`SELECT links FROM patches WHERE dir = 'handbook-1'`).Scan(&links))
+	assert.Equal(t, 2, links)
+
+	var words int
+	require.NoError(t, db.QueryRow(`SELECT json_extract(metadata, '$.words') FROM documents WHERE key = 'doc:a'`).Scan(&words))
+	assert.Equal(t, 120, words)
+
+	// rebuilding replaces the previous index
+	require.NoError(t, index.Build(ctx, store))
+}
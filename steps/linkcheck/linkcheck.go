@@ -0,0 +1,323 @@
+package linkcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// ReportFile is the consolidated link report written to the output root
+const ReportFile = "link_report.json"
+
+// Link statuses
+const (
+	StatusOK         = "ok"
+	StatusRedirected = "redirected"
+	StatusForbidden  = "forbidden"
+	StatusDead       = "dead"
+)
+
+// LinkResult is the outcome of checking one hyperlink
+type LinkResult struct {
+	URL    string `json:"url"`
+	Text   string `json:"text,omitempty"`
+	Status string `json:"status"`
+	// Code is the HTTP status, or 0 when the link was checked through Drive
+	Code     int    `json:"code,omitempty"`
+	Location string `json:"location,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DocReport lists the checked links of one uploaded document
+type DocReport struct {
+	Title string       `json:"title"`
+	DocID string       `json:"doc_id"`
+	Links []LinkResult `json:"links"`
+}
+
+// CheckStats counts link outcomes across all documents
+type CheckStats struct {
+	Docs       int `json:"docs"`
+	OK         int `json:"ok"`
+	Redirected int `json:"redirected"`
+	Forbidden  int `json:"forbidden"`
+	Dead       int `json:"dead"`
+	Failures   int `json:"failures"`
+}
+
+// Checker follows every hyperlink of the uploaded documents and reports
+// which ones still work
+type Checker struct {
+	docsService  *docs.Service
+	driveService *drive.Service
+	client       *http.Client
+
+	// Where id_map.json is read from and the report written to
+	store storage.Storage
+
+	// Shared budget every Google API call draws from
+	limiter ratelimit.Limiter
+
+	// Results by URL, so a link shared by many docs is checked once
+	seen map[string]LinkResult
+
+	// Statistics of the last run
+	stats CheckStats
+}
+
+// Option configures optional Checker behaviour
+type Option func(*Checker)
+
+// WithLimiter makes the checker draw every Google API call from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(c *Checker) {
+		c.limiter = l
+	}
+}
+
+// WithHTTPTransport sends the checker's web requests through rt
+func WithHTTPTransport(rt http.RoundTripper) Option {
+	return func(c *Checker) {
+		c.client.Transport = rt
+	}
+}
+
+// WithStorage reads id_map.json from and writes the report to the given
+// store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(c *Checker) {
+		c.store = s
+	}
+}
+
+// NewChecker creates a link checker over the output in outDir
+func NewChecker(docsSvc *docs.Service, driveSvc *drive.Service, outDir string, opts ...Option) *Checker {
+	c := &Checker{
+		docsService:  docsSvc,
+		driveService: driveSvc,
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+			// report redirects instead of following them
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		store:   storage.NewLocal(outDir),
+		limiter: ratelimit.Unlimited(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Name implements the Step interface
+func (c *Checker) Name() string {
+	return "linkcheck"
+}
+
+// Stats returns the statistics of the last run
+func (c *Checker) Stats() any {
+	return c.stats
+}
+
+// Run implements the Step interface and checks the links of every uploaded doc
+func (c *Checker) Run(ctx context.Context) error {
+	data, err := c.store.ReadFile(ctx, "id_map.json")
+	if err != nil {
+		slog.Info("no id_map.json found, skipping link check", slog.Any("error", err))
+		return nil
+	}
+
+	var idMap map[string]string
+	if err := json.Unmarshal(data, &idMap); err != nil {
+		return fmt.Errorf("decoding id_map.json: %w", err)
+	}
+
+	// check docs in a stable order so reports diff cleanly between runs
+	var docIDs []string
+	for key, id := range idMap {
+		if strings.HasPrefix(key, "doc:") {
+			docIDs = append(docIDs, id)
+		}
+	}
+	sort.Strings(docIDs)
+
+	stats := &CheckStats{}
+	c.seen = make(map[string]LinkResult)
+	var reports []DocReport
+
+	for _, id := range docIDs {
+		report, err := c.checkDoc(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("checking document failed",
+				slog.String("doc_id", id),
+				slog.Any("error", err))
+			stats.Failures++
+			continue
+		}
+
+		stats.Docs++
+		for _, l := range report.Links {
+			switch l.Status {
+			case StatusOK:
+				stats.OK++
+			case StatusRedirected:
+				stats.Redirected++
+			case StatusForbidden:
+				stats.Forbidden++
+			case StatusDead:
+				stats.Dead++
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	out, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling link report: %w", err)
+	}
+	if err := c.store.WriteFile(ctx, ReportFile, out); err != nil {
+		return fmt.Errorf("writing %s: %w", ReportFile, err)
+	}
+
+	c.stats = *stats
+	slog.Info("link check completed",
+		slog.Int("docs", stats.Docs),
+		slog.Int("ok", stats.OK),
+		slog.Int("redirected", stats.Redirected),
+		slog.Int("forbidden", stats.Forbidden),
+		slog.Int("dead", stats.Dead),
+		slog.Int("failures", stats.Failures))
+	return nil
+}
+
+// checkDoc fetches an uploaded doc and checks each of its hyperlinks
+func (c *Checker) checkDoc(ctx context.Context, docID string) (DocReport, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return DocReport{}, err
+	}
+	doc, err := c.docsService.Documents.Get(docID).Context(ctx).Do()
+	if err != nil {
+		return DocReport{}, fmt.Errorf("fetching document: %w", err)
+	}
+
+	report := DocReport{Title: doc.Title, DocID: docID, Links: []LinkResult{}}
+	for _, l := range gdocs.Links(doc) {
+		res, ok := c.seen[l.URL]
+		if !ok {
+			res = c.checkLink(ctx, l.URL)
+			c.seen[l.URL] = res
+		}
+		res.Text = l.Text
+		report.Links = append(report.Links, res)
+	}
+	return report, nil
+}
+
+// driveIDRe extracts the file ID of Docs, Sheets, Slides, Forms and Drive links
+var driveIDRe = regexp.MustCompile(`^https://(?:docs|drive)\.google\.com/(?:document|spreadsheets|presentation|forms|file)/d/([^/?#]+)`)
+
+// checkLink classifies one URL, through Drive for Google files and over HTTP
+// otherwise. Google files answer anonymous requests with a sign-in redirect,
+// so only Drive can tell whether they still exist.
+func (c *Checker) checkLink(ctx context.Context, url string) LinkResult {
+	if m := driveIDRe.FindStringSubmatch(url); m != nil && c.driveService != nil {
+		return c.checkDriveFile(ctx, url, m[1])
+	}
+	return c.checkHTTP(ctx, url)
+}
+
+// checkDriveFile classifies a link to a Drive file by looking the file up
+func (c *Checker) checkDriveFile(ctx context.Context, url, id string) LinkResult {
+	res := LinkResult{URL: url}
+	if err := c.limiter.Wait(ctx); err != nil {
+		res.Status = StatusDead
+		res.Error = err.Error()
+		return res
+	}
+
+	f, err := c.driveService.Files.Get(id).
+		Fields("id, trashed").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil && f.Trashed:
+		res.Status = StatusDead
+		res.Error = "file is in the trash"
+	case err == nil:
+		res.Status = StatusOK
+	case errors.As(err, &apiErr) && (apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusUnauthorized):
+		res.Status = StatusForbidden
+		res.Error = err.Error()
+	default:
+		// Drive answers 404 for files that are gone and for files shared
+		// with nobody the credentials represent alike
+		res.Status = StatusDead
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// checkHTTP classifies a web link with a HEAD request, falling back to GET
+// for servers that don't support HEAD
+func (c *Checker) checkHTTP(ctx context.Context, url string) LinkResult {
+	res := LinkResult{URL: url}
+
+	resp, err := c.request(ctx, http.MethodHead, url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.request(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		res.Status = StatusDead
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Code = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		res.Status = StatusRedirected
+		res.Location = resp.Header.Get("Location")
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		res.Status = StatusForbidden
+	case resp.StatusCode >= 400:
+		res.Status = StatusDead
+	default:
+		res.Status = StatusOK
+	}
+	return res
+}
+
+// request sends a request and discards the body
+func (c *Checker) request(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package linkcheck_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/linkcheck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/option"
+)
+
+func TestCheckerClassifiesLinks(t *testing.T) {
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/private":
+			w.WriteHeader(http.StatusForbidden)
+		case "/nohead":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer web.Close()
+
+	link := func(path string) map[string]any {
+		return map[string]any{"textRun": map[string]any{
+			"content":   path,
+			"textStyle": map[string]any{"link": map[string]any{"url": web.URL + path}},
+		}}
+	}
+	doc := map[string]any{
+		"documentId": "new1",
+		"title":      "Handbook",
+		"body": map[string]any{"content": []any{
+			map[string]any{"paragraph": map[string]any{"elements": []any{link("/ok"), link("/moved")}}},
+			map[string]any{"table": map[string]any{"tableRows": []any{
+				map[string]any{"tableCells": []any{
+					map[string]any{"content": []any{
+						map[string]any{"paragraph": map[string]any{"elements": []any{link("/private"), link("/gone"), link("/nohead")}}},
+					}},
+				}},
+			}}},
+		}},
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/documents/new1" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer api.Close()
+
+	ctx := context.Background()
+	docsSvc, err := docs.NewService(ctx, option.WithEndpoint(api.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(out, "id_map.json"), []byte(`{"doc:old1": "new1", "sheet:old2": "new2"}`), 0o644))
+
+	c := linkcheck.NewChecker(docsSvc, nil, out)
+	require.NoError(t, c.Run(ctx))
+
+	data, err := os.ReadFile(filepath.Join(out, linkcheck.ReportFile))
+	require.NoError(t, err)
+	var reports []linkcheck.DocReport
+	require.NoError(t, json.Unmarshal(data, &reports))
+	require.Len(t, reports, 1)
+	assert.Equal(t, "Handbook", reports[0].Title)
+
+	statuses := map[string]string{}
+	for _, l := range reports[0].Links {
+		statuses[l.Text] = l.Status
+	}
+	assert.Equal(t, map[string]string{
+		"/ok":      linkcheck.StatusOK,
+		"/moved":   linkcheck.StatusRedirected,
+		"/private": linkcheck.StatusForbidden,
+		"/gone":    linkcheck.StatusDead,
+		"/nohead":  linkcheck.StatusOK,
+	}, statuses)
+
+	stats := c.Stats().(linkcheck.CheckStats)
+	assert.Equal(t, linkcheck.CheckStats{Docs: 1, OK: 2, Redirected: 1, Forbidden: 1, Dead: 1}, stats)
+}
@@ -0,0 +1,45 @@
+package patcher
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// benchDocument builds a document with n paragraphs, every other one linking
+// to a source doc that has an uploaded copy
+func benchDocument(n int) (*docs.Document, map[string]string) {
+	doc := &docs.Document{Body: &docs.Body{}}
+	urlMap := make(map[string]string)
+	var index int64 = 1
+	for i := range n {
+		text := fmt.Sprintf("paragraph %d ", i)
+		run := &docs.TextRun{Content: text, TextStyle: &docs.TextStyle{}}
+		if i%2 == 0 {
+			source := fmt.Sprintf("https://docs.google.com/document/d/doc%06d", i)
+			run.TextStyle.Link = &docs.Link{Url: source + "/edit?usp=sharing"}
+			urlMap[source] = fmt.Sprintf("https://docs.google.com/document/d/new%06d/edit", i)
+		}
+		end := index + int64(len(text))
+		doc.Body.Content = append(doc.Body.Content, &docs.StructuralElement{
+			Paragraph: &docs.Paragraph{Elements: []*docs.ParagraphElement{
+				{StartIndex: index, EndIndex: end, TextRun: run},
+			}},
+		})
+		index = end
+	}
+	return doc, urlMap
+}
+
+func BenchmarkBuildPatchRequests(b *testing.B) {
+	p := &Patcher{}
+	doc, urlMap := benchDocument(2000)
+	b.ResetTimer()
+	for range b.N {
+		requests, _ := p.buildPatchRequests(doc, urlMap)
+		if len(requests) != 1000 {
+			b.Fatalf("got %d requests, want 1000", len(requests))
+		}
+	}
+}
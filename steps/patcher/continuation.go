@@ -0,0 +1,129 @@
+package patcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"time"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// ProgressFile records, in a document's output directory, how far the
+// patcher got through an oversized doc; it is removed once the doc is done
+const ProgressFile = "patch_progress.json"
+
+// patchProgress is the content of ProgressFile
+type patchProgress struct {
+	DocID     string        `json:"doc_id"`
+	Rounds    int           `json:"rounds"`
+	Remaining int           `json:"remaining"`
+	Changes   []PatchChange `json:"changes"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// patchInRounds patches an oversized doc one chunk at a time. After every
+// chunk it saves its progress and re-fetches the doc, so the next chunk is
+// computed from what the doc now contains rather than from ranges that may
+// have gone stale; an interrupted run resumes where the last one stopped.
+func (p *Patcher) patchInRounds(ctx context.Context, dir, docID string, doc *docs.Document, urlMap map[string]string) ([]PatchChange, error) {
+	progress, err := p.loadProgress(ctx, dir, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		requests, changes := p.buildPatchRequests(doc, urlMap)
+		if len(requests) == 0 {
+			break
+		}
+		if progress.Rounds > 0 && len(requests) >= progress.Remaining {
+			return progress.Changes, fmt.Errorf("no progress after round %d: %d links still pending", progress.Rounds, len(requests))
+		}
+
+		n := min(chunkSize, len(requests))
+		err := p.retryPolicy.Do(ctx, "docs batch update", func() error {
+			if err := p.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			_, err := p.docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{
+				Requests: requests[:n],
+			}).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return progress.Changes, fmt.Errorf("executing batch update: %w", err)
+		}
+
+		progress.Rounds++
+		progress.Remaining = len(requests) - n
+		progress.Changes = append(progress.Changes, changes[:n]...)
+		if err := p.saveProgress(ctx, dir, progress); err != nil {
+			return progress.Changes, err
+		}
+		slog.Info("patched chunk of oversized document",
+			slog.String("doc_id", docID),
+			slog.Int("round", progress.Rounds),
+			slog.Int("remaining", progress.Remaining))
+
+		if progress.Remaining == 0 {
+			break
+		}
+
+		if err := p.limiter.Wait(ctx); err != nil {
+			return progress.Changes, err
+		}
+		doc, err = p.docsService.Documents.Get(docID).Context(ctx).Do()
+		if err != nil {
+			return progress.Changes, fmt.Errorf("re-fetching document: %w", err)
+		}
+	}
+
+	if err := p.store.RemoveAll(ctx, path.Join(dir, ProgressFile)); err != nil {
+		return progress.Changes, fmt.Errorf("removing %s: %w", ProgressFile, err)
+	}
+	return progress.Changes, nil
+}
+
+// loadProgress returns the saved progress on docID, or a fresh record when
+// there is none (or it belongs to an earlier copy of the doc)
+func (p *Patcher) loadProgress(ctx context.Context, dir, docID string) (*patchProgress, error) {
+	fresh := &patchProgress{DocID: docID}
+
+	data, err := p.store.ReadFile(ctx, path.Join(dir, ProgressFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ProgressFile, err)
+	}
+
+	var progress patchProgress
+	if err := json.Unmarshal(data, &progress); err != nil || progress.DocID != docID {
+		return fresh, nil
+	}
+
+	slog.Info("resuming oversized document",
+		slog.String("doc_id", docID),
+		slog.Int("rounds_done", progress.Rounds))
+	// remaining is re-counted from the doc itself
+	progress.Rounds = 0
+	return &progress, nil
+}
+
+// saveProgress persists the progress on a doc
+func (p *Patcher) saveProgress(ctx context.Context, dir string, progress *patchProgress) error {
+	progress.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := p.store.WriteFile(ctx, path.Join(dir, ProgressFile), data); err != nil {
+		return fmt.Errorf("writing %s: %w", ProgressFile, err)
+	}
+	return nil
+}
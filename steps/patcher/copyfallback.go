@@ -0,0 +1,71 @@
+package patcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// WithCopyOnDenied makes the patcher copy docs it isn't allowed to edit
+// (owned elsewhere, read-only) and patch the copy instead, pointing id_map at
+// it, rather than counting a failure
+func WithCopyOnDenied(drv *drive.Service) Option {
+	return func(p *Patcher) {
+		p.driveService = drv
+	}
+}
+
+// Reuploader uploads a crawled document again and returns the new file's ID.
+// The patcher calls it from one worker at a time.
+type Reuploader interface {
+	Reupload(ctx context.Context, dir string) (string, error)
+}
+
+// WithReuploader makes the patcher re-upload docs whose uploaded copy was
+// deleted between upload and patch, instead of counting a failure
+func WithReuploader(r Reuploader) Option {
+	return func(p *Patcher) {
+		p.reuploader = r
+	}
+}
+
+// isPermissionDenied reports whether a Docs or Drive call was refused for
+// lack of edit rights
+func isPermissionDenied(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+// isNotFound reports whether a call failed because the file is gone
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// copyForPatching copies a doc the patcher can't edit and returns the copy's
+// ID. The copy lands in the original's folder, which is the destination
+// folder the uploader put it in.
+func (p *Patcher) copyForPatching(ctx context.Context, docID, title string) (string, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	copied, err := p.driveService.Files.Copy(docID, &drive.File{Name: title}).
+		Fields("id").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("copying document: %w", err)
+	}
+
+	slog.Info("copied read-only document for patching",
+		slog.String("title", title),
+		slog.String("original_id", docID),
+		slog.String("copy_id", copied.Id))
+	return copied.Id, nil
+}
@@ -0,0 +1,53 @@
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// WithDryRun lists the batch updates the patcher would send in r instead of
+// sending them. When the uploader ran dry too, its placeholder IDs replace
+// id_map.json and the links are planned against the source documents.
+func WithDryRun(r *dryrun.Report) Option {
+	return func(p *Patcher) {
+		p.dryRun = r
+	}
+}
+
+// planPatch records the batch update that would patch the links of the
+// uploaded copy docID
+func (p *Patcher) planPatch(ctx context.Context, metadata *types.Metadata, docID string, urlMap map[string]string, stats *PatchStats) error {
+	readID := docID
+	if dryrun.IsPlaceholder(docID) {
+		// the copy would start out as the source's content
+		readID = metadata.ID
+	}
+	if err := p.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	doc, err := p.docsService.Documents.Get(readID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("fetching document: %w", err)
+	}
+
+	requests, changes := p.buildPatchRequests(doc, urlMap)
+	stats.DocsProcessed++
+	if len(requests) == 0 {
+		return nil
+	}
+	stats.LinksPatched += len(changes)
+
+	p.dryRun.AddPatch(dryrun.Patch{Title: metadata.Title, DocID: docID, Requests: requests})
+	for _, c := range changes {
+		slog.Info("dry run: would update link",
+			slog.String("title", metadata.Title),
+			slog.String("text", c.Text),
+			slog.String("old_url", c.OldURL),
+			slog.String("new_url", c.NewURL))
+	}
+	return nil
+}
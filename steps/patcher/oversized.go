@@ -0,0 +1,73 @@
+package patcher
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// OversizedFile lists the docs left unpatched for manual handling
+const OversizedFile = "oversized_docs.json"
+
+// Oversized handling modes for docs above the element limit
+const (
+	// OversizedChunk patches the doc in several smaller BatchUpdate calls
+	OversizedChunk = "chunk"
+	// OversizedFlag leaves the doc alone and lists it in oversized_docs.json
+	OversizedFlag = "flag"
+)
+
+// chunkSize is the number of link updates sent per BatchUpdate for oversized docs
+const chunkSize = 50
+
+// OversizedDoc is a doc skipped because of its size
+type OversizedDoc struct {
+	Title        string `json:"title"`
+	Dir          string `json:"dir"`
+	DocID        string `json:"doc_id"`
+	Elements     int    `json:"elements"`
+	PendingLinks int    `json:"pending_links"`
+}
+
+// countElements counts the structural and paragraph elements of a doc,
+// descending into tables, as a measure of how heavy it is to edit
+func countElements(doc *docs.Document) int {
+	var count func([]*docs.StructuralElement) int
+	count = func(content []*docs.StructuralElement) int {
+		n := 0
+		for _, el := range content {
+			n++
+			if el.Paragraph != nil {
+				n += len(el.Paragraph.Elements)
+			}
+			if el.Table != nil {
+				for _, row := range el.Table.TableRows {
+					for _, cell := range row.TableCells {
+						n += count(cell.Content)
+					}
+				}
+			}
+		}
+		return n
+	}
+
+	if doc.Body == nil {
+		return 0
+	}
+	return count(doc.Body.Content)
+}
+
+// writeOversized records the flagged docs of this run, or removes a stale
+// list when there are none
+func (p *Patcher) writeOversized(ctx context.Context) error {
+	if len(p.oversized) == 0 {
+		return p.store.RemoveAll(ctx, OversizedFile)
+	}
+
+	data, err := json.MarshalIndent(p.oversized, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.store.WriteFile(ctx, OversizedFile, data)
+}
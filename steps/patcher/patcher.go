@@ -3,63 +3,202 @@ package patcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math"
-	"math/rand"
-	"net/url"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
+	"path"
+	"sync"
 	"time"
 
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gapi"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/retry"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/repair"
 	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
 	"google.golang.org/api/docs/v1"
-	"google.golang.org/api/googleapi"
+	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 )
 
 // Patcher handles patching hyperlinks in uploaded Google Docs
 type Patcher struct {
-	docsService      *docs.Service
-	rateLimitDelay   time.Duration
-	maxRetryAttempts int
+	docsService *docs.Service
+	// Options the Docs client is created with
+	clientOpts     []option.ClientOption
+	rateLimitDelay time.Duration
+	// How batch updates that fail transiently are retried
+	retryPolicy retry.Policy
 
 	// Step configuration
 	outDir string
+	// Where the crawl output is read from; a local outDir unless configured
+	store storage.Storage
+
+	// Shared budget every Docs API call draws from
+	limiter ratelimit.Limiter
+	// Number of docs patched concurrently
+	workers int
+	// Guards the ID map, oversized and idMapChanged while workers patch
+	mu sync.Mutex
+	// Counts the docs found and patched; nil counts nothing
+	progress *progress.Counter
+	// Records the docs that couldn't be patched; nil records nothing
+	failures *failures.Recorder
+	// Directories to patch instead of every saved one; see WithOnly
+	only []string
+
+	// Docs above maxElements are chunked or flagged (0 = no limit)
+	maxElements   int
+	oversizedMode string
+	oversized     []OversizedDoc
+
+	// Copies docs it can't edit when set; see WithCopyOnDenied
+	driveService *drive.Service
+	// Re-uploads docs whose uploaded copy was deleted; see WithReuploader
+	reuploader Reuploader
+	// Serializes re-uploads: the Reuploader isn't safe for concurrent use
+	reuploadMu sync.Mutex
+	// Set when a copy replaced an id_map entry during the run
+	idMapChanged bool
+
+	// Collects the batch updates of a dry run; nil patches for real
+	dryRun *dryrun.Report
+	// Keys ("doc:<id>") of documents an incremental crawl found new this run
+	fresh map[string]bool
+
+	// Statistics of the last run
+	stats PatchStats
+}
+
+// Option configures optional Patcher behaviour
+type Option func(*Patcher)
+
+// WithClientOptions adds options to the Docs client the patcher creates,
+// such as the shared HTTP client
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(p *Patcher) {
+		p.clientOpts = append(p.clientOpts, opts...)
+	}
+}
+
+// WithClients makes the patcher use the Docs service of a shared client set
+// rather than creating its own
+func WithClients(cl *gapi.Clients) Option {
+	return func(p *Patcher) {
+		p.docsService = cl.Docs
+	}
+}
+
+// WithRetryPolicy sets how batch updates that fail transiently are retried,
+// replacing the maxRetryAttempts given to NewPatcher
+func WithRetryPolicy(rp retry.Policy) Option {
+	return func(p *Patcher) {
+		p.retryPolicy = rp
+	}
+}
+
+// WithLimiter makes the patcher draw every Docs API call from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(p *Patcher) {
+		p.limiter = l
+	}
+}
+
+// WithProgress reports the docs the patcher finds and processes to c
+func WithProgress(c *progress.Counter) Option {
+	return func(p *Patcher) {
+		p.progress = c
+	}
+}
 
-	// Pre-compiled regex for finding Google Docs/Sheets links
-	linkRe *regexp.Regexp
+// WithFailures records every doc the patcher gives up on to r
+func WithFailures(r *failures.Recorder) Option {
+	return func(p *Patcher) {
+		p.failures = r
+	}
+}
+
+// WithWorkers patches n docs concurrently. The limiter still paces every
+// Docs API call, so more workers only help while the budget has room.
+func WithWorkers(n int) Option {
+	return func(p *Patcher) {
+		p.workers = max(n, 1)
+	}
+}
+
+// WithMaxElements sets the element count above which a doc is treated as
+// oversized and either patched in chunks or flagged for manual handling
+// (OversizedChunk or OversizedFlag)
+func WithMaxElements(n int, mode string) Option {
+	return func(p *Patcher) {
+		p.maxElements = n
+		p.oversizedMode = mode
+	}
+}
+
+// WithStorage reads the crawl output from the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(p *Patcher) {
+		p.store = s
+	}
 }
 
 // NewPatcher creates a new patcher with the given configuration
-func NewPatcher(ctx context.Context, projectID string, rateLimitDelay time.Duration, maxRetryAttempts int, outDir string) (*Patcher, error) {
-	opts := []option.ClientOption{}
-	if projectID != "" {
-		opts = append(opts, option.WithQuotaProject(projectID))
+func NewPatcher(ctx context.Context, projectID string, rateLimitDelay time.Duration, maxRetryAttempts int, outDir string, opts ...Option) (*Patcher, error) {
+	p := &Patcher{
+		rateLimitDelay: rateLimitDelay,
+		retryPolicy:    retry.Default(),
+		outDir:         outDir,
+		store:          storage.NewLocal(outDir),
+		limiter:        ratelimit.Unlimited(),
+		workers:        1,
+	}
+	p.retryPolicy.MaxAttempts = maxRetryAttempts
+	for _, opt := range opts {
+		opt(p)
 	}
 
-	dsvc, err := docs.NewService(ctx, opts...)
+	if p.docsService != nil {
+		return p, nil
+	}
+	if projectID != "" {
+		p.clientOpts = append(p.clientOpts, option.WithQuotaProject(projectID))
+	}
+	dsvc, err := docs.NewService(ctx, p.clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating Docs service: %w", err)
 	}
-
-	return &Patcher{
-		docsService:      dsvc,
-		rateLimitDelay:   rateLimitDelay,
-		maxRetryAttempts: maxRetryAttempts,
-		outDir:           outDir,
-		linkRe:           regexp.MustCompile(`https://docs\.google\.com/(document|spreadsheets)/d/([^/?#]+)`),
-	}, nil
+	p.docsService = dsvc
+	return p, nil
 }
 
 // PatchStats tracks patching statistics
 type PatchStats struct {
-	DocsProcessed int
-	LinksPatched  int
-	DocsSkipped   int
-	Failures      int
+	DocsProcessed int `json:"docs_processed"`
+	LinksPatched  int `json:"links_patched"`
+	DocsSkipped   int `json:"docs_skipped"`
+	DocsFlagged   int `json:"docs_flagged"`
+	DocsCopied    int `json:"docs_copied"`
+	DocsRestored  int `json:"docs_restored"`
+	Quarantined   int `json:"quarantined,omitempty"`
+	Failures      int `json:"failures"`
+}
+
+// add counts the stats of o into s
+func (s *PatchStats) add(o PatchStats) {
+	s.DocsProcessed += o.DocsProcessed
+	s.LinksPatched += o.LinksPatched
+	s.DocsSkipped += o.DocsSkipped
+	s.DocsFlagged += o.DocsFlagged
+	s.DocsCopied += o.DocsCopied
+	s.DocsRestored += o.DocsRestored
+	s.Quarantined += o.Quarantined
+	s.Failures += o.Failures
 }
 
 // Name implements the Step interface
@@ -67,9 +206,19 @@ func (p *Patcher) Name() string {
 	return "patcher"
 }
 
+// Stats returns the statistics of the last run
+func (p *Patcher) Stats() any {
+	return p.stats
+}
+
 // Run implements the Step interface and starts the patching process
 func (p *Patcher) Run(ctx context.Context) error {
-	idMap, err := p.loadIDMap(p.outDir)
+	idMap, err := p.loadIDMap(ctx)
+	if p.dryRun != nil {
+		if planned := p.dryRun.IDMap(); len(planned) > 0 {
+			idMap, err = planned, nil
+		}
+	}
 	if err != nil {
 		slog.Info("no id_map.json found, skipping patching", slog.Any("error", err))
 		return nil
@@ -78,62 +227,149 @@ func (p *Patcher) Run(ctx context.Context) error {
 	slog.Info("patcher started", slog.Int("id_mappings", len(idMap)))
 
 	stats := &PatchStats{}
+	p.oversized = nil
+	p.idMapChanged = false
 	err = p.processAllDocs(ctx, idMap, stats)
 	if err != nil {
 		return fmt.Errorf("processing documents: %w", err)
 	}
+	if p.idMapChanged {
+		if err := p.writeIDMap(ctx, idMap); err != nil {
+			return fmt.Errorf("writing id_map.json: %w", err)
+		}
+	}
+	if err := p.writeOversized(ctx); err != nil {
+		return fmt.Errorf("writing %s: %w", OversizedFile, err)
+	}
+	if p.dryRun != nil {
+		if err := p.dryRun.Write(ctx, p.store); err != nil {
+			return fmt.Errorf("writing %s: %w", dryrun.File, err)
+		}
+	}
 
+	p.stats = *stats
 	slog.Info("patching completed",
 		slog.Int("docs_processed", stats.DocsProcessed),
 		slog.Int("links_patched", stats.LinksPatched),
 		slog.Int("docs_skipped", stats.DocsSkipped),
+		slog.Int("docs_flagged", stats.DocsFlagged),
+		slog.Int("docs_copied", stats.DocsCopied),
+		slog.Int("docs_restored", stats.DocsRestored),
+		slog.Int("quarantined", stats.Quarantined),
 		slog.Int("failures", stats.Failures))
 
 	return nil
 }
 
 // loadIDMap loads the ID mapping from the output directory
-func (p *Patcher) loadIDMap(outDir string) (map[string]string, error) {
-	mapPath := filepath.Join(outDir, "id_map.json")
-	f, err := os.Open(mapPath)
+func (p *Patcher) loadIDMap(ctx context.Context) (map[string]string, error) {
+	data, err := p.store.ReadFile(ctx, "id_map.json")
 	if err != nil {
 		return nil, fmt.Errorf("opening id_map.json: %w", err)
 	}
-	defer f.Close()
 
 	var idMap map[string]string
-	if err := json.NewDecoder(f).Decode(&idMap); err != nil {
+	if err := json.Unmarshal(data, &idMap); err != nil {
 		return nil, fmt.Errorf("decoding id_map.json: %w", err)
 	}
 
 	return idMap, nil
 }
 
+// writeIDMap saves an ID mapping the patcher changed
+func (p *Patcher) writeIDMap(ctx context.Context, idMap map[string]string) error {
+	data, err := json.MarshalIndent(idMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.store.WriteFile(ctx, "id_map.json", data)
+}
+
 // processAllDocs walks through all directories and patches documents
 func (p *Patcher) processAllDocs(ctx context.Context, idMap map[string]string, stats *PatchStats) error {
-	return filepath.WalkDir(p.outDir, func(path string, d os.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
+	names, err := p.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
 
-		if d.IsDir() || d.Name() != "metadata.json" {
-			return nil
+	var quarantined []repair.Entry
+	var readable []string
+	p.fresh = make(map[string]bool)
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
 		}
 
-		if err := p.processDocument(ctx, path, idMap, stats); err != nil {
-			slog.Warn("processing document failed",
-				slog.String("path", path),
+		m, err := p.loadDocumentMetadata(ctx, name)
+		if err != nil {
+			slog.Warn("quarantining unreadable directory",
+				slog.String("path", name),
 				slog.Any("error", err))
-			stats.Failures++
+			quarantined = append(quarantined, repair.NewEntry(p.Name(), storage.Dir(name), err))
+			continue
+		}
+		readable = append(readable, name)
+		if m.Change == types.ChangeNew {
+			p.fresh[m.Type+":"+m.ID] = true
 		}
+	}
 
-		return nil
-	})
+	readable = p.selected(ctx, readable)
+	p.progress.Found(len(readable))
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for range min(p.workers, len(readable)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range work {
+				var docStats PatchStats
+				err := p.processDocument(ctx, name, idMap, &docStats)
+				if err != nil && ctx.Err() != nil {
+					// cancelled, not failed; Run reports the cancellation
+					continue
+				}
+				if err != nil {
+					slog.Warn("processing document failed",
+						slog.String("path", name),
+						slog.Any("error", err))
+					docStats.Failures++
+					p.progress.Failed()
+					p.failures.Add(storage.Dir(name), err)
+				} else {
+					p.progress.Done()
+				}
+				p.mu.Lock()
+				stats.add(docStats)
+				p.mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range readable {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- name
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stats.Quarantined = len(quarantined)
+	return repair.Record(ctx, p.store, p.Name(), quarantined)
+}
+
+// PatchDir patches the links of the single crawled document stored in dir
+func (p *Patcher) PatchDir(ctx context.Context, dir string, idMap map[string]string) error {
+	stats := &PatchStats{}
+	return p.processDocument(ctx, path.Join(dir, "metadata.json"), idMap, stats)
 }
 
 // processDocument processes a single document for link patching
 func (p *Patcher) processDocument(ctx context.Context, metaPath string, idMap map[string]string, stats *PatchStats) error {
-	metadata, err := p.loadDocumentMetadata(metaPath)
+	metadata, err := p.loadDocumentMetadata(ctx, metaPath)
 	if err != nil {
 		return fmt.Errorf("loading metadata: %w", err)
 	}
@@ -148,16 +384,16 @@ func (p *Patcher) processDocument(ctx context.Context, metaPath string, idMap ma
 		return nil // Only patch documents, not sheets
 	}
 
-	newDocID := idMap["doc:"+metadata.ID]
+	newDocID := p.lookup(idMap, "doc:"+metadata.ID)
 	if newDocID == "" {
 		stats.DocsSkipped++
 		return nil // No uploaded version found
 	}
 
-	dir := filepath.Dir(metaPath)
-	htmlPath := filepath.Join(dir, "content.html")
+	dir := storage.Dir(metaPath)
+	htmlPath := path.Join(dir, metadata.TextFileName())
 
-	urlMap, err := p.buildURLMap(htmlPath, idMap)
+	urlMap, err := p.buildURLMap(ctx, htmlPath, idMap)
 	if err != nil {
 		return fmt.Errorf("building URL map: %w", err)
 	}
@@ -166,35 +402,126 @@ func (p *Patcher) processDocument(ctx context.Context, metaPath string, idMap ma
 		stats.DocsProcessed++
 		return nil // No links to patch
 	}
+	if metadata.Change == types.ChangeUnchanged && !p.linksFresh(urlMap) {
+		// patched by an earlier run, and no link has a new target since
+		stats.DocsSkipped++
+		return nil
+	}
+	if p.dryRun != nil {
+		return p.planPatch(ctx, metadata, newDocID, urlMap, stats)
+	}
 
-	linksPatched, err := p.patchDocumentLinks(ctx, newDocID, urlMap)
+	changes, err := p.patchDocumentLinks(ctx, dir, newDocID, urlMap)
+	if err != nil && p.reuploader != nil && isNotFound(err) {
+		// someone deleted the uploaded copy since the upload
+		slog.Warn("uploaded document is gone, re-uploading",
+			slog.String("title", metadata.Title),
+			slog.String("doc_id", newDocID))
+		p.reuploadMu.Lock()
+		restoredID, upErr := p.reuploader.Reupload(ctx, dir)
+		p.reuploadMu.Unlock()
+		if upErr != nil {
+			return fmt.Errorf("patching document links: %w (re-upload: %w)", err, upErr)
+		}
+		p.remap(idMap, "doc:"+metadata.ID, restoredID)
+		stats.DocsRestored++
+		newDocID = restoredID
+		changes, err = p.patchDocumentLinks(ctx, dir, newDocID, urlMap)
+	}
+	if err != nil && p.driveService != nil && isPermissionDenied(err) {
+		copyID, copyErr := p.copyForPatching(ctx, newDocID, metadata.Title)
+		if copyErr != nil {
+			return fmt.Errorf("patching document links: %w (fallback: %w)", err, copyErr)
+		}
+		p.remap(idMap, "doc:"+metadata.ID, copyID)
+		stats.DocsCopied++
+		newDocID = copyID
+		changes, err = p.patchDocumentLinks(ctx, dir, newDocID, urlMap)
+	}
+	var tooBig *oversizedError
+	if errors.As(err, &tooBig) {
+		p.mu.Lock()
+		p.oversized = append(p.oversized, OversizedDoc{
+			Title:        metadata.Title,
+			Dir:          dir,
+			DocID:        newDocID,
+			Elements:     tooBig.elements,
+			PendingLinks: tooBig.links,
+		})
+		p.mu.Unlock()
+		stats.DocsFlagged++
+		slog.Warn("document too large, flagged for manual patching",
+			slog.String("title", metadata.Title),
+			slog.Int("elements", tooBig.elements))
+		return nil
+	}
+	if len(changes) > 0 {
+		// record even a partial patch, so owners see what already changed
+		if logErr := p.writePatchLog(ctx, dir, newDocID, changes); logErr != nil {
+			slog.Warn("writing patch log failed",
+				slog.String("dir", dir),
+				slog.Any("error", logErr))
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("patching document links: %w", err)
 	}
 
 	stats.DocsProcessed++
-	stats.LinksPatched += linksPatched
+	stats.LinksPatched += len(changes)
 
 	slog.Info("patched document",
 		slog.String("title", metadata.Title),
-		slog.Int("links_patched", linksPatched))
-
-	// Rate limiting to stay under API limits
-	time.Sleep(p.rateLimitDelay)
+		slog.Int("links_patched", len(changes)))
+
+	// the limiter paces every call; this is an extra pause, if configured
+	if p.rateLimitDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.rateLimitDelay):
+		}
+	}
 
 	return nil
 }
 
+// lookup returns the ID of key's uploaded copy, or "" when it has none
+func (p *Patcher) lookup(idMap map[string]string, key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return idMap[key]
+}
+
+// remap points key at another uploaded copy, to be saved when the run ends
+func (p *Patcher) remap(idMap map[string]string, key, id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idMap[key] = id
+	p.idMapChanged = true
+}
+
+// linksFresh reports whether any link of urlMap targets a document new
+// this run, which an earlier patch couldn't have pointed at its copy
+func (p *Patcher) linksFresh(urlMap map[string]string) bool {
+	for oldURL := range urlMap {
+		t, ok := gdocs.ParseTarget(oldURL)
+		if ok && p.fresh[t.Keys()[0]] {
+			return true
+		}
+	}
+	return false
+}
+
 // loadDocumentMetadata loads metadata from a metadata.json file
-func (p *Patcher) loadDocumentMetadata(metaPath string) (*types.Metadata, error) {
-	f, err := os.Open(metaPath)
+func (p *Patcher) loadDocumentMetadata(ctx context.Context, metaPath string) (*types.Metadata, error) {
+	data, err := p.store.ReadFile(ctx, metaPath)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
 	var metadata types.Metadata
-	if err := json.NewDecoder(f).Decode(&metadata); err != nil {
+	if err := json.Unmarshal(data, &metadata); err != nil {
 		return nil, err
 	}
 
@@ -202,68 +529,92 @@ func (p *Patcher) loadDocumentMetadata(metaPath string) (*types.Metadata, error)
 }
 
 // buildURLMap builds a mapping of old URLs to new URLs based on the ID map
-func (p *Patcher) buildURLMap(htmlPath string, idMap map[string]string) (map[string]string, error) {
-	data, err := os.ReadFile(htmlPath)
+func (p *Patcher) buildURLMap(ctx context.Context, htmlPath string, idMap map[string]string) (map[string]string, error) {
+	data, err := p.store.ReadFile(ctx, htmlPath)
 	if err != nil {
 		return nil, fmt.Errorf("reading HTML file: %w", err)
 	}
 
-	matches := p.linkRe.FindAllSubmatch(data, -1)
+	// keyed by the target's plain editor URL, whatever shape the link had;
+	// Drive file links take the type of the key they are found under
 	urlMap := make(map[string]string)
-
-	for _, match := range matches {
-		kind := string(match[1]) // document | spreadsheets
-		oldID := string(match[2])
-
-		// Map document type to our internal key format
-		typeMap := map[string]string{
-			"document":     "doc:" + oldID,
-			"spreadsheets": "sheet:" + oldID,
-		}
-
-		oldKey := typeMap[kind]
-		newID, exists := idMap[oldKey]
-		if !exists {
-			continue // Skip if no mapping found
+	for _, t := range gdocs.FindTargets(data) {
+		for _, key := range t.Keys() {
+			newID := p.lookup(idMap, key)
+			if newID == "" {
+				continue // Skip if no mapping found
+			}
+			kind := gdocs.KindOf(key)
+			urlMap[t.URL(kind)] = fmt.Sprintf("https://docs.google.com/%s/d/%s/edit", kind, newID)
+			break
 		}
-
-		oldURL := p.stripQuery(string(match[0]))
-		newURL := fmt.Sprintf("https://docs.google.com/%s/d/%s/edit", kind, newID)
-		urlMap[oldURL] = newURL
 	}
 
 	return urlMap, nil
 }
 
-// patchDocumentLinks patches all links in a single document
-func (p *Patcher) patchDocumentLinks(ctx context.Context, docID string, urlMap map[string]string) (int, error) {
-	doc, err := p.docsService.Documents.Get(docID).Do()
+// patchDocumentLinks patches all links in a single document and returns
+// the changes applied
+func (p *Patcher) patchDocumentLinks(ctx context.Context, dir, docID string, urlMap map[string]string) ([]PatchChange, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	doc, err := p.docsService.Documents.Get(docID).Context(ctx).Do()
 	if err != nil {
-		return 0, fmt.Errorf("fetching document: %w", err)
+		return nil, fmt.Errorf("fetching document: %w", err)
 	}
 
-	requests := p.buildPatchRequests(doc, urlMap)
+	requests, changes := p.buildPatchRequests(doc, urlMap)
 	if len(requests) == 0 {
-		return 0, nil // No links to patch
+		return nil, nil // No links to patch
 	}
 
-	err = p.executeWithRetry(ctx, func() error {
+	// Huge docs are where BatchUpdate latency and failures concentrate, so
+	// they are patched a chunk at a time
+	if p.maxElements > 0 {
+		if elements := countElements(doc); elements > p.maxElements {
+			if p.oversizedMode == OversizedFlag {
+				return nil, &oversizedError{elements: elements, links: len(requests)}
+			}
+			slog.Info("patching oversized document in chunks",
+				slog.String("doc_id", docID),
+				slog.Int("elements", elements),
+				slog.Int("requests", len(requests)))
+			return p.patchInRounds(ctx, dir, docID, doc, urlMap)
+		}
+	}
+
+	err = p.retryPolicy.Do(ctx, "docs batch update", func() error {
+		if err := p.limiter.Wait(ctx); err != nil {
+			return err
+		}
 		_, err := p.docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{
 			Requests: requests,
-		}).Do()
+		}).Context(ctx).Do()
 		return err
 	})
-
 	if err != nil {
-		return 0, fmt.Errorf("executing batch update: %w", err)
+		return nil, fmt.Errorf("executing batch update: %w", err)
 	}
 
-	return len(requests), nil
+	return changes, nil
+}
+
+// oversizedError reports a doc left unpatched because of its size
+type oversizedError struct {
+	elements int
+	links    int
 }
 
-// buildPatchRequests builds a list of patch requests for document links
-func (p *Patcher) buildPatchRequests(doc *docs.Document, urlMap map[string]string) []*docs.Request {
+func (e *oversizedError) Error() string {
+	return fmt.Sprintf("document has %d elements", e.elements)
+}
+
+// buildPatchRequests builds a list of patch requests for document links,
+// along with a description of each change
+func (p *Patcher) buildPatchRequests(doc *docs.Document, urlMap map[string]string) ([]*docs.Request, []PatchChange) {
 	var requests []*docs.Request
+	var changes []PatchChange
 
 	for _, structuralElement := range doc.Body.Content {
 		paragraph := structuralElement.Paragraph
@@ -271,16 +622,16 @@ func (p *Patcher) buildPatchRequests(doc *docs.Document, urlMap map[string]strin
 			continue
 		}
 
-		for _, element := range paragraph.Elements {
-			textRun := element.TextRun
-			if textRun == nil || textRun.TextStyle == nil || textRun.TextStyle.Link == nil {
+		for i, element := range paragraph.Elements {
+			// text runs and inline images/drawings both carry links in
+			// their text style
+			link, text := gdocs.ElementLink(doc, element)
+			if link == "" {
 				continue
 			}
 
-			// TODO: this needs to remove the /edit from the URL
-			oldURL := canonicalLink(textRun.TextStyle.Link.Url)
-			newURL, exists := urlMap[oldURL]
-			if !exists {
+			newURL := targetURL(link, urlMap)
+			if newURL == "" {
 				continue
 			}
 
@@ -296,75 +647,31 @@ func (p *Patcher) buildPatchRequests(doc *docs.Document, urlMap map[string]strin
 					Fields: "link",
 				},
 			})
+			changes = append(changes, PatchChange{
+				StartIndex: element.StartIndex,
+				EndIndex:   element.EndIndex,
+				OldURL:     link,
+				NewURL:     newURL,
+				Text:       text,
+				Snippet:    snippet(paragraph, i, text),
+			})
 		}
 	}
 
-	return requests
-}
-
-// executeWithRetry executes a function with exponential backoff retry logic
-func (p *Patcher) executeWithRetry(ctx context.Context, fn func() error) error {
-	const base = time.Second
-
-	for i := 0; i < p.maxRetryAttempts; i++ {
-		err := fn()
-		if err == nil {
-			return nil
-		}
-
-		// Only retry on 503 backend errors
-		if googleAPIErr, ok := err.(*googleapi.Error); !ok || googleAPIErr.Code != 503 {
-			return err
-		}
-
-		// Calculate exponential backoff with jitter
-		delay := base * time.Duration(math.Pow(2, float64(i)))
-		jitter := time.Duration(rand.Int63n(int64(delay / 2)))
-		time.Sleep(delay + jitter)
-
-		slog.Info("retrying after 503 error",
-			slog.Int("attempt", i+1),
-			slog.Int("max_attempts", p.maxRetryAttempts))
-	}
-
-	return fmt.Errorf("failed after %d attempts with 503 errors", p.maxRetryAttempts)
+	return requests, changes
 }
 
-// stripQuery removes query parameters and fragments from URLs
-func (p *Patcher) stripQuery(url string) string {
-	if i := strings.IndexAny(url, "?#"); i != -1 {
-		return url[:i]
+// targetURL returns the copy's URL urlMap holds for the doc or sheet link
+// points to, or "" when it has none
+func targetURL(link string, urlMap map[string]string) string {
+	t, ok := gdocs.ParseTarget(link)
+	if !ok {
+		return ""
 	}
-	return url
-}
-
-// pre-compiled once; matches "doc … /d/<ID>" or "spreadsheets … /d/<ID>"
-var tidyRE = regexp.MustCompile(`^(https://docs\.google\.com/(?:document|spreadsheets)/d/[^/]+)`)
-
-// canonicalLink unwraps Google's redirector and drops tracking params.
-func canonicalLink(raw string) string {
-	u := raw
-
-	// ── 1. unwrap Google redirector ──────────────────────────────────────────
-	for i := 0; i < 3 && strings.Contains(u, "://www.google.com/url?"); i++ {
-		parsed, _ := url.Parse(u)
-		real := parsed.Query().Get("q")
-		if real == "" {
-			break
+	for _, key := range t.Keys() {
+		if newURL, ok := urlMap[t.URL(gdocs.KindOf(key))]; ok {
+			return newURL
 		}
-		real, _ = url.QueryUnescape(real)
-		u = real
-	}
-
-	// ── 2. strip ?query and #fragment ────────────────────────────────────────
-	if i := strings.IndexAny(u, "?#"); i != -1 {
-		u = u[:i]
-	}
-
-	// ── 3. drop trailing /edit, /view, /preview … ───────────────────────────
-	if m := tidyRE.FindStringSubmatch(u); len(m) > 0 {
-		u = m[1] // keep only the part through "…/d/<ID>"
 	}
-
-	return u
+	return ""
 }
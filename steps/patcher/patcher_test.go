@@ -0,0 +1,288 @@
+package patcher_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/patcher"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/option"
+)
+
+func TestRunPatchesDocsConcurrently(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	const n = 12
+	idMap := map[string]string{"doc:target": "new-target"}
+	for i := range n {
+		id := fmt.Sprintf("src%d", i)
+		idMap["doc:"+id] = "new-" + id
+		m, err := json.Marshal(types.Metadata{ID: id, Type: "doc", Title: id, ContentFile: "content.html"})
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFile(ctx, id+"/metadata.json", m))
+		require.NoError(t, store.WriteFile(ctx, id+"/content.html",
+			[]byte(`<a href="https://docs.google.com/document/d/target/edit">t</a>`)))
+	}
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", data))
+
+	var inFlight, peak, updates atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, ":batchUpdate") {
+			updates.Add(1)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		cur := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+		_, _ = w.Write([]byte(`{"body":{"content":[{"paragraph":{"elements":[{"startIndex":1,"endIndex":2,
+			"textRun":{"content":"t","textStyle":{"link":{"url":"https://docs.google.com/document/d/target/edit"}}}}]}}]}}`))
+	}))
+	defer api.Close()
+
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication()),
+		patcher.WithWorkers(4))
+	require.NoError(t, err)
+	require.NoError(t, p.Run(ctx))
+
+	stats := p.Stats().(patcher.PatchStats)
+	assert.Equal(t, n, stats.DocsProcessed)
+	assert.Equal(t, n, stats.LinksPatched)
+	assert.Zero(t, stats.Failures)
+	assert.EqualValues(t, n, updates.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+}
+
+func TestRunWithOnlyPatchesRetriedDocsAndTheirLinkers(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	// a links to b, which failed to upload last time; c links elsewhere
+	docs := map[string]string{"a": "b", "b": "c", "c": "x"}
+	idMap := map[string]string{"doc:x": "new-x"}
+	for id, target := range docs {
+		idMap["doc:"+id] = "new-" + id
+		m, err := json.Marshal(types.Metadata{ID: id, Type: "doc", Title: id, ContentFile: "content.html"})
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFile(ctx, id+"/metadata.json", m))
+		require.NoError(t, store.WriteFile(ctx, id+"/content.html",
+			[]byte(`<a href="https://docs.google.com/document/d/`+target+`/edit">t</a>`)))
+	}
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", data))
+
+	var patched []string
+	var mu sync.Mutex
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if id, ok := strings.CutSuffix(path.Base(r.URL.Path), ":batchUpdate"); ok {
+			mu.Lock()
+			patched = append(patched, id)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		target := docs[strings.TrimPrefix(path.Base(r.URL.Path), "new-")]
+		_, _ = w.Write([]byte(`{"body":{"content":[{"paragraph":{"elements":[{"startIndex":1,"endIndex":2,
+			"textRun":{"content":"t","textStyle":{"link":{"url":"https://docs.google.com/document/d/` + target + `/edit"}}}}]}}]}}`))
+	}))
+	defer api.Close()
+
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication()),
+		patcher.WithOnly([]string{"b"}))
+	require.NoError(t, err)
+	require.NoError(t, p.Run(ctx))
+
+	assert.ElementsMatch(t, []string{"new-a", "new-b"}, patched)
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	const n = 12
+	idMap := map[string]string{"doc:target": "new-target"}
+	for i := range n {
+		id := fmt.Sprintf("src%d", i)
+		idMap["doc:"+id] = "new-" + id
+		m, err := json.Marshal(types.Metadata{ID: id, Type: "doc", Title: id, ContentFile: "content.html"})
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFile(ctx, id+"/metadata.json", m))
+		require.NoError(t, store.WriteFile(ctx, id+"/content.html",
+			[]byte(`<a href="https://docs.google.com/document/d/target/edit">t</a>`)))
+	}
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", data))
+
+	// the run is cancelled while the first doc is patched
+	var updates atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, ":batchUpdate") {
+			updates.Add(1)
+			cancel()
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"body":{"content":[{"paragraph":{"elements":[{"startIndex":1,"endIndex":2,
+			"textRun":{"content":"t","textStyle":{"link":{"url":"https://docs.google.com/document/d/target/edit"}}}}]}}]}}`))
+	}))
+	defer api.Close()
+
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication()),
+		patcher.WithWorkers(1))
+	require.NoError(t, err)
+	require.ErrorIs(t, p.Run(ctx), context.Canceled)
+	assert.EqualValues(t, 1, updates.Load())
+}
+
+// recordingReuploader records re-uploads without locking, like the uploader
+type recordingReuploader struct {
+	dirs map[string]int
+}
+
+func (r *recordingReuploader) Reupload(_ context.Context, dir string) (string, error) {
+	r.dirs[dir]++
+	return "restored-" + path.Base(dir), nil
+}
+
+func TestRunReuploadsDeletedCopiesOneAtATime(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	const n = 8
+	idMap := map[string]string{"doc:target": "new-target"}
+	for i := range n {
+		id := fmt.Sprintf("src%d", i)
+		idMap["doc:"+id] = "new-" + id
+		m, err := json.Marshal(types.Metadata{ID: id, Type: "doc", Title: id, ContentFile: "content.html"})
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFile(ctx, id+"/metadata.json", m))
+		require.NoError(t, store.WriteFile(ctx, id+"/content.html",
+			[]byte(`<a href="https://docs.google.com/document/d/target/edit">t</a>`)))
+	}
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", data))
+
+	// every uploaded copy is gone; the re-uploaded ones patch fine
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/new-") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ":batchUpdate") {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"body":{"content":[{"paragraph":{"elements":[{"startIndex":1,"endIndex":2,
+			"textRun":{"content":"t","textStyle":{"link":{"url":"https://docs.google.com/document/d/target/edit"}}}}]}}]}}`))
+	}))
+	defer api.Close()
+
+	r := &recordingReuploader{dirs: make(map[string]int)}
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication()),
+		patcher.WithWorkers(4),
+		patcher.WithReuploader(r))
+	require.NoError(t, err)
+	require.NoError(t, p.Run(ctx))
+
+	assert.Len(t, r.dirs, n)
+	stats := p.Stats().(patcher.PatchStats)
+	assert.Equal(t, n, stats.DocsRestored)
+	assert.Zero(t, stats.Failures)
+}
+
+func TestRunPatchesEveryLinkShapeTheCrawlerFollows(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	store := storage.NewLocal(out)
+
+	links := map[string]string{
+		"https://docs.google.com/a/example.com/document/d/workspace/edit": "https://docs.google.com/document/d/new-workspace/edit",
+		"https://docs.google.com/open?id=opened":                          "https://docs.google.com/document/d/new-opened/edit",
+		"https://drive.google.com/open?id=budget&authuser=0":              "https://docs.google.com/spreadsheets/d/new-budget/edit",
+		"https://drive.google.com/file/d/filed/view?usp=sharing":          "https://docs.google.com/document/d/new-filed/edit",
+		"https://drive.google.com/uc?export=download&id=downloaded":       "https://docs.google.com/document/d/new-downloaded/edit",
+	}
+	idMap := map[string]string{
+		"doc:src": "new-src", "doc:workspace": "new-workspace", "doc:opened": "new-opened",
+		"sheet:budget": "new-budget", "doc:filed": "new-filed", "doc:downloaded": "new-downloaded",
+	}
+	var page strings.Builder
+	var elements []string
+	var index int
+	for link := range links {
+		// the export wraps links in Google's redirector
+		fmt.Fprintf(&page, `<a href="https://www.google.com/url?q=%s&amp;sa=D">t</a>`, url.QueryEscape(link))
+		index++
+		elements = append(elements, fmt.Sprintf(`{"startIndex":%d,"endIndex":%d,"textRun":{"content":"t","textStyle":{"link":{"url":%q}}}}`, index, index+1, link))
+	}
+	m, err := json.Marshal(types.Metadata{ID: "src", Type: "doc", Title: "src", ContentFile: "content.html"})
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "src/metadata.json", m))
+	require.NoError(t, store.WriteFile(ctx, "src/content.html", []byte(page.String())))
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", data))
+
+	var patched []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, ":batchUpdate") {
+			var req docs.BatchUpdateDocumentRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			for _, u := range req.Requests {
+				patched = append(patched, u.UpdateTextStyle.TextStyle.Link.Url)
+			}
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"body":{"content":[{"paragraph":{"elements":[` + strings.Join(elements, ",") + `]}}]}}`))
+	}))
+	defer api.Close()
+
+	p, err := patcher.NewPatcher(ctx, "", 0, 1, out,
+		patcher.WithClientOptions(option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication()))
+	require.NoError(t, err)
+	require.NoError(t, p.Run(ctx))
+
+	assert.ElementsMatch(t, slices.Collect(maps.Values(links)), patched)
+}
@@ -0,0 +1,76 @@
+package patcher
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// PatchLogFile lists, in a document's output directory, the links the
+// patcher rewrote in its uploaded copy
+const PatchLogFile = "patch_log.json"
+
+// snippetRadius is how much text on each side of a link its snippet keeps
+const snippetRadius = 40
+
+// PatchChange is one rewritten link
+type PatchChange struct {
+	StartIndex int64  `json:"start_index"`
+	EndIndex   int64  `json:"end_index"`
+	OldURL     string `json:"old_url"`
+	NewURL     string `json:"new_url"`
+	// Text is the link text; Snippet is it with the surrounding text
+	Text    string `json:"text"`
+	Snippet string `json:"snippet"`
+}
+
+// PatchLog is the content of PatchLogFile
+type PatchLog struct {
+	DocID     string        `json:"doc_id"`
+	PatchedAt time.Time     `json:"patched_at"`
+	Changes   []PatchChange `json:"changes"`
+}
+
+// writePatchLog records the changes made to a document in its directory
+func (p *Patcher) writePatchLog(ctx context.Context, dir, docID string, changes []PatchChange) error {
+	data, err := json.MarshalIndent(PatchLog{
+		DocID:     docID,
+		PatchedAt: time.Now().UTC(),
+		Changes:   changes,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return p.store.WriteFile(ctx, path.Join(dir, PatchLogFile), data)
+}
+
+// snippet returns the text of a paragraph around the element at index i,
+// with the element's own text, given as label, marked by brackets
+func snippet(paragraph *docs.Paragraph, i int, label string) string {
+	var before, after strings.Builder
+	for j, el := range paragraph.Elements {
+		if el.TextRun == nil || j == i {
+			continue
+		}
+		if j < i {
+			before.WriteString(el.TextRun.Content)
+		} else {
+			after.WriteString(el.TextRun.Content)
+		}
+	}
+
+	b := []rune(strings.TrimLeft(before.String(), " \t"))
+	if len(b) > snippetRadius {
+		b = append([]rune("…"), b[len(b)-snippetRadius:]...)
+	}
+	a := []rune(strings.TrimRight(after.String(), " \t\n"))
+	if len(a) > snippetRadius {
+		a = append(a[:snippetRadius], []rune("…")...)
+	}
+
+	return string(b) + "[" + label + "]" + string(a)
+}
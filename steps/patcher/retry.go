@@ -0,0 +1,70 @@
+package patcher
+
+import (
+	"context"
+	"path"
+	"slices"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+)
+
+// WithOnly patches just the docs in the given directories, such as the ones
+// a previous run failed to upload or patch, along with every doc linking to
+// one of them, whose links couldn't point at a copy that didn't exist yet
+func WithOnly(dirs []string) Option {
+	return func(p *Patcher) {
+		p.only = dirs
+	}
+}
+
+// selected narrows the metadata files to patch down to the WithOnly
+// directories and the docs linking to them
+func (p *Patcher) selected(ctx context.Context, names []string) []string {
+	if p.only == nil {
+		return names
+	}
+	retried := make(map[string]bool)
+	for _, name := range names {
+		if !slices.Contains(p.only, storage.Dir(name)) {
+			continue
+		}
+		if m, err := p.loadDocumentMetadata(ctx, name); err == nil {
+			retried[m.Type+":"+m.ID] = true
+		}
+	}
+
+	// like documents new this run, their copies are new to every link
+	for key := range retried {
+		p.fresh[key] = true
+	}
+
+	var out []string
+	for _, name := range names {
+		if slices.Contains(p.only, storage.Dir(name)) || p.linksTo(ctx, name, retried) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// linksTo reports whether the doc of the metadata file name links to one of
+// the documents keys holds
+func (p *Patcher) linksTo(ctx context.Context, name string, keys map[string]bool) bool {
+	m, err := p.loadDocumentMetadata(ctx, name)
+	if err != nil || m.Type != "doc" || m.IsRedirect {
+		return false
+	}
+	data, err := p.store.ReadFile(ctx, path.Join(storage.Dir(name), m.TextFileName()))
+	if err != nil {
+		return false
+	}
+	for _, t := range gdocs.FindTargets(data) {
+		for _, key := range t.Keys() {
+			if keys[key] {
+				return true
+			}
+		}
+	}
+	return false
+}
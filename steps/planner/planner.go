@@ -0,0 +1,194 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// PlanFile is the estimate written at the output root
+const PlanFile = "plan.json"
+
+// Plan estimates what uploading and patching a crawl would cost
+type Plan struct {
+	// Documents is the number of Drive files the uploader would create
+	Documents int `json:"documents"`
+	Docs      int `json:"docs"`
+	Sheets    int `json:"sheets"`
+	// Redirects are duplicate links that don't create a file
+	Redirects int `json:"redirects"`
+	// Bytes is the size of the content that would be uploaded
+	Bytes int64 `json:"bytes"`
+	// LinksToPatch counts links between crawled documents
+	LinksToPatch int `json:"links_to_patch"`
+	// APICalls estimates the Google API requests made by each step
+	APICalls      map[string]int `json:"api_calls"`
+	TotalAPICalls int            `json:"total_api_calls"`
+	// EstimatedDuration is the expected wall-clock time of the upload and
+	// patch steps under the API budget
+	EstimatedDuration time.Duration `json:"estimated_duration_ns"`
+}
+
+// Planner reads a crawl's output and estimates the rest of the pipeline
+// without calling any Google API
+type Planner struct {
+	outDir string
+	store  storage.Storage
+	// Shared API budget the estimate assumes (0 = unlimited)
+	qps float64
+	// Pause the patcher makes after each doc
+	patchDelay time.Duration
+	// Docs the patcher works on at once, each pausing on its own
+	patchWorkers int
+
+	plan Plan
+}
+
+// Option configures optional Planner behaviour
+type Option func(*Planner)
+
+// WithStorage reads the crawl output from the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(p *Planner) {
+		p.store = s
+	}
+}
+
+// WithPatchWorkers plans for a patcher patching n docs concurrently
+func WithPatchWorkers(n int) Option {
+	return func(p *Planner) {
+		p.patchWorkers = max(n, 1)
+	}
+}
+
+// NewPlanner plans for an API budget of qps requests per second and a
+// patcher pausing patchDelay after each doc
+func NewPlanner(outDir string, qps float64, patchDelay time.Duration, opts ...Option) *Planner {
+	p := &Planner{
+		outDir:       outDir,
+		store:        storage.NewLocal(outDir),
+		qps:          qps,
+		patchDelay:   patchDelay,
+		patchWorkers: 1,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements the Step interface
+func (p *Planner) Name() string {
+	return "planner"
+}
+
+// Stats returns the plan of the last run
+func (p *Planner) Stats() any {
+	return p.plan
+}
+
+// Run estimates the upload and patch of the crawl output and writes plan.json
+func (p *Planner) Run(ctx context.Context) error {
+	names, err := p.store.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("listing output: %w", err)
+	}
+
+	plan := Plan{APICalls: make(map[string]int)}
+	// docs linking to at least one other crawled document get patched
+	linking := make(map[string]bool)
+	docs := make(map[string]bool)
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" {
+			continue
+		}
+		m, err := p.loadMetadata(ctx, name)
+		if err != nil {
+			slog.Warn("skipping unreadable metadata", slog.String("path", name), slog.Any("error", err))
+			continue
+		}
+
+		if m.DiscoveredBy != "" {
+			plan.LinksToPatch++
+			linking[m.DiscoveredBy] = true
+		}
+		if m.IsRedirect {
+			plan.Redirects++
+			continue
+		}
+
+		plan.Documents++
+		switch m.Type {
+		case "doc":
+			plan.Docs++
+			docs["doc:"+m.ID] = true
+		case "sheet":
+			plan.Sheets++
+		}
+		if data, err := p.store.ReadFile(ctx, path.Join(storage.Dir(name), m.ContentFileName())); err == nil {
+			plan.Bytes += int64(len(data))
+		}
+	}
+
+	patched := 0
+	for key := range linking {
+		if docs[key] {
+			patched++
+		}
+	}
+
+	// one folder plus one create per document; the patcher reads each doc
+	// with links and sends it one batch update
+	plan.APICalls["uploader"] = 1 + plan.Documents
+	plan.APICalls["patcher"] = 2 * patched
+	for _, n := range plan.APICalls {
+		plan.TotalAPICalls += n
+	}
+	plan.EstimatedDuration = p.estimate(plan.TotalAPICalls, patched)
+
+	p.plan = plan
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := p.store.WriteFile(ctx, PlanFile, data); err != nil {
+		return fmt.Errorf("writing %s: %w", PlanFile, err)
+	}
+
+	slog.Info("migration plan",
+		slog.Int("documents", plan.Documents),
+		slog.Int("redirects", plan.Redirects),
+		slog.Int64("bytes", plan.Bytes),
+		slog.Int("links_to_patch", plan.LinksToPatch),
+		slog.Int("api_calls", plan.TotalAPICalls),
+		slog.Duration("estimated_duration", plan.EstimatedDuration))
+	return nil
+}
+
+// estimate is the time calls API requests take under the budget, plus the
+// patcher's pause after each of its docs, spread over its workers
+func (p *Planner) estimate(calls, patchedDocs int) time.Duration {
+	var d time.Duration
+	if p.qps > 0 {
+		d = time.Duration(float64(calls) / p.qps * float64(time.Second))
+	}
+	return d + time.Duration(patchedDocs)*p.patchDelay/time.Duration(p.patchWorkers)
+}
+
+func (p *Planner) loadMetadata(ctx context.Context, name string) (*types.Metadata, error) {
+	data, err := p.store.ReadFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var m types.Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
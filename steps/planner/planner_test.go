@@ -0,0 +1,49 @@
+package planner_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/planner"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanner(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := storage.NewLocal(dir)
+
+	write := func(name string, m types.Metadata, content string) {
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		require.NoError(t, s.WriteFile(ctx, name+"/metadata.json", data))
+		if content != "" {
+			require.NoError(t, s.WriteFile(ctx, name+"/"+m.ContentFileName(), []byte(content)))
+		}
+	}
+	write("handbook-d1", types.Metadata{ID: "d1", Type: "doc"}, "<p>handbook</p>")
+	write("handbook-d1/budget-s1", types.Metadata{ID: "s1", Type: "sheet", DiscoveredBy: "doc:d1"}, "a,b\n")
+	write("handbook-d1/budget-s1-redirect", types.Metadata{ID: "s1", Type: "sheet", DiscoveredBy: "doc:d1", IsRedirect: true}, "")
+
+	p := planner.NewPlanner(dir, 2, time.Second)
+	require.NoError(t, p.Run(ctx))
+
+	plan := p.Stats().(planner.Plan)
+	assert.Equal(t, 2, plan.Documents)
+	assert.Equal(t, 1, plan.Docs)
+	assert.Equal(t, 1, plan.Sheets)
+	assert.Equal(t, 1, plan.Redirects)
+	assert.Equal(t, int64(19), plan.Bytes)
+	assert.Equal(t, 2, plan.LinksToPatch)
+	assert.Equal(t, map[string]int{"uploader": 3, "patcher": 2}, plan.APICalls)
+	// 5 calls at 2 per second, plus the pause after the one patched doc
+	assert.Equal(t, 3500*time.Millisecond, plan.EstimatedDuration)
+
+	_, err := s.ReadFile(ctx, planner.PlanFile)
+	assert.NoError(t, err)
+}
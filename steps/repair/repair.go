@@ -0,0 +1,72 @@
+// Package repair keeps the list of crawled directories that steps had to
+// skip because their files could not be read or parsed.
+package repair
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+)
+
+// File is the repair list at the output root
+const File = "repair_list.json"
+
+// Entry is a directory a step quarantined
+type Entry struct {
+	Dir     string    `json:"dir"`
+	Step    string    `json:"step"`
+	Error   string    `json:"error"`
+	FoundAt time.Time `json:"found_at"`
+}
+
+// NewEntry records that step could not read dir
+func NewEntry(step, dir string, err error) Entry {
+	return Entry{Dir: dir, Step: step, Error: err.Error(), FoundAt: time.Now().UTC()}
+}
+
+// Record replaces the entries step reported on its previous run with
+// entries, keeping those of other steps. The file is removed once empty.
+func Record(ctx context.Context, store storage.Storage, step string, entries []Entry) error {
+	var list []Entry
+	data, err := store.ReadFile(ctx, File)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("reading %s: %w", File, err)
+	default:
+		// a damaged repair list is rebuilt rather than blocking the run
+		_ = json.Unmarshal(data, &list)
+	}
+
+	kept := entries
+	for _, e := range list {
+		if e.Step != step {
+			kept = append(kept, e)
+		}
+	}
+
+	if len(kept) == 0 {
+		return store.RemoveAll(ctx, File)
+	}
+	// order doesn't depend on which step ran last, so lists diff cleanly
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Step != kept[j].Step {
+			return kept[i].Step < kept[j].Step
+		}
+		return kept[i].Dir < kept[j].Dir
+	})
+	data, err = json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.WriteFile(ctx, File, data); err != nil {
+		return fmt.Errorf("writing %s: %w", File, err)
+	}
+	return nil
+}
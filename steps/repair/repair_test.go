@@ -0,0 +1,44 @@
+package repair_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/repair"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordOrderIsStable(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewLocal(t.TempDir())
+	broken := errors.New("unexpected end of JSON input")
+
+	require.NoError(t, repair.Record(ctx, s, "uploader", []repair.Entry{
+		repair.NewEntry("uploader", "b", broken),
+		repair.NewEntry("uploader", "a", broken),
+	}))
+	require.NoError(t, repair.Record(ctx, s, "crawler", []repair.Entry{
+		repair.NewEntry("crawler", "c", broken),
+	}))
+
+	data, err := s.ReadFile(ctx, repair.File)
+	require.NoError(t, err)
+	var list []repair.Entry
+	require.NoError(t, json.Unmarshal(data, &list))
+
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Step+":"+e.Dir)
+	}
+	assert.Equal(t, []string{"crawler:c", "uploader:a", "uploader:b"}, got)
+
+	// clearing every step removes the file
+	require.NoError(t, repair.Record(ctx, s, "crawler", nil))
+	require.NoError(t, repair.Record(ctx, s, "uploader", nil))
+	_, err = s.ReadFile(ctx, repair.File)
+	assert.Error(t, err)
+}
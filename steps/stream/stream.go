@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/crawler"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+)
+
+// Step crawls and uploads at the same time: each document the crawler saves
+// is handed to the uploader over a bounded channel, overlapping downloads
+// with uploads instead of waiting for the whole crawl to finish
+type Step struct {
+	crawler  *crawler.Crawler
+	uploader *uploader.Uploader
+	// Saved directories waiting for the uploader before the crawl pauses
+	buffer int
+}
+
+// NewStep streams c's output to u, buffering up to buffer directories
+func NewStep(c *crawler.Crawler, u *uploader.Uploader, buffer int) *Step {
+	return &Step{crawler: c, uploader: u, buffer: buffer}
+}
+
+// Name implements the Step interface
+func (s *Step) Name() string {
+	return "stream"
+}
+
+// Stats is what a streamed run did on each side
+type Stats struct {
+	Crawler  any `json:"crawler"`
+	Uploader any `json:"uploader"`
+}
+
+// Stats returns the crawler's and uploader's statistics of the last run
+func (s *Step) Stats() any {
+	return Stats{Crawler: s.crawler.Stats(), Uploader: s.uploader.Stats()}
+}
+
+// Run crawls and uploads concurrently. A failing upload stops the crawl; a
+// failing crawl still uploads everything saved before it stopped.
+func (s *Step) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dirs := make(chan string, s.buffer)
+	crawled := make(chan error, 1)
+	go func() {
+		crawled <- s.crawler.RunStreaming(ctx, dirs)
+	}()
+
+	if err := s.uploader.Stream(ctx, dirs); err != nil {
+		cancel()
+		<-crawled
+		return fmt.Errorf("uploading: %w", err)
+	}
+	if err := <-crawled; err != nil {
+		return fmt.Errorf("crawling: %w", err)
+	}
+	return nil
+}
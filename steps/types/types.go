@@ -3,18 +3,245 @@ package types
 import "time"
 
 type Metadata struct {
-	Title      string    `json:"title"`
-	ID         string    `json:"id"`
-	SourceURL  string    `json:"source_url"`
-	Depth      int       `json:"depth"`
-	Type       string    `json:"type"`
-	CrawledAt  time.Time `json:"crawled_at"`
-	IsRedirect bool      `json:"is_redirect,omitempty"`
-	RedirectTo string    `json:"redirect_to,omitempty"`
+	Title     string `json:"title"`
+	ID        string `json:"id"`
+	SourceURL string `json:"source_url"`
+	// Depth counts the links followed from the start document, which is 0
+	Depth int `json:"depth"`
+	// DiscoveredBy is the canonical key ("doc:<id>") of the document whose
+	// link led here; empty for the start document
+	DiscoveredBy string    `json:"discovered_by,omitempty"`
+	Type         string    `json:"type"`
+	CrawledAt    time.Time `json:"crawled_at"`
+	IsRedirect   bool      `json:"is_redirect,omitempty"`
+	// RedirectTo is the target's directory relative to the redirect's parent
+	// at crawl time; it goes stale when directories are moved
+	RedirectTo string `json:"redirect_to,omitempty"`
+	// RedirectKey is the canonical key ("doc:<id>") of the redirect's target
+	RedirectKey string `json:"redirect_key,omitempty"`
+	// RedirectDriveID is the ID of the target's uploaded copy, set by the uploader
+	RedirectDriveID string `json:"redirect_drive_id,omitempty"`
+
+	// LinkedForm is the URL of the Google Form whose responses this sheet collects
+	LinkedForm string `json:"linked_form,omitempty"`
+	// SelfLinks are the document's links to itself (table of contents,
+	// cross-references); they are not crawled
+	SelfLinks []string `json:"self_links,omitempty"`
+	// LinksTo are the canonical keys ("doc:<id>") of the other documents the
+	// document links to, each once, in link order
+	LinksTo []string `json:"links_to,omitempty"`
+
+	// Language is the ISO 639-1 code of the document's primary language
+	Language string `json:"language,omitempty"`
+
+	// Size of the document's text; Pages is estimated for docs only
+	Words      int `json:"words,omitempty"`
+	Characters int `json:"characters,omitempty"`
+	Pages      int `json:"pages,omitempty"`
+
+	// SourceEncoding is the character encoding a sheet's CSV export arrived
+	// in; the saved file is always UTF-8 without BOM
+	SourceEncoding string `json:"source_encoding,omitempty"`
+	// CSVDelimiter separates the saved CSV's fields when it isn't a comma
+	CSVDelimiter string `json:"csv_delimiter,omitempty"`
+
+	// ContentFile names the document's export within its directory; empty
+	// in metadata written before content names were configurable
+	ContentFile string `json:"content_file,omitempty"`
+	// Format is the export format of ContentFile when it isn't the type's
+	// default (see DefaultFormats)
+	Format string `json:"format,omitempty"`
+	// HTMLFile names the HTML export of a doc saved in another Format, which
+	// links, title and text are read from
+	HTMLFile string `json:"html_file,omitempty"`
+	// Tabs are the worksheets of a sheet saved one CSV each
+	Tabs []Tab `json:"tabs,omitempty"`
+	// Forms are the Google Forms a doc links to
+	Forms []Form `json:"forms,omitempty"`
+
+	// Checksums maps each saved content file, relative to the document's
+	// directory, to its hex SHA-256
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// ModifiedTime is the source's Drive modifiedTime (RFC 3339) when an
+	// incremental crawl last saw it
+	ModifiedTime string `json:"modified_time,omitempty"`
+	// Change is how an incremental crawl found the document compared to the
+	// previous run: ChangeNew, ChangeModified or ChangeUnchanged
+	Change string `json:"change,omitempty"`
+}
+
+// Changes an incremental crawl records in Metadata.Change
+const (
+	ChangeNew       = "new"
+	ChangeModified  = "modified"
+	ChangeUnchanged = "unchanged"
+)
+
+// Tab is a worksheet of a spreadsheet saved as its own CSV
+type Tab struct {
+	Title string `json:"title"`
+	// SheetID is the worksheet's gid
+	SheetID int64 `json:"sheet_id"`
+	// File names the saved CSV within the document's directory
+	File string `json:"file"`
+}
+
+// Form is a Google Form a document links to
+type Form struct {
+	// ID is the form's file ID; empty for published links, which only
+	// carry a responder token
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url"`
+	// Title is empty when neither the Forms API, Drive nor the form's
+	// public page gave it
+	Title string `json:"title,omitempty"`
+	// ResponseSheet is the URL of the spreadsheet collecting the form's
+	// responses, when the Forms API could tell
+	ResponseSheet string `json:"response_sheet,omitempty"`
+}
+
+// DefaultFormats are the export formats of each document type unless
+// configured otherwise
+var DefaultFormats = map[string]string{
+	"doc":   "html",
+	"sheet": "csv",
+}
+
+// legacyContentFiles are the content file names used before ContentFile was recorded
+var legacyContentFiles = map[string]string{
+	"doc":   "content.html",
+	"sheet": "content.csv",
+}
+
+// ContentFileName returns the name of the document's export within its
+// directory, or "" for an unsupported type
+func (m *Metadata) ContentFileName() string {
+	if m.ContentFile != "" {
+		return m.ContentFile
+	}
+	return legacyContentFiles[m.Type]
+}
+
+// ExportFormat returns the format of the document's content file
+func (m *Metadata) ExportFormat() string {
+	if m.Format != "" {
+		return m.Format
+	}
+	return DefaultFormats[m.Type]
+}
+
+// TextFileName returns the saved file later steps read the document's
+// text and links from: a doc's HTML export or a sheet's CSV. It is "" for
+// a sheet saved in a binary format.
+func (m *Metadata) TextFileName() string {
+	if m.HTMLFile != "" {
+		return m.HTMLFile
+	}
+	switch m.ExportFormat() {
+	case "html", "csv":
+		return m.ContentFileName()
+	}
+	return ""
 }
 
 type Links struct {
-	Link   string
+	Link string
+	// Depth is one more than the depth of the document the link was found in
 	Depth  int
 	Parent string
+	// DiscoveredBy is the canonical key of the document the link was found in
+	DiscoveredBy string
+
+	// ID identifies the link's queue entry in a shared crawl frontier
+	ID int64
+	// Form is set when the link is a form's response sheet rather than a hyperlink
+	Form string
+}
+
+// AccessRequest records a linked document the crawler wasn't allowed to read
+type AccessRequest struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Status is the HTTP status of the refused export: 401, 403, or none
+	// when Google redirected to its sign-in page
+	Status     int    `json:"status,omitempty"`
+	LinkedFrom string `json:"linked_from"`
+	// AlsoLinkedFrom are the other documents linking to it
+	AlsoLinkedFrom []string  `json:"also_linked_from,omitempty"`
+	Title          string    `json:"title,omitempty"`
+	Owners         []Owner   `json:"owners,omitempty"`
+	FoundAt        time.Time `json:"found_at"`
+}
+
+// InaccessibleDoc is an inaccessible.json entry: a linked document whose
+// export Google refused, and the documents that link to it
+type InaccessibleDoc struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Status is the HTTP status of the refused export, as in AccessRequest
+	Status     int        `json:"status,omitempty"`
+	ReferredBy []Referrer `json:"referred_by"`
+}
+
+// Referrer is a crawled document linking to an inaccessible one
+type Referrer struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Dir is the referrer's directory in the crawl output
+	Dir string `json:"dir"`
+}
+
+// SkippedDocument records a linked document the owner or link filter left
+// out
+type SkippedDocument struct {
+	ID         string  `json:"id"`
+	Type       string  `json:"type"`
+	URL        string  `json:"url"`
+	LinkedFrom string  `json:"linked_from"`
+	Title      string  `json:"title,omitempty"`
+	Owners     []Owner `json:"owners,omitempty"`
+	// Reason says why the document didn't pass the filter
+	Reason string `json:"reason"`
+}
+
+// Sharing states of a document in the sharing report
+const (
+	VisibilityPublic     = "public"
+	VisibilityDomain     = "domain"
+	VisibilityRestricted = "restricted"
+)
+
+// SharingEntry records who can see a discovered document
+type SharingEntry struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Dir is where the document was saved; empty if it couldn't be read
+	Dir string `json:"dir,omitempty"`
+	// Visibility is public (anyone with the link), domain or restricted
+	Visibility string `json:"visibility"`
+	// Domains the document is shared with as a whole
+	Domains []string `json:"domains,omitempty"`
+	// External lists users and groups outside the owners' domains with
+	// access, as "email (role)"
+	External []string `json:"external,omitempty"`
+	// PermissionsListed is false when the credentials couldn't read the
+	// permissions and the visibility was inferred from the crawl
+	PermissionsListed bool `json:"permissions_listed"`
+}
+
+// Owner identifies the owner of a Drive file
+type Owner struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Revision is one entry of a document's editing history
+type Revision struct {
+	ID           string    `json:"id"`
+	ModifiedTime time.Time `json:"modified_time"`
+	Author       Owner     `json:"author,omitzero"`
 }
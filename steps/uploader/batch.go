@@ -0,0 +1,51 @@
+package uploader
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// grantBatch caps the permission grants in flight at once. The Go Drive
+// client has no batch endpoint, so grants are sent concurrently instead;
+// the limiter still paces each one.
+const grantBatch = 8
+
+// grant is one permission to create on a Drive file
+type grant struct {
+	fileID string
+	perm   *drive.Permission
+	// notify lets Drive email the people and groups granted access
+	notify bool
+}
+
+// createPermissions sends grants, up to grantBatch at a time, and returns
+// the error of each, in order
+func (u *Uploader) createPermissions(ctx context.Context, grants []grant) []error {
+	errs := make([]error, len(grants))
+	sem := make(chan struct{}, grantBatch)
+	var wg sync.WaitGroup
+	for i, g := range grants {
+		if err := u.limiter.Wait(ctx); err != nil {
+			errs[i] = err
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			call := u.driveService.Permissions.Create(g.fileID, g.perm).
+				SupportsAllDrives(true).
+				Context(ctx)
+			if !g.notify && (g.perm.Type == "user" || g.perm.Type == "group") {
+				// Drive only notifies people, and migrations shouldn't
+				call = call.SendNotificationEmail(false)
+			}
+			_, errs[i] = call.Do()
+		}()
+	}
+	wg.Wait()
+	return errs
+}
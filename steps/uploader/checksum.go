@@ -0,0 +1,35 @@
+package uploader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// verifyChecksums checks every file of dir recorded in the metadata against
+// its checksum, so content corrupted or altered on disk since the crawl
+// never reaches Drive. Exports crawled before checksums were recorded pass.
+func (u *Uploader) verifyChecksums(ctx context.Context, dir string, metadata *types.Metadata) error {
+	names := make([]string, 0, len(metadata.Checksums))
+	for name := range metadata.Checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := u.store.ReadFile(ctx, path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != metadata.Checksums[name] {
+			return fmt.Errorf("checksum mismatch for %s: recorded %s, found %s", name, metadata.Checksums[name], got)
+		}
+	}
+	return nil
+}
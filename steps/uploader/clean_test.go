@@ -0,0 +1,36 @@
+package uploader_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanHTMLUploadsCleanedExport(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+
+	out := t.TempDir()
+	export := `<html><head><style>.c1{font-weight:700}</style></head><body><h1 class="c1"></h1>` +
+		`<p><span class="c1">Hi</span> <a href="https://www.google.com/url?q=https://example.com/&amp;sa=D">site</a></p></body></html>`
+	writeDoc(t, out, "handbook-1AbC", types.Metadata{ID: "1AbC", Type: "doc", Title: "Handbook"}, export)
+
+	u := newUploader(t, google, out, uploader.WithCleanHTML())
+	require.NoError(t, u.Run(context.Background()))
+
+	files := google.Files()
+	require.Len(t, files, 2)
+	assert.Equal(t, `<html><head></head><body><p><strong>Hi</strong> <a href="https://example.com/">site</a></p></body></html>`,
+		string(files[1].Content))
+	// the crawl output is left as exported
+	saved, err := os.ReadFile(filepath.Join(out, "handbook-1AbC", "content.html"))
+	require.NoError(t, err)
+	assert.Equal(t, export, string(saved))
+}
@@ -0,0 +1,25 @@
+package uploader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"unicode/utf8"
+)
+
+// commaSeparated rewrites a CSV whose fields are separated by delimiter
+// with commas, the only separator Drive's CSV import understands
+func commaSeparated(content []byte, delimiter string) ([]byte, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma, _ = utf8.DecodeRuneInString(delimiter)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package uploader
+
+import (
+	"context"
+	"log/slog"
+	"path"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// WithDryRun lists the folders and files the uploader would create in r
+// instead of creating them. Drive is still searched for existing folders and
+// copies; nothing is shared, replaced or written to id_map.json.
+func WithDryRun(r *dryrun.Report) Option {
+	return func(u *Uploader) {
+		u.dryRun = r
+	}
+}
+
+// planFolder records a folder that doesn't exist yet and returns its
+// placeholder ID
+func (u *Uploader) planFolder(name, parentID string) string {
+	id := u.dryRun.AddFolder(dryrun.Folder{Name: name, Parent: parentID})
+	slog.Info("dry run: would create drive folder", slog.String("name", name))
+	return id
+}
+
+// planUpload records the file uploadFile would create and returns its
+// placeholder ID. The content is only checked and measured: re-hosting
+// images would upload them.
+func (u *Uploader) planUpload(ctx context.Context, filePath string, metadata *types.Metadata, parentID string) (string, error) {
+	if err := u.verifyChecksums(ctx, path.Dir(filePath), metadata); err != nil {
+		return "", err
+	}
+	content, err := u.store.ReadFile(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	id := u.dryRun.AddUpload(metadata.Type+":"+metadata.ID, dryrun.Upload{
+		Title:    metadata.Title,
+		Type:     metadata.Type,
+		MimeType: u.mimeTypes[metadata.Type],
+		SourceID: metadata.ID,
+		Parent:   parentID,
+		Bytes:    int64(len(content)),
+	})
+	slog.Info("dry run: would upload file",
+		slog.String("type", metadata.Type),
+		slog.String("title", metadata.Title),
+		slog.Int("bytes", len(content)))
+	return id, nil
+}
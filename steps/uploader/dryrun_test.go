@@ -0,0 +1,41 @@
+package uploader_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunCreatesNothing(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+
+	out := t.TempDir()
+	writeDoc(t, out, "handbook-1AbC", types.Metadata{ID: "1AbC", Type: "doc", Title: "Handbook"}, "<p>hi</p>")
+
+	report := dryrun.New()
+	u := newUploader(t, google, out,
+		uploader.WithSubfolder("run-{runID}", "r1"),
+		uploader.WithDryRun(report))
+	require.NoError(t, u.Run(context.Background()))
+
+	assert.Zero(t, google.Writes())
+	assert.Equal(t, []dryrun.Folder{
+		{Name: "Imported Docs"},
+		{Name: "run-r1", Parent: dryrun.Placeholder("folder-Imported Docs")},
+	}, report.Folders)
+	require.Len(t, report.Uploads, 1)
+	assert.Equal(t, "Handbook", report.Uploads[0].Title)
+	assert.EqualValues(t, 9, report.Uploads[0].Bytes)
+	assert.Equal(t, map[string]string{"doc:1AbC": dryrun.Placeholder("1AbC")}, report.IDMap())
+
+	assert.NoFileExists(t, filepath.Join(out, "id_map.json"))
+	assert.FileExists(t, filepath.Join(out, dryrun.File))
+}
@@ -0,0 +1,186 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Duplicate policies for documents that already have a copy in the destination
+const (
+	// DuplicateCreate always uploads a new copy
+	DuplicateCreate = "create"
+	// DuplicateSkip keeps the existing copy and uploads nothing
+	DuplicateSkip = "skip"
+	// DuplicateReplace overwrites the existing copy's content in place
+	DuplicateReplace = "replace"
+	// DuplicateVersion uploads a new copy named "<title> (vN)"
+	DuplicateVersion = "version"
+)
+
+// duplicateAliases are the -on-existing names of duplicate policies
+var duplicateAliases = map[string]string{
+	"update":    DuplicateReplace,
+	"duplicate": DuplicateCreate,
+}
+
+// ValidDuplicatePolicy reports whether p is a known duplicate policy or an
+// alias of one
+func ValidDuplicatePolicy(p string) bool {
+	if _, ok := duplicateAliases[p]; ok {
+		return true
+	}
+	switch p {
+	case DuplicateCreate, DuplicateSkip, DuplicateReplace, DuplicateVersion:
+		return true
+	}
+	return false
+}
+
+// WithDuplicatePolicy sets what happens when a document already has a copy
+// in the destination folder
+func WithDuplicatePolicy(p string) Option {
+	return func(u *Uploader) {
+		if policy, ok := duplicateAliases[p]; ok {
+			p = policy
+		}
+		u.duplicates = p
+	}
+}
+
+// recordedCopy returns the copy id_map.json recorded for key in an earlier
+// run, or nil when there is none or it has since been deleted or trashed
+func (u *Uploader) recordedCopy(ctx context.Context, key string) (*drive.File, error) {
+	id := u.previousIDs[key]
+	if id == "" || dryrun.IsPlaceholder(id) {
+		return nil, nil
+	}
+	if err := u.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	f, err := u.driveService.Files.Get(id).
+		Fields("id, name, trashed").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up recorded copy: %w", err)
+	}
+	if f.Trashed {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// findExisting returns the copies of a document already in the destination
+// folder: those tagged with its source appProperties, or failing that those
+// of the same type carrying its title. The oldest copy comes first.
+func (u *Uploader) findExisting(ctx context.Context, metadata *types.Metadata, parentID string) ([]*drive.File, error) {
+	if dryrun.IsPlaceholder(parentID) {
+		return nil, nil
+	}
+	scope := "trashed=false"
+	if parentID != "" {
+		scope += fmt.Sprintf(" and '%s' in parents", parentID)
+	}
+
+	queries := []string{
+		fmt.Sprintf("appProperties has { key='%s' and value='%s' } and appProperties has { key='%s' and value='%s' } and %s",
+			PropSourceID, quote(metadata.ID), PropSourceType, quote(metadata.Type), scope),
+		fmt.Sprintf("name='%s' and mimeType='%s' and %s",
+			quote(metadata.Title), u.mimeTypes[metadata.Type], scope),
+	}
+
+	for _, q := range queries {
+		if err := u.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		r, err := u.driveService.Files.List().
+			Q(q).
+			Fields("files(id, name)").
+			OrderBy("createdTime").
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return nil, fmt.Errorf("searching for existing copies: %w", err)
+		}
+		if len(r.Files) > 0 {
+			return r.Files, nil
+		}
+	}
+	return nil, nil
+}
+
+// uploadWithPolicy uploads the document in dir, applying the duplicate policy
+// when it already has a copy: the one id_map.json recorded in an earlier
+// run, or failing that one found in the destination. It returns the ID of
+// the copy links should point at and whether a new file was created.
+func (u *Uploader) uploadWithPolicy(ctx context.Context, dir, filePath string, metadata *types.Metadata, parentID string) (string, bool, error) {
+	if u.duplicates == "" || u.duplicates == DuplicateCreate {
+		id, err := u.uploadFile(ctx, filePath, metadata, parentID)
+		return id, err == nil, err
+	}
+
+	var existing []*drive.File
+	if u.duplicates != DuplicateVersion {
+		// versions are numbered by every copy in the folder
+		recorded, err := u.recordedCopy(ctx, metadata.Type+":"+metadata.ID)
+		if err != nil {
+			return "", false, err
+		}
+		if recorded != nil {
+			existing = []*drive.File{recorded}
+		}
+	}
+	if existing == nil {
+		var err error
+		if existing, err = u.findExisting(ctx, metadata, parentID); err != nil {
+			return "", false, err
+		}
+	}
+	if len(existing) == 0 {
+		id, err := u.uploadFile(ctx, filePath, metadata, parentID)
+		return id, err == nil, err
+	}
+
+	latest := existing[len(existing)-1]
+	switch u.duplicates {
+	case DuplicateSkip:
+		slog.Info("keeping existing copy",
+			slog.String("title", metadata.Title),
+			slog.String("id", latest.Id))
+		return latest.Id, false, nil
+
+	case DuplicateReplace:
+		if err := u.UpdateFile(ctx, dir, latest.Id); err != nil {
+			return "", false, err
+		}
+		return latest.Id, false, nil
+
+	case DuplicateVersion:
+		versioned := *metadata
+		versioned.Title = fmt.Sprintf("%s (v%d)", metadata.Title, len(existing)+1)
+		id, err := u.uploadFile(ctx, filePath, &versioned, parentID)
+		return id, err == nil, err
+	}
+	return "", false, fmt.Errorf("unknown duplicate policy %q", u.duplicates)
+}
+
+// quote escapes a value for use inside a quoted Drive query string
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -0,0 +1,44 @@
+package uploader_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordedCopiesAreReusedOnRerun(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	// copy-b was deleted since the last run
+	google.AddFile(fakegoogle.File{ID: "copy-a", Name: "A"})
+
+	out := t.TempDir()
+	for _, id := range []string{"a", "b"} {
+		writeDoc(t, out, id, types.Metadata{ID: id, Type: "sheet", Title: strings.ToUpper(id)}, "a,b\n")
+	}
+	idMap, err := json.Marshal(map[string]string{"sheet:a": "copy-a", "sheet:b": "copy-b"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(out, "id_map.json"), idMap, 0o644))
+
+	u := newUploader(t, google, out, uploader.WithDuplicatePolicy("update"))
+	require.NoError(t, u.Run(context.Background()))
+
+	files := google.Files()
+	require.Len(t, files, 3, "copy-a, the folder and a new copy of b")
+	assert.Equal(t, 1, files[0].Revisions)
+	assert.Equal(t, "B", files[2].Name)
+	data, err := os.ReadFile(filepath.Join(out, "id_map.json"))
+	require.NoError(t, err)
+	var got map[string]string
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, map[string]string{"sheet:a": "copy-a", "sheet:b": files[2].ID}, got)
+}
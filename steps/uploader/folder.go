@@ -0,0 +1,179 @@
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// rootPlaceholders are the folder template fields taken from the start
+// document's metadata
+var rootPlaceholders = []string{"{root-title}", "{root-id}", "{root-type}"}
+
+// WithRunID names the run {runID} stands for in folder templates
+func WithRunID(runID string) Option {
+	return func(u *Uploader) {
+		u.runID = runID
+	}
+}
+
+// FolderName expands a Drive folder template: {date} (2006-01-02), {time}
+// (150405), {runID}, and {root-title}, {root-id} and {root-type} from the
+// start document's metadata. root may be nil when the template doesn't
+// use it.
+func FolderName(template, runID string, t time.Time, root *types.Metadata) string {
+	var title, id, docType string
+	if root != nil {
+		title, id, docType = root.Title, root.ID, root.Type
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	return strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+		"{runID}", runID,
+		"{root-title}", strings.TrimSpace(title),
+		"{root-id}", id,
+		"{root-type}", docType,
+	).Replace(template)
+}
+
+// FolderPath expands a folder template that may name a path of nested
+// folders, e.g. "Migrations/{date}/Q3". Each "/"-separated segment is
+// expanded with FolderName, so a title containing a slash stays one folder;
+// empty segments are dropped.
+func FolderPath(template, runID string, t time.Time, root *types.Metadata) []string {
+	var segments []string
+	for _, seg := range strings.Split(template, "/") {
+		if name := strings.TrimSpace(FolderName(seg, runID, t, root)); name != "" {
+			segments = append(segments, name)
+		}
+	}
+	return segments
+}
+
+// usesRoot reports whether a folder template needs the start document
+func usesRoot(template string) bool {
+	return slices.ContainsFunc(rootPlaceholders, func(p string) bool {
+		return strings.Contains(template, p)
+	})
+}
+
+// resolveFolders expands the folder and subfolder templates for this run
+func (u *Uploader) resolveFolders(ctx context.Context) {
+	var root *types.Metadata
+	if usesRoot(u.driveFolder) || usesRoot(u.subfolder) {
+		var err error
+		if root, err = u.rootMetadata(ctx); err != nil {
+			slog.Warn("start document not found for folder template", slog.Any("error", err))
+		}
+	}
+	now := time.Now()
+	u.folderPath = FolderPath(u.driveFolder, u.runID, now, root)
+	u.subfolderPath = FolderPath(u.subfolder, u.runID, now, root)
+	u.resolved = true
+}
+
+// destFolder returns the expanded Drive folder path, resolving it outside a
+// run (re-uploads for a patcher resumed on its own)
+func (u *Uploader) destFolder(ctx context.Context) []string {
+	if !u.resolved {
+		u.resolveFolders(ctx)
+	}
+	return u.folderPath
+}
+
+// createDrivePath returns the ID of the innermost folder of path inside
+// parentID (or My Drive), creating each folder along it that doesn't exist
+// yet. An empty path is parentID itself.
+func (u *Uploader) createDrivePath(ctx context.Context, path []string, parentID string) (string, error) {
+	for _, name := range path {
+		var err error
+		if parentID, err = u.createDriveFolder(ctx, name, parentID); err != nil {
+			return "", err
+		}
+	}
+	return parentID, nil
+}
+
+// rootMetadata loads the metadata of the start document: the top-level
+// directory's document that no other document led to
+func (u *Uploader) rootMetadata(ctx context.Context) (*types.Metadata, error) {
+	names, err := u.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if path.Base(name) != "metadata.json" || strings.Count(name, "/") != 1 {
+			continue
+		}
+		data, err := u.store.ReadFile(ctx, name)
+		if err != nil {
+			continue
+		}
+		var m types.Metadata
+		if err := json.Unmarshal(data, &m); err != nil || m.IsRedirect || m.DiscoveredBy != "" {
+			continue
+		}
+		return &m, nil
+	}
+	return nil, fmt.Errorf("no start document in %s", u.store.String())
+}
+
+// counted passes dirs on, counting each as found as the crawl delivers it
+func counted(ctx context.Context, dirs <-chan string, c *progress.Counter) <-chan string {
+	if c == nil {
+		return dirs
+	}
+	out := make(chan string, cap(dirs))
+	go func() {
+		defer close(out)
+		for dir := range dirs {
+			c.Found(1)
+			select {
+			case out <- dir:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// afterFirst waits until dirs delivers its first directory (or closes) and
+// returns a channel delivering everything dirs does, that one included
+func afterFirst(ctx context.Context, dirs <-chan string) <-chan string {
+	var first string
+	ok := false
+	select {
+	case first, ok = <-dirs:
+	case <-ctx.Done():
+	}
+	out := make(chan string, cap(dirs)+1)
+	if !ok {
+		close(out)
+		return out
+	}
+	out <- first
+	go func() {
+		defer close(out)
+		for dir := range dirs {
+			select {
+			case out <- dir:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
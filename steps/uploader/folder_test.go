@@ -0,0 +1,56 @@
+package uploader_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderName(t *testing.T) {
+	at := time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+	root := &types.Metadata{ID: "1AbC", Type: "doc", Title: " Team Handbook "}
+
+	assert.Equal(t, "Team Handbook import 2025-03-14",
+		uploader.FolderName("{root-title} import {date}", "r1", at, root))
+	assert.Equal(t, "doc-1AbC-092653-r1",
+		uploader.FolderName("{root-type}-{root-id}-{time}-{runID}", "r1", at, root))
+	assert.Equal(t, "Untitled import", uploader.FolderName("{root-title} import", "r1", at, nil))
+	assert.Equal(t, "Imported Docs", uploader.FolderName("Imported Docs", "r1", at, nil))
+}
+
+func TestFolderPath(t *testing.T) {
+	at := time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+	root := &types.Metadata{ID: "1AbC", Type: "doc", Title: "Q3/Q4 plan"}
+
+	assert.Equal(t, []string{"Migrations", "2025-03-14", "Q3/Q4 plan"},
+		uploader.FolderPath("Migrations/ {date} //{root-title}", "r1", at, root))
+	assert.Equal(t, []string{"Imported Docs"}, uploader.FolderPath("Imported Docs", "r1", at, nil))
+	assert.Empty(t, uploader.FolderPath("", "r1", at, nil))
+}
+
+func TestRunCreatesEachFolderOfThePath(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+
+	u, err := uploader.NewUploader(context.Background(), "", "Team's Docs/2024/Q3", t.TempDir(),
+		uploader.WithClientOptions(google.ClientOptions()...))
+	require.NoError(t, err)
+	require.NoError(t, u.Run(context.Background()))
+
+	created := google.Files()
+	require.Len(t, created, 3)
+	assert.Equal(t, "Team's Docs", created[0].Name)
+	assert.Nil(t, created[0].Parents)
+	assert.Equal(t, "2024", created[1].Name)
+	assert.Equal(t, []string{created[0].ID}, created[1].Parents)
+	assert.Equal(t, []string{created[1].ID}, created[2].Parents)
+	queries := google.Searches()
+	assert.Contains(t, queries[0], `name='Team\'s Docs'`)
+	assert.Contains(t, queries[2], `name='Q3' and trashed=false and '`+created[1].ID+`' in parents`)
+}
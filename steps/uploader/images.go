@@ -0,0 +1,302 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"google.golang.org/api/drive/v3"
+)
+
+// ImageAssetsFile records, per document, which Drive file each image was
+// re-uploaded to
+const ImageAssetsFile = "image_assets.json"
+
+// imageFolderName is the folder inside the Drive folder holding re-uploaded images
+const imageFolderName = "assets"
+
+// maxImageSize caps the images downloaded for re-upload
+const maxImageSize = 25 << 20
+
+// PropImageHash is the appProperty holding a re-uploaded image's SHA-256
+const PropImageHash = "gdoc_image_sha256"
+
+// driveImageURL serves a Drive file as an image to those it is shared with
+const driveImageURL = "https://drive.google.com/uc?export=view&id=%s"
+
+// WithImageAssets re-uploads the images of docs to Drive before uploading
+// the docs themselves, and points the docs at those copies, so images don't
+// depend on googleusercontent URLs that eventually expire. The copies only
+// carry the Drive folder's sharing unless WithPublicImages is set too.
+func WithImageAssets() Option {
+	return func(u *Uploader) {
+		u.imageAssets = true
+	}
+}
+
+// WithPublicImages shares every image WithImageAssets re-uploads with anyone
+// holding the link, so Docs can fetch it anonymously on import. Images of
+// restricted docs become readable by anyone who finds their link.
+func WithPublicImages() Option {
+	return func(u *Uploader) {
+		u.publicImages = true
+	}
+}
+
+// rewriteImages uploads every image of a doc's HTML to the Drive assets
+// folder and returns the HTML with each <img> pointing at its Drive copy.
+// Images that can't be fetched keep their original source.
+func (u *Uploader) rewriteImages(ctx context.Context, dir string, content []byte) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+
+	var imgs []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			imgs = append(imgs, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	if len(imgs) == 0 {
+		return content, nil
+	}
+
+	// the rewritten sources, to restore those whose image can't be shared
+	type rewrite struct {
+		attr    *html.Attribute
+		src, id string
+	}
+	var rewrites []rewrite
+	assets := make(map[string]string)
+	for _, img := range imgs {
+		for i := range img.Attr {
+			if img.Attr[i].Key != "src" || strings.HasPrefix(img.Attr[i].Val, "data:") {
+				continue
+			}
+			src := img.Attr[i].Val
+
+			id, ok := assets[src]
+			if !ok {
+				id, err = u.uploadImage(ctx, dir, src)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					slog.Warn("re-uploading image failed, keeping original",
+						slog.String("dir", dir),
+						slog.String("src", src),
+						slog.Any("error", err))
+					continue
+				}
+				assets[src] = id
+			}
+			img.Attr[i].Val = fmt.Sprintf(driveImageURL, id)
+			rewrites = append(rewrites, rewrite{attr: &img.Attr[i], src: src, id: id})
+		}
+	}
+
+	if unshared := u.shareImages(ctx); len(unshared) > 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for _, r := range rewrites {
+			if unshared[r.id] {
+				r.attr.Val = r.src
+				delete(assets, r.src)
+			}
+		}
+	}
+
+	if len(assets) > 0 {
+		data, err := json.MarshalIndent(assets, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := u.store.WriteFile(ctx, path.Join(dir, ImageAssetsFile), data); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", ImageAssetsFile, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, fmt.Errorf("rendering HTML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// uploadImage stores one image in the Drive assets folder and returns its
+// file ID. Identical images, across docs and runs, share one Drive file.
+func (u *Uploader) uploadImage(ctx context.Context, dir, src string) (string, error) {
+	data, err := u.readImage(ctx, dir, src)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if id, ok := u.images[hash]; ok {
+		return id, nil
+	}
+
+	folderID, err := u.imageFolderID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// an earlier run may have uploaded the same image already
+	if err := u.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	r, err := u.driveService.Files.List().
+		Q(fmt.Sprintf("appProperties has { key='%s' and value='%s' } and '%s' in parents and trashed=false",
+			PropImageHash, hash, folderID)).
+		Fields("files(id)").
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("searching for image: %w", err)
+	}
+	if len(r.Files) > 0 {
+		u.images[hash] = r.Files[0].Id
+		return r.Files[0].Id, nil
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("not an image: %s", contentType)
+	}
+
+	if err := u.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	created, err := u.driveService.Files.Create(&drive.File{
+		Name:          hash[:16] + imageExt(contentType),
+		Parents:       []string{folderID},
+		AppProperties: map[string]string{PropImageHash: hash},
+	}).
+		Media(bytes.NewReader(data), u.media(contentType)...).
+		Fields("id").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("uploading image: %w", err)
+	}
+
+	if u.publicImages {
+		// shared with the doc's other new images by shareImages
+		u.unshared = append(u.unshared, hash)
+	}
+
+	u.images[hash] = created.Id
+	slog.Info("uploaded image",
+		slog.String("src", src),
+		slog.String("id", created.Id))
+	return created.Id, nil
+}
+
+// shareImages shares the images uploaded since the last call with anyone
+// holding the link, as Docs import fetches them anonymously. It returns the
+// IDs of the images it couldn't share, which are forgotten so a later doc
+// uploads them again.
+func (u *Uploader) shareImages(ctx context.Context) map[string]bool {
+	grants := make([]grant, len(u.unshared))
+	for i, hash := range u.unshared {
+		grants[i] = grant{fileID: u.images[hash], perm: &drive.Permission{Type: "anyone", Role: "reader"}}
+	}
+
+	var failed map[string]bool
+	for i, err := range u.createPermissions(ctx, grants) {
+		if err == nil {
+			continue
+		}
+		if failed == nil {
+			failed = make(map[string]bool)
+		}
+		id := grants[i].fileID
+		failed[id] = true
+		delete(u.images, u.unshared[i])
+		slog.Warn("sharing image failed, keeping original",
+			slog.String("id", id),
+			slog.Any("error", err))
+	}
+	u.unshared = nil
+	return failed
+}
+
+// readImage loads an image referenced by a doc: relative sources are files
+// of the doc's output directory (such as -charts assets), the rest are
+// downloaded
+func (u *Uploader) readImage(ctx context.Context, dir, src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return u.store.ReadFile(ctx, path.Join(dir, src))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading image: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxImageSize))
+}
+
+// imageFolderID returns the Drive folder re-uploaded images go to, creating
+// it on first use
+func (u *Uploader) imageFolderID(ctx context.Context) (string, error) {
+	if u.imageFolder != "" {
+		return u.imageFolder, nil
+	}
+
+	parentID, err := u.createDrivePath(ctx, u.destFolder(ctx), "")
+	if err != nil {
+		return "", err
+	}
+	id, err := u.createDriveFolder(ctx, imageFolderName, parentID)
+	if err != nil {
+		return "", err
+	}
+	u.imageFolder = id
+	return id, nil
+}
+
+// imageExt returns the file extension for an image content type
+func imageExt(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
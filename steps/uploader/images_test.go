@@ -0,0 +1,88 @@
+package uploader_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// png is the start of a PNG file, enough to be sniffed as one
+const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+// writeImageDoc saves a crawled doc showing the given images, stored among
+// its assets
+func writeImageDoc(t *testing.T, out string, images ...string) {
+	t.Helper()
+	page := "<html><body>"
+	for _, name := range images {
+		page += `<img src="assets/` + name + `">`
+	}
+	writeDoc(t, out, "doc", types.Metadata{ID: "doc", Type: "doc", Title: "Doc"}, page+"</body></html>")
+	require.NoError(t, os.MkdirAll(filepath.Join(out, "doc", "assets"), 0o755))
+	for _, name := range images {
+		require.NoError(t, os.WriteFile(filepath.Join(out, "doc", "assets", name), []byte(png+name), 0o644))
+	}
+}
+
+func TestImageAssetsAreOnlyPublicWhenAsked(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts   []uploader.Option
+		public bool
+	}{
+		"folder sharing": {opts: []uploader.Option{uploader.WithImageAssets()}},
+		"public":         {opts: []uploader.Option{uploader.WithImageAssets(), uploader.WithPublicImages()}, public: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			google := fakegoogle.New()
+			defer google.Close()
+
+			out := t.TempDir()
+			writeImageDoc(t, out, "chart.png")
+			require.NoError(t, newUploader(t, google, out, tt.opts...).Run(context.Background()))
+
+			grants := google.Grants()
+			if !tt.public {
+				assert.Empty(t, grants)
+				return
+			}
+			require.Len(t, grants, 1)
+			assert.Equal(t, "anyone", grants[0].Permission.Type)
+			assert.Equal(t, "reader", grants[0].Permission.Role)
+		})
+	}
+}
+
+func TestImagesThatCantBeSharedKeepTheirSource(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	google.RefuseGrants(func(f fakegoogle.File) bool {
+		return bytes.HasSuffix(f.Content, []byte("b.png"))
+	})
+
+	out := t.TempDir()
+	writeImageDoc(t, out, "a.png", "b.png")
+	require.NoError(t, newUploader(t, google, out, uploader.WithImageAssets(), uploader.WithPublicImages()).
+		Run(context.Background()))
+
+	var imageA string
+	for _, f := range google.Files() {
+		if bytes.HasSuffix(f.Content, []byte("a.png")) {
+			imageA = f.ID
+		}
+	}
+	require.NotEmpty(t, imageA)
+	data, err := os.ReadFile(filepath.Join(out, "doc", uploader.ImageAssetsFile))
+	require.NoError(t, err)
+	var assets map[string]string
+	require.NoError(t, json.Unmarshal(data, &assets))
+	assert.Equal(t, map[string]string{"assets/a.png": imageA}, assets)
+}
@@ -0,0 +1,67 @@
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+)
+
+// loadIDMap reads the copies recorded by the previous run, if any
+func (u *Uploader) loadIDMap(ctx context.Context) map[string]string {
+	data, err := u.store.ReadFile(ctx, "id_map.json")
+	if err != nil {
+		return nil
+	}
+	var idMap map[string]string
+	if err := json.Unmarshal(data, &idMap); err != nil {
+		slog.Warn("ignoring unreadable id_map.json", slog.Any("error", err))
+		return nil
+	}
+	return idMap
+}
+
+// keepCopy reuses the previous run's copy of a document an incremental crawl
+// found unchanged, or replaces a modified one's content in place so links to
+// it stay valid. ok is false when the document needs a normal upload.
+func (u *Uploader) keepCopy(ctx context.Context, dir, key string, metadata *types.Metadata) (string, bool) {
+	copyID := u.previousIDs[key]
+	if copyID == "" {
+		return "", false
+	}
+	switch metadata.Change {
+	case types.ChangeUnchanged:
+		slog.Info("unchanged since last run, keeping copy",
+			slog.String("title", metadata.Title),
+			slog.String("id", copyID))
+		return copyID, true
+	case types.ChangeModified:
+		if err := u.UpdateFile(ctx, dir, copyID); err != nil {
+			// the copy may have been deleted; upload a new one instead
+			slog.Warn("updating previous copy failed",
+				slog.String("title", metadata.Title),
+				slog.String("id", copyID),
+				slog.Any("error", err))
+			return "", false
+		}
+		return copyID, true
+	}
+	return "", false
+}
+
+// clearChange drops the unchanged mark of a document that got a new copy
+// anyway, since the patcher skips unchanged documents and this copy's links
+// still point at the sources
+func (u *Uploader) clearChange(ctx context.Context, dir string, metadata *types.Metadata) {
+	m := *metadata
+	m.Change = ""
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = u.store.WriteFile(ctx, path.Join(dir, "metadata.json"), data)
+	}
+	if err != nil {
+		slog.Warn("updating metadata failed", slog.String("dir", dir), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,129 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// RedirectIndexTitle names the Doc listing every migrated document
+const RedirectIndexTitle = "Redirect index"
+
+// PropRedirectIndex marks the redirect index so later runs update it in place
+const PropRedirectIndex = "gdoc_redirect_index"
+
+// WithRedirectIndex makes the uploader maintain a Doc in the destination
+// folder that lists every original URL alongside the URL of its copy
+func WithRedirectIndex() Option {
+	return func(u *Uploader) {
+		u.redirectIndex = true
+	}
+}
+
+// indexEntry is one row of the redirect index
+type indexEntry struct {
+	title  string
+	oldURL string
+	newURL string
+}
+
+// newIndexEntry builds the redirect index row for an uploaded document
+func newIndexEntry(metadata *types.Metadata, newID string) indexEntry {
+	kind := "document"
+	if metadata.Type == "sheet" {
+		kind = "spreadsheets"
+	}
+	return indexEntry{
+		title:  metadata.Title,
+		oldURL: metadata.SourceURL,
+		newURL: fmt.Sprintf("https://docs.google.com/%s/d/%s/edit", kind, newID),
+	}
+}
+
+// writeRedirectIndex creates or refreshes the redirect index Doc in folderID
+func (u *Uploader) writeRedirectIndex(ctx context.Context, folderID string, entries []indexEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].title != entries[j].title {
+			return entries[i].title < entries[j].title
+		}
+		return entries[i].oldURL < entries[j].oldURL
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<html><head><meta charset=\"utf-8\"><title>%s</title></head><body>\n", RedirectIndexTitle)
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n<p>Every migrated document, its original URL and the URL of its copy.</p>\n", RedirectIndexTitle)
+	buf.WriteString("<table><tr><th>Title</th><th>Original URL</th><th>New URL</th></tr>\n")
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "<tr><td>%s</td><td><a href=\"%s\">%s</a></td><td><a href=\"%s\">%s</a></td></tr>\n",
+			html.EscapeString(e.title),
+			html.EscapeString(e.oldURL), html.EscapeString(e.oldURL),
+			html.EscapeString(e.newURL), html.EscapeString(e.newURL))
+	}
+	buf.WriteString("</table></body></html>\n")
+
+	q := fmt.Sprintf("appProperties has { key='%s' and value='true' } and trashed=false", PropRedirectIndex)
+	if folderID != "" {
+		q += fmt.Sprintf(" and '%s' in parents", folderID)
+	}
+	if err := u.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	r, err := u.driveService.Files.List().
+		Q(q).
+		Fields("files(id)").
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("searching for redirect index: %w", err)
+	}
+
+	media := googleapi.ContentType("text/html")
+	if err := u.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	if len(r.Files) > 0 {
+		_, err = u.driveService.Files.Update(r.Files[0].Id, &drive.File{}).
+			Media(bytes.NewReader(buf.Bytes()), media).
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return fmt.Errorf("updating redirect index: %w", err)
+		}
+		slog.Info("updated redirect index",
+			slog.String("id", r.Files[0].Id),
+			slog.Int("entries", len(entries)))
+		return nil
+	}
+
+	f := &drive.File{
+		Name:          RedirectIndexTitle,
+		MimeType:      u.mimeTypes["doc"],
+		AppProperties: map[string]string{PropRedirectIndex: "true"},
+	}
+	if folderID != "" {
+		f.Parents = []string{folderID}
+	}
+	created, err := u.driveService.Files.Create(f).
+		Media(bytes.NewReader(buf.Bytes()), media).
+		Fields("id").
+		SupportsAllDrives(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("creating redirect index: %w", err)
+	}
+	slog.Info("created redirect index",
+		slog.String("id", created.Id),
+		slog.Int("entries", len(entries)))
+	return nil
+}
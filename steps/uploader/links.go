@@ -0,0 +1,63 @@
+package uploader
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"golang.org/x/net/html"
+)
+
+// WithLinkRewrite points the links of each doc at the copies of the
+// documents uploaded before it, before Drive converts it, so the patcher
+// only has the links to documents uploaded later left to patch
+func WithLinkRewrite() Option {
+	return func(u *Uploader) {
+		u.linkRewrite = true
+	}
+}
+
+// rewriteLinks points every link of an HTML doc whose target has a copy in
+// idMap at that copy, returning the HTML and the number of links rewritten
+func rewriteLinks(content []byte, idMap map[string]string) ([]byte, int, error) {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rewritten := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for i, a := range n.Attr {
+				if a.Key != "href" {
+					continue
+				}
+				t, ok := gdocs.ParseTarget(a.Val)
+				if !ok {
+					continue
+				}
+				for _, key := range t.Keys() {
+					if newID := idMap[key]; newID != "" {
+						n.Attr[i].Val = fmt.Sprintf("https://docs.google.com/%s/d/%s/edit", gdocs.KindOf(key), newID)
+						rewritten++
+						break
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	if rewritten == 0 {
+		return content, 0, nil
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), rewritten, nil
+}
@@ -0,0 +1,178 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// maxParseExamples caps the mismatching cells logged per sheet
+const maxParseExamples = 5
+
+// WithSheetLocale sets the locale (e.g. "de_DE") and time zone (e.g.
+// "Europe/Berlin") of converted spreadsheets and re-enters their values so
+// dates and numbers are parsed under that locale. Either may be empty.
+func WithSheetLocale(svc *sheets.Service, locale, timeZone string) Option {
+	return func(u *Uploader) {
+		u.sheetsService = svc
+		u.locale = locale
+		u.timeZone = timeZone
+	}
+}
+
+// applySheetLocale sets the locale and time zone of an uploaded spreadsheet,
+// re-enters the CSV so every cell is parsed under them, and checks how the
+// numeric-looking cells came out. It returns the number of suspicious cells.
+func (u *Uploader) applySheetLocale(ctx context.Context, spreadsheetID string, content []byte) (int, error) {
+	props := &sheets.SpreadsheetProperties{Locale: u.locale, TimeZone: u.timeZone}
+	var fields []string
+	if u.locale != "" {
+		fields = append(fields, "locale")
+	}
+	if u.timeZone != "" {
+		fields = append(fields, "timeZone")
+	}
+
+	if err := u.limiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	_, err := u.sheetsService.Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			UpdateSpreadsheetProperties: &sheets.UpdateSpreadsheetPropertiesRequest{
+				Properties: props,
+				Fields:     strings.Join(fields, ","),
+			},
+		}},
+	}).Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("setting spreadsheet locale: %w", err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("parsing CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	values := make([][]any, len(records))
+	for i, row := range records {
+		values[i] = make([]any, len(row))
+		for j, cell := range row {
+			values[i][j] = cell
+		}
+	}
+
+	// USER_ENTERED makes Sheets parse each cell as if typed under the new locale
+	if err := u.limiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	_, err = u.sheetsService.Spreadsheets.Values.Update(spreadsheetID, "A1", &sheets.ValueRange{Values: values}).
+		ValueInputOption("USER_ENTERED").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return 0, fmt.Errorf("re-entering values: %w", err)
+	}
+
+	if err := u.limiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	got, err := u.sheetsService.Spreadsheets.Values.Get(spreadsheetID, "A1").
+		ValueRenderOption("UNFORMATTED_VALUE").
+		DateTimeRenderOption("FORMATTED_STRING").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return 0, fmt.Errorf("reading back values: %w", err)
+	}
+
+	var examples []string
+	mismatches := 0
+	for i, row := range records {
+		for j, cell := range row {
+			var parsed any
+			if i < len(got.Values) && j < len(got.Values[i]) {
+				parsed = got.Values[i][j]
+			}
+			if problem := checkParsedCell(cell, parsed); problem != "" {
+				mismatches++
+				if len(examples) < maxParseExamples {
+					examples = append(examples, fmt.Sprintf("R%dC%d %q %s", i+1, j+1, cell, problem))
+				}
+			}
+		}
+	}
+
+	if mismatches > 0 {
+		slog.Warn("spreadsheet values may have changed meaning",
+			slog.String("id", spreadsheetID),
+			slog.String("locale", u.locale),
+			slog.Int("cells", mismatches),
+			slog.Any("examples", examples))
+	}
+	return mismatches, nil
+}
+
+// checkParsedCell compares a CSV cell with what Sheets made of it. A cell
+// that looks like a number must come back as one carrying the same
+// significant digits; otherwise the locale read its separators differently.
+// Separators that are valid either way ("1,000") can't be told apart.
+func checkParsedCell(source string, parsed any) string {
+	if !looksNumeric(source) || digitsOf(source) == "" {
+		return ""
+	}
+
+	n, ok := parsed.(float64)
+	if !ok {
+		return "stayed text"
+	}
+
+	got := strconv.FormatFloat(n, 'f', -1, 64)
+	if significant(digitsOf(got)) != significant(digitsOf(source)) {
+		return "became " + got
+	}
+	return ""
+}
+
+// looksNumeric reports whether s is made only of digits, separators, signs,
+// percent and common currency symbols
+func looksNumeric(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case strings.ContainsRune(".,'  -+%()$€£¥", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// significant drops leading and trailing zeros, which scaling (percentages,
+// dropped decimals) adds or removes
+func significant(digits string) string {
+	return strings.Trim(digits, "0")
+}
+
+// digitsOf returns the decimal digits of s
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
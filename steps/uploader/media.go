@@ -0,0 +1,47 @@
+package uploader
+
+import (
+	"log/slog"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultChunkSize is the piece size files larger than it are uploaded in
+const DefaultChunkSize = googleapi.DefaultUploadChunkSize
+
+// minChunkRetryDeadline is how long a failing chunk is retried at least,
+// the Drive client's own default
+const minChunkRetryDeadline = 32 * time.Second
+
+// WithChunkSize sends files larger than size bytes through Drive's resumable
+// upload protocol in pieces of size, rounded up to a multiple of 256 KiB.
+// A piece that fails transiently is sent again on its own, so a dropped
+// connection late in a large upload doesn't restart it.
+func WithChunkSize(size int) Option {
+	return func(u *Uploader) {
+		u.chunkSize = size
+	}
+}
+
+// media returns the options a file's content is uploaded with: its MIME
+// type, the chunk size and how long each chunk is retried, which follows
+// the retry policy's total wait
+func (u *Uploader) media(mimeType string) []googleapi.MediaOption {
+	deadline := max(u.retryPolicy.MaxDelay*time.Duration(max(u.retryPolicy.MaxAttempts-1, 1)), minChunkRetryDeadline)
+	return []googleapi.MediaOption{
+		googleapi.ContentType(mimeType),
+		googleapi.ChunkSize(u.chunkSize),
+		googleapi.ChunkRetryDeadline(deadline),
+	}
+}
+
+// logUpload logs how far the resumable upload of a large file has come
+func logUpload(title string) googleapi.ProgressUpdater {
+	return func(current, total int64) {
+		slog.Debug("uploading",
+			slog.String("title", title),
+			slog.Int64("sent", current),
+			slog.Int64("total", total))
+	}
+}
@@ -0,0 +1,34 @@
+package uploader_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeFilesUploadInRetriedChunks(t *testing.T) {
+	const chunk = 256 << 10
+	content := strings.Repeat("a,b,c\n", chunk/2)
+
+	google := fakegoogle.New()
+	defer google.Close()
+	// the second piece fails once and must be sent again alone
+	google.FailChunk(2)
+
+	out := t.TempDir()
+	writeDoc(t, out, "budget-1AbC", types.Metadata{ID: "1AbC", Type: "sheet", Title: "Budget"}, content)
+	u := newUploader(t, google, out, uploader.WithChunkSize(chunk))
+	require.NoError(t, u.Run(context.Background()))
+
+	files := google.Files()
+	require.Len(t, files, 2)
+	assert.Equal(t, content, string(files[1].Content))
+	// three pieces, the retried one, and the empty one that ends the upload
+	assert.Equal(t, 5, google.Chunks())
+}
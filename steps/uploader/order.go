@@ -0,0 +1,57 @@
+package uploader
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLeavesFirst uploads documents after the documents they link to,
+// following the links the crawl recorded in metadata.json, so each doc's
+// targets mostly have copies by the time it is uploaded. Combined with
+// WithLinkRewrite, the patcher is left with the links of cycles only. Links
+// are read before the upload starts, so streamed uploads keep crawl order.
+func WithLeavesFirst() Option {
+	return func(u *Uploader) {
+		u.leavesFirst = true
+	}
+}
+
+// leavesFirstOrder orders dirs so every document comes after the documents
+// it links to, except around link cycles, which are broken where the walk
+// enters them. Otherwise dirs keep their order; directories whose metadata
+// can't be read stay where they are and are quarantined by the upload.
+func (u *Uploader) leavesFirstOrder(ctx context.Context, dirs []string) []string {
+	byKey := make(map[string]string, len(dirs))
+	links := make(map[string][]string, len(dirs))
+	for _, dir := range dirs {
+		metadata, err := u.loadMetadata(ctx, dir)
+		if err != nil {
+			continue
+		}
+		byKey[metadata.Type+":"+metadata.ID] = dir
+		links[dir] = metadata.LinksTo
+	}
+
+	ordered := make([]string, 0, len(dirs))
+	visited := make(map[string]bool, len(dirs))
+	var visit func(dir string)
+	visit = func(dir string) {
+		if visited[dir] {
+			// done, or on the walk's path: a cycle
+			return
+		}
+		visited[dir] = true
+		for _, key := range links[dir] {
+			if target, ok := byKey[key]; ok {
+				visit(target)
+			}
+		}
+		ordered = append(ordered, dir)
+	}
+	for _, dir := range dirs {
+		visit(dir)
+	}
+
+	slog.Debug("ordered directories leaves first", slog.Int("count", len(ordered)))
+	return ordered
+}
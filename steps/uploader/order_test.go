@@ -0,0 +1,45 @@
+package uploader_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeavesFirstUploadsLinkTargetsFirst(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+
+	// a links to b, b to c and back to a; crawl order is a, b, c
+	out := t.TempDir()
+	for _, d := range []struct{ id, links string }{
+		{"a", "b"},
+		{"b", "c a"},
+		{"c", ""},
+	} {
+		m := types.Metadata{ID: d.id, Type: "doc", Title: d.id}
+		page := "<html><body>"
+		for _, id := range strings.Fields(d.links) {
+			m.LinksTo = append(m.LinksTo, "doc:"+id)
+			page += `<a href="https://docs.google.com/document/d/` + id + `/edit">` + id + `</a>`
+		}
+		writeDoc(t, out, d.id, m, page+"</body></html>")
+	}
+
+	u := newUploader(t, google, out, uploader.WithLinkRewrite(), uploader.WithLeavesFirst())
+	require.NoError(t, u.Run(context.Background()))
+
+	var names []string
+	for _, f := range google.Files()[1:] {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, names)
+	// only b's link back to a, around the cycle, is left to patch
+	assert.Equal(t, 2, u.Stats().(uploader.UploadStats).LinksRewritten)
+}
@@ -0,0 +1,116 @@
+package uploader
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// WithCopyPermissions grants every new copy the permissions of its source
+// document, so shared documents keep their audiences. Source permissions
+// are only listed to editors; documents the credentials can't read them of
+// are uploaded with the folder's sharing alone.
+func WithCopyPermissions() Option {
+	return func(u *Uploader) {
+		u.copyPermissions = true
+	}
+}
+
+// copyRole is the role a source permission is granted with on the copy.
+// The copy already has an owner, and shared-drive organizer roles don't
+// exist on My Drive files, so those become editors.
+func copyRole(role string) string {
+	switch role {
+	case "owner", "organizer", "fileOrganizer":
+		return "writer"
+	}
+	return role
+}
+
+// copySourcePermissions grants the copy newID the permissions of source
+// document sourceID. Failures are logged and counted, never fatal: the copy
+// exists either way.
+func (u *Uploader) copySourcePermissions(ctx context.Context, sourceID, newID string) {
+	var perms []*drive.Permission
+	pageToken := ""
+	for {
+		if err := u.limiter.Wait(ctx); err != nil {
+			return
+		}
+		call := u.driveService.Permissions.List(sourceID).
+			Fields("nextPageToken", "permissions(type,role,emailAddress,domain,allowFileDiscovery,deleted)").
+			SupportsAllDrives(true).
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		r, err := call.Do()
+		if err != nil {
+			slog.Info("source permissions not readable, not copying them",
+				slog.String("source_id", sourceID),
+				slog.Any("error", err))
+			return
+		}
+		perms = append(perms, r.Permissions...)
+		if pageToken = r.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	account := u.accountEmail(ctx)
+	var grants []grant
+	for _, p := range perms {
+		if p.Deleted || p.EmailAddress != "" && strings.EqualFold(p.EmailAddress, account) {
+			// the uploading account owns the copy already
+			continue
+		}
+		grants = append(grants, grant{fileID: newID, perm: &drive.Permission{
+			Type:               p.Type,
+			Role:               copyRole(p.Role),
+			EmailAddress:       p.EmailAddress,
+			Domain:             p.Domain,
+			AllowFileDiscovery: p.AllowFileDiscovery,
+		}})
+	}
+
+	for i, err := range u.createPermissions(ctx, grants) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p := grants[i].perm
+			slog.Warn("failed to copy permission",
+				slog.String("source_id", sourceID),
+				slog.String("id", newID),
+				slog.String("type", p.Type),
+				slog.String("email", p.EmailAddress),
+				slog.String("domain", p.Domain),
+				slog.Any("error", err))
+			u.permissionsFailed++
+			continue
+		}
+		u.permissionsCopied++
+	}
+}
+
+// accountEmail returns the email of the account uploading, looked up once;
+// empty when Drive won't say
+func (u *Uploader) accountEmail(ctx context.Context) string {
+	if u.account != nil {
+		return *u.account
+	}
+	email := ""
+	if err := u.limiter.Wait(ctx); err != nil {
+		return ""
+	}
+	about, err := u.driveService.About.Get().Fields("user(emailAddress)").Context(ctx).Do()
+	if err != nil {
+		slog.Debug("account lookup failed", slog.Any("error", err))
+	} else if about.User != nil {
+		email = about.User.EmailAddress
+	}
+	u.account = &email
+	return email
+}
@@ -0,0 +1,45 @@
+package uploader_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestCopyPermissionsGrantsSourceAudience(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	google.SetAccount("me@example.com")
+	google.AddFile(fakegoogle.File{ID: "src", Permissions: []*drive.Permission{
+		{Type: "user", Role: "owner", EmailAddress: "Me@example.com"},
+		{Type: "user", Role: "writer", EmailAddress: "ana@example.com"},
+		{Type: "domain", Role: "reader", Domain: "example.com"},
+	}})
+
+	out := t.TempDir()
+	writeDoc(t, out, "src", types.Metadata{ID: "src", Type: "sheet", Title: "Source"}, "a,b\n")
+	u := newUploader(t, google, out, uploader.WithCopyPermissions())
+	require.NoError(t, u.Run(context.Background()))
+
+	// the uploading account already owns the copy; grants are sent
+	// concurrently, in no set order
+	byType := make(map[string]fakegoogle.Grant)
+	for _, g := range google.Grants() {
+		byType[g.Permission.Type] = g
+	}
+	require.Len(t, byType, 2)
+	assert.Equal(t, "ana@example.com", byType["user"].Permission.EmailAddress)
+	assert.Equal(t, "writer", byType["user"].Permission.Role)
+	assert.False(t, byType["user"].Notify)
+	assert.Equal(t, "example.com", byType["domain"].Permission.Domain)
+	assert.True(t, byType["domain"].Notify)
+	copied := google.Files()[len(google.Files())-1]
+	assert.Equal(t, copied.ID, byType["user"].FileID)
+	assert.Equal(t, 2, u.Stats().(uploader.UploadStats).PermissionsCopied)
+}
@@ -0,0 +1,32 @@
+package uploader
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// WithOnly uploads just the given directories, such as the ones a previous
+// run failed on, instead of every saved document. The copies id_map.json
+// already records for the others are kept in it.
+func WithOnly(dirs []string) Option {
+	return func(u *Uploader) {
+		u.only = dirs
+	}
+}
+
+// selected narrows the discovered directories down to the WithOnly ones
+// that still exist
+func (u *Uploader) selected(found []string) []string {
+	if u.only == nil {
+		return found
+	}
+	var dirs []string
+	for _, dir := range u.only {
+		if slices.Contains(found, dir) {
+			dirs = append(dirs, dir)
+		} else {
+			slog.Warn("directory to retry no longer exists", slog.String("dir", dir))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,73 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Share is a permission granted on the import folder
+type Share struct {
+	// Type is "anyone" (link sharing) or "domain"
+	Type string
+	// Domain is the domain the folder is visible to, for Type "domain"
+	Domain string
+	// Role is "reader" or "commenter"
+	Role string
+}
+
+// ParseShare parses "anyone:<role>" or "domain:<domain>:<role>"
+func ParseShare(spec string) (Share, error) {
+	parts := strings.Split(spec, ":")
+	var s Share
+	switch {
+	case len(parts) == 2 && parts[0] == "anyone":
+		s = Share{Type: "anyone", Role: parts[1]}
+	case len(parts) == 3 && parts[0] == "domain" && parts[1] != "":
+		s = Share{Type: "domain", Domain: parts[1], Role: parts[2]}
+	default:
+		return Share{}, fmt.Errorf("invalid share %q: want anyone:<role> or domain:<domain>:<role>", spec)
+	}
+
+	if s.Role != "reader" && s.Role != "commenter" {
+		return Share{}, fmt.Errorf("invalid share role %q: want reader or commenter", s.Role)
+	}
+	return s, nil
+}
+
+// WithSharing grants the given permissions on the top-level Drive folder
+func WithSharing(shares ...Share) Option {
+	return func(u *Uploader) {
+		u.shares = shares
+	}
+}
+
+// shareFolder grants the configured permissions on a folder. Granting a
+// permission the folder already has just leaves it in place.
+func (u *Uploader) shareFolder(ctx context.Context, folderID string) error {
+	grants := make([]grant, len(u.shares))
+	for i, s := range u.shares {
+		grants[i] = grant{fileID: folderID, notify: true, perm: &drive.Permission{
+			Type:   s.Type,
+			Domain: s.Domain,
+			Role:   s.Role,
+		}}
+	}
+
+	for i, err := range u.createPermissions(ctx, grants) {
+		s := u.shares[i]
+		if err != nil {
+			return fmt.Errorf("sharing folder with %s: %w", s.Type, err)
+		}
+
+		slog.Info("shared drive folder",
+			slog.String("id", folderID),
+			slog.String("type", s.Type),
+			slog.String("domain", s.Domain),
+			slog.String("role", s.Role))
+	}
+	return nil
+}
@@ -1,61 +1,264 @@
 package uploader
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"mime"
-	"os"
-	"path/filepath"
-	"strings"
-
+	"maps"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gapi"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/htmlclean"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/progress"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/retry"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/dryrun"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/repair"
 	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
 	"google.golang.org/api/drive/v3"
-	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
 )
 
 // UploadStats tracks upload statistics
 type UploadStats struct {
-	TotalUploaded int
-	Failed        int
-	Skipped       int
+	TotalUploaded int `json:"total_uploaded"`
+	Failed        int `json:"failed"`
+	Skipped       int `json:"skipped"`
+	// Existing counts documents whose existing copy was kept or replaced
+	Existing int `json:"existing"`
+	// ParseWarnings counts sheet cells whose value may have changed meaning
+	// under the configured locale
+	ParseWarnings int `json:"parse_warnings,omitempty"`
+	// Quarantined counts directories set aside in the repair list
+	Quarantined int `json:"quarantined,omitempty"`
+	// Sanitized counts scripts, trackers and external references removed
+	// from docs before upload
+	Sanitized int `json:"sanitized,omitempty"`
+	// PermissionsCopied counts source permissions granted on new copies,
+	// and PermissionsFailed those Drive refused
+	PermissionsCopied int `json:"permissions_copied,omitempty"`
+	PermissionsFailed int `json:"permissions_failed,omitempty"`
+	// LinksRewritten counts doc links pointed at copies before upload,
+	// which the patcher has no need to patch
+	LinksRewritten int `json:"links_rewritten,omitempty"`
 }
 
 // Uploader handles uploading crawled files to Google Drive
 type Uploader struct {
 	driveService *drive.Service
-	projectID    string
-	driveFolder  string
-	outDir       string
+	// Options the Drive client is created with
+	clientOpts []option.ClientOption
+	// Downloads images for WithImageAssets
+	httpClient *http.Client
+	// Used to set the locale of converted sheets; nil leaves them as imported
+	sheetsService *sheets.Service
+	projectID     string
+	driveFolder   string
+	outDir        string
+	// Where the crawl output is read from; a local outDir unless configured
+	store storage.Storage
+	// Per-run subfolder template inside driveFolder, and the run it names
+	subfolder string
+	runID     string
+	// driveFolder and subfolder expanded for the current run, as folder
+	// paths; resolved once they are
+	folderPath    []string
+	subfolderPath []string
+	resolved      bool
+	// What to do when a document already has a copy in the destination
+	duplicates string
+	// Locale and time zone of converted sheets
+	locale   string
+	timeZone string
+	// Permissions granted on the top-level folder
+	shares []Share
+	// Grant each new copy its source's permissions; account is the uploading
+	// account's email, once looked up
+	copyPermissions bool
+	account         *string
+	// Upload docs cleaned of the export's styling instead of as exported
+	cleanHTML bool
+	// Point doc links at the copies uploaded so far, the current run's
+	// idMap, before conversion
+	linkRewrite bool
+	idMap       map[string]string
+	// Upload documents after the documents they link to
+	leavesFirst bool
+	// Re-upload doc images to Drive; images maps image hashes to Drive IDs
+	imageAssets bool
+	images      map[string]string
+	imageFolder string
+	// Share re-uploaded images with anyone holding the link
+	publicImages bool
+	// Hashes of the images uploaded for the current doc, not shared yet
+	unshared []string
+	// Maintain a Doc listing every original URL and its copy
+	redirectIndex bool
+	// Folder the last run uploaded into
+	folderID string
 	// MIME type mappings for different file types
 	mimeTypes map[string]string
+
+	// Shared budget every Drive API call draws from
+	limiter ratelimit.Limiter
+	// Counts the directories found and uploaded; nil counts nothing
+	progress *progress.Counter
+	// Records the directories that couldn't be uploaded; nil records nothing
+	failures *failures.Recorder
+	// Directories to upload instead of every saved one; see WithOnly
+	only []string
+	// How uploads that fail transiently are retried
+	retryPolicy retry.Policy
+	// Size of the pieces large files are uploaded in
+	chunkSize int
+
+	// Statistics of the last run
+	stats UploadStats
+	// Suspicious sheet cells seen so far in the current run
+	parseWarnings int
+	// Items the sanitizer removed during the current run
+	sanitized int
+	// Links pointed at copies before upload in the current run
+	linksRewritten int
+	// Source permissions granted on copies, and those that failed, in the
+	// current run
+	permissionsCopied int
+	permissionsFailed int
+	// Collects what a dry run would create; nil uploads for real
+	dryRun *dryrun.Report
+	// Copies made by the previous run, from its id_map.json; documents an
+	// incremental crawl found unchanged keep theirs
+	previousIDs map[string]string
 }
 
-// NewUploader creates a new uploader with the given configuration
-func NewUploader(ctx context.Context, projectID string, driveFolder string, outDir string) (*Uploader, error) {
-	opts := []option.ClientOption{}
-	if projectID != "" {
-		opts = append(opts, option.WithQuotaProject(projectID))
+// Option configures optional Uploader behaviour
+type Option func(*Uploader)
+
+// WithClientOptions adds options to the Drive client the uploader creates,
+// such as the shared HTTP client
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(u *Uploader) {
+		u.clientOpts = append(u.clientOpts, opts...)
 	}
+}
 
-	drv, err := drive.NewService(ctx, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("creating Drive service: %w", err)
+// WithClients makes the uploader use the Drive service of a shared client
+// set rather than creating its own
+func WithClients(cl *gapi.Clients) Option {
+	return func(u *Uploader) {
+		u.driveService = cl.Drive
 	}
+}
 
-	return &Uploader{
-		driveService: drv,
-		projectID:    projectID,
-		driveFolder:  driveFolder,
-		outDir:       outDir,
+// WithHTTPTransport sends the image downloads of WithImageAssets through rt
+func WithHTTPTransport(rt http.RoundTripper) Option {
+	return func(u *Uploader) {
+		u.httpClient.Transport = rt
+	}
+}
+
+// WithLimiter makes the uploader draw every Drive API call from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(u *Uploader) {
+		u.limiter = l
+	}
+}
+
+// WithProgress reports the directories the uploader finds and uploads to c
+func WithProgress(c *progress.Counter) Option {
+	return func(u *Uploader) {
+		u.progress = c
+	}
+}
+
+// WithFailures records every directory the uploader gives up on to r
+func WithFailures(r *failures.Recorder) Option {
+	return func(u *Uploader) {
+		u.failures = r
+	}
+}
+
+// WithRetryPolicy sets how uploads and updates that fail transiently are
+// retried
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(u *Uploader) {
+		u.retryPolicy = p
+	}
+}
+
+// WithStorage reads the crawl output from the given store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(u *Uploader) {
+		u.store = s
+	}
+}
+
+// WithSubfolder puts each run's uploads in its own subfolder of the Drive
+// folder, named by a template such as "{date}-{runID}". See SubfolderName.
+func WithSubfolder(template, runID string) Option {
+	return func(u *Uploader) {
+		u.subfolder = template
+		u.runID = runID
+	}
+}
+
+// SubfolderName expands a subfolder template without the start document's
+// fields; see FolderName
+func SubfolderName(template, runID string, t time.Time) string {
+	return FolderName(template, runID, t, nil)
+}
+
+// WithCleanHTML cleans each doc's HTML export before it is converted:
+// inline CSS, generated classes and wrapper spans are stripped, links
+// through Google's redirector point at their target and empty headings are
+// dropped (see htmlclean.Clean). The crawled export stays as it was.
+func WithCleanHTML() Option {
+	return func(u *Uploader) {
+		u.cleanHTML = true
+	}
+}
+
+// NewUploader creates a new uploader with the given configuration
+func NewUploader(ctx context.Context, projectID string, driveFolder string, outDir string, opts ...Option) (*Uploader, error) {
+	u := &Uploader{
+		projectID:   projectID,
+		driveFolder: driveFolder,
+		outDir:      outDir,
+		store:       storage.NewLocal(outDir),
 
 		mimeTypes: map[string]string{
 			"doc":   "application/vnd.google-apps.document",
 			"sheet": "application/vnd.google-apps.spreadsheet",
 		},
-	}, nil
+		limiter:     ratelimit.Unlimited(),
+		retryPolicy: retry.Default(),
+		chunkSize:   DefaultChunkSize,
+		images:      make(map[string]string),
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	if u.driveService != nil {
+		return u, nil
+	}
+	if projectID != "" {
+		u.clientOpts = append(u.clientOpts, option.WithQuotaProject(projectID))
+	}
+	drv, err := drive.NewService(ctx, u.clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Drive service: %w", err)
+	}
+	u.driveService = drv
+	return u, nil
 }
 
 // Name implements the Step interface
@@ -63,207 +266,394 @@ func (u *Uploader) Name() string {
 	return "uploader"
 }
 
+// Stats returns the statistics of the last run
+func (u *Uploader) Stats() any {
+	return u.stats
+}
+
 // Run implements the Step interface and starts the upload process
 func (u *Uploader) Run(ctx context.Context) error {
-	parentID, err := u.createDriveFolder(ctx)
+	parentID, err := u.prepareFolder(ctx)
 	if err != nil {
-		return fmt.Errorf("creating Drive folder: %w", err)
+		return err
 	}
 
 	// Discover directories to process by scanning output directory
-	dirs, err := u.discoverDirectories()
+	found, err := u.discoverDirectories(ctx)
 	if err != nil {
 		return fmt.Errorf("discovering directories: %w", err)
 	}
+	found = u.selected(found)
+	if u.leavesFirst {
+		found = u.leavesFirstOrder(ctx, found)
+	}
+	slog.Info("starting upload",
+		slog.String("output_dir", u.store.String()),
+		slog.Int("directories_found", len(found)))
+
+	u.progress.Found(len(found))
+	dirs := make(chan string, len(found))
+	for _, dir := range found {
+		dirs <- dir
+	}
+	close(dirs)
+	return u.upload(ctx, parentID, dirs)
+}
 
+// Stream uploads directories as a concurrently running crawl saves them,
+// until dirs is closed (see crawler.RunStreaming). The ID map and redirects
+// are written once the crawl is over.
+func (u *Uploader) Stream(ctx context.Context, dirs <-chan string) error {
+	if usesRoot(u.driveFolder) || usesRoot(u.subfolder) {
+		// the folder is named after the start document, which the crawl
+		// saves first
+		dirs = afterFirst(ctx, dirs)
+	}
+	parentID, err := u.prepareFolder(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("starting streamed upload", slog.String("output_dir", u.store.String()))
+	return u.upload(ctx, parentID, counted(ctx, dirs, u.progress))
+}
+
+// prepareFolder creates and shares the destination folder (and the run's
+// subfolder), returning the ID to upload into
+func (u *Uploader) prepareFolder(ctx context.Context) (string, error) {
+	u.resolveFolders(ctx)
+	parentID, err := u.createDrivePath(ctx, u.folderPath, "")
+	if err != nil {
+		return "", fmt.Errorf("creating Drive folder: %w", err)
+	}
+
+	if len(u.shares) > 0 {
+		if parentID == "" {
+			slog.Warn("no Drive folder to share")
+		} else if u.dryRun != nil {
+			slog.Info("dry run: would share drive folder", slog.Int("permissions", len(u.shares)))
+		} else if err := u.shareFolder(ctx, parentID); err != nil {
+			return "", err
+		}
+	}
+
+	if len(u.subfolderPath) > 0 {
+		parentID, err = u.createDrivePath(ctx, u.subfolderPath, parentID)
+		if err != nil {
+			return "", fmt.Errorf("creating run subfolder: %w", err)
+		}
+	}
+
+	u.folderID = parentID
+	return parentID, nil
+}
+
+// upload processes every directory received from dirs into parentID
+func (u *Uploader) upload(ctx context.Context, parentID string, dirs <-chan string) error {
 	idMap := make(map[string]string)
 	stats := &UploadStats{}
+	var index []indexEntry
+	u.parseWarnings = 0
+	u.sanitized = 0
+	u.permissionsCopied = 0
+	u.permissionsFailed = 0
+	u.linksRewritten = 0
+
+	u.previousIDs = u.loadIDMap(ctx)
+	if u.only != nil {
+		// the rest of the documents keep their copies
+		maps.Copy(idMap, u.previousIDs)
+	}
+	u.idMap = idMap
 
-	slog.Info("starting upload",
-		slog.String("output_dir", u.outDir),
-		slog.Int("directories_found", len(dirs)))
-
-	for _, dir := range dirs {
-		metadata, err := u.loadMetadata(dir)
+	var quarantined []repair.Entry
+	redirects := make(map[string]*types.Metadata)
+	for dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		metadata, err := u.loadMetadata(ctx, dir)
 		if err != nil {
-			return fmt.Errorf("loading metadata from %s: %w", dir, err)
+			// a crash mid-crawl can leave unreadable metadata; set the
+			// directory aside instead of failing the whole upload
+			slog.Warn("quarantining unreadable directory",
+				slog.String("dir", dir),
+				slog.Any("error", err))
+			quarantined = append(quarantined, repair.NewEntry(u.Name(), dir, err))
+			u.progress.Failed()
+			continue
 		}
 
 		if metadata.IsRedirect {
+			redirects[dir] = metadata
 			stats.Skipped++
+			u.progress.Done()
 			continue
 		}
 
-		if err := u.processDirectory(ctx, dir, parentID, idMap, metadata); err != nil {
+		created, err := u.processDirectory(ctx, dir, parentID, idMap, metadata)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			slog.Warn("processing directory failed",
 				slog.String("dir", dir),
 				slog.Any("error", err))
 			stats.Failed++
+			u.progress.Failed()
+			u.failures.Add(dir, err)
 			continue
 		}
-		stats.TotalUploaded++
+		u.progress.Done()
+		if created {
+			stats.TotalUploaded++
+		} else {
+			stats.Existing++
+		}
+		index = append(index, newIndexEntry(metadata, idMap[metadata.Type+":"+metadata.ID]))
 	}
 
-	if err := u.writeIDMap(u.outDir, idMap); err != nil {
-		return fmt.Errorf("writing ID map: %w", err)
+	if u.dryRun != nil {
+		// the placeholders stay in the report for the patcher
+		if err := u.dryRun.Write(ctx, u.store); err != nil {
+			return fmt.Errorf("writing %s: %w", dryrun.File, err)
+		}
+	} else {
+		if err := u.writeIDMap(ctx, idMap); err != nil {
+			return fmt.Errorf("writing ID map: %w", err)
+		}
+		if err := u.resolveRedirects(ctx, redirects, idMap); err != nil {
+			return err
+		}
+	}
+	stats.Quarantined = len(quarantined)
+	if err := repair.Record(ctx, u.store, u.Name(), quarantined); err != nil {
+		return err
 	}
 
+	// an index of just the retried documents would replace the full one
+	if u.redirectIndex && len(index) > 0 && u.dryRun == nil && u.only == nil {
+		if err := u.writeRedirectIndex(ctx, parentID, index); err != nil {
+			return err
+		}
+	}
+
+	stats.ParseWarnings = u.parseWarnings
+	stats.Sanitized = u.sanitized
+	stats.PermissionsCopied = u.permissionsCopied
+	stats.LinksRewritten = u.linksRewritten
+	stats.PermissionsFailed = u.permissionsFailed
+	u.stats = *stats
 	slog.Info("upload completed",
 		slog.Int("uploaded", stats.TotalUploaded),
 		slog.Int("failed", stats.Failed),
-		slog.Int("skipped", stats.Skipped))
+		slog.Int("skipped", stats.Skipped),
+		slog.Int("existing", stats.Existing),
+		slog.Int("quarantined", stats.Quarantined))
 	return nil
 }
 
 // discoverDirectories recursively scans the output directory for subdirectories with metadata
-func (u *Uploader) discoverDirectories() ([]string, error) {
+func (u *Uploader) discoverDirectories(ctx context.Context) ([]string, error) {
 	var dirs []string
 
-	err := filepath.WalkDir(u.outDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip if not a directory
-		if !d.IsDir() {
-			return nil
-		}
-
-		// Check if this directory contains metadata.json
-		metadataPath := filepath.Join(path, "metadata.json")
-		if _, err := os.Stat(metadataPath); err == nil {
-			dirs = append(dirs, path)
-		}
-
-		return nil
-	})
-
+	names, err := u.store.List(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("walking output directory: %w", err)
 	}
 
+	// Every directory containing metadata.json holds a document
+	for _, name := range names {
+		if path.Base(name) == "metadata.json" {
+			dirs = append(dirs, storage.Dir(name))
+		}
+	}
+
 	slog.Info("discovered directories", slog.Int("count", len(dirs)))
 	return dirs, nil
 }
 
-// processDirectory handles uploading a single directory
-func (u *Uploader) processDirectory(ctx context.Context, dir string, parentID string, idMap map[string]string, metadata *types.Metadata) error {
-	contentFile := u.getContentFileName(metadata.Type)
+// processDirectory handles uploading a single directory, reporting whether
+// a new Drive file was created for it
+func (u *Uploader) processDirectory(ctx context.Context, dir string, parentID string, idMap map[string]string, metadata *types.Metadata) (bool, error) {
+	contentFile := metadata.ContentFileName()
 	if contentFile == "" {
-		return fmt.Errorf("unsupported content type: %s", metadata.Type)
+		return false, fmt.Errorf("unsupported content type: %s", metadata.Type)
+	}
+
+	key := fmt.Sprintf("%s:%s", metadata.Type, metadata.ID)
+	if copyID, ok := u.keepCopy(ctx, dir, key, metadata); ok {
+		idMap[key] = copyID
+		return false, nil
 	}
 
-	filePath := filepath.Join(dir, contentFile)
-	newID, err := u.uploadFile(filePath, metadata, parentID)
+	filePath := path.Join(dir, contentFile)
+	newID, created, err := u.uploadWithPolicy(ctx, dir, filePath, metadata, parentID)
 	if err != nil {
-		return fmt.Errorf("uploading file: %w", err)
+		return false, fmt.Errorf("uploading file: %w", err)
+	}
+	if metadata.Change == types.ChangeUnchanged {
+		u.clearChange(ctx, dir, metadata)
+	}
+	if created && u.copyPermissions && u.dryRun == nil {
+		u.copySourcePermissions(ctx, metadata.ID, newID)
 	}
 
-	key := fmt.Sprintf("%s:%s", metadata.Type, metadata.ID)
 	idMap[key] = newID
 
+	return created, nil
+}
+
+// resolveRedirects records in each redirect's metadata the Drive ID its
+// target was uploaded as, so the redirect stays resolvable after the output
+// tree is moved
+func (u *Uploader) resolveRedirects(ctx context.Context, redirects map[string]*types.Metadata, idMap map[string]string) error {
+	for dir, m := range redirects {
+		if m.RedirectKey == "" {
+			// crawled before redirects recorded their target
+			m.RedirectKey = m.Type + ":" + m.ID
+		}
+		driveID := idMap[m.RedirectKey]
+		if driveID == "" || driveID == m.RedirectDriveID {
+			continue
+		}
+		m.RedirectDriveID = driveID
+
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := u.store.WriteFile(ctx, path.Join(dir, "metadata.json"), data); err != nil {
+			return fmt.Errorf("updating redirect %s: %w", dir, err)
+		}
+	}
 	return nil
 }
 
 // loadMetadata loads metadata from a directory
-func (u *Uploader) loadMetadata(dir string) (*types.Metadata, error) {
-	metaPath := filepath.Join(dir, "metadata.json")
-	f, err := os.Open(metaPath)
+func (u *Uploader) loadMetadata(ctx context.Context, dir string) (*types.Metadata, error) {
+	data, err := u.store.ReadFile(ctx, path.Join(dir, "metadata.json"))
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
 	var metadata types.Metadata
-	if err := json.NewDecoder(f).Decode(&metadata); err != nil {
+	if err := json.Unmarshal(data, &metadata); err != nil {
 		return nil, err
 	}
 
 	return &metadata, nil
 }
 
-// getContentFileName returns the content file name for a given type
-func (u *Uploader) getContentFileName(fileType string) string {
-	contentFiles := map[string]string{
-		"doc":   "content.html",
-		"sheet": "content.csv",
+// createDriveFolder returns the ID of the named folder (inside parentID, if
+// set), creating it when it doesn't exist yet
+func (u *Uploader) createDriveFolder(ctx context.Context, name, parentID string) (string, error) {
+	if name == "" {
+		return parentID, nil // No folder
 	}
-	return contentFiles[fileType]
-}
-
-// createDriveFolder creates a new Drive folder and returns its ID
-func (u *Uploader) createDriveFolder(ctx context.Context) (string, error) {
-	if u.driveFolder == "" {
-		return "", nil // No parent folder
+	if dryrun.IsPlaceholder(parentID) {
+		// nothing can be inside a folder that wasn't created
+		return u.planFolder(name, parentID), nil
 	}
 
 	// Search for existing folder
 	q := fmt.Sprintf("mimeType='application/vnd.google-apps.folder' and name='%s' and trashed=false",
-		u.driveFolder)
+		quote(name))
+	if parentID != "" {
+		q += fmt.Sprintf(" and '%s' in parents", parentID)
+	}
 
-	r, err := u.driveService.Files.List().Q(q).Fields("files(id)").Do()
+	if err := u.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	r, err := u.driveService.Files.List().Q(q).Fields("files(id)").Context(ctx).Do()
 	if err != nil {
 		return "", fmt.Errorf("searching for folder: %w", err)
 	}
 
 	if len(r.Files) > 0 {
 		slog.Info("found existing drive folder",
-			slog.String("name", u.driveFolder),
+			slog.String("name", name),
 			slog.String("id", r.Files[0].Id))
 		return r.Files[0].Id, nil
 	}
 
+	if u.dryRun != nil {
+		return u.planFolder(name, parentID), nil
+	}
+
 	// Create new folder
 	f := &drive.File{
-		Name:     u.driveFolder,
+		Name:     name,
 		MimeType: "application/vnd.google-apps.folder",
 	}
+	if parentID != "" {
+		f.Parents = []string{parentID}
+	}
 
-	created, err := u.driveService.Files.Create(f).Fields("id").Do()
+	if err := u.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	created, err := u.driveService.Files.Create(f).Fields("id").Context(ctx).Do()
 	if err != nil {
 		return "", fmt.Errorf("creating folder: %w", err)
 	}
 
 	slog.Info("created drive folder",
-		slog.String("name", u.driveFolder),
+		slog.String("name", name),
 		slog.String("id", created.Id))
 	return created.Id, nil
 }
 
 // uploadFile uploads a single file to Google Drive
-func (u *Uploader) uploadFile(filePath string, metadata *types.Metadata, parentID string) (string, error) {
+func (u *Uploader) uploadFile(ctx context.Context, filePath string, metadata *types.Metadata, parentID string) (string, error) {
 	mimeType, ok := u.mimeTypes[metadata.Type]
 	if !ok {
 		return "", fmt.Errorf("unsupported file type: %s", metadata.Type)
 	}
 
 	// Prepare Drive file metadata
+	// Provenance travels in the create request itself rather than in
+	// follow-up metadata-only calls, so a large import costs one round trip
+	// per file
 	driveFile := &drive.File{
-		Name:     metadata.Title,
-		MimeType: mimeType,
+		Name:          metadata.Title,
+		MimeType:      mimeType,
+		Description:   "Imported from " + metadata.SourceURL,
+		AppProperties: sourceProperties(metadata),
 	}
 
 	if parentID != "" {
 		driveFile.Parents = []string{parentID}
 	}
+	if u.dryRun != nil {
+		return u.planUpload(ctx, filePath, metadata, parentID)
+	}
 
-	// Open the content file
-	media, err := os.Open(filePath)
+	// Read the content file
+	content, err := u.readContent(ctx, filePath, metadata)
 	if err != nil {
-		return "", fmt.Errorf("opening file: %w", err)
+		return "", err
 	}
-	defer media.Close()
 
 	// Determine media MIME type
-	mediaMimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filePath)))
+	mediaMimeType := mediaTypes[metadata.ExportFormat()]
 
 	// Upload the file
-	resp, err := u.driveService.Files.Create(driveFile).
-		Media(media, googleapi.ContentType(mediaMimeType)).
-		Fields("id").
-		SupportsAllDrives(true).
-		Do()
-
+	var resp *drive.File
+	err = u.retryPolicy.Do(ctx, "drive upload", func() error {
+		if err := u.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		var err error
+		resp, err = u.driveService.Files.Create(driveFile).
+			Media(bytes.NewReader(content), u.media(mediaMimeType)...).
+			ProgressUpdater(logUpload(metadata.Title)).
+			Fields("id").
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("Drive API upload: %w", err)
 	}
@@ -272,23 +662,205 @@ func (u *Uploader) uploadFile(filePath string, metadata *types.Metadata, parentI
 		slog.String("type", metadata.Type),
 		slog.String("id", resp.Id),
 		slog.String("title", metadata.Title))
+
+	u.localizeSheet(ctx, resp.Id, metadata, content)
 	return resp.Id, nil
 }
 
+// localizeSheet applies the configured locale to a sheet converted from CSV.
+// Failures are logged rather than failing the upload, since the file already
+// exists.
+func (u *Uploader) localizeSheet(ctx context.Context, fileID string, metadata *types.Metadata, content []byte) {
+	if metadata.Type != "sheet" || metadata.ExportFormat() != "csv" || u.sheetsService == nil || (u.locale == "" && u.timeZone == "") {
+		return
+	}
+
+	n, err := u.applySheetLocale(ctx, fileID, content)
+	if err != nil {
+		slog.Warn("applying sheet locale failed",
+			slog.String("id", fileID),
+			slog.Any("error", err))
+		return
+	}
+	u.parseWarnings += n
+}
+
+// readContent reads a document's export once its checksums check out. HTML
+// docs are cleaned (see WithCleanHTML), have their links rewritten (see
+// WithLinkRewrite) and are sanitized and, when configured to, have their
+// images re-hosted;
+// sheets saved with another delimiter become the comma-separated CSV Drive
+// imports.
+func (u *Uploader) readContent(ctx context.Context, filePath string, metadata *types.Metadata) ([]byte, error) {
+	if err := u.verifyChecksums(ctx, path.Dir(filePath), metadata); err != nil {
+		return nil, err
+	}
+
+	content, err := u.store.ReadFile(ctx, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+
+	html := metadata.Type == "doc" && metadata.ExportFormat() == "html"
+	if html && u.cleanHTML {
+		if content, err = htmlclean.Clean(content); err != nil {
+			return nil, fmt.Errorf("cleaning HTML: %w", err)
+		}
+	}
+	if html && u.linkRewrite && len(u.idMap) > 0 {
+		var n int
+		if content, n, err = rewriteLinks(content, u.idMap); err != nil {
+			return nil, fmt.Errorf("rewriting links: %w", err)
+		}
+		u.linksRewritten += n
+	}
+	if html {
+		var removed int
+		content, removed, err = htmlclean.Sanitize(content)
+		if err != nil {
+			return nil, fmt.Errorf("sanitizing HTML: %w", err)
+		}
+		if removed > 0 {
+			slog.Info("sanitized document",
+				slog.String("path", filePath),
+				slog.Int("removed", removed))
+			u.sanitized += removed
+		}
+	}
+
+	if u.imageAssets && html {
+		content, err = u.rewriteImages(ctx, path.Dir(filePath), content)
+		if err != nil {
+			return nil, fmt.Errorf("re-hosting images: %w", err)
+		}
+	}
+	if metadata.CSVDelimiter != "" {
+		content, err = commaSeparated(content, metadata.CSVDelimiter)
+		if err != nil {
+			return nil, fmt.Errorf("converting delimiter: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// mediaTypes are the content types of each export format, which no longer
+// follow from the file extension once content names are templated. Drive
+// converts each of them to a Google Doc or Sheet.
+var mediaTypes = map[string]string{
+	"html": "text/html; charset=utf-8",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"pdf":  "application/pdf",
+	"txt":  "text/plain; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+}
+
+// Keys of the appProperties recording where an uploaded copy came from
+const (
+	PropSourceID   = "gdoc_source_id"
+	PropSourceType = "gdoc_source_type"
+)
+
+// sourceProperties returns the appProperties identifying a copy's source
+func sourceProperties(metadata *types.Metadata) map[string]string {
+	return map[string]string{
+		PropSourceID:   metadata.ID,
+		PropSourceType: metadata.Type,
+	}
+}
+
+// UpdateFile replaces the content of an already uploaded Drive file with the
+// local export in dir. The file keeps its ID, so links pointing at it stay valid.
+func (u *Uploader) UpdateFile(ctx context.Context, dir string, fileID string) error {
+	metadata, err := u.loadMetadata(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("loading metadata: %w", err)
+	}
+
+	contentFile := metadata.ContentFileName()
+	if contentFile == "" {
+		return fmt.Errorf("unsupported content type: %s", metadata.Type)
+	}
+
+	if u.dryRun != nil {
+		slog.Info("dry run: would replace existing copy",
+			slog.String("title", metadata.Title),
+			slog.String("id", fileID))
+		return nil
+	}
+
+	filePath := path.Join(dir, contentFile)
+	content, err := u.readContent(ctx, filePath, metadata)
+	if err != nil {
+		return err
+	}
+
+	mediaMimeType := mediaTypes[metadata.ExportFormat()]
+
+	err = u.retryPolicy.Do(ctx, "drive update", func() error {
+		if err := u.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := u.driveService.Files.Update(fileID, &drive.File{}).
+			Media(bytes.NewReader(content), u.media(mediaMimeType)...).
+			ProgressUpdater(logUpload(metadata.Title)).
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Drive API update: %w", err)
+	}
+
+	slog.Info("updated file",
+		slog.String("type", metadata.Type),
+		slog.String("id", fileID),
+		slog.String("title", metadata.Title))
+
+	u.localizeSheet(ctx, fileID, metadata, content)
+	return nil
+}
+
+// Reupload uploads the document in dir as a new file, into the folder of
+// the last run or else the configured Drive folder, and returns its ID
+func (u *Uploader) Reupload(ctx context.Context, dir string) (string, error) {
+	metadata, err := u.loadMetadata(ctx, dir)
+	if err != nil {
+		return "", fmt.Errorf("loading metadata: %w", err)
+	}
+
+	contentFile := metadata.ContentFileName()
+	if contentFile == "" {
+		return "", fmt.Errorf("unsupported content type: %s", metadata.Type)
+	}
+
+	if u.folderID == "" {
+		u.folderID, err = u.createDrivePath(ctx, u.destFolder(ctx), "")
+		if err != nil {
+			return "", fmt.Errorf("creating Drive folder: %w", err)
+		}
+	}
+
+	return u.uploadFile(ctx, path.Join(dir, contentFile), metadata, u.folderID)
+}
+
 // writeIDMap writes the ID mapping to a JSON file
-func (u *Uploader) writeIDMap(outDir string, idMap map[string]string) error {
+func (u *Uploader) writeIDMap(ctx context.Context, idMap map[string]string) error {
 	if len(idMap) == 0 {
 		slog.Info("no files uploaded, skipping ID map creation")
 		return nil
 	}
 
-	mapPath := filepath.Join(outDir, "id_map.json")
+	mapPath := "id_map.json"
 	data, err := json.MarshalIndent(idMap, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshaling ID map: %w", err)
 	}
 
-	if err := os.WriteFile(mapPath, data, 0o644); err != nil {
+	if err := u.store.WriteFile(ctx, mapPath, data); err != nil {
 		return fmt.Errorf("writing ID map file: %w", err)
 	}
 
@@ -0,0 +1,34 @@
+package uploader_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/uploader"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDoc saves a crawled document the way the crawler does: metadata.json
+// and the content file in out/dir
+func writeDoc(t *testing.T, out, dir string, meta types.Metadata, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(out, dir), 0o755))
+	data, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(out, dir, "metadata.json"), data, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(out, dir, meta.ContentFileName()), []byte(content), 0o644))
+}
+
+// newUploader returns an uploader of out into "Imported Docs" on the fake
+func newUploader(t *testing.T, google *fakegoogle.Server, out string, opts ...uploader.Option) *uploader.Uploader {
+	t.Helper()
+	u, err := uploader.NewUploader(context.Background(), "", "Imported Docs", out,
+		append([]uploader.Option{uploader.WithClientOptions(google.ClientOptions()...)}, opts...)...)
+	require.NoError(t, err)
+	return u
+}
@@ -0,0 +1,247 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/failures"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/gdocs"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/ratelimit"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"google.golang.org/api/docs/v1"
+)
+
+// ReportFile lists the links still pointing at source documents
+const ReportFile = "patch_verification.json"
+
+// Leftover is a link in an uploaded doc that still points at the source copy
+// of a document that was uploaded too
+type Leftover struct {
+	URL string `json:"url"`
+	// Target is the id_map key ("doc:<id>") of the source document it points at
+	Target string `json:"target"`
+	Text   string `json:"text,omitempty"`
+	// TabID is the document tab holding the link
+	TabID     string `json:"tab_id,omitempty"`
+	SegmentID string `json:"segment_id,omitempty"`
+	// StartIndex and EndIndex locate the link text within its segment
+	StartIndex int64 `json:"start_index"`
+	EndIndex   int64 `json:"end_index"`
+}
+
+// DocLeftovers lists the leftovers of one uploaded doc
+type DocLeftovers struct {
+	Title     string     `json:"title"`
+	DocID     string     `json:"doc_id"`
+	Leftovers []Leftover `json:"leftovers"`
+}
+
+// VerifyStats summarises a verification run
+type VerifyStats struct {
+	DocsChecked int `json:"docs_checked"`
+	DocsOpen    int `json:"docs_open"`
+	Leftovers   int `json:"leftovers"`
+	Failures    int `json:"failures"`
+}
+
+// Verifier re-reads the uploaded docs after patching and checks that their
+// link graph is closed over the uploaded set: no link may still point at the
+// source of a document that has an uploaded copy
+type Verifier struct {
+	docsService *docs.Service
+
+	// Where id_map.json is read from and the report written to
+	store storage.Storage
+
+	// Shared budget every Docs API call draws from
+	limiter ratelimit.Limiter
+	// Records the docs that couldn't be verified; nil records nothing
+	failures *failures.Recorder
+
+	// Statistics of the last run
+	stats VerifyStats
+}
+
+// Option configures optional Verifier behaviour
+type Option func(*Verifier)
+
+// WithLimiter makes the verifier draw every Docs API call from the given budget
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(v *Verifier) {
+		v.limiter = l
+	}
+}
+
+// WithFailures records every doc the verifier can't read to r
+func WithFailures(r *failures.Recorder) Option {
+	return func(v *Verifier) {
+		v.failures = r
+	}
+}
+
+// WithStorage reads id_map.json from and writes the report to the given
+// store instead of outDir
+func WithStorage(s storage.Storage) Option {
+	return func(v *Verifier) {
+		v.store = s
+	}
+}
+
+// NewVerifier creates a verifier over the output in outDir
+func NewVerifier(docsSvc *docs.Service, outDir string, opts ...Option) *Verifier {
+	v := &Verifier{
+		docsService: docsSvc,
+		store:       storage.NewLocal(outDir),
+		limiter:     ratelimit.Unlimited(),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Name implements the Step interface
+func (v *Verifier) Name() string {
+	return "verifier"
+}
+
+// Stats returns the statistics of the last run
+func (v *Verifier) Stats() any {
+	return v.stats
+}
+
+// Run implements the Step interface. It fails when any uploaded doc still
+// links to a source document, after writing the full list to ReportFile.
+func (v *Verifier) Run(ctx context.Context) error {
+	data, err := v.store.ReadFile(ctx, "id_map.json")
+	if err != nil {
+		slog.Info("no id_map.json found, skipping verification", slog.Any("error", err))
+		return nil
+	}
+
+	var idMap map[string]string
+	if err := json.Unmarshal(data, &idMap); err != nil {
+		return fmt.Errorf("decoding id_map.json: %w", err)
+	}
+
+	keys := slices.Sorted(maps.Keys(idMap))
+
+	stats := &VerifyStats{}
+	report := []DocLeftovers{}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "doc:") {
+			continue // only docs carry patched links
+		}
+
+		docID := idMap[key]
+		leftovers, err := v.verifyDoc(ctx, docID, idMap)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("verifying document failed",
+				slog.String("doc_id", docID),
+				slog.Any("error", err))
+			stats.Failures++
+			v.failures.Add(docID, err)
+			continue
+		}
+
+		stats.DocsChecked++
+		if len(leftovers.Leftovers) > 0 {
+			stats.DocsOpen++
+			stats.Leftovers += len(leftovers.Leftovers)
+			report = append(report, leftovers)
+		}
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling verification report: %w", err)
+	}
+	if err := v.store.WriteFile(ctx, ReportFile, out); err != nil {
+		return fmt.Errorf("writing %s: %w", ReportFile, err)
+	}
+
+	v.stats = *stats
+	slog.Info("verification completed",
+		slog.Int("docs_checked", stats.DocsChecked),
+		slog.Int("docs_open", stats.DocsOpen),
+		slog.Int("leftovers", stats.Leftovers),
+		slog.Int("failures", stats.Failures))
+
+	if stats.Leftovers > 0 {
+		return fmt.Errorf("%d links in %d docs still point at source documents (see %s): %s",
+			stats.Leftovers, stats.DocsOpen, ReportFile, summarize(report))
+	}
+	return nil
+}
+
+// verifyDoc fetches an uploaded doc with every one of its tabs and returns
+// its links to source documents
+func (v *Verifier) verifyDoc(ctx context.Context, docID string, idMap map[string]string) (DocLeftovers, error) {
+	if err := v.limiter.Wait(ctx); err != nil {
+		return DocLeftovers{}, err
+	}
+	doc, err := v.docsService.Documents.Get(docID).IncludeTabsContent(true).Context(ctx).Do()
+	if err != nil {
+		return DocLeftovers{}, fmt.Errorf("fetching document: %w", err)
+	}
+
+	result := DocLeftovers{Title: doc.Title, DocID: docID}
+	for _, tab := range gdocs.Tabs(doc) {
+		for _, l := range gdocs.Links(tab.Doc) {
+			target := sourceTarget(l.URL, idMap)
+			if target == "" {
+				continue
+			}
+			result.Leftovers = append(result.Leftovers, Leftover{
+				URL:        l.URL,
+				Target:     target,
+				Text:       l.Text,
+				TabID:      tab.ID,
+				SegmentID:  l.SegmentID,
+				StartIndex: l.StartIndex,
+				EndIndex:   l.EndIndex,
+			})
+		}
+	}
+	return result, nil
+}
+
+// sourceTarget returns the id_map key of the uploaded source document a
+// link points at, through Google's redirector and in any of the link forms
+// the crawler follows, or "" if it points at none
+func sourceTarget(link string, idMap map[string]string) string {
+	t, ok := gdocs.ParseTarget(link)
+	if !ok {
+		return ""
+	}
+	for _, key := range t.Keys() {
+		if _, ok := idMap[key]; ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// summarize lists the first few leftovers for the error message
+func summarize(report []DocLeftovers) string {
+	const maxListed = 5
+	var parts []string
+	for _, d := range report {
+		for _, l := range d.Leftovers {
+			if len(parts) == maxListed {
+				return strings.Join(parts, "; ") + "; …"
+			}
+			parts = append(parts, fmt.Sprintf("%q → %s", d.Title, l.Target))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,128 @@
+package verifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/option"
+)
+
+// linkedDoc renders a Docs API document whose paragraph links to each URL
+func linkedDoc(title string, urls ...string) string {
+	var elements []string
+	for i, u := range urls {
+		elements = append(elements, fmt.Sprintf(`{"startIndex":%d,"endIndex":%d,"textRun":{"content":"t","textStyle":{"link":{"url":%q}}}}`, i+1, i+2, u))
+	}
+	return `{"title":"` + title + `","body":{"content":[{"paragraph":{"elements":[` + strings.Join(elements, ",") + `]}}]}}`
+}
+
+// newVerifier returns a verifier over out whose Docs API serves docs by ID;
+// other IDs are not found
+func newVerifier(t *testing.T, out string, served map[string]string) *verifier.Verifier {
+	t.Helper()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body, ok := served[path.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(api.Close)
+	svc, err := docs.NewService(context.Background(), option.WithEndpoint(api.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	return verifier.NewVerifier(svc, out)
+}
+
+func writeIDMap(t *testing.T, out string, idMap map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(idMap)
+	require.NoError(t, err)
+	require.NoError(t, storage.NewLocal(out).WriteFile(context.Background(), "id_map.json", data))
+}
+
+func TestVerifyPassesWhenEveryLinkPointsAtACopy(t *testing.T) {
+	out := t.TempDir()
+	writeIDMap(t, out, map[string]string{"doc:a": "new-a", "doc:b": "new-b", "sheet:s": "new-s"})
+	v := newVerifier(t, out, map[string]string{
+		"new-a": linkedDoc("A",
+			"https://docs.google.com/document/d/new-b/edit",
+			"https://docs.google.com/spreadsheets/d/new-s/edit",
+			// never crawled, so not the verifier's concern
+			"https://docs.google.com/document/d/elsewhere/edit",
+			"https://example.com/"),
+		"new-b": linkedDoc("B", "https://docs.google.com/document/d/new-a/edit"),
+	})
+
+	require.NoError(t, v.Run(context.Background()))
+	stats := v.Stats().(verifier.VerifyStats)
+	assert.Equal(t, 2, stats.DocsChecked)
+	assert.Zero(t, stats.Leftovers)
+
+	data, err := storage.NewLocal(out).ReadFile(context.Background(), verifier.ReportFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+}
+
+func TestVerifyReportsStaleLinks(t *testing.T) {
+	out := t.TempDir()
+	// "ab" is a prefix of "abc", which must not count as a link to it
+	writeIDMap(t, out, map[string]string{"doc:a": "new-a", "doc:ab": "new-ab", "sheet:s": "new-s"})
+	v := newVerifier(t, out, map[string]string{
+		"new-a": linkedDoc("A",
+			"https://www.google.com/url?q=https://docs.google.com/document/d/ab/edit&sa=D",
+			"https://drive.google.com/open?id=s",
+			"https://docs.google.com/document/d/abc/edit"),
+		"new-ab": linkedDoc("AB"),
+	})
+
+	err := v.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), verifier.ReportFile)
+	stats := v.Stats().(verifier.VerifyStats)
+	assert.Equal(t, 1, stats.DocsOpen)
+	assert.Equal(t, 2, stats.Leftovers)
+
+	data, err := storage.NewLocal(out).ReadFile(context.Background(), verifier.ReportFile)
+	require.NoError(t, err)
+	var report []verifier.DocLeftovers
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Len(t, report, 1)
+	assert.Equal(t, "new-a", report[0].DocID)
+	require.Len(t, report[0].Leftovers, 2)
+	assert.Equal(t, "doc:ab", report[0].Leftovers[0].Target)
+	assert.Equal(t, "sheet:s", report[0].Leftovers[1].Target)
+}
+
+func TestVerifyCountsMissingCopiesAsFailures(t *testing.T) {
+	out := t.TempDir()
+	writeIDMap(t, out, map[string]string{"doc:a": "new-a", "doc:gone": "deleted"})
+	v := newVerifier(t, out, map[string]string{
+		"new-a": linkedDoc("A", "https://docs.google.com/document/d/deleted/edit"),
+	})
+
+	require.NoError(t, v.Run(context.Background()))
+	stats := v.Stats().(verifier.VerifyStats)
+	assert.Equal(t, 1, stats.DocsChecked)
+	assert.Equal(t, 1, stats.Failures)
+	assert.Zero(t, stats.Leftovers)
+}
+
+func TestVerifySkipsRunsWithoutIDMap(t *testing.T) {
+	v := newVerifier(t, t.TempDir(), nil)
+	require.NoError(t, v.Run(context.Background()))
+	assert.Zero(t, v.Stats().(verifier.VerifyStats).DocsChecked)
+}
@@ -0,0 +1,309 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"google.golang.org/api/drive/v3"
+)
+
+// Refresher re-exports a crawled document into its existing directory
+type Refresher interface {
+	Refresh(ctx context.Context, dir string) error
+}
+
+// Updater replaces the content of an uploaded Drive copy in place
+type Updater interface {
+	UpdateFile(ctx context.Context, dir string, fileID string) error
+}
+
+// DocPatcher rewrites the links of a single uploaded document
+type DocPatcher interface {
+	PatchDir(ctx context.Context, dir string, idMap map[string]string) error
+}
+
+// syncState is persisted between polls so a restarted watcher only sees
+// changes it hasn't handled yet
+type syncState struct {
+	PageToken string    `json:"page_token"`
+	LastSync  time.Time `json:"last_sync"`
+	// Source IDs of changed documents that failed to sync; the feed won't
+	// report them again, so they are retried on every poll until they sync
+	Pending []string `json:"pending,omitempty"`
+}
+
+// SyncStats tracks what a single poll did
+type SyncStats struct {
+	Changed int
+	Synced  int
+	Failed  int
+}
+
+// Watcher polls the Drive changes feed and re-syncs crawled documents that
+// changed since the last poll
+type Watcher struct {
+	driveService *drive.Service
+	interval     time.Duration
+	store        storage.Storage
+
+	refresher Refresher
+	updater   Updater
+	patcher   DocPatcher
+}
+
+// NewWatcher creates a new watcher over the crawl output in store
+func NewWatcher(driveService *drive.Service, interval time.Duration, store storage.Storage, refresher Refresher, updater Updater, patcher DocPatcher) *Watcher {
+	return &Watcher{
+		driveService: driveService,
+		interval:     interval,
+		store:        store,
+		refresher:    refresher,
+		updater:      updater,
+		patcher:      patcher,
+	}
+}
+
+// Run polls for changes every interval until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	slog.Info("watching for source changes",
+		slog.String("output_dir", w.store.String()),
+		slog.Duration("interval", w.interval))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Warn("sync poll failed", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("watcher stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches all changes since the stored page token and syncs every
+// crawled document among them
+func (w *Watcher) poll(ctx context.Context) error {
+	state, err := w.loadState(ctx)
+	if err != nil {
+		return fmt.Errorf("loading sync state: %w", err)
+	}
+
+	// First poll: start from "now", there is nothing to catch up on
+	if state.PageToken == "" {
+		start, err := w.driveService.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("getting start page token: %w", err)
+		}
+		state.PageToken = start.StartPageToken
+		state.LastSync = time.Now().UTC()
+		return w.saveState(ctx, state)
+	}
+
+	changed, nextToken, err := w.listChanges(ctx, state.PageToken)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range state.Pending {
+		changed[id] = true
+	}
+
+	stats := &SyncStats{}
+	var failed []string
+	if len(changed) > 0 {
+		failed, err = w.syncDocuments(ctx, changed, stats)
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("sync poll completed",
+		slog.Int("changed", stats.Changed),
+		slog.Int("synced", stats.Synced),
+		slog.Int("failed", stats.Failed))
+
+	state.PageToken = nextToken
+	state.Pending = failed
+	state.LastSync = time.Now().UTC()
+	return w.saveState(ctx, state)
+}
+
+// listChanges pages through the changes feed and returns the IDs of the
+// files that changed together with the token for the next poll
+func (w *Watcher) listChanges(ctx context.Context, pageToken string) (map[string]bool, string, error) {
+	changed := make(map[string]bool)
+
+	for {
+		resp, err := w.driveService.Changes.List(pageToken).
+			Fields("nextPageToken,newStartPageToken,changes(fileId,removed)").
+			IncludeItemsFromAllDrives(true).
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return nil, "", fmt.Errorf("listing changes: %w", err)
+		}
+
+		for _, ch := range resp.Changes {
+			if !ch.Removed {
+				changed[ch.FileId] = true
+			}
+		}
+
+		if resp.NewStartPageToken != "" {
+			return changed, resp.NewStartPageToken, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// syncDocuments re-exports, re-uploads and re-patches every crawled document
+// whose source ID is in changed, and returns the source IDs that failed
+func (w *Watcher) syncDocuments(ctx context.Context, changed map[string]bool, stats *SyncStats) ([]string, error) {
+	idMap, err := w.loadIDMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading ID map: %w", err)
+	}
+
+	dirs, err := w.crawledDirs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("discovering crawled documents: %w", err)
+	}
+
+	var failed []string
+	var patchDirs, patchIDs []string
+	for _, dir := range dirs {
+		metadata, err := w.loadMetadata(ctx, dir)
+		if err != nil || metadata.IsRedirect || !changed[metadata.ID] {
+			continue
+		}
+		stats.Changed++
+
+		newID := idMap[metadata.Type+":"+metadata.ID]
+		if newID == "" {
+			slog.Warn("changed document was never uploaded", slog.String("dir", dir))
+			stats.Failed++
+			failed = append(failed, metadata.ID)
+			continue
+		}
+
+		if err := w.refresher.Refresh(ctx, dir); err != nil {
+			slog.Warn("re-export failed", slog.String("dir", dir), slog.Any("error", err))
+			stats.Failed++
+			failed = append(failed, metadata.ID)
+			continue
+		}
+		if err := w.updater.UpdateFile(ctx, dir, newID); err != nil {
+			slog.Warn("re-upload failed", slog.String("dir", dir), slog.Any("error", err))
+			stats.Failed++
+			failed = append(failed, metadata.ID)
+			continue
+		}
+		patchDirs = append(patchDirs, dir)
+		patchIDs = append(patchIDs, metadata.ID)
+	}
+
+	// Re-uploading replaces the patched links with the original ones, so every
+	// synced document has to go through the patcher again
+	for i, dir := range patchDirs {
+		if err := w.patcher.PatchDir(ctx, dir, idMap); err != nil {
+			slog.Warn("re-patch failed", slog.String("dir", dir), slog.Any("error", err))
+			stats.Failed++
+			failed = append(failed, patchIDs[i])
+			continue
+		}
+		stats.Synced++
+	}
+
+	slices.Sort(failed)
+	return slices.Compact(failed), nil
+}
+
+// crawledDirs returns every directory in the output tree holding metadata
+func (w *Watcher) crawledDirs(ctx context.Context) ([]string, error) {
+	names, err := w.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, name := range names {
+		if path.Base(name) == "metadata.json" {
+			dirs = append(dirs, storage.Dir(name))
+		}
+	}
+	return dirs, nil
+}
+
+// loadMetadata loads metadata from a directory
+func (w *Watcher) loadMetadata(ctx context.Context, dir string) (*types.Metadata, error) {
+	data, err := w.store.ReadFile(ctx, path.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata types.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// loadIDMap loads the ID mapping written by the uploader
+func (w *Watcher) loadIDMap(ctx context.Context) (map[string]string, error) {
+	data, err := w.store.ReadFile(ctx, "id_map.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var idMap map[string]string
+	if err := json.Unmarshal(data, &idMap); err != nil {
+		return nil, err
+	}
+	return idMap, nil
+}
+
+// loadState reads sync_state.json, returning an empty state on the first run
+func (w *Watcher) loadState(ctx context.Context) (*syncState, error) {
+	data, err := w.store.ReadFile(ctx, "sync_state.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return &syncState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state syncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveState persists the page token for the next poll
+func (w *Watcher) saveState(ctx context.Context, state *syncState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling sync state: %w", err)
+	}
+	return w.store.WriteFile(ctx, "sync_state.json", data)
+}
@@ -0,0 +1,136 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rasha-hantash/gdoc-pipeline/lib/fakegoogle"
+	"github.com/rasha-hantash/gdoc-pipeline/lib/storage"
+	"github.com/rasha-hantash/gdoc-pipeline/steps/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+// recorder stands in for the crawler, uploader and patcher, recording what
+// the watcher asked of each
+type recorder struct {
+	refreshed []string
+	updated   map[string]string
+	patched   []string
+	// dirs whose re-export fails
+	failing map[string]bool
+}
+
+func (r *recorder) Refresh(_ context.Context, dir string) error {
+	r.refreshed = append(r.refreshed, dir)
+	if r.failing[dir] {
+		return errors.New("export failed")
+	}
+	return nil
+}
+
+func (r *recorder) UpdateFile(_ context.Context, dir, fileID string) error {
+	r.updated[dir] = fileID
+	return nil
+}
+
+func (r *recorder) PatchDir(_ context.Context, dir string, _ map[string]string) error {
+	r.patched = append(r.patched, dir)
+	return nil
+}
+
+// newTestWatcher returns a watcher over a crawl of docs a and b, and of c,
+// which was never uploaded
+func newTestWatcher(t *testing.T, google *fakegoogle.Server) (*Watcher, *recorder, storage.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	for _, id := range []string{"a", "b", "c"} {
+		m, err := json.Marshal(types.Metadata{ID: id, Type: "doc", Title: id})
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFile(ctx, "root/"+id+"/metadata.json", m))
+	}
+	idMap, err := json.Marshal(map[string]string{"doc:a": "new-a", "doc:b": "new-b"})
+	require.NoError(t, err)
+	require.NoError(t, store.WriteFile(ctx, "id_map.json", idMap))
+
+	svc, err := drive.NewService(ctx, google.ClientOptions()...)
+	require.NoError(t, err)
+	r := &recorder{updated: make(map[string]string)}
+	return NewWatcher(svc, time.Minute, store, r, r, r), r, store
+}
+
+func TestFirstPollOnlyStoresStartToken(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	w, r, store := newTestWatcher(t, google)
+	ctx := context.Background()
+
+	// edits from before the watch started are not synced
+	google.Change("a", "b")
+	require.NoError(t, w.poll(ctx))
+
+	assert.Empty(t, r.refreshed)
+	assert.Empty(t, r.patched)
+	state, err := w.loadState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", state.PageToken)
+	assert.False(t, state.LastSync.IsZero())
+	_, err = store.ReadFile(ctx, "sync_state.json")
+	assert.NoError(t, err)
+}
+
+func TestLaterPollsSyncChangedDocuments(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	w, r, _ := newTestWatcher(t, google)
+	ctx := context.Background()
+	require.NoError(t, w.poll(ctx))
+
+	// five changes span three pages of the feed; c has no copy to update
+	// and x was never crawled
+	google.Change("a", "x", "c", "a", "b")
+	require.NoError(t, w.poll(ctx))
+
+	assert.Equal(t, []string{"root/a", "root/b"}, r.refreshed)
+	assert.Equal(t, map[string]string{"root/a": "new-a", "root/b": "new-b"}, r.updated)
+	assert.Equal(t, []string{"root/a", "root/b"}, r.patched)
+	state, err := w.loadState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "5", state.PageToken)
+
+	// nothing changed since
+	require.NoError(t, w.poll(ctx))
+	assert.Len(t, r.refreshed, 2)
+}
+
+func TestFailedSyncsAreRetriedOnLaterPolls(t *testing.T) {
+	google := fakegoogle.New()
+	defer google.Close()
+	w, r, _ := newTestWatcher(t, google)
+	ctx := context.Background()
+	require.NoError(t, w.poll(ctx))
+
+	r.failing = map[string]bool{"root/a": true}
+	google.Change("a", "b", "c")
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, []string{"root/b"}, r.patched)
+	state, err := w.loadState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, state.Pending)
+
+	// the feed has nothing new, but a is synced once its export works
+	r.failing = nil
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, []string{"root/b", "root/a"}, r.patched)
+	state, err = w.loadState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, state.Pending, "c still has no copy to update")
+
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, []string{"root/b", "root/a"}, r.patched)
+}